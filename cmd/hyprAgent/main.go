@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/reinhart/hyprAgent/internal/assistant"
 	"github.com/reinhart/hyprAgent/internal/configuration"
 	"github.com/reinhart/hyprAgent/internal/logger"
+	"github.com/reinhart/hyprAgent/internal/mcp"
 	"github.com/reinhart/hyprAgent/internal/safety"
 	"github.com/reinhart/hyprAgent/internal/ui"
 )
@@ -29,6 +38,14 @@ func buildSystemPrompt(cfg *configuration.Config, backendType configuration.Conf
 
 	allowedDirsStr := strings.Join(sec.AllowedDirs, ", ")
 	allowedFilesStr := strings.Join(sec.AllowedFiles, ", ")
+	readOnlyFilesStr := "none"
+	if len(sec.ReadOnlyFiles) > 0 {
+		readOnlyFilesStr = strings.Join(sec.ReadOnlyFiles, ", ")
+	}
+	configRoot, err := configuration.HyprConfigRoot()
+	if err != nil {
+		configRoot = "~/.config/hypr"
+	}
 
 	return fmt.Sprintf(`You are HyprAgent, an expert assistant for configuring the Hyprland window manager.
 Your goal is to help the user modify their Hyprland configuration safely and correctly.
@@ -37,16 +54,18 @@ ENVIRONMENT:
 - Installation Type: %s
 - Allowed Directories: %s
 - Allowed Files: %s
+- Read-Only Files: %s
 
 SECURITY CONSTRAINTS:
 - You can ONLY read/write files within the allowed directories and files listed above.
+- Read-only files may be read to understand the setup but are never written; put changes in another file instead.
 - Any attempt to access files outside these paths will be rejected.
-- The configuration root is ~/.config/hypr/
+- The configuration root is %s/
 
 GUIDELINES:
-1. DETECTION: Start by using 'detect_installation_root' to understand the environment (Native, HyDE, Omarchy).
-2. EXPLORATION: Use 'list_dir' and 'read_file' to locate relevant config files within allowed paths.
-3. ANALYSIS: Read the config files to understand the current state.
+1. DETECTION: Start with 'gather_context', which detects the environment (Native, HyDE, Omarchy), lists the config root and returns the main config in a single call. 'detect_installation_root' is available for detection alone.
+2. EXPLORATION: Use 'inspect_config_layout' to find which file holds each kind of setting, and 'list_dir' and 'read_file' to locate other config files within allowed paths. To find where a keybind, rule or variable is defined, call 'search_config' once instead of reading files one by one.
+3. ANALYSIS: Read the config files to understand the current state. Use 'resolve_variables' to see what lines using $variables (like $mainMod) expand to, and 'explain_line' when the user asks what a line does. When a request names a monitor, workspace or window, call 'query_hyprland' to see what the running session actually has.
 4. PLANNING: Formulate a plan.
 5. DOCUMENTATION:
    - If you are unsure about a configuration option, variable name, or syntax, use 'fetch_url' to check the official Hyprland Wiki or other online documentation.
@@ -55,45 +74,92 @@ GUIDELINES:
    - If a file read fails because of size or binary content, ask the user for specific sections or use 'grep' (if available) or just skip it.
 6. PATCHING PROTOCOL (IMPORTANT):
    - FIRST, use 'make_patch' to generate the diff.
+   - If the file may have changed since the patch was made, use 'preview_patch' to check that every hunk still applies.
    - STOP and show this diff to the user in your response.
    - ASK the user for confirmation (e.g., "Shall I apply this change?").
    - WAIT for the user to reply "Yes" or "Apply".
    - ONLY THEN use 'apply_patch' to execute the change.
    - DO NOT call 'apply_patch' in the same turn as 'make_patch'.
+   - 'apply_patch' also asks the user for a final y/n. If it reports that the user declined, do not retry; ask what they would like changed.
+   - To create a new file (e.g. splitting keybinds into keybindings.conf), show its content, get confirmation, then use 'write_file' and add the matching source= line with a patch.
+   - To rename a file, get confirmation, use 'move_file', then patch every source= line that named the old path.
 6. SAFETY:
-   - The system automatically snapshots files before 'apply_patch'.
-   - Verify that your generated config is valid Hyprland syntax.
+   - The system automatically snapshots files before 'apply_patch'. Pass a short 'description' of the change so the snapshot can be found later.
+   - Verify that your generated config is valid Hyprland syntax with 'validate_hyprland_syntax' before creating a patch.
+   - After adding or changing a keybind, run 'detect_bind_conflicts' and tell the user about any combination bound twice.
+   - For border colors and gradients use 'set_border_colors' instead of writing the value by hand; it composes the exact syntax.
+   - Before suggesting a reload (or right after applying a change), run 'check_risks' and warn the user about any findings.
+   - Use 'reload' only after the user agrees; if it or 'apply_patch' reports config errors, show them and offer a rollback.
 7. ROLLBACK:
    - If the user says "undo", "revert", or "it broke", use the 'rollback' tool.
-`, backendType, allowedDirsStr, allowedFilesStr)
+   - Every applied change reports the snapshot taken before it. To undo a specific change, pass that snapshot_id to 'rollback'; without one the latest snapshot is restored.
+   - To undo only the latest change and leave other files alone, use 'undo_last_patch'.
+   - Use 'list_snapshots' to find an older rollback point, e.g. "the one before I changed animations".
+   - If the config directory is a git repository, offer 'git_commit' after an accepted change, with a message describing it.
+`, backendType, allowedDirsStr, allowedFilesStr, readOnlyFilesStr, configRoot) + companionPrompt(cfg.Security.Companions)
 }
 
-func main() {
-	// Load Configuration
-	cfg, err := configuration.LoadConfig()
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+// companionPrompt describes the opted-in companion app directories, if any
+func companionPrompt(sec configuration.CompanionSecurity) string {
+	if !sec.Enabled || len(sec.AllowedDirs) == 0 {
+		return ""
 	}
+	return fmt.Sprintf(`
+COMPANION APPS:
+- The user has allowed access to these companion app config directories (relative to ~/.config): %s
+- Use 'read_companion_file' and 'write_companion_file' for them, never the Hyprland file tools. Writes are snapshotted and confirmed by the user.
+`, strings.Join(sec.AllowedDirs, ", "))
+}
 
-	// Initialize Logger
-	logger.Init()
-	if cfg.Agent.Debug {
-		logger.DebugMode = true
+// dryRunPrompt explains that changes are only described, never made
+const dryRunPrompt = `
+
+DRY-RUN MODE:
+- Nothing can be written: apply_patch, write_file, rollback and the other mutating tools return what they would have done instead. Previews (apply=false) and make_patch still work.
+- Explain the change you would make, with its target file and diff, rather than asking the user to confirm it.
+`
+
+// oneShotPrompt tells the model that nobody can answer follow-up questions
+func oneShotPrompt(yes bool) string {
+	prompt := `
+
+NON-INTERACTIVE MODE:
+- You are running from a script; the user cannot reply to questions. Do the task in this single turn and finish with a short summary.
+`
+	if yes {
+		return prompt + "- The user passed --yes: changes are pre-approved, so apply them directly instead of asking for confirmation.\n"
 	}
+	return prompt + "- Changes are NOT approved: do not write any files. Describe the change and show the patch instead.\n"
+}
 
-	// If DEBUG is set, redirect logs to file immediately so we catch early init issues
-	if logger.DebugMode {
-		f, err := tea.LogToFile("debug.log", "debug")
-		if err != nil {
-			fmt.Println("fatal: could not open debug.log:", err)
-			os.Exit(1)
-		}
-		defer f.Close()
-		logger.SetOutput(f) // Redirect standard log to the file
-		logger.Debug("Logger initialized")
+// runOneShot answers a single query without the TUI and returns the exit code
+func runOneShot(agent *assistant.Agent, query string) int {
+	response, err := agent.ProcessMessage(context.Background(), query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
 	}
+	fmt.Println(response)
+	return 0
+}
 
+// latestSession returns the most recently saved session in dir
+func latestSession(dir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no saved sessions in %s", dir)
+	}
+	// Session files are named by timestamp, so the last one is the newest
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// selectProvider creates the configured LLM provider, exiting with setup
+// instructions when it cannot be used
+func selectProvider(cfg *configuration.Config) assistant.LLMProvider {
 	// Provider Selection Logic (config takes precedence over env)
 	providerType := cfg.LLM.Provider
 	if envProvider := os.Getenv("LLM_PROVIDER"); envProvider != "" {
@@ -101,156 +167,695 @@ func main() {
 	}
 	logger.Debug("Selected Provider: %s", providerType)
 
-	var llm assistant.LLMProvider
+	llm, err := newProvider(cfg, providerType, "")
+	var setupErr *providerSetupError
+	switch {
+	case errors.As(err, &setupErr):
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		fmt.Printf("❌ Error: %s\n", setupErr.problem)
+		fmt.Println("")
+		fmt.Println(setupErr.help)
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		os.Exit(1)
+	case err != nil:
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return withFallbacks(cfg, providerType, llm)
+}
+
+// withFallbacks wraps llm so that requests go to the configured
+// fallback_providers when it is unavailable. Fallbacks that are not set up
+// are skipped with a warning.
+func withFallbacks(cfg *configuration.Config, providerType string, llm assistant.LLMProvider) assistant.LLMProvider {
+	var fallbacks []assistant.LLMProvider
+	for _, name := range cfg.LLM.FallbackProviders {
+		if strings.EqualFold(name, providerType) {
+			continue
+		}
+		fallback, err := newProvider(cfg, name, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping fallback provider %s: %v\n", name, err)
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	if len(fallbacks) == 0 {
+		return llm
+	}
+	return assistant.NewFallbackProvider(llm, fallbacks...)
+}
+
+// providerSetupError is returned by newProvider when the provider's key or
+// other settings are missing. help explains how to set them.
+type providerSetupError struct {
+	problem string
+	help    string
+}
+
+func (e *providerSetupError) Error() string {
+	return e.problem
+}
+
+// newProvider creates an LLM provider of the given type from the config and
+// environment, using the configured tool mode. A non-empty model overrides
+// the configured one.
+func newProvider(cfg *configuration.Config, providerType, model string) (assistant.LLMProvider, error) {
+	mode := strings.ToLower(cfg.LLM.ToolMode)
+	if mode == "" {
+		mode = assistant.ToolModeAuto
+	}
+	if mode != assistant.ToolModeAuto && mode != assistant.ToolModeNative && mode != assistant.ToolModeJSON {
+		return nil, fmt.Errorf("unknown tool_mode %q (use auto, native or json)", cfg.LLM.ToolMode)
+	}
+	llm, err := buildProvider(cfg, providerType, model)
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case assistant.ToolModeJSON:
+		return assistant.NewJSONToolProvider(llm), nil
+	case assistant.ToolModeAuto:
+		return assistant.NewAutoToolProvider(llm), nil
+	}
+	return llm, nil
+}
+
+// httpClients is the connection pool shared by every provider built in this
+// process, so a fallback chain or a switch with /model reuses connections
+var (
+	httpClientsOnce sync.Once
+	httpClients     *assistant.HTTPClientFactory
+)
 
+func sharedHTTPClients(cfg *configuration.Config) *assistant.HTTPClientFactory {
+	httpClientsOnce.Do(func() {
+		httpClients = assistant.NewHTTPClientFactory(assistant.HTTPOptions{
+			MaxIdleConns:    cfg.LLM.MaxIdleConns,
+			IdleConnTimeout: time.Duration(cfg.LLM.IdleConnTimeoutSeconds) * time.Second,
+			KeepAlive:       time.Duration(cfg.LLM.KeepAliveSeconds) * time.Second,
+		})
+	})
+	return httpClients
+}
+
+// buildProvider creates the provider of the given type
+func buildProvider(cfg *configuration.Config, providerType, model string) (assistant.LLMProvider, error) {
+	providerOpts := assistant.ProviderOptions{
+		Timeout:       time.Duration(cfg.LLM.TimeoutSeconds) * time.Second,
+		MaxRetries:    cfg.LLM.MaxRetries,
+		Temperature:   cfg.LLM.Temperature,
+		MaxTokens:     cfg.LLM.MaxTokens,
+		PromptCaching: cfg.LLM.PromptCaching,
+		HTTP:          sharedHTTPClients(cfg),
+	}
 	// Validate API key is available
-	var apiKey string
 	switch strings.ToLower(providerType) {
 	case "anthropic":
-		apiKey = cfg.LLM.AnthropicKey
+		apiKey := firstSetting(cfg.LLM.AnthropicKey, os.Getenv("ANTHROPIC_API_KEY"))
 		if apiKey == "" {
-			apiKey = os.Getenv("ANTHROPIC_API_KEY")
-		}
-		if apiKey == "" {
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			fmt.Println("❌ Error: ANTHROPIC_API_KEY not set")
-			fmt.Println("")
-			fmt.Println("Set it via environment variable:")
-			fmt.Println("  export ANTHROPIC_API_KEY='sk-ant-...'")
-			fmt.Println("")
-			fmt.Println("Or add it to ~/.config/hypragent/config.toml:")
-			fmt.Println("  [llm]")
-			fmt.Println("  anthropic_api_key = \"sk-ant-...\"")
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			os.Exit(1)
-		}
-		model := cfg.LLM.AnthropicModel
-		if model == "" {
-			model = os.Getenv("ANTHROPIC_MODEL")
+			return nil, &providerSetupError{
+				problem: "ANTHROPIC_API_KEY not set",
+				help: `Set it via environment variable:
+  export ANTHROPIC_API_KEY='sk-ant-...'
+
+Or add it to ~/.config/hypragent/config.toml:
+  [llm]
+  anthropic_api_key = "sk-ant-..."`,
+			}
 		}
-		llm = assistant.NewAnthropicProvider(apiKey, model)
+		return assistant.NewAnthropicProvider(apiKey, firstSetting(model, cfg.LLM.AnthropicModel, os.Getenv("ANTHROPIC_MODEL")), providerOpts), nil
 
 	case "gemini":
-		apiKey = cfg.LLM.GeminiKey
-		if apiKey == "" {
-			apiKey = os.Getenv("GEMINI_API_KEY")
-		}
+		apiKey := firstSetting(cfg.LLM.GeminiKey, os.Getenv("GEMINI_API_KEY"))
 		if apiKey == "" {
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			fmt.Println("❌ Error: GEMINI_API_KEY not set")
-			fmt.Println("")
-			fmt.Println("Set it via environment variable:")
-			fmt.Println("  export GEMINI_API_KEY='...'")
-			fmt.Println("")
-			fmt.Println("Or add it to ~/.config/hypragent/config.toml:")
-			fmt.Println("  [llm]")
-			fmt.Println("  gemini_api_key = \"...\"")
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			os.Exit(1)
-		}
-		model := cfg.LLM.GeminiModel
-		if model == "" {
-			model = os.Getenv("GEMINI_MODEL")
+			return nil, &providerSetupError{
+				problem: "GEMINI_API_KEY not set",
+				help: `Set it via environment variable:
+  export GEMINI_API_KEY='...'
+
+Or add it to ~/.config/hypragent/config.toml:
+  [llm]
+  gemini_api_key = "..."`,
+			}
 		}
-		llm, err = assistant.NewGeminiProvider(context.Background(), apiKey, model)
+		llm, err := assistant.NewGeminiProvider(context.Background(), apiKey, firstSetting(model, cfg.LLM.GeminiModel, os.Getenv("GEMINI_MODEL")), providerOpts)
 		if err != nil {
-			fmt.Printf("Error initializing Gemini: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("initializing Gemini: %w", err)
 		}
+		return llm, nil
 
 	case "ollama":
-		host := cfg.LLM.OllamaHost
-		if host == "" {
-			host = os.Getenv("OLLAMA_HOST")
-		}
-		model := cfg.LLM.OllamaModel
-		if model == "" {
-			model = os.Getenv("OLLAMA_MODEL")
-		}
-		llm = assistant.NewOllamaProvider(host, model)
+		host := firstSetting(cfg.LLM.OllamaHost, os.Getenv("OLLAMA_HOST"))
+		return assistant.NewOllamaProvider(host, firstSetting(model, cfg.LLM.OllamaModel, os.Getenv("OLLAMA_MODEL")), providerOpts), nil
 
 	case "openai":
-		apiKey = cfg.LLM.OpenAIKey
+		apiKey := firstSetting(cfg.LLM.OpenAIKey, os.Getenv("OPENAI_API_KEY"))
 		if apiKey == "" {
-			apiKey = os.Getenv("OPENAI_API_KEY")
+			return nil, &providerSetupError{
+				problem: "OPENAI_API_KEY not set",
+				help: `Set it via environment variable:
+  export OPENAI_API_KEY='sk-...'
+
+Or add it to ~/.config/hypragent/config.toml:
+  [llm]
+  openai_api_key = "sk-..."`,
+			}
 		}
+		return assistant.NewOpenAIProvider(apiKey, firstSetting(model, cfg.LLM.OpenAIModel, os.Getenv("OPENAI_MODEL")), providerOpts), nil
+
+	case "openai-compatible":
+		baseURL := firstSetting(cfg.LLM.BaseURL, os.Getenv("OPENAI_BASE_URL"))
+		compatibleModel := firstSetting(model, cfg.LLM.CompatibleModel, os.Getenv("OPENAI_COMPATIBLE_MODEL"))
+		if baseURL == "" || compatibleModel == "" {
+			return nil, &providerSetupError{
+				problem: "OpenAI-compatible provider is not fully configured",
+				help: `Add the server and model to ~/.config/hypragent/config.toml:
+  [llm]
+  provider = "openai-compatible"
+  base_url = "https://api.mistral.ai/v1"
+  compatible_model = "mistral-large-latest"
+  compatible_api_key = "..."`,
+			}
+		}
+		apiKey := firstSetting(cfg.LLM.CompatibleKey, os.Getenv("OPENAI_COMPATIBLE_API_KEY"))
+		return assistant.NewOpenAICompatibleProvider(baseURL, apiKey, compatibleModel, providerOpts), nil
+
+	case "groq":
+		apiKey := firstSetting(cfg.LLM.GroqKey, os.Getenv("GROQ_API_KEY"))
 		if apiKey == "" {
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			fmt.Println("❌ Error: OPENAI_API_KEY not set")
-			fmt.Println("")
-			fmt.Println("Set it via environment variable:")
-			fmt.Println("  export OPENAI_API_KEY='sk-...'")
-			fmt.Println("")
-			fmt.Println("Or add it to ~/.config/hypragent/config.toml:")
-			fmt.Println("  [llm]")
-			fmt.Println("  openai_api_key = \"sk-...\"")
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			os.Exit(1)
+			return nil, &providerSetupError{
+				problem: "GROQ_API_KEY not set",
+				help: `Set it via environment variable:
+  export GROQ_API_KEY='gsk_...'
+
+Or add it to ~/.config/hypragent/config.toml:
+  [llm]
+  groq_api_key = "gsk_..."`,
+			}
 		}
-		model := cfg.LLM.OpenAIModel
-		if model == "" {
-			model = os.Getenv("OPENAI_MODEL")
+		return assistant.NewGroqProvider(apiKey, firstSetting(model, cfg.LLM.GroqModel, os.Getenv("GROQ_MODEL")), providerOpts), nil
+
+	case "azure":
+		// Azure serves one model per deployment, so a model selects the deployment
+		apiKey := firstSetting(cfg.LLM.AzureKey, os.Getenv("AZURE_OPENAI_API_KEY"))
+		endpoint := firstSetting(cfg.LLM.AzureEndpoint, os.Getenv("AZURE_OPENAI_ENDPOINT"))
+		deployment := firstSetting(model, cfg.LLM.AzureDeployment, os.Getenv("AZURE_OPENAI_DEPLOYMENT"))
+		apiVersion := firstSetting(cfg.LLM.AzureAPIVersion, os.Getenv("AZURE_OPENAI_API_VERSION"))
+		if apiKey == "" || endpoint == "" || deployment == "" {
+			return nil, &providerSetupError{
+				problem: "Azure OpenAI is not fully configured",
+				help: `Set it via environment variables:
+  export AZURE_OPENAI_API_KEY='...'
+  export AZURE_OPENAI_ENDPOINT='https://my-resource.openai.azure.com'
+  export AZURE_OPENAI_DEPLOYMENT='my-deployment'
+
+Or add them to ~/.config/hypragent/config.toml:
+  [llm]
+  azure_api_key = "..."
+  azure_endpoint = "https://my-resource.openai.azure.com"
+  azure_deployment = "my-deployment"`,
+			}
 		}
-		llm = assistant.NewOpenAIProvider(apiKey, model)
+		return assistant.NewAzureOpenAIProvider(apiKey, endpoint, deployment, apiVersion, providerOpts), nil
 
-	default:
-		fmt.Printf("Error: Unknown LLM_PROVIDER '%s'. Supported: openai, anthropic, gemini, ollama\n", providerType)
+	case "bedrock":
+		region := firstSetting(cfg.LLM.BedrockRegion, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+		creds, err := assistant.LoadAWSCredentials()
+		if err != nil || region == "" {
+			problem := "AWS Bedrock is not fully configured"
+			if err != nil {
+				problem += "\n  " + err.Error()
+			}
+			return nil, &providerSetupError{
+				problem: problem,
+				help: `Set your AWS credentials and region via environment variables:
+  export AWS_ACCESS_KEY_ID='...'
+  export AWS_SECRET_ACCESS_KEY='...'
+  export AWS_REGION='us-east-1'
+
+Or use a profile from ~/.aws/credentials (AWS_PROFILE) and add
+the region to ~/.config/hypragent/config.toml:
+  [llm]
+  bedrock_region = "us-east-1"
+  bedrock_model = "anthropic.claude-3-5-sonnet-20240620-v1:0"`,
+			}
+		}
+		return assistant.NewBedrockProvider(creds, region, firstSetting(model, cfg.LLM.BedrockModel, os.Getenv("BEDROCK_MODEL")), providerOpts), nil
+	}
+	return nil, fmt.Errorf("unknown LLM_PROVIDER '%s'. Supported: %s", providerType, strings.Join(configuration.KnownProviders, ", "))
+}
+
+// firstSetting returns the first non-empty value, so config settings can
+// fall back to environment variables
+func firstSetting(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// transferSnapshot exports or imports a snapshot archive for -export-snapshot
+// and -import-snapshot and returns the exit code
+func transferSnapshot(snapshots *safety.SnapshotService, exportID, exportTo, importPath string) int {
+	if importPath != "" {
+		id, err := snapshots.Import(importPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✓ Imported snapshot %s; ask the agent to roll back to it to restore it\n", id)
+		return 0
+	}
+
+	if exportID == "latest" {
+		latest, err := snapshots.Latest()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		exportID = latest
+	}
+	if exportTo == "" {
+		exportTo = "hyprAgent-" + exportID + ".tar.gz"
+	}
+	if err := snapshots.Export(exportID, exportTo); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✓ Exported snapshot %s to %s\n", exportID, exportTo)
+	return 0
+}
+
+// writeConfig writes the default config file for -init and returns the exit code
+func writeConfig(force bool) int {
+	path, err := configuration.UserConfigPath()
+	if err == nil {
+		err = configuration.WriteDefaultConfig(path, force)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✓ Wrote the default config to %s; add your API key there\n", path)
+	return 0
+}
+
+// version is reported to MCP clients; release builds set it with -ldflags "-X main.version=..."
+var version = "dev"
+
+func main() {
+	var query string
+	var exportID, exportTo, importPath string
+	var yes, resume, dryRun, initConfig, force bool
+	flag.StringVar(&query, "q", "", "Answer a single query without the TUI and print the result")
+	flag.StringVar(&query, "query", "", "Same as -q")
+	flag.BoolVar(&yes, "yes", false, "With -q, approve changes that would normally ask for confirmation")
+	flag.BoolVar(&resume, "resume", false, "Continue the most recent saved conversation")
+	flag.BoolVar(&dryRun, "dry-run", false, "Describe changes instead of writing any files")
+	flag.StringVar(&exportID, "export-snapshot", "", "Write the snapshot with this ID (or \"latest\") to a .tar.gz and exit")
+	flag.StringVar(&exportTo, "export-to", "", "With -export-snapshot, the archive to write (default hyprAgent-<id>.tar.gz)")
+	flag.StringVar(&importPath, "import-snapshot", "", "Add the snapshot in an exported .tar.gz to the backups and exit")
+	flag.BoolVar(&initConfig, "init", false, "Write a commented config.toml with the default settings to ~/.config/hypragent and exit")
+	flag.BoolVar(&force, "force", false, "With -init, overwrite an existing config file")
+	flag.Parse()
+
+	// Before LoadConfig, which would complain that there is no config yet
+	if initConfig {
+		os.Exit(writeConfig(force))
+	}
+
+	// Load Configuration
+	cfg, err := configuration.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Initialize Logger
+	logger.Init()
+	if cfg.Agent.Debug {
+		logger.DebugMode = true
+		logger.Level = logger.DebugLevel
+	}
+	if cfg.Agent.LogLevel != "" {
+		level, err := logger.ParseLevel(cfg.Agent.LogLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			logger.Level = level
+		}
+	}
+
+	// If DEBUG or a log level is set, redirect logs to file immediately so we
+	// catch early init issues
+	if logger.DebugMode || cfg.Agent.LogLevel != "" {
+		f, err := tea.LogToFile("debug.log", "debug")
+		if err != nil {
+			fmt.Println("fatal: could not open debug.log:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logger.SetOutput(f) // Redirect standard log to the file
+		logger.Debug("Logger initialized")
+	}
+
 	// Initialize Safety Service
-	snapshotService, err := safety.NewSnapshotService("")
+	var snapshotService *safety.SnapshotService
+	backupDir, err := cfg.DataSubdir("backups")
+	if err == nil {
+		snapshotService, err = safety.NewSnapshotService(backupDir)
+	}
 	if err != nil {
-		fmt.Printf("Warning: Failed to initialize snapshot service: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: Failed to initialize snapshot service: %v\n", err)
+	} else {
+		snapshotService.MaxSnapshots = cfg.Safety.MaxSnapshots
+		snapshotService.MaxAge = time.Duration(cfg.Safety.MaxSnapshotAgeDays) * 24 * time.Hour
+	}
+
+	if exportID != "" || importPath != "" {
+		if snapshotService == nil {
+			os.Exit(1)
+		}
+		os.Exit(transferSnapshot(snapshotService, exportID, exportTo, importPath))
+	}
+
+	mcpMode := flag.Arg(0) == "mcp"
+
+	// The MCP server only exposes tools, so it needs no LLM
+	var llm assistant.LLMProvider
+	if !mcpMode {
+		llm = selectProvider(cfg)
 	}
 
 	// Initialize Backends
 	nativeBackend := configuration.NewNativeBackend()
-	hydeBackend := &configuration.HyDEBackend{}
-	omarchyBackend := &configuration.OmarchyBackend{}
+	hydeBackend := &configuration.HyDEBackend{Security: cfg.Security.Hyde}
+	omarchyBackend := &configuration.OmarchyBackend{Security: cfg.Security.Omarchy}
+
+	// source= expansion stays inside each backend's allowed paths
+	nativeBackend.Allow = cfg.SourceFilter(configuration.SourceNative)
+	hydeBackend.Allow = cfg.SourceFilter(configuration.SourceHyDE)
+	omarchyBackend.Allow = cfg.SourceFilter(configuration.SourceOmarchy)
 
 	backends := []configuration.ConfigBackend{hydeBackend, nativeBackend, omarchyBackend}
 
 	// Detect active backend for system prompt
 	var activeBackend configuration.ConfigBackend = nativeBackend // Default
-	var detectedType configuration.ConfigSourceType = configuration.SourceNative
-	for _, b := range backends {
-		if found, _ := b.Detect(""); found {
-			activeBackend = b
-			detectedType = b.Type()
-			break
+	detected := configuration.DetectBackends(backends)
+	switch {
+	case cfg.Agent.Backend != "":
+		activeBackend = configuredBackend(detected, cfg.Agent.Backend)
+		if activeBackend == nil {
+			fmt.Fprintf(os.Stderr, "Warning: configured backend %q was not detected; detecting automatically\n", cfg.Agent.Backend)
+			activeBackend = nativeBackend
+			if len(detected) > 0 {
+				activeBackend = detected[0]
+			}
+		}
+	case len(detected) > 1 && query == "" && !mcpMode && isTerminal(os.Stdin):
+		activeBackend = chooseBackend(detected)
+	case len(detected) > 0:
+		activeBackend = detected[0]
+	}
+	if len(detected) > 1 {
+		fmt.Fprintf(os.Stderr, "✓ Using the %s backend; set backend under [agent] to change it\n", activeBackend.Type())
+	}
+	detectedType := activeBackend.Type()
+	// Tools that detect on their own take the first match, so put ours first
+	backends = configuration.PreferBackend(backends, detectedType)
+	if snapshotService != nil {
+		// Snapshots are only written back where the tools could have written
+		snapshotService.AllowRestore = func(path string) error {
+			if _, err := cfg.CompanionPath(path); err == nil {
+				return nil
+			}
+			_, err := cfg.IsPathAllowed(detectedType, path, configuration.AccessWrite)
+			return err
 		}
 	}
 
 	// Build system prompt with security context
 	systemPrompt := buildSystemPrompt(cfg, detectedType)
+	if query != "" {
+		systemPrompt += oneShotPrompt(yes)
+	}
+	dryRun = dryRun || cfg.Agent.ReadOnly
+	if dryRun {
+		systemPrompt += dryRunPrompt
+	}
+
+	// Changes applied by tools are recorded with the snapshot that undoes them
+	actions := assistant.NewActionLog()
+	if dataDir, err := cfg.DataDir(); err == nil {
+		actions.SetAudit(assistant.NewAuditLog(filepath.Join(dataDir, "audit.log")))
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: audit log disabled: %v\n", err)
+	}
 
 	// Initialize Tools with config
 	registry := assistant.NewToolRegistry()
+	// Another instance must not snapshot and write the same files meanwhile
+	if dataDir, err := cfg.DataDir(); err == nil {
+		registry.SetLock(safety.NewConfigLock(filepath.Join(dataDir, safety.LockFile)))
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: changes are not locked against other instances: %v\n", err)
+	}
 	registry.Register(&assistant.DetectRootTool{Backends: backends})
+	registry.Register(&assistant.GatherContextTool{Config: cfg, Backends: backends})
+	registry.Register(&assistant.BackendHealthTool{Config: cfg, Backend: activeBackend})
 	registry.Register(&assistant.ListDirTool{Config: cfg, Backend: activeBackend})
-	registry.Register(&assistant.ReadFileTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.ReadFileTool{Config: cfg, Backend: activeBackend, MaxBytes: cfg.Agent.ReadMaxBytes})
+	registry.Register(&assistant.EstimateTokensTool{Config: cfg, Backend: activeBackend})
+	writeFileTool := &assistant.WriteFileTool{
+		Config:   cfg,
+		Backend:  activeBackend,
+		Snapshot: snapshotService,
+		Actions:  actions,
+	}
+	registry.Register(writeFileTool)
+	moveFileTool := &assistant.MoveFileTool{
+		Config:   cfg,
+		Backend:  activeBackend,
+		Snapshot: snapshotService,
+		Actions:  actions,
+	}
+	registry.Register(moveFileTool)
 	registry.Register(&assistant.ParseConfigTool{Backend: activeBackend})
+	registry.Register(&assistant.ResolveVariablesTool{Backend: activeBackend})
+	registry.Register(&assistant.ExplainLineTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.ValidateConfigTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.DetectValueConflictsTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.DetectBindConflictsTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.ConfigLayoutTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.SourceTreeTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.RiskCheckTool{Config: cfg, Backend: activeBackend})
 	registry.Register(&assistant.MakePatchTool{})
-	registry.Register(&assistant.ApplyPatchTool{
+	registry.Register(&assistant.DiffFilesTool{Config: cfg, Backend: activeBackend})
+	applyPatchTool := &assistant.ApplyPatchTool{
+		Backend:         activeBackend,
+		Snapshot:        snapshotService,
+		Config:          cfg,
+		Actions:         actions,
+		AutoReload:      cfg.Agent.AutoReload,
+		RollbackOnError: cfg.Agent.RollbackOnError,
+	}
+	registry.Register(applyPatchTool)
+	registry.Register(&assistant.PreviewPatchTool{Backend: activeBackend, Config: cfg})
+	mergeConfigTool := &assistant.MergeConfigTool{
+		Config:   cfg,
 		Backend:  activeBackend,
 		Snapshot: snapshotService,
+		Actions:  actions,
+	}
+	registry.Register(mergeConfigTool)
+	registry.Register(&assistant.ListPresetsTool{})
+	applyPresetTool := &assistant.ApplyPresetTool{
 		Config:   cfg,
-	})
-	registry.Register(&assistant.RollbackTool{Snapshot: snapshotService})
+		Backend:  activeBackend,
+		Snapshot: snapshotService,
+		Actions:  actions,
+	}
+	registry.Register(applyPresetTool)
+	setBorderColorsTool := &assistant.SetBorderColorsTool{
+		Config:   cfg,
+		Backend:  activeBackend,
+		Snapshot: snapshotService,
+		Actions:  actions,
+	}
+	registry.Register(setBorderColorsTool)
+	registry.Register(&assistant.IdleLockInfoTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.SetIdleListenerTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.SetLockSettingTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.ListSnapshotsTool{Snapshot: snapshotService, Actions: actions})
+	rollbackTool := &assistant.RollbackTool{Backend: activeBackend, Snapshot: snapshotService, Actions: actions}
+	registry.Register(rollbackTool)
+	undoLastPatchTool := &assistant.UndoLastPatchTool{Backend: activeBackend, Snapshot: snapshotService, Actions: actions}
+	registry.Register(undoLastPatchTool)
+	registry.Register(&assistant.GitCommitTool{Config: cfg, Backend: activeBackend, Actions: actions})
+	registry.Register(&assistant.ReloadTool{Allowed: cfg.Agent.AllowReload})
+	registry.Register(&assistant.QueryHyprlandTool{})
+	registry.Register(&assistant.ConfigErrorsTool{})
 	registry.Register(&assistant.FetchURLTool{})
 	registry.Register(&assistant.GrepTool{Config: cfg, Backend: activeBackend})
+	registry.Register(&assistant.SearchConfigTool{Config: cfg, Backend: activeBackend})
+
+	// Companion app configs (waybar, rofi, ...) are only reachable when opted in
+	var companionWriteTool *assistant.WriteCompanionFileTool
+	if cfg.Security.Companions.Enabled {
+		companionWriteTool = &assistant.WriteCompanionFileTool{
+			Config:   cfg,
+			Snapshot: snapshotService,
+			Actions:  actions,
+		}
+		registry.Register(&assistant.ReadCompanionFileTool{Config: cfg})
+		registry.Register(companionWriteTool)
+	}
+	// Every tool that writes asks the user before touching anything
+	confirmed := []*func(action string) bool{
+		&applyPatchTool.Confirm,
+		&mergeConfigTool.Confirm,
+		&applyPresetTool.Confirm,
+		&setBorderColorsTool.Confirm,
+		&writeFileTool.Confirm,
+		&moveFileTool.Confirm,
+		&rollbackTool.Confirm,
+		&undoLastPatchTool.Confirm,
+	}
+	if companionWriteTool != nil {
+		confirmed = append(confirmed, &companionWriteTool.Confirm)
+	}
+
+	if mcpMode {
+		// stdout carries the protocol, so diagnostics must go to stderr
+		server := mcp.NewServer(registry, version)
+		server.ReadOnly = dryRun
+		for _, c := range confirmed {
+			*c = server.Confirm
+		}
+		if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize Assistant with dynamic max turns
-	agent := assistant.NewAgent(llm, registry, systemPrompt)
+	agent := assistant.NewAgent(llm, registry, systemPrompt, assistant.AgentOptions{
+		MaxTurns:            cfg.Agent.MaxTurns,
+		Actions:             actions,
+		ContextBudget:       cfg.Agent.ContextBudget,
+		MaxUnknownToolCalls: cfg.Agent.MaxUnknownToolCalls,
+		ListToolsOnUnknown:  cfg.Agent.ListToolsOnUnknown,
+		DryRun:              dryRun,
+		SequentialTools:     cfg.Agent.SequentialTools,
+		ToolTimeout:         time.Duration(cfg.Agent.ToolTimeoutSeconds) * time.Second,
+	})
+
+	sessionDir, err := cfg.DataSubdir("sessions")
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if resume && sessionDir != "" {
+		path, err := latestSession(sessionDir)
+		if err == nil {
+			err = agent.LoadHistory(path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not resume session: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "✓ Resumed session from: %s\n", path)
+		}
+	}
+
+	// Writing tools ask the user through the TUI before touching anything
+	confirm := agent.RequestConfirmation
+	if query != "" {
+		// Nobody can answer a y/n prompt from a script
+		confirm = func(action string) bool {
+			if !yes {
+				fmt.Fprintln(os.Stderr, "Declined a change because --yes was not passed")
+			}
+			return yes
+		}
+	}
+	for _, c := range confirmed {
+		*c = confirm
+	}
+
+	if query != "" {
+		os.Exit(runOneShot(agent, query))
+	}
 
 	// Initialize UI
-	model := ui.NewModel(agent)
+	model := ui.NewModel(agent, llm.Name(), llm.Model(), func(provider, model string) (assistant.LLMProvider, error) {
+		llm, err := newProvider(cfg, provider, model)
+		if err != nil {
+			return nil, err
+		}
+		return withFallbacks(cfg, provider, llm), nil
+	}, snapshotService)
+
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
+	_, runErr := p.Run()
 
-	if _, err := p.Run(); err != nil {
-		fmt.Printf("Error running HyprAgent: %v\n", err)
+	// Save the conversation so it can be continued with --resume
+	if sessionDir != "" && hasConversation(agent.History()) {
+		path := filepath.Join(sessionDir, time.Now().Format("20060102-150405")+".json")
+		if err := agent.SaveHistory(path); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else {
+			fmt.Printf("Session saved. Continue it with: hyprAgent --resume\n")
+		}
+	}
+
+	if runErr != nil {
+		fmt.Printf("Error running HyprAgent: %v\n", runErr)
 		os.Exit(1)
 	}
 }
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// configuredBackend returns the detected backend named by the backend setting,
+// or nil if it was not detected
+func configuredBackend(detected []configuration.ConfigBackend, name string) configuration.ConfigBackend {
+	for _, b := range detected {
+		if string(b.Type()) == strings.ToLower(name) {
+			return b
+		}
+	}
+	return nil
+}
+
+// chooseBackend asks which of several detected installations to configure
+func chooseBackend(detected []configuration.ConfigBackend) configuration.ConfigBackend {
+	fmt.Println("Several Hyprland setups were detected:")
+	for i, b := range detected {
+		fmt.Printf("  %d) %s\n", i+1, b.Type())
+	}
+	fmt.Printf("Which one should HyprAgent configure? [1]: ")
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if n, err := strconv.Atoi(strings.TrimSpace(line)); err == nil && n >= 1 && n <= len(detected) {
+		return detected[n-1]
+	}
+	return detected[0]
+}
+
+// hasConversation reports whether history contains anything worth saving
+func hasConversation(history []assistant.Message) bool {
+	for _, msg := range history {
+		if msg.Role == assistant.RoleUser {
+			return true
+		}
+	}
+	return false
+}
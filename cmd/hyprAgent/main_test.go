@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reinhart/hyprAgent/internal/assistant"
+	"github.com/reinhart/hyprAgent/internal/configuration"
+)
+
+// mockProvider answers with the next of its replies and records the
+// conversations it was sent
+type mockProvider struct {
+	replies []*assistant.Message
+	err     error
+	sent    [][]assistant.Message
+}
+
+func (p *mockProvider) Name() string  { return "mock" }
+func (p *mockProvider) Model() string { return "mock-model" }
+
+func (p *mockProvider) Chat(ctx context.Context, messages []assistant.Message, tools []assistant.ToolDefinition) (*assistant.Message, error) {
+	p.sent = append(p.sent, messages)
+	if p.err != nil {
+		return nil, p.err
+	}
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return reply, nil
+}
+
+// captureOutput returns what fn writes to stdout and stderr
+func captureOutput(t *testing.T, fn func()) (string, string) {
+	t.Helper()
+	capture := func(f **os.File) (func() string, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		orig := *f
+		*f = w
+		done := make(chan string)
+		go func() {
+			data, _ := io.ReadAll(r)
+			done <- string(data)
+		}()
+		return func() string {
+			w.Close()
+			*f = orig
+			return <-done
+		}, nil
+	}
+	stdout, err := capture(&os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := capture(&os.Stderr)
+	if err != nil {
+		stdout()
+		t.Fatal(err)
+	}
+	fn()
+	return stdout(), stderr()
+}
+
+// oneShotAgent returns an agent for the one-shot path that can read files
+// from a temp config root
+func oneShotAgent(t *testing.T, provider assistant.LLMProvider) *assistant.Agent {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	root := filepath.Join(home, "hypr")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "hyprland.conf"), []byte("general {\n    gaps_in = 5\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := configuration.DefaultConfig()
+	backend := configuration.NewNativeBackend()
+	registry := assistant.NewToolRegistry()
+	registry.Register(&assistant.ReadFileTool{Config: cfg, Backend: backend})
+	return assistant.NewAgent(provider, registry, buildSystemPrompt(cfg, backend.Type())+oneShotPrompt(false), assistant.AgentOptions{})
+}
+
+func TestRunOneShotPrintsAnswer(t *testing.T) {
+	provider := &mockProvider{replies: []*assistant.Message{
+		{Role: assistant.RoleAssistant, ToolCalls: []assistant.ToolCall{{
+			ID: "call_1", Type: "function",
+			Function: assistant.FunctionCall{Name: "read_file", Arguments: `{"path": "hyprland.conf"}`},
+		}}},
+		{Role: assistant.RoleAssistant, Content: "Your inner gaps are 5 pixels."},
+	}}
+	agent := oneShotAgent(t, provider)
+
+	var code int
+	stdout, stderr := captureOutput(t, func() { code = runOneShot(agent, "What are my gaps?") })
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	if stdout != "Your inner gaps are 5 pixels.\n" {
+		t.Errorf("stdout = %q, want only the answer", stdout)
+	}
+
+	// The model saw the file and was told nobody can answer back
+	last := provider.sent[len(provider.sent)-1]
+	if result := last[len(last)-1]; result.Role != assistant.RoleTool || !strings.Contains(result.Content, "gaps_in = 5") {
+		t.Errorf("last message sent = %+v, want the read_file result", result)
+	}
+	if !strings.Contains(last[0].Content, "NON-INTERACTIVE MODE") {
+		t.Error("system prompt does not mention the non-interactive mode")
+	}
+}
+
+func TestRunOneShotReportsErrors(t *testing.T) {
+	agent := oneShotAgent(t, &mockProvider{err: errors.New("connection refused")})
+
+	var code int
+	stdout, stderr := captureOutput(t, func() { code = runOneShot(agent, "What are my gaps?") })
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if stdout != "" || !strings.Contains(stderr, "connection refused") {
+		t.Errorf("stdout = %q, stderr = %q; want the error on stderr only", stdout, stderr)
+	}
+}
+
+func TestConfiguredBackendWinsOverDetectionOrder(t *testing.T) {
+	t.Setenv("HYDE_CONFIG_HOME", "")
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, "hypr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"hyprland.conf", "hyde.conf"} {
+		if err := os.WriteFile(filepath.Join(home, "hypr", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	detected := configuration.DetectBackends([]configuration.ConfigBackend{
+		&configuration.HyDEBackend{}, configuration.NewNativeBackend(), &configuration.OmarchyBackend{},
+	})
+	if len(detected) != 2 {
+		t.Fatalf("detected %d backends, want hyde and native", len(detected))
+	}
+
+	if b := configuredBackend(detected, "Native"); b == nil || b.Type() != configuration.SourceNative {
+		t.Errorf("configuredBackend(native) = %v, want the native backend", b)
+	}
+	if b := configuredBackend(detected, "omarchy"); b != nil {
+		t.Errorf("configuredBackend(omarchy) = %v, want nil as it was not detected", b.Type())
+	}
+}
+
+func TestGroqKeyFromConfigOrEnvironment(t *testing.T) {
+	t.Setenv("GROQ_API_KEY", "")
+	t.Setenv("GROQ_MODEL", "")
+	cfg := configuration.DefaultConfig()
+
+	var setup *providerSetupError
+	if _, err := buildProvider(cfg, "groq", ""); !errors.As(err, &setup) || !strings.Contains(setup.help, "groq_api_key") {
+		t.Errorf("without a key err = %v, want a setup error naming groq_api_key", err)
+	}
+
+	t.Setenv("GROQ_API_KEY", "gsk_env")
+	llm, err := buildProvider(cfg, "groq", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if llm.Name() != "groq" || llm.Model() != assistant.DefaultGroqModel {
+		t.Errorf("provider = %s/%s, want groq/%s", llm.Name(), llm.Model(), assistant.DefaultGroqModel)
+	}
+
+	cfg.LLM.GroqKey, cfg.LLM.GroqModel = "gsk_config", "qwen-qwq-32b"
+	if llm, err := buildProvider(cfg, "groq", ""); err != nil || llm.Model() != "qwen-qwq-32b" {
+		t.Errorf("configured provider = %v, %v; want the configured model", llm, err)
+	}
+}
+
+func TestInitWritesDefaultConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	path := filepath.Join(home, ".config", "hypragent", "config.toml")
+
+	var code int
+	stdout, _ := captureOutput(t, func() { code = writeConfig(false) })
+	if code != 0 || !strings.Contains(stdout, path) {
+		t.Fatalf("writeConfig() = %d with output %q, want the path reported", code, stdout)
+	}
+	var cfg configuration.Config
+	warnings, err := configuration.DecodeConfigFile(path, &cfg)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("decoding the written config: %v, %v", err, warnings)
+	}
+	if !reflect.DeepEqual(&cfg, configuration.DefaultConfig()) {
+		t.Errorf("written config decodes to\n%+v\nwant the defaults\n%+v", cfg, *configuration.DefaultConfig())
+	}
+
+	// An existing config is only replaced with -force
+	if err := os.WriteFile(path, []byte("[llm]\nprovider = \"ollama\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr := captureOutput(t, func() { code = writeConfig(false) })
+	if code != 1 || !strings.Contains(stderr, "already exists") {
+		t.Errorf("writeConfig() over an existing file = %d with %q, want it refused", code, stderr)
+	}
+	captureOutput(t, func() { code = writeConfig(true) })
+	if data, _ := os.ReadFile(path); code != 0 || strings.Contains(string(data), `provider = "ollama"`) {
+		t.Errorf("writeConfig(force) = %d, want the file replaced", code)
+	}
+}
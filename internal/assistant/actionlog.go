@@ -0,0 +1,147 @@
+package assistant
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/reinhart/hyprAgent/internal/logger"
+)
+
+// Action is a change a tool made to the user's files
+type Action struct {
+	Time       time.Time `json:"time"`
+	Tool       string    `json:"tool"`
+	Path       string    `json:"path,omitempty"`
+	Source     string    `json:"source,omitempty"`      // The old path of a moved file
+	SnapshotID string    `json:"snapshot_id,omitempty"` // Snapshot taken just before the change
+	Hash       string    `json:"hash,omitempty"`        // SHA-256 of the patch or content written
+	Summary    string    `json:"summary"`
+}
+
+// ActionLog records the changes made during a session so each one can be
+// tied to the snapshot that undoes it
+type ActionLog struct {
+	mu       sync.Mutex
+	entries  []Action
+	undone   map[int]bool // Entries reverted by undo_last_patch
+	onRecord func(Action) // Set by the agent to surface actions in the transcript
+	audit    *AuditLog    // Optional; every action is also appended to it
+}
+
+func NewActionLog() *ActionLog {
+	return &ActionLog{}
+}
+
+// Record appends an action. It is safe to call on a nil log.
+func (l *ActionLog) Record(a Action) {
+	if l == nil {
+		return
+	}
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	l.entries = append(l.entries, a)
+	notify, audit := l.onRecord, l.audit
+	l.mu.Unlock()
+
+	// The change has already been made, so a failed audit write only warns
+	if err := audit.Write(a); err != nil {
+		logger.Warn("Failed to write audit log: %v", err)
+	}
+	if notify != nil {
+		notify(a)
+	}
+}
+
+// Entries returns a copy of all recorded actions, oldest first
+func (l *ActionLog) Entries() []Action {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Action(nil), l.entries...)
+}
+
+// LastUndoable returns the most recent action that changed a file and has not
+// been undone yet, with its index for MarkUndone
+func (l *ActionLog) LastUndoable() (int, Action, bool) {
+	if l == nil {
+		return 0, Action{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if l.entries[i].Path != "" && !l.undone[i] {
+			return i, l.entries[i], true
+		}
+	}
+	return 0, Action{}, false
+}
+
+// MarkUndone records that the action at index i has been reverted
+func (l *ActionLog) MarkUndone(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.undone == nil {
+		l.undone = make(map[int]bool)
+	}
+	l.undone[i] = true
+}
+
+// SetAudit makes Record also append every action to audit
+func (l *ActionLog) SetAudit(audit *AuditLog) {
+	l.mu.Lock()
+	l.audit = audit
+	l.mu.Unlock()
+}
+
+func (l *ActionLog) setNotify(fn func(Action)) {
+	l.mu.Lock()
+	l.onRecord = fn
+	l.mu.Unlock()
+}
+
+// AuditLog is an append-only JSON-lines file of every change made, kept
+// across sessions. Unlike the debug log it is always written.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewAuditLog returns an audit log that appends to path, creating it (and its
+// directory) on the first write
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Write appends one action. It is safe to call on a nil log.
+func (a *AuditLog) Write(action Action) error {
+	if a == nil {
+		return nil
+	}
+	line, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
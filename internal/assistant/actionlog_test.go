@@ -0,0 +1,92 @@
+package assistant
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reinhart/hyprAgent/internal/configuration"
+)
+
+func TestApplyPatchWritesAuditEntry(t *testing.T) {
+	const original = "general:gaps_in = 5\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	main := filepath.Join(root, "hyprland.conf")
+	snapshots := testSnapshots(t, root)
+	auditPath := filepath.Join(t.TempDir(), "state", "audit.jsonl")
+	actions := NewActionLog()
+	actions.SetAudit(NewAuditLog(auditPath))
+	var asked []string
+	tool := &ApplyPatchTool{
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Config:   configuration.DefaultConfig(),
+		Actions:  actions,
+		Confirm:  answer(true, &asked),
+	}
+	patch, err := makePatch(original, "general:gaps_in = 10\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(ApplyPatchArgs{Path: "hyprland.conf", Patch: patch})
+	if _, err := tool.Execute(string(args)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(readString(t, auditPath), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("audit log has %d entries, want 1:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	var entry Action
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("audit entry %q is not valid JSON: %v", lines[0], err)
+	}
+	if entry.Tool != "apply_patch" || entry.Path != main || entry.Time.IsZero() || entry.Summary == "" {
+		t.Errorf("audit entry = %+v", entry)
+	}
+	if entry.Hash != sha256Hex([]byte(strings.TrimSpace(patch))) {
+		t.Errorf("hash = %s, want the SHA-256 of the patch", entry.Hash)
+	}
+
+	// The entry links to the snapshot that undoes the change
+	list, err := snapshots.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || entry.SnapshotID != list[0].ID {
+		t.Fatalf("snapshot_id = %q, want the one snapshot taken (%+v)", entry.SnapshotID, list)
+	}
+	if !strings.Contains(strings.Join(list[0].Files, "\n"), main) {
+		t.Errorf("snapshot %s holds %v, want %s", entry.SnapshotID, list[0].Files, main)
+	}
+}
+
+func TestAuditLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := NewAuditLog(path)
+	for _, tool := range []string{"write_file", "move_file"} {
+		if err := audit.Write(Action{Tool: tool, Summary: "changed"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A second session appends to the same file
+	if err := NewAuditLog(path).Write(Action{Tool: "rollback", Summary: "undone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var tools []string
+	for _, line := range strings.Split(strings.TrimSuffix(readString(t, path), "\n"), "\n") {
+		var a Action
+		if err := json.Unmarshal([]byte(line), &a); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		tools = append(tools, a.Tool)
+	}
+	if got := strings.Join(tools, ","); got != "write_file,move_file,rollback" {
+		t.Errorf("audit entries = %s", got)
+	}
+	if err := (*AuditLog)(nil).Write(Action{}); err != nil {
+		t.Errorf("writing to a nil audit log = %v", err)
+	}
+}
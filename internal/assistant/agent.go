@@ -2,16 +2,82 @@ package assistant
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/reinhart/hyprAgent/internal/logger"
+	"github.com/reinhart/hyprAgent/internal/safety"
 )
 
 // StatusUpdate represents a real-time update from the agent
 type StatusUpdate struct {
 	Message string
 	Diff    string // Optional diff content to display
+	Note    string // Optional line to add to the transcript
+	Chunk   string // Optional streamed response text
+	Tokens  int    // Optional running total of tokens used this session
+}
+
+// ConfirmRequest asks the user to approve an action before a tool performs it
+type ConfirmRequest struct {
+	Action string // Description of the action, including the proposed diff
+	reply  chan bool
+}
+
+// Respond delivers the user's decision to the waiting tool
+func (r *ConfirmRequest) Respond(approved bool) {
+	r.reply <- approved
+}
+
+// confirmTimeout bounds how long a tool waits for the user to answer
+const confirmTimeout = 10 * time.Minute
+
+// DefaultMaxTurns is used when AgentOptions.MaxTurns is zero or negative
+const DefaultMaxTurns = 25
+
+// DefaultMaxUnknownToolCalls is used when AgentOptions.MaxUnknownToolCalls is zero or negative
+const DefaultMaxUnknownToolCalls = 3
+
+// DefaultToolTimeout is used when AgentOptions.ToolTimeout is zero or negative
+const DefaultToolTimeout = 30 * time.Second
+
+// DefaultContextBudget is used when AgentOptions.ContextBudget is zero or negative
+const DefaultContextBudget = 60000
+
+// elidedToolOutput replaces old tool results once the history is over budget
+const elidedToolOutput = "[tool output elided to save context; call the tool again if you need it]"
+
+// AgentOptions configures the behaviour of the agent loop
+type AgentOptions struct {
+	// MaxTurns caps the number of LLM calls per user message
+	MaxTurns int
+	// Actions is the log that writing tools record to; a new one is created if nil
+	Actions *ActionLog
+	// ContextBudget is the approximate number of tokens of history sent to the LLM
+	ContextBudget int
+	// MaxUnknownToolCalls aborts a request once the model has called this many
+	// tools that do not exist
+	MaxUnknownToolCalls int
+	// ListToolsOnUnknown adds the valid tool names to the result of the first
+	// unknown tool call so the model can correct itself
+	ListToolsOnUnknown bool
+	// DryRun refuses every mutating tool and reports what it would have done
+	// instead. Previews (apply=false) still run since they write nothing.
+	DryRun bool
+	// SequentialTools runs the tool calls of every turn one at a time in
+	// request order. Turns with a mutating call always do.
+	SequentialTools bool
+	// ToolTimeout bounds each call of a tool that does not change anything;
+	// on timeout the model gets an error result and the turn goes on.
+	// Mutating tools are not abandoned midway, as they may be waiting for
+	// the user to confirm.
+	ToolTimeout time.Duration
 }
 
 // Agent manages the conversation flow between the user, the LLM, and the tools
@@ -21,17 +87,42 @@ type Agent struct {
 	history  []Message
 	system   string
 	updates  chan StatusUpdate // Channel for sending updates to UI
+	confirms chan *ConfirmRequest
+	metrics  *Metrics
+	opts     AgentOptions
+	usage    Usage // Tokens used by all requests this session
 }
 
 // NewAgent creates a new agent instance
-func NewAgent(provider LLMProvider, registry *ToolRegistry, systemPrompt string) *Agent {
+func NewAgent(provider LLMProvider, registry *ToolRegistry, systemPrompt string, opts AgentOptions) *Agent {
+	if opts.MaxTurns <= 0 {
+		opts.MaxTurns = DefaultMaxTurns
+	}
+	if opts.Actions == nil {
+		opts.Actions = NewActionLog()
+	}
+	if opts.ContextBudget <= 0 {
+		opts.ContextBudget = DefaultContextBudget
+	}
+	if opts.MaxUnknownToolCalls <= 0 {
+		opts.MaxUnknownToolCalls = DefaultMaxUnknownToolCalls
+	}
+	if opts.ToolTimeout <= 0 {
+		opts.ToolTimeout = DefaultToolTimeout
+	}
+
 	agent := &Agent{
 		provider: provider,
 		registry: registry,
 		history:  make([]Message, 0),
 		system:   systemPrompt,
 		updates:  make(chan StatusUpdate, 20), // Buffered channel
+		confirms: make(chan *ConfirmRequest),
+		metrics:  NewMetrics(),
+		opts:     opts,
 	}
+	opts.Actions.setNotify(agent.sendActionNote)
+	agent.watchFallbacks()
 	return agent
 }
 
@@ -40,6 +131,71 @@ func (a *Agent) Updates() <-chan StatusUpdate {
 	return a.updates
 }
 
+// Confirmations returns the channel on which tools ask the user for approval
+func (a *Agent) Confirmations() <-chan *ConfirmRequest {
+	return a.confirms
+}
+
+// RequestConfirmation blocks until the user approves or rejects action. It
+// matches the Confirm callback of tools such as ApplyPatchTool. If nobody
+// answers within confirmTimeout the action is rejected.
+func (a *Agent) RequestConfirmation(action string) bool {
+	req := &ConfirmRequest{Action: action, reply: make(chan bool, 1)}
+	timeout := time.After(confirmTimeout)
+
+	select {
+	case a.confirms <- req:
+	case <-timeout:
+		logger.Warn("Confirmation request was not picked up; rejecting")
+		return false
+	}
+
+	select {
+	case approved := <-req.reply:
+		return approved
+	case <-timeout:
+		logger.Warn("Confirmation timed out; rejecting")
+		return false
+	}
+}
+
+// Metrics returns the per-provider request metrics collected this session
+func (a *Agent) Metrics() *Metrics {
+	return a.metrics
+}
+
+// SetProvider switches the LLM used for the following requests. The history
+// is kept, so the conversation continues with the new model. It must not be
+// called while a request is running.
+func (a *Agent) SetProvider(provider LLMProvider) {
+	a.provider = provider
+	a.watchFallbacks()
+}
+
+// watchFallbacks shows in the status line when a FallbackProvider has to
+// use another provider
+func (a *Agent) watchFallbacks() {
+	if fp, ok := a.provider.(*FallbackProvider); ok {
+		fp.Notify = a.sendUpdate
+	}
+}
+
+// Actions returns the log of changes applied this session
+func (a *Agent) Actions() *ActionLog {
+	return a.opts.Actions
+}
+
+// DryRun reports whether the agent refuses every change
+func (a *Agent) DryRun() bool {
+	return a.opts.DryRun
+}
+
+// ConfigLock returns the lock mutating tools hold while they run, or nil. Take
+// it to change files outside a tool.
+func (a *Agent) ConfigLock() *safety.ConfigLock {
+	return a.registry.lock
+}
+
 // sendUpdate sends a status update non-blocking
 func (a *Agent) sendUpdate(msg string) {
 	select {
@@ -57,6 +213,26 @@ func (a *Agent) sendDiffUpdate(diff string) {
 	}
 }
 
+// sendUsageUpdate reports the running token total to the UI
+func (a *Agent) sendUsageUpdate() {
+	select {
+	case a.updates <- StatusUpdate{Tokens: a.usage.Total()}:
+	default:
+	}
+}
+
+// sendActionNote adds an applied change, and how to undo it, to the transcript
+func (a *Agent) sendActionNote(act Action) {
+	note := act.Summary
+	if act.SnapshotID != "" {
+		note = fmt.Sprintf("%s; to undo, rollback to %s", note, act.SnapshotID)
+	}
+	select {
+	case a.updates <- StatusUpdate{Message: fmt.Sprintf("Finished %s", act.Tool), Note: note}:
+	default:
+	}
+}
+
 // ProcessMessage handles a user message and runs the agent loop
 func (a *Agent) ProcessMessage(ctx context.Context, input string) (string, error) {
 	logger.Info("Processing user input: %s", input)
@@ -70,106 +246,90 @@ func (a *Agent) ProcessMessage(ctx context.Context, input string) (string, error
 	// Add user message to history
 	a.history = append(a.history, Message{Role: RoleUser, Content: input})
 
+	unknownCalls := 0
+
 	// Max turns loop to prevent infinite loops
-	const maxTurns = 25
-	for i := 0; i < maxTurns; i++ {
+	for i := 0; i < a.opts.MaxTurns; i++ {
 		logger.Debug("Agent Loop Turn: %d", i+1)
 
 		// Call LLM
 		a.sendUpdate(fmt.Sprintf("Thinking (Turn %d)...", i+1))
+		a.trimHistory()
 		logger.Debug("Sending request to LLM Provider...")
-		resp, err := a.provider.Chat(ctx, a.history, a.registry.Definitions())
+		start := time.Now()
+		resp, err := a.chat(ctx)
+		latency := time.Since(start)
 		if err != nil {
-			logger.Info("LLM Error: %v", err)
+			logger.Error("LLM Error: %v", err)
+			a.metrics.Record(a.provider.Name(), RequestSample{Latency: latency, Failed: true})
 
 			// Check if error is due to context timeout/cancellation
 			if ctx.Err() == context.DeadlineExceeded {
 				a.sendUpdate("Request timed out")
-				return "", fmt.Errorf("LLM request timed out after waiting too long. The API may be slow or unavailable")
+				return "", &ProviderError{
+					Provider: a.provider.Name(),
+					Cause:    ErrTimeout,
+					Err:      fmt.Errorf("LLM request timed out after waiting too long. The API may be slow or unavailable"),
+				}
 			} else if ctx.Err() == context.Canceled {
 				a.sendUpdate("Request cancelled")
 				return "", fmt.Errorf("request was cancelled")
 			}
 
 			a.sendUpdate("Error communicating with LLM")
-			return "", err
+			// Provider errors can echo request details, keys included
+			return "", logger.RedactError(err)
+		}
+		logger.Debug("Received response from LLM (Content len: %d, ToolCalls: %d, Latency: %s)", len(resp.Content), len(resp.ToolCalls), latency)
+
+		sample := RequestSample{Latency: latency}
+		if resp.Usage != nil {
+			sample.PromptTokens = resp.Usage.PromptTokens
+			sample.CompletionTokens = resp.Usage.CompletionTokens
+			a.usage.PromptTokens += resp.Usage.PromptTokens
+			a.usage.CompletionTokens += resp.Usage.CompletionTokens
+			a.sendUsageUpdate()
 		}
-		logger.Debug("Received response from LLM (Content len: %d, ToolCalls: %d)", len(resp.Content), len(resp.ToolCalls))
+		a.metrics.Record(a.provider.Name(), sample)
 
 		a.history = append(a.history, *resp)
 
 		// If no tool calls, we are done
 		if len(resp.ToolCalls) == 0 {
+			// A model without function calling often writes the call out instead
+			if calls, _ := ParseToolCallBlocks(resp.Content); len(calls) > 0 {
+				logger.Warn("The model wrote a %s call as text; if %s does not support function calling, set tool_mode = \"json\" under [llm]", calls[0].Function.Name, a.provider.Model())
+			}
 			logger.Info("Final response received")
 			a.sendUpdate("Done")
 			return resp.Content, nil
 		}
 
-		// Handle tool calls
+		// Handle tool calls. Reads run concurrently; a turn with a mutating
+		// call (or every turn, with SequentialTools) runs its calls one by
+		// one in the order the model requested them, so writes never race on
+		// the same files and a read after a write sees its result.
 		results := make([]Message, len(resp.ToolCalls))
-		var wg sync.WaitGroup
+		sequential := a.opts.SequentialTools
+		for _, tc := range resp.ToolCalls {
+			sequential = sequential || a.registry.IsMutating(tc.Function.Name)
+		}
 
+		var wg sync.WaitGroup
 		for i, tc := range resp.ToolCalls {
+			if _, ok := a.registry.Get(tc.Function.Name); !ok {
+				unknownCalls++
+				results[i] = a.unknownToolResult(tc, unknownCalls == 1)
+				continue
+			}
+			if sequential {
+				results[i] = a.executeToolCall(ctx, tc)
+				continue
+			}
 			wg.Add(1)
 			go func(i int, tc ToolCall) {
 				defer wg.Done()
-				logger.Info("Tool Call Request: %s(%s)", tc.Function.Name, tc.Function.Arguments)
-
-				// Update UI with specific action
-				switch tc.Function.Name {
-				case "detect_installation_root":
-					a.sendUpdate("Detecting Hyprland installation...")
-				case "list_dir":
-					a.sendUpdate("Listing directory contents...")
-				case "read_file":
-					a.sendUpdate("Reading configuration file...")
-				case "parse_config":
-					a.sendUpdate("Parsing configuration structure...")
-				case "make_patch":
-					a.sendUpdate("Generating configuration patch...")
-				case "apply_patch":
-					a.sendUpdate("Requesting to apply patch...")
-				case "fetch_url":
-					a.sendUpdate("Fetching documentation...")
-				case "grep":
-					a.sendUpdate("Searching for pattern in files...")
-				}
-
-				tool, ok := a.registry.Get(tc.Function.Name)
-				if !ok {
-					logger.Info("Error: Tool not found: %s", tc.Function.Name)
-					results[i] = Message{
-						Role:       RoleTool,
-						ToolCallID: tc.ID,
-						Name:       tc.Function.Name,
-						Content:    fmt.Sprintf("Error: Tool %s not found", tc.Function.Name),
-					}
-					return
-				}
-
-				// Execute
-				output, err := tool.Execute(tc.Function.Arguments)
-				if err != nil {
-					logger.Info("Tool Execution Error (%s): %v", tc.Function.Name, err)
-					a.sendUpdate(fmt.Sprintf("Error in %s: %v", tc.Function.Name, err))
-					// Include error in content so LLM knows
-					output = fmt.Sprintf("Error: %v", err)
-				} else {
-					logger.Debug("Tool Output (%s): %s", tc.Function.Name, output)
-					a.sendUpdate(fmt.Sprintf("Finished %s", tc.Function.Name))
-
-					// If this was make_patch, send the diff to UI
-					if tc.Function.Name == "make_patch" {
-						a.sendDiffUpdate(output)
-					}
-				}
-
-				results[i] = Message{
-					Role:       RoleTool,
-					ToolCallID: tc.ID,
-					Name:       tc.Function.Name,
-					Content:    output,
-				}
+				results[i] = a.executeToolCall(ctx, tc)
 			}(i, tc)
 		}
 		wg.Wait()
@@ -177,15 +337,455 @@ func (a *Agent) ProcessMessage(ctx context.Context, input string) (string, error
 		// Append all results to history
 		a.history = append(a.history, results...)
 
+		if unknownCalls >= a.opts.MaxUnknownToolCalls {
+			logger.Warn("Aborting after %d unknown tool calls", unknownCalls)
+			a.sendUpdate("Error: Too many unknown tool calls")
+			return "", fmt.Errorf("%w: stopped after the model called %d tools that do not exist", ErrToolExecution, unknownCalls)
+		}
+
 		// Loop continues to send tool results back to LLM
 	}
 
-	logger.Info("Agent loop limit reached")
+	logger.Warn("Agent loop limit reached (%d turns)", a.opts.MaxTurns)
 	a.sendUpdate("Error: Loop limit reached")
 	return "Error: Agent loop limit reached without final response. I got stuck trying to solve this.", nil
 }
 
+// trimHistory elides old tool results, oldest first, until the history fits
+// the context budget. The system prompt and user and assistant messages are
+// never touched, nor are the results the model has not seen yet.
+func (a *Agent) trimHistory() {
+	total := 0
+	for _, msg := range a.history {
+		total += messageTokens(msg)
+	}
+	if total <= a.opts.ContextBudget {
+		return
+	}
+
+	// Results at the end of the history answer the latest calls and are needed now
+	pending := len(a.history)
+	for pending > 0 && a.history[pending-1].Role == RoleTool {
+		pending--
+	}
+
+	elided := 0
+	for i := 0; i < pending && total > a.opts.ContextBudget; i++ {
+		msg := &a.history[i]
+		if msg.Role != RoleTool || msg.Content == elidedToolOutput {
+			continue
+		}
+		before := messageTokens(*msg)
+		msg.Content = elidedToolOutput
+		total -= before - messageTokens(*msg)
+		elided++
+	}
+	if elided > 0 {
+		logger.Info("Elided %d old tool results to fit the context budget (~%d tokens left)", elided, total)
+	}
+}
+
+// messageTokens estimates the tokens a message takes up in a request
+func messageTokens(msg Message) int {
+	tokens := estimateTokens(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		tokens += estimateTokens(tc.Function.Name) + estimateTokens(tc.Function.Arguments)
+	}
+	return tokens
+}
+
+// chat requests the next response, streaming it to the UI when the provider
+// supports it
+func (a *Agent) chat(ctx context.Context) (*Message, error) {
+	sp, ok := a.provider.(StreamingProvider)
+	if !ok {
+		return a.provider.Chat(ctx, a.history, a.registry.Definitions())
+	}
+
+	chunks, err := sp.ChatStream(ctx, a.history, a.registry.Definitions())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		logger.Warn("Streaming failed, falling back to a regular request: %v", err)
+		return a.provider.Chat(ctx, a.history, a.registry.Definitions())
+	}
+
+	// Text is coalesced while the UI is busy so that no tokens are dropped
+	var pending string
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			return nil, chunk.Err
+		}
+		if chunk.Content != "" {
+			pending += chunk.Content
+			select {
+			case a.updates <- StatusUpdate{Chunk: pending}:
+				pending = ""
+			default:
+			}
+		}
+		if chunk.Done {
+			if pending != "" {
+				select {
+				case a.updates <- StatusUpdate{Chunk: pending}:
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			return chunk.Message, nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("%s stream ended without a response", a.provider.Name())
+}
+
+// executeToolCall runs a single tool call and returns its result message
+func (a *Agent) executeToolCall(ctx context.Context, tc ToolCall) Message {
+	logger.Info("Tool Call Request: %s(%s)", tc.Function.Name, tc.Function.Arguments)
+
+	// Update UI with specific action
+	switch tc.Function.Name {
+	case "detect_installation_root":
+		a.sendUpdate("Detecting Hyprland installation...")
+	case "gather_context":
+		a.sendUpdate("Gathering configuration context...")
+	case "check_backend_health":
+		a.sendUpdate("Checking installation health...")
+	case "list_dir":
+		a.sendUpdate("Listing directory contents...")
+	case "read_file":
+		a.sendUpdate("Reading configuration file...")
+	case "parse_config":
+		a.sendUpdate("Parsing configuration structure...")
+	case "diff_files":
+		a.sendUpdate("Comparing files...")
+	case "explain_line":
+		a.sendUpdate("Explaining config line...")
+	case "resolve_variables":
+		a.sendUpdate("Resolving config variables...")
+	case "estimate_tokens":
+		a.sendUpdate("Estimating file size...")
+	case "read_companion_file", "write_companion_file":
+		a.sendUpdate("Accessing companion app config...")
+	case "write_file":
+		a.sendUpdate("Writing configuration file...")
+	case "move_file":
+		a.sendUpdate("Moving configuration file...")
+	case "undo_last_patch":
+		a.sendUpdate("Undoing the last change...")
+	case "make_patch":
+		a.sendUpdate("Generating configuration patch...")
+	case "apply_patch":
+		a.sendUpdate("Requesting to apply patch...")
+	case "preview_patch":
+		a.sendUpdate("Dry-running patch...")
+	case "fetch_url":
+		a.sendUpdate("Fetching documentation...")
+	case "grep":
+		a.sendUpdate("Searching for pattern in files...")
+	case "search_config":
+		a.sendUpdate("Searching config files...")
+	case "validate_hyprland_syntax":
+		a.sendUpdate("Validating configuration syntax...")
+	case "detect_bind_conflicts":
+		a.sendUpdate("Checking keybinds for conflicts...")
+	case "detect_value_conflicts":
+		a.sendUpdate("Checking for conflicting values across files...")
+	case "query_hyprland":
+		a.sendUpdate("Querying live Hyprland state...")
+	case "reload":
+		a.sendUpdate("Reloading Hyprland...")
+	case "config_errors":
+		a.sendUpdate("Checking Hyprland config errors...")
+	case "show_source_tree":
+		a.sendUpdate("Following source= includes...")
+	case "inspect_config_layout":
+		a.sendUpdate("Mapping config layout...")
+	case "check_risks":
+		a.sendUpdate("Checking for lock-out risks...")
+	case "merge_config":
+		a.sendUpdate("Merging configuration settings...")
+	case "list_presets":
+		a.sendUpdate("Listing config presets...")
+	case "apply_preset":
+		a.sendUpdate("Preparing preset changes...")
+	case "set_border_colors":
+		a.sendUpdate("Composing border colors...")
+	case "inspect_idle_lock":
+		a.sendUpdate("Reading hypridle/hyprlock configuration...")
+	case "set_idle_listener", "set_lock_setting":
+		a.sendUpdate("Preparing idle/lock screen change...")
+	case "list_snapshots":
+		a.sendUpdate("Listing snapshots...")
+	case "git_commit":
+		a.sendUpdate("Committing changes to git...")
+	}
+
+	tool, ok := a.registry.Get(tc.Function.Name)
+	if !ok {
+		return a.unknownToolResult(tc, false)
+	}
+
+	if a.opts.DryRun && a.registry.IsMutating(tc.Function.Name) && !isPreview(tc.Function.Arguments) {
+		logger.Info("Dry run: skipped %s", tc.Function.Name)
+		a.sendUpdate(fmt.Sprintf("Dry run: skipped %s", tc.Function.Name))
+		return Message{
+			Role:       RoleTool,
+			ToolCallID: tc.ID,
+			Name:       tc.Function.Name,
+			Content:    dryRunResult(tc),
+		}
+	}
+
+	// Execute
+	var output string
+	var err error
+	if a.registry.IsMutating(tc.Function.Name) {
+		output, err = a.registry.run(ctx, tool, tc.Function.Name, tc.Function.Arguments)
+	} else {
+		output, err = a.runToolWithTimeout(ctx, tool, tc)
+	}
+	if err != nil {
+		logger.Warn("Tool Execution Error (%s): %v", tc.Function.Name, err)
+		a.sendUpdate(fmt.Sprintf("Error in %s: %v", tc.Function.Name, err))
+		// Include error in content so LLM knows
+		output = fmt.Sprintf("Error: %v", err)
+	} else {
+		logger.Debug("Tool Output (%s): %s", tc.Function.Name, output)
+		a.sendUpdate(fmt.Sprintf("Finished %s", tc.Function.Name))
+
+		// If this was make_patch, send the diff to UI
+		if tc.Function.Name == "make_patch" {
+			a.sendDiffUpdate(output)
+		}
+	}
+
+	return Message{
+		Role:       RoleTool,
+		ToolCallID: tc.ID,
+		Name:       tc.Function.Name,
+		Content:    output,
+	}
+}
+
+// isPreview reports whether a call asks a tool that supports previews (such as
+// apply_preset) to only return the diff, i.e. it passes "apply": false
+func isPreview(args string) bool {
+	var a struct {
+		Apply *bool `json:"apply"`
+	}
+	return json.Unmarshal([]byte(args), &a) == nil && a.Apply != nil && !*a.Apply
+}
+
+// dryRunResult describes a mutating call that was not executed, including its
+// target path and patch or content, so the model can relay it to the user
+func dryRunResult(tc ToolCall) string {
+	args := tc.Function.Arguments
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &fields); err == nil {
+		if pretty, err := json.MarshalIndent(fields, "", "  "); err == nil {
+			args = string(pretty)
+		}
+	}
+	return fmt.Sprintf("Dry run: %s was NOT executed and nothing was changed. It would have run with these arguments:\n%s\nTell the user what this call would have done; do not retry it.", tc.Function.Name, args)
+}
+
+// unknownToolResult answers a call to a tool that does not exist. With
+// listTools (and the ListToolsOnUnknown option), the valid names are included.
+func (a *Agent) unknownToolResult(tc ToolCall, listTools bool) Message {
+	logger.Warn("Error: Tool not found: %s", tc.Function.Name)
+	content := fmt.Sprintf("Error: Tool %s not found", tc.Function.Name)
+	if listTools && a.opts.ListToolsOnUnknown {
+		content += ". Available tools: " + strings.Join(a.registry.Names(), ", ")
+	}
+	return Message{
+		Role:       RoleTool,
+		ToolCallID: tc.ID,
+		Name:       tc.Function.Name,
+		Content:    content,
+	}
+}
+
+// runToolWithTimeout runs a tool for at most ToolTimeout. A tool that
+// ignores its context is left to finish in the background; its result is
+// dropped.
+func (a *Agent) runToolWithTimeout(ctx context.Context, tool Tool, tc ToolCall) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.opts.ToolTimeout)
+	defer cancel()
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := runTool(ctx, tool, tc.Function.Name, tc.Function.Arguments)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%s timed out after %s; try a smaller request or continue without it", tc.Function.Name, a.opts.ToolTimeout)
+		}
+		return "", fmt.Errorf("%s was cancelled", tc.Function.Name)
+	}
+}
+
+// runTool executes a tool, converting a panic into an error so that a single
+// buggy tool cannot crash the program. The stack is included in debug mode.
+func runTool(ctx context.Context, tool Tool, name, args string) (output string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			logger.Error("Tool %s panicked: %v\n%s", name, r, stack)
+			if logger.DebugMode {
+				err = fmt.Errorf("tool %s crashed: %v\n%s", name, r, stack)
+			} else {
+				err = fmt.Errorf("tool %s crashed unexpectedly: %v", name, r)
+			}
+		}
+	}()
+	if ct, ok := tool.(ContextTool); ok {
+		return ct.ExecuteContext(ctx, args)
+	}
+	return tool.Execute(args)
+}
+
 // Reset clears the conversation history
 func (a *Agent) Reset() {
 	a.history = make([]Message, 0)
 }
+
+// Usage returns the tokens used by all requests this session
+func (a *Agent) Usage() Usage {
+	return a.usage
+}
+
+// History returns a copy of the conversation, including tool calls and results
+func (a *Agent) History() []Message {
+	return append([]Message(nil), a.history...)
+}
+
+// SaveHistory writes the conversation to path as JSON
+func (a *Agent) SaveHistory(path string) error {
+	data, err := json.MarshalIndent(a.history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+	return nil
+}
+
+// SaveTranscript writes the conversation to path as markdown for reading:
+// the user and assistant turns, and with includeTools the tool calls and
+// their results
+func (a *Agent) SaveTranscript(path string, includeTools bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(TranscriptMarkdown(a.history, includeTools)), 0600); err != nil {
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+	return nil
+}
+
+// TranscriptMarkdown renders a conversation as markdown. The system prompt is
+// left out; tool calls and results are included only with includeTools.
+func TranscriptMarkdown(history []Message, includeTools bool) string {
+	var b strings.Builder
+	b.WriteString("# HyprAgent session\n")
+	for _, msg := range history {
+		switch msg.Role {
+		case RoleUser:
+			fmt.Fprintf(&b, "\n## You\n\n%s\n", msg.Content)
+		case RoleAssistant:
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "\n## HyprAgent\n\n%s\n", msg.Content)
+			}
+			if includeTools {
+				for _, tc := range msg.ToolCalls {
+					fmt.Fprintf(&b, "\n**Tool call:** `%s`\n\n```json\n%s\n```\n", tc.Function.Name, tc.Function.Arguments)
+				}
+			}
+		case RoleTool:
+			if includeTools {
+				fmt.Fprintf(&b, "\n**Result of** `%s`:\n\n```\n%s\n```\n", msg.Name, strings.TrimRight(msg.Content, "\n"))
+			}
+		}
+	}
+	return b.String()
+}
+
+// LoadHistory replaces the conversation with one saved by SaveHistory. The
+// saved system prompt is replaced by the current one.
+func (a *Agent) LoadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	var history []Message
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse history %s: %w", path, err)
+	}
+
+	a.history = make([]Message, 0, len(history)+1)
+	if a.system != "" {
+		a.history = append(a.history, Message{Role: RoleSystem, Content: a.system})
+	}
+	a.history = append(a.history, pairToolResults(history)...)
+	return nil
+}
+
+// pairToolResults drops system messages and any tool exchange that is not
+// complete: providers reject an assistant tool call without a matching result
+// (e.g. when the program quit mid-turn) and a result whose ToolCallID names no
+// call.
+func pairToolResults(history []Message) []Message {
+	var out []Message
+	for i := 0; i < len(history); i++ {
+		msg := history[i]
+		switch {
+		case msg.Role == RoleSystem:
+			continue
+		case msg.Role == RoleTool:
+			// Results are consumed together with their call below
+			logger.Warn("Dropping tool result %s without a matching call", msg.ToolCallID)
+			continue
+		case msg.Role != RoleAssistant || len(msg.ToolCalls) == 0:
+			out = append(out, msg)
+			continue
+		}
+
+		pending := make(map[string]bool, len(msg.ToolCalls))
+		for _, tc := range msg.ToolCalls {
+			pending[tc.ID] = true
+		}
+		var results []Message
+		j := i + 1
+		for ; j < len(history) && history[j].Role == RoleTool; j++ {
+			if pending[history[j].ToolCallID] {
+				delete(pending, history[j].ToolCallID)
+				results = append(results, history[j])
+			}
+		}
+		if len(pending) == 0 {
+			out = append(out, msg)
+			out = append(out, results...)
+		} else {
+			logger.Warn("Dropping incomplete tool exchange with %d unanswered calls", len(pending))
+		}
+		i = j - 1
+	}
+	return out
+}
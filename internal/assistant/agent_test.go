@@ -0,0 +1,505 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reinhart/hyprAgent/internal/configuration"
+)
+
+// funcTool is a tool whose behaviour is given by a function
+type funcTool struct {
+	name     string
+	mutating bool
+	run      func(args string) (string, error)
+}
+
+func (t *funcTool) Definition() ToolDefinition          { return ToolDefinition{Name: t.name} }
+func (t *funcTool) Execute(args string) (string, error) { return t.run(args) }
+func (t *funcTool) Mutating() bool                      { return t.mutating }
+
+// callTools is a reply that calls each of the named tools once
+func callTools(names ...string) func([]ToolDefinition) (*Message, error) {
+	return func([]ToolDefinition) (*Message, error) {
+		msg := &Message{Role: RoleAssistant}
+		for i, name := range names {
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       fmt.Sprintf("call_%d", i),
+				Type:     "function",
+				Function: FunctionCall{Name: name, Arguments: "{}"},
+			})
+		}
+		return msg, nil
+	}
+}
+
+// say is a reply with text and no tool calls
+func say(text string) func([]ToolDefinition) (*Message, error) {
+	return func([]ToolDefinition) (*Message, error) {
+		return &Message{Role: RoleAssistant, Content: text}, nil
+	}
+}
+
+// testAgent returns an agent that talks to provider and can call tools
+func testAgent(provider LLMProvider, opts AgentOptions, tools ...Tool) *Agent {
+	registry := NewToolRegistry()
+	for _, tool := range tools {
+		registry.Register(tool)
+	}
+	return NewAgent(provider, registry, "You edit Hyprland configs.", opts)
+}
+
+// toolResults returns the tool results in the agent's history
+func toolResults(a *Agent) []Message {
+	var results []Message
+	for _, msg := range a.History() {
+		if msg.Role == RoleTool {
+			results = append(results, msg)
+		}
+	}
+	return results
+}
+
+func TestAgentSurvivesPanickingTool(t *testing.T) {
+	explode := &funcTool{name: "explode", run: func(string) (string, error) {
+		var rules map[string]string
+		rules["gaps_in"] = "5" // Assignment to a nil map
+		return "", nil
+	}}
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		callTools("explode"),
+		say("That tool is broken, sorry."),
+	}}
+	a := testAgent(provider, AgentOptions{}, explode)
+
+	reply, err := a.ProcessMessage(context.Background(), "Set gaps to 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "That tool is broken, sorry." {
+		t.Errorf("reply = %q", reply)
+	}
+	results := toolResults(a)
+	if len(results) != 1 || !strings.Contains(results[0].Content, "tool explode crashed") {
+		t.Errorf("tool results = %+v, want the panic reported to the model", results)
+	}
+}
+
+func TestAgentStopsAfterMaxTurns(t *testing.T) {
+	noop := &funcTool{name: "read_file", run: func(string) (string, error) { return "gaps_in = 2", nil }}
+	provider := &scriptedProvider{}
+	for range 5 {
+		provider.replies = append(provider.replies, callTools("read_file"))
+	}
+	a := testAgent(provider, AgentOptions{MaxTurns: 3}, noop)
+
+	reply, err := a.ProcessMessage(context.Background(), "Keep reading")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := len(provider.sentTools); calls != 3 {
+		t.Errorf("made %d LLM calls, want 3", calls)
+	}
+	if !strings.Contains(reply, "loop limit reached") {
+		t.Errorf("reply = %q, want the loop limit message", reply)
+	}
+}
+
+func TestAgentNeverOverlapsWrites(t *testing.T) {
+	var mu sync.Mutex
+	running, overlapped := 0, false
+	var order []string
+	write := func(name string) *funcTool {
+		return &funcTool{name: name, mutating: true, run: func(string) (string, error) {
+			mu.Lock()
+			running++
+			overlapped = overlapped || running > 1
+			order = append(order, name)
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return "written", nil
+		}}
+	}
+	read := &funcTool{name: "read_file", run: func(string) (string, error) { return "gaps_in = 5", nil }}
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		callTools("apply_patch", "read_file", "write_file", "apply_patch"),
+		say("Done."),
+	}}
+	a := testAgent(provider, AgentOptions{}, write("apply_patch"), write("write_file"), read)
+
+	if _, err := a.ProcessMessage(context.Background(), "Change three things"); err != nil {
+		t.Fatal(err)
+	}
+	if overlapped {
+		t.Error("two writes ran at the same time")
+	}
+	if want := []string{"apply_patch", "write_file", "apply_patch"}; !slices.Equal(order, want) {
+		t.Errorf("writes ran in order %v, want %v", order, want)
+	}
+	if results := toolResults(a); len(results) != 4 {
+		t.Errorf("got %d tool results, want 4", len(results))
+	}
+}
+
+// contextTool is a funcTool that is given the call's context
+type contextTool struct {
+	funcTool
+	runContext func(ctx context.Context, args string) (string, error)
+}
+
+func (t *contextTool) ExecuteContext(ctx context.Context, args string) (string, error) {
+	return t.runContext(ctx, args)
+}
+
+func TestSlowToolTimesOutAndTurnContinues(t *testing.T) {
+	cancelled := make(chan error, 1)
+	slow := &contextTool{funcTool: funcTool{name: "query_hyprland"}, runContext: func(ctx context.Context, _ string) (string, error) {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return "", ctx.Err()
+	}}
+	// One that ignores its context is abandoned too
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	stuck := &funcTool{name: "list_files", run: func(string) (string, error) {
+		<-release
+		return "hyprland.conf", nil
+	}}
+	read := &funcTool{name: "read_file", run: func(string) (string, error) { return "gaps_in = 5", nil }}
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		callTools("query_hyprland", "list_files", "read_file"),
+		say("Your gaps are 5; Hyprland did not answer."),
+	}}
+	a := testAgent(provider, AgentOptions{ToolTimeout: 20 * time.Millisecond}, slow, stuck, read)
+
+	reply, err := a.ProcessMessage(context.Background(), "What are my gaps?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Your gaps are 5; Hyprland did not answer." {
+		t.Errorf("reply = %q, want the turn to go on after the timeouts", reply)
+	}
+	results := toolResults(a)
+	if len(results) != 3 {
+		t.Fatalf("got %d tool results, want 3", len(results))
+	}
+	for _, r := range results[:2] {
+		if !strings.Contains(r.Content, r.Name+" timed out after 20ms") {
+			t.Errorf("%s result = %q, want a timeout error", r.Name, r.Content)
+		}
+	}
+	if results[2].Content != "gaps_in = 5" {
+		t.Errorf("read_file result = %q", results[2].Content)
+	}
+	select {
+	case err := <-cancelled:
+		if err != context.DeadlineExceeded {
+			t.Errorf("query_hyprland context ended with %v, want its deadline", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("query_hyprland's context was never cancelled")
+	}
+}
+
+func TestSaveAndLoadHistoryWithToolCalls(t *testing.T) {
+	read := &funcTool{name: "read_file", run: func(string) (string, error) { return "gaps_in = 5", nil }}
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		callTools("read_file"),
+		say("Your gaps are 5."),
+	}}
+	a := testAgent(provider, AgentOptions{}, read)
+	if _, err := a.ProcessMessage(context.Background(), "What are my gaps?"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "sessions", "session.json")
+	if err := a.SaveHistory(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := NewAgent(nil, NewToolRegistry(), "A newer system prompt.", AgentOptions{})
+	if err := resumed.LoadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, loaded := a.History(), resumed.History()
+	if len(loaded) != len(saved) {
+		t.Fatalf("loaded %d messages, want %d: %+v", len(loaded), len(saved), loaded)
+	}
+	// The saved system prompt is replaced by the current one
+	if loaded[0].Role != RoleSystem || loaded[0].Content != "A newer system prompt." {
+		t.Errorf("first message = %+v, want the current system prompt", loaded[0])
+	}
+	for i := 1; i < len(saved); i++ {
+		if !reflect.DeepEqual(loaded[i], saved[i]) {
+			t.Errorf("message %d = %+v, want %+v", i, loaded[i], saved[i])
+		}
+	}
+	if call := loaded[2].ToolCalls; len(call) != 1 || call[0].Function.Name != "read_file" || loaded[3].ToolCallID != call[0].ID {
+		t.Errorf("tool exchange = %+v, %+v; want the call and its result", loaded[2], loaded[3])
+	}
+}
+
+func TestSetProviderKeepsConversation(t *testing.T) {
+	first := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){say("Your gaps are 5.")}}
+	second := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){say("Set gaps_in to 10.")}}
+	a := testAgent(first, AgentOptions{})
+	if _, err := a.ProcessMessage(context.Background(), "What are my gaps?"); err != nil {
+		t.Fatal(err)
+	}
+
+	a.SetProvider(second)
+	reply, err := a.ProcessMessage(context.Background(), "Double them")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Set gaps_in to 10." || len(second.sentTools) != 1 || len(first.sentTools) != 1 {
+		t.Errorf("reply = %q after %d and %d requests; want the second provider to answer", reply, len(first.sentTools), len(second.sentTools))
+	}
+	var turns []string
+	for _, msg := range a.History()[1:] {
+		turns = append(turns, msg.Content)
+	}
+	if want := []string{"What are my gaps?", "Your gaps are 5.", "Double them", "Set gaps_in to 10."}; !slices.Equal(turns, want) {
+		t.Errorf("history = %q, want %q", turns, want)
+	}
+}
+
+func TestLoadHistoryDropsUnansweredToolCalls(t *testing.T) {
+	history := []Message{
+		{Role: RoleUser, Content: "What are my gaps?"},
+		// The program quit before the tool returned
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Function: FunctionCall{Name: "read_file"}}}},
+		{Role: RoleUser, Content: "Are you there?"},
+	}
+	data, _ := json.Marshal(history)
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAgent(nil, NewToolRegistry(), "", AgentOptions{})
+	if err := a.LoadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := a.History()
+	if len(loaded) != 2 || loaded[0].Content != "What are my gaps?" || loaded[1].Content != "Are you there?" {
+		t.Errorf("loaded %+v, want only the two user messages", loaded)
+	}
+}
+
+func TestTrimHistoryFitsBudget(t *testing.T) {
+	const budget = 1000
+	a := NewAgent(nil, NewToolRegistry(), "You edit Hyprland configs.", AgentOptions{ContextBudget: budget})
+	a.history = []Message{
+		{Role: RoleSystem, Content: "You edit Hyprland configs."},
+		{Role: RoleUser, Content: "Read all my configs"},
+	}
+	for i := range 10 {
+		id := fmt.Sprintf("call_%d", i)
+		a.history = append(a.history,
+			Message{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: id, Function: FunctionCall{Name: "read_file", Arguments: `{"path": "hyprland.conf"}`}}}},
+			Message{Role: RoleTool, ToolCallID: id, Name: "read_file", Content: strings.Repeat("general:gaps_in = 5\n", 200)},
+		)
+	}
+	a.history = append(a.history, Message{Role: RoleUser, Content: "Now lower every gap by one"})
+	system, latest := a.history[0], a.history[len(a.history)-1]
+
+	a.trimHistory()
+
+	total := 0
+	for _, msg := range a.history {
+		total += messageTokens(msg)
+	}
+	if total > budget {
+		t.Errorf("trimmed history is ~%d tokens, want at most %d", total, budget)
+	}
+	if len(a.history) != 23 {
+		t.Errorf("history has %d messages, want all 23 kept", len(a.history))
+	}
+	if !reflect.DeepEqual(a.history[0], system) || !reflect.DeepEqual(a.history[len(a.history)-1], latest) {
+		t.Errorf("system prompt or latest user message changed: %+v, %+v", a.history[0], a.history[len(a.history)-1])
+	}
+}
+
+func TestDryRunChangesNothing(t *testing.T) {
+	const original = "general:gaps_in = 5\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	snapshots := testSnapshots(t, root)
+	patch, err := makePatch(original, "general:gaps_in = 10\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(ApplyPatchArgs{Path: "hyprland.conf", Patch: patch})
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		func([]ToolDefinition) (*Message, error) {
+			return &Message{Role: RoleAssistant, ToolCalls: []ToolCall{{
+				ID: "call_1", Type: "function",
+				Function: FunctionCall{Name: "apply_patch", Arguments: string(args)},
+			}}}, nil
+		},
+		say("I would have raised gaps_in to 10."),
+	}}
+	patcher := &ApplyPatchTool{
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Config:   configuration.DefaultConfig(),
+		Actions:  NewActionLog(),
+		Confirm:  func(string) bool { return true },
+	}
+	a := testAgent(provider, AgentOptions{DryRun: true}, patcher)
+
+	if _, err := a.ProcessMessage(context.Background(), "Set gaps_in to 10"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, filepath.Join(root, "hyprland.conf")); got != original {
+		t.Errorf("hyprland.conf = %q, want it unchanged in a dry run", got)
+	}
+	if list, _ := snapshots.List(); len(list) != 0 {
+		t.Errorf("took %d snapshot(s) in a dry run", len(list))
+	}
+	results := toolResults(a)
+	if len(results) != 1 || !strings.Contains(results[0].Content, "NOT executed") || !strings.Contains(results[0].Content, "gaps_in = 10") {
+		t.Errorf("tool results = %+v, want the skipped patch described", results)
+	}
+}
+
+func TestDryRunStillPreparesIdleListeners(t *testing.T) {
+	const original = "listener {\n    timeout = 300\n    on-timeout = loginctl lock-session\n}\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": "", "hypridle.conf": original})
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		func([]ToolDefinition) (*Message, error) {
+			return &Message{Role: RoleAssistant, ToolCalls: []ToolCall{{
+				ID: "call_1", Type: "function",
+				Function: FunctionCall{Name: "set_idle_listener", Arguments: `{"timeout": 600, "match_timeout": 300}`},
+			}}}, nil
+		},
+		say("Here is the patch."),
+	}}
+	backend := configuration.NewNativeBackend()
+	backend.ConfigPath = filepath.Join(root, "hyprland.conf")
+	tool := &SetIdleListenerTool{Config: configuration.DefaultConfig(), Backend: backend}
+	a := testAgent(provider, AgentOptions{DryRun: true}, tool)
+
+	if _, err := a.ProcessMessage(context.Background(), "Lock after 10 minutes"); err != nil {
+		t.Fatal(err)
+	}
+	// It only returns a patch, so a dry run has no reason to skip it
+	results := toolResults(a)
+	if len(results) != 1 || strings.Contains(results[0].Content, "NOT executed") || !strings.Contains(results[0].Content, "timeout = 600") {
+		t.Errorf("tool results = %+v, want the listener block prepared", results)
+	}
+	if got := readString(t, filepath.Join(root, "hypridle.conf")); got != original {
+		t.Errorf("hypridle.conf = %q, want it unchanged", got)
+	}
+}
+
+func TestAgentAddsUpTokenUsage(t *testing.T) {
+	withUsage := func(reply func([]ToolDefinition) (*Message, error), prompt, completion int) func([]ToolDefinition) (*Message, error) {
+		return func(tools []ToolDefinition) (*Message, error) {
+			msg, err := reply(tools)
+			msg.Usage = &Usage{PromptTokens: prompt, CompletionTokens: completion}
+			return msg, err
+		}
+	}
+	read := &funcTool{name: "read_file", run: func(string) (string, error) { return "gaps_in = 5", nil }}
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		withUsage(callTools("read_file"), 100, 10),
+		withUsage(say("Your gaps are 5."), 150, 20),
+		say("No usage reported for this one."),
+		withUsage(say("Now they are 10."), 200, 30),
+	}}
+	a := testAgent(provider, AgentOptions{}, read)
+	// The UI is told the running total after each reply that reports usage
+	var totals []int
+	send := func(input string) {
+		t.Helper()
+		if _, err := a.ProcessMessage(context.Background(), input); err != nil {
+			t.Fatal(err)
+		}
+		for len(a.Updates()) > 0 {
+			if u := <-a.Updates(); u.Tokens > 0 {
+				totals = append(totals, u.Tokens)
+			}
+		}
+	}
+
+	send("What are my gaps?")
+	if got := a.Usage(); got != (Usage{PromptTokens: 250, CompletionTokens: 30}) {
+		t.Errorf("usage after the first message = %+v, want 250 prompt and 30 completion tokens", got)
+	}
+	send("Thanks")
+	send("Set them to 10")
+	if got := a.Usage().Total(); got != 510 {
+		t.Errorf("total usage = %d, want 510", got)
+	}
+	if !slices.Equal(totals, []int{110, 280, 510}) {
+		t.Errorf("token updates = %v, want 110, 280, 510", totals)
+	}
+}
+
+func TestConcurrentPatchesDoNotCorrupt(t *testing.T) {
+	const original = "general {\n    gaps_in = 5\n    gaps_out = 20\n    border_size = 2\n    layout = dwindle\n}\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	main := filepath.Join(root, "hyprland.conf")
+	snapshots := testSnapshots(t, root)
+	var asked []string
+	patchTool := &ApplyPatchTool{
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Config:   configuration.DefaultConfig(),
+		Actions:  NewActionLog(),
+		Confirm:  answer(true, &asked),
+	}
+
+	// Both patches are made against the original, as a model would in one turn
+	var calls []ToolCall
+	for i, modified := range []string{
+		strings.Replace(original, "gaps_in = 5", "gaps_in = 10", 1),
+		strings.Replace(original, "layout = dwindle", "layout = master", 1),
+	} {
+		patch, err := makePatchContext(original, modified, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, _ := json.Marshal(ApplyPatchArgs{Path: "hyprland.conf", Patch: patch})
+		calls = append(calls, ToolCall{ID: fmt.Sprintf("call_%d", i), Type: "function", Function: FunctionCall{Name: "apply_patch", Arguments: string(args)}})
+	}
+	provider := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		func([]ToolDefinition) (*Message, error) { return &Message{Role: RoleAssistant, ToolCalls: calls}, nil },
+		say("Gaps and layout changed."),
+	}}
+	a := testAgent(provider, AgentOptions{}, patchTool)
+
+	if _, err := a.ProcessMessage(context.Background(), "Set gaps to 10 and use the master layout"); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range toolResults(a) {
+		if !strings.Contains(r.Content, "Patch applied successfully") {
+			t.Errorf("%s: %s", r.ToolCallID, r.Content)
+		}
+	}
+	want := "general {\n    gaps_in = 10\n    gaps_out = 20\n    border_size = 2\n    layout = master\n}\n"
+	if got := readString(t, main); got != want {
+		t.Errorf("hyprland.conf =\n%s\nwant both changes:\n%s", got, want)
+	}
+	list, err := snapshots.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID == list[1].ID {
+		t.Errorf("snapshots = %+v, want one per patch", list)
+	}
+}
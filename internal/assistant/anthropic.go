@@ -4,8 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
-	"time"
 
 	"github.com/liushuangls/go-anthropic/v2"
 )
@@ -14,30 +12,33 @@ import (
 type AnthropicProvider struct {
 	client *anthropic.Client
 	model  string
+	opts   ProviderOptions
 }
 
 // NewAnthropicProvider creates a new Anthropic provider instance
-func NewAnthropicProvider(apiKey string, model string) *AnthropicProvider {
+func NewAnthropicProvider(apiKey string, model string, opts ProviderOptions) *AnthropicProvider {
 	if model == "" {
 		model = string(anthropic.ModelClaude3Dot5Sonnet20240620)
 	}
-	
-	// Create HTTP client with proper timeouts
-	httpClient := &http.Client{
-		Timeout: 120 * time.Second, // 2 minute timeout for API calls
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     90 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
-		},
-	}
-	
+	opts = opts.withDefaults()
+
 	return &AnthropicProvider{
-		client: anthropic.NewClient(apiKey, anthropic.WithHTTPClient(httpClient)),
+		client: anthropic.NewClient(apiKey, anthropic.WithHTTPClient(opts.httpClient())),
 		model:  model,
+		opts:   opts,
 	}
 }
 
+// Name returns the provider identifier
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+// Model returns the model requests are sent to
+func (p *AnthropicProvider) Model() string {
+	return p.model
+}
+
 func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
 	var anthropicMessages []anthropic.Message
 	var systemPrompt string
@@ -58,9 +59,12 @@ func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools
 		}
 
 		// Content construction
-		// For simple text:
-		content := []anthropic.MessageContent{
-			anthropic.NewTextMessageContent(msg.Content),
+		// Only add a text block when there is text: assistant turns that consist
+		// solely of tool calls would otherwise send an empty text block, which
+		// Anthropic rejects with a 400.
+		var content []anthropic.MessageContent
+		if msg.Content != "" {
+			content = append(content, anthropic.NewTextMessageContent(msg.Content))
 		}
 
 		// If this message has tool calls (Assistant output)
@@ -111,17 +115,39 @@ func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools
 		Model:     anthropic.Model(p.model),
 		Messages:  anthropicMessages,
 		Tools:     anthropicTools,
-		MaxTokens: 4096,
+		MaxTokens: 4096, // Anthropic requires a limit
 		System:    systemPrompt,
 	}
+	if p.opts.MaxTokens > 0 {
+		req.MaxTokens = p.opts.MaxTokens
+	}
+	if p.opts.Temperature > 0 {
+		req.SetTemperature(p.opts.Temperature)
+	}
+	if p.opts.PromptCaching {
+		cacheStablePrefix(&req)
+	}
 
-	resp, err := p.client.CreateMessages(ctx, req)
+	var resp anthropic.MessagesResponse
+	attempts, err := withRetries(ctx, p.opts.MaxRetries, func() error {
+		var err error
+		resp, err = p.client.CreateMessages(ctx, req)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("anthropic completion error: %w", err)
+		if ctx.Err() != nil {
+			return nil, providerError("anthropic", fmt.Errorf("anthropic completion error (context): %w", ctx.Err()))
+		}
+		return nil, providerError("anthropic", fmt.Errorf("anthropic completion failed after %d attempts: %w", attempts, err))
 	}
 
 	result := &Message{
 		Role: RoleAssistant,
+		Usage: &Usage{
+			// Cached input is reported separately but is still part of the prompt
+			PromptTokens:     resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+		},
 	}
 
 	// Parse response
@@ -143,3 +169,19 @@ func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools
 
 	return result, nil
 }
+
+// cacheStablePrefix marks the end of the tool definitions and of the system
+// prompt as cache breakpoints. Both stay the same for the whole session, so
+// every turn after the first reads them from the cache instead of paying for
+// them again.
+func cacheStablePrefix(req *anthropic.MessagesRequest) {
+	ephemeral := &anthropic.MessageCacheControl{Type: anthropic.CacheControlTypeEphemeral}
+	if n := len(req.Tools); n > 0 {
+		req.Tools[n-1].CacheControl = ephemeral
+	}
+	if req.System != "" {
+		part := anthropic.NewSystemMessagePart(req.System)
+		part.CacheControl = ephemeral
+		req.MultiSystem = []anthropic.MessageSystemPart{part}
+	}
+}
@@ -0,0 +1,195 @@
+package assistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// roundTripFunc lets a function stand in for the API server
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeHTTP returns a client factory whose requests are answered by fn instead
+// of the network. Rate-limit responses are still turned into RateLimitError.
+func fakeHTTP(fn roundTripFunc) *HTTPClientFactory {
+	return &HTTPClientFactory{
+		transport: &retryAfterTransport{base: fn},
+		clients:   make(map[time.Duration]*http.Client),
+	}
+}
+
+// jsonResponse builds a response with the given status and JSON body
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+// captureRequests answers every request with reply and records the bodies sent
+func captureRequests(reply string, bodies *[][]byte) *HTTPClientFactory {
+	return fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		*bodies = append(*bodies, body)
+		return jsonResponse(http.StatusOK, reply), nil
+	})
+}
+
+const anthropicReply = `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test",
+	"content":[{"type":"text","text":"Gaps are now 5."}],"stop_reason":"end_turn",
+	"usage":{"input_tokens":20,"output_tokens":5}}`
+
+func TestAnthropicSendsToolOnlyTurnWithoutTextBlock(t *testing.T) {
+	var bodies [][]byte
+	p := NewAnthropicProvider("key", "claude-test", ProviderOptions{HTTP: captureRequests(anthropicReply, &bodies)})
+
+	history := []Message{
+		{Role: RoleSystem, Content: "You edit Hyprland configs."},
+		{Role: RoleUser, Content: "Set gaps to 5"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{
+			ID: "toolu_1", Type: "function",
+			Function: FunctionCall{Name: "read_file", Arguments: `{"path":"hyprland.conf"}`},
+		}}},
+		{Role: RoleTool, ToolCallID: "toolu_1", Content: "gaps_in = 2"},
+	}
+	resp, err := p.Chat(context.Background(), history, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Gaps are now 5." {
+		t.Errorf("content = %q", resp.Content)
+	}
+
+	var req struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+				ID   string `json:"id"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(bodies))
+	}
+	if err := json.Unmarshal(bodies[0], &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Messages) != 3 {
+		t.Fatalf("sent %d messages, want 3: %s", len(req.Messages), bodies[0])
+	}
+	turn := req.Messages[1]
+	if turn.Role != "assistant" || len(turn.Content) != 1 || turn.Content[0].Type != "tool_use" || turn.Content[0].ID != "toolu_1" {
+		t.Errorf("assistant turn = %+v, want a single tool_use block", turn)
+	}
+}
+
+func TestAnthropicPromptCachingMarksSystemBlock(t *testing.T) {
+	history := []Message{
+		{Role: RoleSystem, Content: "You edit Hyprland configs."},
+		{Role: RoleUser, Content: "Set gaps to 5"},
+	}
+	tools := []ToolDefinition{
+		{Name: "read_file", Description: "Reads a file", Parameters: json.RawMessage(`{"type":"object"}`)},
+		{Name: "apply_patch", Description: "Patches a file", Parameters: json.RawMessage(`{"type":"object"}`)},
+	}
+	type request struct {
+		System json.RawMessage `json:"system"`
+		Tools  []struct {
+			Name         string          `json:"name"`
+			CacheControl json.RawMessage `json:"cache_control"`
+		} `json:"tools"`
+	}
+	send := func(caching bool) request {
+		t.Helper()
+		var bodies [][]byte
+		p := NewAnthropicProvider("key", "claude-test", ProviderOptions{
+			HTTP:          captureRequests(anthropicReply, &bodies),
+			PromptCaching: caching,
+		})
+		if _, err := p.Chat(context.Background(), history, tools); err != nil {
+			t.Fatal(err)
+		}
+		var req request
+		if err := json.Unmarshal(bodies[0], &req); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	req := send(true)
+	var system []struct {
+		Type         string `json:"type"`
+		Text         string `json:"text"`
+		CacheControl *struct {
+			Type string `json:"type"`
+		} `json:"cache_control"`
+	}
+	if err := json.Unmarshal(req.System, &system); err != nil {
+		t.Fatalf("system = %s, want a list of blocks: %v", req.System, err)
+	}
+	if len(system) != 1 || system[0].Text != "You edit Hyprland configs.\n" || system[0].CacheControl == nil || system[0].CacheControl.Type != "ephemeral" {
+		t.Errorf("system = %s, want one block marked ephemeral", req.System)
+	}
+	if len(req.Tools) != 2 || req.Tools[0].CacheControl != nil || req.Tools[1].CacheControl == nil {
+		t.Errorf("tools = %+v, want only the last one marked", req.Tools)
+	}
+
+	// Without caching the system prompt is sent as plain text
+	req = send(false)
+	if string(req.System) != `"You edit Hyprland configs.\n"` {
+		t.Errorf("system without caching = %s", req.System)
+	}
+	for _, tool := range req.Tools {
+		if tool.CacheControl != nil {
+			t.Errorf("tool %s marked for caching when it is off", tool.Name)
+		}
+	}
+}
+
+func TestAnthropicSendsGenerationSettings(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		opts        ProviderOptions
+		temperature float32 // Zero when none should be sent
+		maxTokens   int
+	}{
+		{"configured", ProviderOptions{Temperature: 0.2, MaxTokens: 1000}, 0.2, 1000},
+		{"defaults", ProviderOptions{}, 0, 4096},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var bodies [][]byte
+			tc.opts.HTTP = captureRequests(anthropicReply, &bodies)
+			p := NewAnthropicProvider("key", "claude-test", tc.opts)
+			if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "Set gaps to 5"}}, nil); err != nil {
+				t.Fatal(err)
+			}
+			var req struct {
+				Temperature *float32 `json:"temperature"`
+				MaxTokens   int      `json:"max_tokens"`
+			}
+			if err := json.Unmarshal(bodies[0], &req); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tc.temperature == 0 && req.Temperature != nil:
+				t.Errorf("temperature = %v, want none sent", *req.Temperature)
+			case tc.temperature != 0 && (req.Temperature == nil || *req.Temperature != tc.temperature):
+				t.Errorf("temperature = %v, want %v", req.Temperature, tc.temperature)
+			}
+			if req.MaxTokens != tc.maxTokens {
+				t.Errorf("max_tokens = %d, want %d", req.MaxTokens, tc.maxTokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package assistant
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// NewAzureOpenAIProvider creates a new OpenAI provider configured for an Azure
+// OpenAI resource. Azure routes requests by deployment name, so every request
+// is sent to the given deployment regardless of model.
+func NewAzureOpenAIProvider(apiKey, endpoint, deployment, apiVersion string, opts ProviderOptions) *OpenAIProvider {
+	opts = opts.withDefaults()
+
+	config := openai.DefaultAzureConfig(apiKey, endpoint)
+	if apiVersion != "" {
+		config.APIVersion = apiVersion
+	}
+	config.AzureModelMapperFunc = func(model string) string {
+		return deployment
+	}
+	config.HTTPClient = opts.httpClient()
+
+	return &OpenAIProvider{
+		client: openai.NewClientWithConfig(config),
+		model:  deployment,
+		name:   "azure",
+		opts:   opts,
+	}
+}
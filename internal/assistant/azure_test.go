@@ -0,0 +1,32 @@
+package assistant
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestAzureRequestsGoToDeployment(t *testing.T) {
+	var got *http.Request
+	azure := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		got = req
+		return jsonResponse(http.StatusOK, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"}}]}`), nil
+	})
+	p := NewAzureOpenAIProvider("azure-key", "https://myres.openai.azure.com/", "hypr-gpt4o", "2024-06-01", ProviderOptions{HTTP: azure})
+
+	if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("no request was sent")
+	}
+	if want := "https://myres.openai.azure.com/openai/deployments/hypr-gpt4o/chat/completions?api-version=2024-06-01"; got.URL.String() != want {
+		t.Errorf("request URL = %s, want %s", got.URL, want)
+	}
+	if key := got.Header.Get("api-key"); key != "azure-key" {
+		t.Errorf("api-key header = %q", key)
+	}
+	if p.Name() != "azure" || p.Model() != "hypr-gpt4o" {
+		t.Errorf("provider = %s/%s, want azure/hypr-gpt4o", p.Name(), p.Model())
+	}
+}
@@ -0,0 +1,297 @@
+package assistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBedrockModel is used when no model ID is configured
+const DefaultBedrockModel = "anthropic.claude-3-5-sonnet-20240620-v1:0"
+
+// BedrockProvider implements LLMProvider using the Converse API of AWS
+// Bedrock Runtime, with requests signed by SigV4
+type BedrockProvider struct {
+	client   *http.Client
+	endpoint string // e.g. https://bedrock-runtime.us-east-1.amazonaws.com
+	region   string
+	model    string
+	creds    AWSCredentials
+	opts     ProviderOptions
+}
+
+// NewBedrockProvider creates a new Bedrock provider for the given region and
+// model ID (or inference profile ID, e.g. us.anthropic.claude-...)
+func NewBedrockProvider(creds AWSCredentials, region, model string, opts ProviderOptions) *BedrockProvider {
+	if model == "" {
+		model = DefaultBedrockModel
+	}
+	opts = opts.withDefaults()
+
+	return &BedrockProvider{
+		client:   opts.httpClient(),
+		endpoint: fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", region),
+		region:   region,
+		model:    model,
+		creds:    creds,
+		opts:     opts,
+	}
+}
+
+// Name returns the provider identifier
+func (p *BedrockProvider) Name() string {
+	return "bedrock"
+}
+
+// Model returns the model requests are sent to
+func (p *BedrockProvider) Model() string {
+	return p.model
+}
+
+// Converse API request and response shapes. A content block holds exactly
+// one of its fields.
+type converseRequest struct {
+	Messages        []converseMessage        `json:"messages"`
+	System          []converseContent        `json:"system,omitempty"`
+	InferenceConfig *converseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *converseToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type converseMessage struct {
+	Role    string            `json:"role"`
+	Content []converseContent `json:"content"`
+}
+
+type converseContent struct {
+	Text       *string             `json:"text,omitempty"`
+	ToolUse    *converseToolUse    `json:"toolUse,omitempty"`
+	ToolResult *converseToolResult `json:"toolResult,omitempty"`
+	CachePoint *converseCachePoint `json:"cachePoint,omitempty"`
+}
+
+type converseToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type converseToolResult struct {
+	ToolUseID string            `json:"toolUseId"`
+	Content   []converseContent `json:"content"`
+}
+
+type converseCachePoint struct {
+	Type string `json:"type"`
+}
+
+type converseInferenceConfig struct {
+	MaxTokens   int     `json:"maxTokens,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+}
+
+type converseToolConfig struct {
+	Tools []converseTool `json:"tools"`
+}
+
+type converseTool struct {
+	ToolSpec   *converseToolSpec   `json:"toolSpec,omitempty"`
+	CachePoint *converseCachePoint `json:"cachePoint,omitempty"`
+}
+
+type converseToolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	InputSchema struct {
+		JSON interface{} `json:"json"`
+	} `json:"inputSchema"`
+}
+
+type converseResponse struct {
+	Output struct {
+		Message converseMessage `json:"message"`
+	} `json:"output"`
+	StopReason string `json:"stopReason"`
+	Usage      struct {
+		InputTokens           int `json:"inputTokens"`
+		OutputTokens          int `json:"outputTokens"`
+		CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+		CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+	} `json:"usage"`
+}
+
+func (p *BedrockProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+	body, err := json.Marshal(p.buildRequest(messages, tools))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bedrock request: %w", err)
+	}
+
+	var resp converseResponse
+	attempts, err := withRetries(ctx, p.opts.MaxRetries, func() error {
+		var err error
+		resp, err = p.converse(ctx, body)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, providerError("bedrock", fmt.Errorf("bedrock completion error (context): %w", ctx.Err()))
+		}
+		return nil, providerError("bedrock", fmt.Errorf("bedrock completion failed after %d attempts: %w", attempts, err))
+	}
+
+	return parseConverseResponse(resp)
+}
+
+// converse sends one signed Converse request
+func (p *BedrockProvider) converse(ctx context.Context, body []byte) (converseResponse, error) {
+	var out converseResponse
+
+	// Model IDs contain ':', which must reach the service percent-encoded
+	url := p.endpoint + "/model/" + awsURIEncode(p.model) + "/converse"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return out, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signV4(req, body, p.creds, p.region, "bedrock", time.Now())
+
+	httpResp, err := p.client.Do(req)
+	if err != nil {
+		return out, err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return out, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return out, &statusError{StatusCode: httpResp.StatusCode, Message: fmt.Sprintf("bedrock returned %s: %s", httpResp.Status, apiErr.Message)}
+		}
+		return out, &statusError{StatusCode: httpResp.StatusCode, Message: fmt.Sprintf("bedrock returned %s: %s", httpResp.Status, strings.TrimSpace(string(data)))}
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, fmt.Errorf("invalid bedrock response: %w", err)
+	}
+	return out, nil
+}
+
+// buildRequest converts the conversation into a Converse request
+func (p *BedrockProvider) buildRequest(messages []Message, tools []ToolDefinition) converseRequest {
+	var req converseRequest
+
+	var systemPrompt string
+	for _, msg := range messages {
+		// Bedrock takes the system prompt separately, like Anthropic
+		if msg.Role == RoleSystem {
+			systemPrompt += msg.Content + "\n"
+			continue
+		}
+
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "assistant"
+		}
+
+		var content []converseContent
+		switch {
+		case msg.Role == RoleTool:
+			text := msg.Content
+			content = []converseContent{{ToolResult: &converseToolResult{
+				ToolUseID: msg.ToolCallID,
+				Content:   []converseContent{{Text: &text}},
+			}}}
+		default:
+			// Empty text blocks are rejected, as they are by Anthropic
+			if msg.Content != "" {
+				text := msg.Content
+				content = append(content, converseContent{Text: &text})
+			}
+			for _, tc := range msg.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) || strings.TrimSpace(tc.Function.Arguments) == "" {
+					input = json.RawMessage("{}")
+				}
+				content = append(content, converseContent{ToolUse: &converseToolUse{
+					ToolUseID: tc.ID,
+					Name:      tc.Function.Name,
+					Input:     input,
+				}})
+			}
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		// Roles must alternate, so the results of parallel tool calls (one
+		// message each here) are sent together in a single user turn
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, content...)
+			continue
+		}
+		req.Messages = append(req.Messages, converseMessage{Role: role, Content: content})
+	}
+
+	if systemPrompt != "" {
+		req.System = []converseContent{{Text: &systemPrompt}}
+		if p.opts.PromptCaching {
+			req.System = append(req.System, converseContent{CachePoint: &converseCachePoint{Type: "default"}})
+		}
+	}
+
+	if len(tools) > 0 {
+		req.ToolConfig = &converseToolConfig{}
+		for _, t := range tools {
+			spec := &converseToolSpec{Name: t.Name, Description: t.Description}
+			spec.InputSchema.JSON = t.Parameters
+			req.ToolConfig.Tools = append(req.ToolConfig.Tools, converseTool{ToolSpec: spec})
+		}
+		if p.opts.PromptCaching {
+			req.ToolConfig.Tools = append(req.ToolConfig.Tools, converseTool{CachePoint: &converseCachePoint{Type: "default"}})
+		}
+	}
+
+	if p.opts.MaxTokens > 0 || p.opts.Temperature > 0 {
+		req.InferenceConfig = &converseInferenceConfig{MaxTokens: p.opts.MaxTokens, Temperature: p.opts.Temperature}
+	}
+	return req
+}
+
+// parseConverseResponse converts the model's reply into a Message
+func parseConverseResponse(resp converseResponse) (*Message, error) {
+	result := &Message{
+		Role: RoleAssistant,
+		Usage: &Usage{
+			PromptTokens:     resp.Usage.InputTokens + resp.Usage.CacheReadInputTokens + resp.Usage.CacheWriteInputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+		},
+	}
+
+	for _, block := range resp.Output.Message.Content {
+		if block.Text != nil {
+			result.Content += *block.Text
+		} else if block.ToolUse != nil {
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:   block.ToolUse.ToolUseID,
+				Type: "function",
+				Function: FunctionCall{
+					Name:      block.ToolUse.Name,
+					Arguments: string(block.ToolUse.Input),
+				},
+			})
+		}
+	}
+
+	if result.Content == "" && len(result.ToolCalls) == 0 {
+		return nil, fmt.Errorf("bedrock returned an empty response (stop reason %q)", resp.StopReason)
+	}
+	return result, nil
+}
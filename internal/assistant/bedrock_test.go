@@ -0,0 +1,111 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testCreds are credentials for requests that never leave the test
+var testCreds = AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+
+func TestBedrockRequestUsesGenerationSettings(t *testing.T) {
+	messages := []Message{{Role: RoleUser, Content: "Set gaps to 5"}}
+
+	p := NewBedrockProvider(testCreds, "us-east-1", "anthropic.claude-test", ProviderOptions{Temperature: 0.2, MaxTokens: 1000})
+	cfg := p.buildRequest(messages, nil).InferenceConfig
+	if cfg == nil || cfg.Temperature != 0.2 || cfg.MaxTokens != 1000 {
+		t.Errorf("inference config = %+v, want temperature 0.2 and 1000 tokens", cfg)
+	}
+
+	// Zero values leave the model's defaults
+	p = NewBedrockProvider(testCreds, "us-east-1", "anthropic.claude-test", ProviderOptions{})
+	if cfg := p.buildRequest(messages, nil).InferenceConfig; cfg != nil {
+		t.Errorf("inference config = %+v, want none", cfg)
+	}
+}
+
+func TestBedrockToolCallsRoundTripConverse(t *testing.T) {
+	var sent []byte
+	var path, auth string
+	server := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		sent, _ = io.ReadAll(req.Body)
+		path, auth = req.URL.EscapedPath(), req.Header.Get("Authorization")
+		return jsonResponse(http.StatusOK, `{"output":{"message":{"role":"assistant","content":[
+			{"text":"Let me read both files."},
+			{"toolUse":{"toolUseId":"tooluse_3","name":"read_file","input":{"path":"hyprland.conf"}}}
+		]}},"stopReason":"tool_use","usage":{"inputTokens":40,"outputTokens":12}}`), nil
+	})
+	p := NewBedrockProvider(testCreds, "us-east-1", "anthropic.claude-test:0", ProviderOptions{HTTP: server})
+
+	history := []Message{
+		{Role: RoleSystem, Content: "You edit Hyprland configs."},
+		{Role: RoleUser, Content: "Compare my binds"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{
+			{ID: "tooluse_1", Type: "function", Function: FunctionCall{Name: "list_binds", Arguments: `{}`}},
+			{ID: "tooluse_2", Type: "function", Function: FunctionCall{Name: "find_bind_conflicts", Arguments: ``}},
+		}},
+		{Role: RoleTool, ToolCallID: "tooluse_1", Content: "SUPER, Q, killactive"},
+		{Role: RoleTool, ToolCallID: "tooluse_2", Content: "No conflicts."},
+	}
+	tools := []ToolDefinition{{Name: "read_file", Description: "Reads a file", Parameters: json.RawMessage(`{"type":"object"}`)}}
+	resp, err := p.Chat(context.Background(), history, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/model/anthropic.claude-test%3A0/converse" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		t.Errorf("sent to %s with Authorization %q, want a signed Converse request", path, auth)
+	}
+	var req converseRequest
+	if err := json.Unmarshal(sent, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.System) != 1 || *req.System[0].Text != "You edit Hyprland configs.\n" {
+		t.Errorf("system = %s, want the system prompt", sent)
+	}
+	if len(req.ToolConfig.Tools) != 1 || req.ToolConfig.Tools[0].ToolSpec.Name != "read_file" {
+		t.Errorf("tools = %+v", req.ToolConfig.Tools)
+	}
+	if len(req.Messages) != 3 {
+		t.Fatalf("sent %d messages, want 3: %s", len(req.Messages), sent)
+	}
+	calls := req.Messages[1]
+	if calls.Role != "assistant" || len(calls.Content) != 2 {
+		t.Fatalf("assistant turn = %+v, want two toolUse blocks", calls)
+	}
+	for i, want := range []struct{ id, name, input string }{
+		{"tooluse_1", "list_binds", `{}`},
+		{"tooluse_2", "find_bind_conflicts", `{}`}, // Empty arguments are sent as an empty object
+	} {
+		use := calls.Content[i].ToolUse
+		if use == nil || use.ToolUseID != want.id || use.Name != want.name || string(use.Input) != want.input {
+			t.Errorf("block %d = %+v, want toolUse %s %s %s", i, calls.Content[i], want.id, want.name, want.input)
+		}
+	}
+	// Both results go back together in one user turn
+	results := req.Messages[2]
+	if results.Role != "user" || len(results.Content) != 2 {
+		t.Fatalf("results turn = %+v, want two toolResult blocks", results)
+	}
+	for i, want := range []struct{ id, text string }{{"tooluse_1", "SUPER, Q, killactive"}, {"tooluse_2", "No conflicts."}} {
+		res := results.Content[i].ToolResult
+		if res == nil || res.ToolUseID != want.id || len(res.Content) != 1 || *res.Content[0].Text != want.text {
+			t.Errorf("result %d = %+v, want %s: %s", i, results.Content[i], want.id, want.text)
+		}
+	}
+
+	if resp.Content != "Let me read both files." || len(resp.ToolCalls) != 1 {
+		t.Fatalf("response = %+v, want text and one tool call", resp)
+	}
+	call := resp.ToolCalls[0]
+	if call.ID != "tooluse_3" || call.Function.Name != "read_file" || call.Function.Arguments != `{"path":"hyprland.conf"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	if resp.Usage == nil || resp.Usage.Total() != 52 {
+		t.Errorf("usage = %+v, want 52 tokens", resp.Usage)
+	}
+}
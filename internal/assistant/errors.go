@@ -0,0 +1,122 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+)
+
+// Causes of a failed request, so the UI can say what to do about it. Check
+// for them with errors.Is; the original error stays in the chain.
+var (
+	ErrAuth          = errors.New("authentication failed")
+	ErrTimeout       = errors.New("request timed out")
+	ErrRateLimit     = errors.New("rate limited")
+	ErrToolExecution = errors.New("tool execution failed")
+)
+
+// ProviderError is a failed LLM request. Cause is one of the errors above, or
+// nil when the failure does not fit any of them.
+type ProviderError struct {
+	Provider string
+	Cause    error
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// statusError is an HTTP error response from an API called without an SDK
+type statusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *statusError) Error() string {
+	return e.Message
+}
+
+// providerError wraps a failed request of the named provider with its cause
+func providerError(provider string, err error) error {
+	return &ProviderError{Provider: provider, Cause: errorCause(err), Err: err}
+}
+
+// errorCause maps the errors of the provider SDKs to ErrAuth, ErrTimeout or
+// ErrRateLimit by their type or HTTP status, or returns nil
+func errorCause(err error) error {
+	var rateLimited *RateLimitError
+	if errors.As(err, &rateLimited) {
+		return ErrRateLimit
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+
+	switch statusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusTooManyRequests:
+		return ErrRateLimit
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrTimeout
+	}
+	return nil
+}
+
+// statusCode returns the HTTP status of a failed request, or 0 if unknown
+func statusCode(err error) int {
+	var (
+		openaiAPIErr    *openai.APIError
+		openaiReqErr    *openai.RequestError
+		anthropicAPIErr *anthropic.APIError
+		anthropicReqErr *anthropic.RequestError
+		googleErr       *googleapi.Error
+		statusErr       *statusError
+		httpCoder       interface{ HTTPCode() int } // gax errors from the Gemini client
+	)
+	switch {
+	case errors.As(err, &openaiAPIErr):
+		return openaiAPIErr.HTTPStatusCode
+	case errors.As(err, &openaiReqErr):
+		return openaiReqErr.HTTPStatusCode
+	case errors.As(err, &anthropicAPIErr):
+		return anthropicStatus[anthropicAPIErr.Type]
+	case errors.As(err, &anthropicReqErr):
+		return anthropicReqErr.StatusCode
+	case errors.As(err, &googleErr):
+		return googleErr.Code
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode
+	case errors.As(err, &httpCoder):
+		return httpCoder.HTTPCode()
+	}
+	return 0
+}
+
+// anthropicStatus is the HTTP status each Anthropic error type is sent with.
+// The SDK does not keep the status once the error body parses, only the type.
+var anthropicStatus = map[anthropic.ErrType]int{
+	anthropic.ErrTypeInvalidRequest: http.StatusBadRequest,
+	anthropic.ErrTypeAuthentication: http.StatusUnauthorized,
+	anthropic.ErrTypePermission:     http.StatusForbidden,
+	anthropic.ErrTypeNotFound:       http.StatusNotFound,
+	anthropic.ErrTypeTooLarge:       http.StatusRequestEntityTooLarge,
+	anthropic.ErrTypeRateLimit:      http.StatusTooManyRequests,
+	anthropic.ErrTypeApi:            http.StatusInternalServerError,
+	"timeout_error":                 http.StatusGatewayTimeout,
+	anthropic.ErrTypeOverloaded:     529,
+}
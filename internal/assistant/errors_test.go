@@ -0,0 +1,106 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// errorBodies are the error responses each API sends, keyed by provider
+var errorBodies = map[string]func(status int) string{
+	"anthropic": func(status int) string {
+		kind := map[int]string{
+			http.StatusUnauthorized:        "authentication_error",
+			http.StatusForbidden:           "permission_error",
+			http.StatusTooManyRequests:     "rate_limit_error",
+			http.StatusGatewayTimeout:      "timeout_error",
+			http.StatusInternalServerError: "api_error",
+		}[status]
+		return fmt.Sprintf(`{"type":"error","error":{"type":%q,"message":"request failed"}}`, kind)
+	},
+	"openai": func(int) string {
+		return `{"error":{"message":"request failed","type":"invalid_request_error"}}`
+	},
+	"bedrock": func(int) string {
+		return `{"message":"request failed"}`
+	},
+}
+
+func TestProvidersClassifyFailures(t *testing.T) {
+	newProvider := map[string]func(*HTTPClientFactory) LLMProvider{
+		"anthropic": func(h *HTTPClientFactory) LLMProvider {
+			return NewAnthropicProvider("key", "claude-test", ProviderOptions{MaxRetries: 1, HTTP: h})
+		},
+		"openai": func(h *HTTPClientFactory) LLMProvider {
+			return NewOpenAIProvider("key", "gpt-test", ProviderOptions{MaxRetries: 1, HTTP: h})
+		},
+		"bedrock": func(h *HTTPClientFactory) LLMProvider {
+			return NewBedrockProvider(testCreds, "us-east-1", "anthropic.claude-test", ProviderOptions{MaxRetries: 1, HTTP: h})
+		},
+	}
+	causes := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, ErrAuth},
+		{http.StatusForbidden, ErrAuth},
+		{http.StatusTooManyRequests, ErrRateLimit},
+		{http.StatusGatewayTimeout, ErrTimeout},
+		{http.StatusInternalServerError, nil},
+	}
+	for name, build := range newProvider {
+		for _, c := range causes {
+			t.Run(fmt.Sprintf("%s/%d", name, c.status), func(t *testing.T) {
+				server := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+					return jsonResponse(c.status, errorBodies[name](c.status)), nil
+				})
+				_, err := build(server).Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil)
+
+				var perr *ProviderError
+				if !errors.As(err, &perr) || perr.Provider != name {
+					t.Fatalf("err = %#v, want a ProviderError from %s", err, name)
+				}
+				if perr.Cause != c.want {
+					t.Errorf("cause = %v, want %v (err: %v)", perr.Cause, c.want, err)
+				}
+				if c.want != nil && !errors.Is(err, c.want) {
+					t.Errorf("errors.Is(%v, %v) = false", err, c.want)
+				}
+			})
+		}
+	}
+}
+
+func TestTimeoutsAreClassified(t *testing.T) {
+	// A transport that gave up, while the caller's context is still live
+	server := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		return nil, context.DeadlineExceeded
+	})
+	p := NewOpenAIProvider("key", "gpt-test", ProviderOptions{MaxRetries: 1, HTTP: server})
+	if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil); !errors.Is(err, ErrTimeout) {
+		t.Errorf("err = %v, want ErrTimeout", err)
+	}
+}
+
+func TestGeminiErrorsAreClassified(t *testing.T) {
+	// The Gemini client reports failures as googleapi errors
+	for code, want := range map[int]error{
+		http.StatusUnauthorized:    ErrAuth,
+		http.StatusTooManyRequests: ErrRateLimit,
+		http.StatusGatewayTimeout:  ErrTimeout,
+		http.StatusBadRequest:      nil,
+	} {
+		err := providerError("gemini", fmt.Errorf("gemini chat failed: %w", &googleapi.Error{Code: code, Message: "request failed"}))
+		if got := err.(*ProviderError).Cause; got != want {
+			t.Errorf("status %d: cause = %v, want %v", code, got, want)
+		}
+		if !strings.Contains(err.Error(), "request failed") {
+			t.Errorf("status %d: error = %q, want the original message kept", code, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// FallbackProvider sends each request to the primary provider and, when it
+// fails with an error that another provider could avoid (timeouts, rate
+// limits, 5xx responses, an unreachable server), to each fallback in turn.
+// Every provider gets the same messages and tools, so the agent loop works
+// unchanged whichever one answers.
+type FallbackProvider struct {
+	providers []LLMProvider
+
+	// Notify, if set, is told when a request falls back and which provider
+	// answered it
+	Notify func(msg string)
+}
+
+// NewFallbackProvider tries primary first, then fallbacks in order
+func NewFallbackProvider(primary LLMProvider, fallbacks ...LLMProvider) *FallbackProvider {
+	return &FallbackProvider{providers: append([]LLMProvider{primary}, fallbacks...)}
+}
+
+// Name returns the name of the primary provider
+func (p *FallbackProvider) Name() string {
+	return p.providers[0].Name()
+}
+
+// Model returns the model of the primary provider
+func (p *FallbackProvider) Model() string {
+	return p.providers[0].Model()
+}
+
+// Chat asks each provider in turn until one answers or fails with an error
+// that is not worth falling back for
+func (p *FallbackProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+	var err error
+	for i, provider := range p.providers {
+		if i > 0 {
+			p.notifyFallback(p.providers[i-1], provider, err)
+		}
+		var resp *Message
+		resp, err = provider.Chat(ctx, messages, tools)
+		if err == nil {
+			p.notifyAnswered(i, provider)
+			return resp, nil
+		}
+		if ctx.Err() != nil || !shouldFallBack(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// ChatStream streams the answer of the first provider that can give one.
+// Providers that do not stream answer in a single chunk. Once any text has
+// been streamed, a failure is returned as it is rather than starting over
+// with the next provider.
+func (p *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition) (<-chan StreamChunk, error) {
+	out := make(chan StreamChunk)
+	go func() {
+		defer close(out)
+		var err error
+		for i, provider := range p.providers {
+			if i > 0 {
+				p.notifyFallback(p.providers[i-1], provider, err)
+			}
+			var streamed bool
+			streamed, err = p.stream(ctx, provider, messages, tools, out)
+			if err == nil {
+				p.notifyAnswered(i, provider)
+				return
+			}
+			if streamed || ctx.Err() != nil || !shouldFallBack(err) {
+				break
+			}
+		}
+		out <- StreamChunk{Err: err}
+	}()
+	return out, nil
+}
+
+// stream forwards one provider's answer to out and reports whether any text
+// was forwarded before it failed. A stream that cannot be opened is retried
+// as a regular request, as Agent.chat does.
+func (p *FallbackProvider) stream(ctx context.Context, provider LLMProvider, messages []Message, tools []ToolDefinition, out chan<- StreamChunk) (bool, error) {
+	sp, ok := provider.(StreamingProvider)
+	if ok {
+		chunks, err := sp.ChatStream(ctx, messages, tools)
+		if err == nil {
+			streamed := false
+			for chunk := range chunks {
+				if chunk.Err != nil {
+					return streamed, chunk.Err
+				}
+				out <- chunk
+				streamed = streamed || chunk.Content != ""
+				if chunk.Done {
+					return streamed, nil
+				}
+			}
+			if ctx.Err() != nil {
+				return streamed, ctx.Err()
+			}
+			return streamed, fmt.Errorf("%s stream ended without a response", provider.Name())
+		}
+		if ctx.Err() != nil {
+			return false, err
+		}
+	}
+
+	resp, err := provider.Chat(ctx, messages, tools)
+	if err != nil {
+		return false, err
+	}
+	out <- StreamChunk{Content: resp.Content, Done: true, Message: resp}
+	return false, nil
+}
+
+func (p *FallbackProvider) notifyFallback(failed, next LLMProvider, err error) {
+	if p.Notify != nil {
+		p.Notify(fmt.Sprintf("%s failed (%v); trying %s...", failed.Name(), errorSummary(err), next.Name()))
+	}
+}
+
+func (p *FallbackProvider) notifyAnswered(i int, provider LLMProvider) {
+	if i > 0 && p.Notify != nil {
+		p.Notify(fmt.Sprintf("Answered by fallback provider %s (%s)", provider.Name(), provider.Model()))
+	}
+}
+
+// errorSummary names the cause of a failed request briefly, for status lines
+func errorSummary(err error) string {
+	for _, cause := range []error{ErrTimeout, ErrRateLimit, ErrAuth} {
+		if errors.Is(err, cause) {
+			return cause.Error()
+		}
+	}
+	if code := statusCode(err); code != 0 {
+		return fmt.Sprintf("HTTP %d", code)
+	}
+	return "unreachable"
+}
+
+// shouldFallBack reports whether a failed request might succeed with another
+// provider: the service is slow, rate limited, failing or unreachable.
+// Errors in the request itself, such as a bad key, are not.
+func shouldFallBack(err error) bool {
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrRateLimit) {
+		return true
+	}
+	if code := statusCode(err); code != 0 {
+		return code >= http.StatusInternalServerError
+	}
+	cause := errorCause(err)
+	if cause != nil {
+		return cause == ErrTimeout || cause == ErrRateLimit
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,70 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// anthropicFailing answers every request with an Anthropic error of the
+// given type and counts them
+func anthropicFailing(status int, kind string, requests *int) *HTTPClientFactory {
+	return fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		*requests++
+		return jsonResponse(status, fmt.Sprintf(`{"type":"error","error":{"type":%q,"message":"request failed"}}`, kind)), nil
+	})
+}
+
+const openAIToolReply = `{"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"",
+	"tool_calls":[{"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"hyprland.conf\"}"}}]}}]}`
+
+func TestFallbackAnswersWhenPrimaryFails(t *testing.T) {
+	var failed int
+	primary := NewAnthropicProvider("key", "claude-test", ProviderOptions{MaxRetries: 1, HTTP: anthropicFailing(529, "overloaded_error", &failed)})
+	var bodies [][]byte
+	secondary := NewOpenAIProvider("key", "gpt-test", ProviderOptions{HTTP: captureRequests(openAIToolReply, &bodies)})
+	p := NewFallbackProvider(primary, secondary)
+	var notes []string
+	p.Notify = func(msg string) { notes = append(notes, msg) }
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "What are my gaps?"}}, []ToolDefinition{{Name: "read_file"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 || len(bodies) != 1 {
+		t.Errorf("sent %d request(s) to the primary and %d to the fallback, want 1 each", failed, len(bodies))
+	}
+	// The fallback's tool call comes back as any provider's would
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[0].Function.Name != "read_file" {
+		t.Errorf("response = %+v, want the fallback's read_file call", resp)
+	}
+	want := []string{
+		"anthropic failed (HTTP 529); trying openai...",
+		"Answered by fallback provider openai (gpt-test)",
+	}
+	if !slices.Equal(notes, want) {
+		t.Errorf("notes = %q, want %q", notes, want)
+	}
+	if p.Name() != "anthropic" || p.Model() != "claude-test" {
+		t.Errorf("provider = %s/%s, want the primary's", p.Name(), p.Model())
+	}
+}
+
+func TestFallbackKeepsRequestErrors(t *testing.T) {
+	var failed int
+	primary := NewAnthropicProvider("bad-key", "claude-test", ProviderOptions{MaxRetries: 1, HTTP: anthropicFailing(http.StatusUnauthorized, "authentication_error", &failed)})
+	var bodies [][]byte
+	secondary := NewOpenAIProvider("key", "gpt-test", ProviderOptions{HTTP: captureRequests(openAIToolReply, &bodies)})
+
+	// A bad key is not something another provider can fix
+	_, err := NewFallbackProvider(primary, secondary).Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil)
+	if !errors.Is(err, ErrAuth) {
+		t.Errorf("err = %v, want the primary's auth error", err)
+	}
+	if len(bodies) != 0 {
+		t.Errorf("fell back after an auth error")
+	}
+}
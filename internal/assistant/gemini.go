@@ -13,10 +13,11 @@ import (
 type GeminiProvider struct {
 	client *genai.Client
 	model  string
+	opts   ProviderOptions
 }
 
 // NewGeminiProvider creates a new Gemini provider instance
-func NewGeminiProvider(ctx context.Context, apiKey string, model string) (*GeminiProvider, error) {
+func NewGeminiProvider(ctx context.Context, apiKey string, model string, opts ProviderOptions) (*GeminiProvider, error) {
 	if model == "" {
 		model = "gemini-2.5-pro" // Or whatever the exact string for 2.5 is when released, using placeholder based on request
 	}
@@ -27,11 +28,35 @@ func NewGeminiProvider(ctx context.Context, apiKey string, model string) (*Gemin
 	return &GeminiProvider{
 		client: client,
 		model:  model,
+		opts:   opts.withDefaults(),
 	}, nil
 }
 
-func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+// Name returns the provider identifier
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+// Model returns the model requests are sent to
+func (p *GeminiProvider) Model() string {
+	return p.model
+}
+
+// generativeModel returns the model with the configured generation settings;
+// zero values leave Gemini's defaults
+func (p *GeminiProvider) generativeModel() *genai.GenerativeModel {
 	model := p.client.GenerativeModel(p.model)
+	if p.opts.Temperature > 0 {
+		model.SetTemperature(p.opts.Temperature)
+	}
+	if p.opts.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(p.opts.MaxTokens))
+	}
+	return model
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+	model := p.generativeModel()
 
 	// Convert Tools
 	var toolDecls []*genai.Tool
@@ -41,25 +66,19 @@ func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []T
 		var funcDecls []*genai.FunctionDeclaration
 
 		for _, t := range tools {
-			// We need to manually map the JSON schema parameters to genai.Schema
-			// This is complex as standard JSON schema -> GenAI Schema mapping isn't 1:1 automatic in the SDK
-			// For this MVP, we might need a simplified schema mapper or rely on the fact that GenAI
-			// supports OpenAPI schema objects.
-
-			// NOTE: Proper Schema mapping is significant work.
-			// For now, assuming simple object/string params or using a map workaround?
-			// Actually, genai-go requires structured Schema types.
-			// As a fallback for MVP, we define a "Any" schema or try to parse.
-			// Realistically, we need a helper to convert JSON Schema to genai.Schema.
-
-			// WORKAROUND: Use empty schema (allow anything) if we can't parse easily,
-			// or basic mapping.
-			// Let's implement a basic mapper in a helper function later.
-
 			f := &genai.FunctionDeclaration{
 				Name:        t.Name,
 				Description: t.Description,
-				// Parameters: ... (Skipping complex mapping for brevity, essentially need a converter)
+			}
+
+			// Gemini rejects OBJECT schemas without properties, so tools that
+			// take no arguments are declared without parameters
+			params, err := toGenaiSchema(t.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameter schema for tool %s: %w", t.Name, err)
+			}
+			if params != nil && (params.Type != genai.TypeObject || len(params.Properties) > 0) {
+				f.Parameters = params
 			}
 			funcDecls = append(funcDecls, f)
 		}
@@ -139,9 +158,22 @@ func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []T
 		if lastMsg.Role == "user" {
 			// Pop it
 			cs.History = cs.History[:len(cs.History)-1]
-			resp, err := cs.SendMessage(ctx, lastMsg.Parts...)
+
+			// The genai client brings its own transport (which carries the
+			// API key), so the timeout is applied per attempt instead
+			var resp *genai.GenerateContentResponse
+			attempts, err := withRetries(ctx, p.opts.MaxRetries, func() error {
+				attemptCtx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+				defer cancel()
+				var err error
+				resp, err = cs.SendMessage(attemptCtx, lastMsg.Parts...)
+				return err
+			})
 			if err != nil {
-				return nil, err
+				if ctx.Err() != nil {
+					return nil, providerError("gemini", fmt.Errorf("gemini completion error (context): %w", ctx.Err()))
+				}
+				return nil, providerError("gemini", fmt.Errorf("gemini completion failed after %d attempts: %w", attempts, err))
 			}
 			return p.parseResponse(resp)
 		}
@@ -151,6 +183,93 @@ func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return nil, fmt.Errorf("last message was not from user")
 }
 
+// jsonSchema is the subset of JSON Schema used by tool definitions
+type jsonSchema struct {
+	Type        string                 `json:"type"`
+	Description string                 `json:"description"`
+	Enum        []string               `json:"enum"`
+	Items       *jsonSchema            `json:"items"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Required    []string               `json:"required"`
+}
+
+// toGenaiSchema converts a tool's JSON Schema parameters into a genai.Schema
+func toGenaiSchema(params interface{}) (*genai.Schema, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	var raw []byte
+	switch v := params.(type) {
+	case json.RawMessage:
+		raw = v
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	}
+
+	var js jsonSchema
+	if err := json.Unmarshal(raw, &js); err != nil {
+		return nil, err
+	}
+	return convertSchema(&js)
+}
+
+func convertSchema(js *jsonSchema) (*genai.Schema, error) {
+	schema := &genai.Schema{
+		Description: js.Description,
+		Enum:        js.Enum,
+	}
+
+	switch js.Type {
+	case "object":
+		schema.Type = genai.TypeObject
+		if len(js.Properties) > 0 {
+			schema.Properties = make(map[string]*genai.Schema, len(js.Properties))
+			for name, prop := range js.Properties {
+				converted, err := convertSchema(prop)
+				if err != nil {
+					return nil, fmt.Errorf("property %s: %w", name, err)
+				}
+				schema.Properties[name] = converted
+			}
+		}
+		schema.Required = js.Required
+	case "array":
+		schema.Type = genai.TypeArray
+		if js.Items == nil {
+			return nil, fmt.Errorf("array schema is missing items")
+		}
+		items, err := convertSchema(js.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		schema.Items = items
+	case "string":
+		schema.Type = genai.TypeString
+	case "number":
+		schema.Type = genai.TypeNumber
+	case "integer":
+		schema.Type = genai.TypeInteger
+	case "boolean":
+		schema.Type = genai.TypeBoolean
+	case "":
+		// Untyped schemas are treated as free-form strings
+		schema.Type = genai.TypeString
+	default:
+		return nil, fmt.Errorf("unsupported schema type %q", js.Type)
+	}
+
+	return schema, nil
+}
+
 func (p *GeminiProvider) parseResponse(resp *genai.GenerateContentResponse) (*Message, error) {
 	if len(resp.Candidates) == 0 {
 		return nil, fmt.Errorf("no candidates returned")
@@ -160,6 +279,12 @@ func (p *GeminiProvider) parseResponse(resp *genai.GenerateContentResponse) (*Me
 	result := &Message{
 		Role: RoleAssistant,
 	}
+	if resp.UsageMetadata != nil {
+		result.Usage = &Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		}
+	}
 
 	for _, part := range cand.Content.Parts {
 		if txt, ok := part.(genai.Text); ok {
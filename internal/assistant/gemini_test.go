@@ -0,0 +1,52 @@
+package assistant
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestGeminiSchemaForReadFile(t *testing.T) {
+	schema, err := toGenaiSchema((&ReadFileTool{}).Definition().Parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Type != genai.TypeObject {
+		t.Fatalf("type = %v, want object", schema.Type)
+	}
+	path, ok := schema.Properties["path"]
+	if !ok || path.Type != genai.TypeString {
+		t.Errorf("path property = %+v, want a string", path)
+	}
+	if !slices.Contains(schema.Required, "path") {
+		t.Errorf("required = %v, want path", schema.Required)
+	}
+	if line := schema.Properties["start_line"]; line == nil || line.Type != genai.TypeInteger {
+		t.Errorf("start_line property = %+v, want an integer", line)
+	}
+}
+
+func TestGeminiUsesGenerationSettings(t *testing.T) {
+	p, err := NewGeminiProvider(context.Background(), "key", "gemini-test", ProviderOptions{Temperature: 0.2, MaxTokens: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := p.generativeModel()
+	if model.Temperature == nil || *model.Temperature != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", model.Temperature)
+	}
+	if model.MaxOutputTokens == nil || *model.MaxOutputTokens != 1000 {
+		t.Errorf("max output tokens = %v, want 1000", model.MaxOutputTokens)
+	}
+
+	// Zero values leave Gemini's defaults
+	p, err = NewGeminiProvider(context.Background(), "key", "gemini-test", ProviderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model := p.generativeModel(); model.Temperature != nil || model.MaxOutputTokens != nil {
+		t.Errorf("temperature = %v, max output tokens = %v; want them unset", model.Temperature, model.MaxOutputTokens)
+	}
+}
@@ -0,0 +1,32 @@
+package assistant
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// GroqBaseURL is Groq's OpenAI-compatible API endpoint
+const GroqBaseURL = "https://api.groq.com/openai/v1"
+
+// DefaultGroqModel is used when no Groq model is configured. It supports tool
+// calling, which not every model Groq serves does.
+const DefaultGroqModel = "llama-3.3-70b-versatile"
+
+// NewGroqProvider creates a new OpenAI provider for Groq. Groq accepts the
+// OpenAI chat completions format, tool calls included.
+func NewGroqProvider(apiKey, model string, opts ProviderOptions) *OpenAIProvider {
+	if model == "" {
+		model = DefaultGroqModel
+	}
+	opts = opts.withDefaults()
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = GroqBaseURL
+	config.HTTPClient = opts.httpClient()
+
+	return &OpenAIProvider{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+		name:   "groq",
+		opts:   opts,
+	}
+}
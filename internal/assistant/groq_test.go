@@ -0,0 +1,44 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestGroqRequestsGoToGroq(t *testing.T) {
+	var got *http.Request
+	var body struct {
+		Model string `json:"model"`
+	}
+	groq := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		got = req
+		data, _ := io.ReadAll(req.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		return jsonResponse(http.StatusOK, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"}}]}`), nil
+	})
+	p := NewGroqProvider("gsk_test", "", ProviderOptions{HTTP: groq})
+
+	if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("no request was sent")
+	}
+	if want := "https://api.groq.com/openai/v1/chat/completions"; got.URL.String() != want {
+		t.Errorf("request URL = %s, want %s", got.URL, want)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer gsk_test" {
+		t.Errorf("Authorization header = %q", auth)
+	}
+	if body.Model != DefaultGroqModel {
+		t.Errorf("model sent = %q, want the default %s", body.Model, DefaultGroqModel)
+	}
+	if p.Name() != "groq" || p.Model() != DefaultGroqModel {
+		t.Errorf("provider = %s/%s, want groq/%s", p.Name(), p.Model(), DefaultGroqModel)
+	}
+}
@@ -0,0 +1,78 @@
+package assistant
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for HTTPOptions fields left at zero
+const (
+	DefaultMaxIdleConns    = 10
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// HTTPOptions tunes the connection pool behind an HTTPClientFactory
+type HTTPOptions struct {
+	// MaxIdleConns caps the idle connections kept open, in total and to
+	// each API host
+	MaxIdleConns int
+	// IdleConnTimeout is how long an idle connection is kept for reuse
+	IdleConnTimeout time.Duration
+	// KeepAlive is the TCP keep-alive interval; 0 uses Go's default and a
+	// negative value disables keep-alives
+	KeepAlive time.Duration
+}
+
+// HTTPClientFactory hands out HTTP clients that share one connection pool
+// and TLS session cache, so the providers built from it (a fallback chain, or
+// a provider switched to with /model) reuse connections instead of each
+// dialling and negotiating TLS again. Rate-limit responses are surfaced as
+// RateLimitError so retries can honor their Retry-After header.
+type HTTPClientFactory struct {
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	clients map[time.Duration]*http.Client // One per request timeout
+}
+
+// NewHTTPClientFactory creates a factory with its own connection pool
+func NewHTTPClientFactory(opts HTTPOptions) *HTTPClientFactory {
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: opts.KeepAlive}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        opts.MaxIdleConns,
+		MaxIdleConnsPerHost: opts.MaxIdleConns, // Go keeps only 2 per host by default
+		IdleConnTimeout:     opts.IdleConnTimeout,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(0)},
+	}
+	return &HTTPClientFactory{
+		transport: &retryAfterTransport{base: transport},
+		clients:   make(map[time.Duration]*http.Client),
+	}
+}
+
+// Client returns the client for requests limited to timeout. Every call with
+// the same timeout returns the same client.
+func (f *HTTPClientFactory) Client(timeout time.Duration) *http.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	client, ok := f.clients[timeout]
+	if !ok {
+		client = &http.Client{Timeout: timeout, Transport: f.transport}
+		f.clients[timeout] = client
+	}
+	return client
+}
@@ -0,0 +1,65 @@
+package assistant
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOpenAIFamilyProvidersShareOneClient(t *testing.T) {
+	var hosts []string
+	shared := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		return jsonResponse(http.StatusOK, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"}}]}`), nil
+	})
+	opts := ProviderOptions{HTTP: shared}
+	providers := []LLMProvider{
+		NewOpenAIProvider("key", "gpt-test", opts),
+		NewAzureOpenAIProvider("key", "https://myres.openai.azure.com/", "hypr-gpt4o", "2024-06-01", opts),
+		NewOllamaProvider("http://localhost:11434/v1", "llama3", opts),
+		NewOpenAICompatibleProvider("http://localhost:8000/v1", "key", "mistral", opts),
+		NewGroqProvider("gsk_test", "", opts),
+	}
+
+	// Every provider asked the factory for a client with the same timeout,
+	// so they all got the same one
+	if len(shared.clients) != 1 {
+		t.Fatalf("factory made %d clients, want 1 shared by every provider", len(shared.clients))
+	}
+	if client := shared.Client(DefaultTimeout); shared.Client(DefaultTimeout) != client || client.Timeout != DefaultTimeout {
+		t.Errorf("Client(%s) = %+v, want the same client with that timeout each time", DefaultTimeout, client)
+	}
+
+	for _, p := range providers {
+		if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil); err != nil {
+			t.Fatalf("%s: %v", p.Name(), err)
+		}
+	}
+	want := []string{"api.openai.com", "myres.openai.azure.com", "localhost:11434", "localhost:8000", "api.groq.com"}
+	if !slices.Equal(hosts, want) {
+		t.Errorf("requests went to %q through the shared transport, want %q", hosts, want)
+	}
+
+	// A different timeout gets a client of its own on the same transport
+	if other := shared.Client(time.Minute); other == shared.Client(DefaultTimeout) || other.Transport != shared.transport {
+		t.Errorf("Client(1m) = %+v, want a separate client on the shared transport", other)
+	}
+}
+
+func TestHTTPClientFactoryTunesPool(t *testing.T) {
+	f := NewHTTPClientFactory(HTTPOptions{MaxIdleConns: 4, IdleConnTimeout: time.Minute})
+	transport := f.transport.(*retryAfterTransport).base.(*http.Transport)
+	if transport.MaxIdleConns != 4 || transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("pool = %d idle (%d per host) for %s, want 4 for 1m", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.ClientSessionCache == nil {
+		t.Error("TLS sessions are not cached for reuse")
+	}
+
+	defaults := NewHTTPClientFactory(HTTPOptions{}).transport.(*retryAfterTransport).base.(*http.Transport)
+	if defaults.MaxIdleConns != DefaultMaxIdleConns || defaults.IdleConnTimeout != DefaultIdleConnTimeout {
+		t.Errorf("default pool = %d idle for %s", defaults.MaxIdleConns, defaults.IdleConnTimeout)
+	}
+}
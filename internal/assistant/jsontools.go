@@ -0,0 +1,297 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/reinhart/hyprAgent/internal/logger"
+)
+
+// Tool modes for LLMConfig.ToolMode
+const (
+	ToolModeAuto   = "auto"   // Native until the model turns out to have none, then JSON
+	ToolModeNative = "native" // The provider's own function calling
+	ToolModeJSON   = "json"   // Tool calls written as JSON blocks in the reply
+)
+
+// JSONToolProvider wraps a provider whose model has no function calling. The
+// tools are described in the system prompt and the model asks for one by
+// writing a fenced tool_call block, which is parsed back into ToolCalls, so
+// the agent loop works unchanged.
+type JSONToolProvider struct {
+	LLMProvider
+}
+
+// NewJSONToolProvider wraps provider in the JSON tool protocol
+func NewJSONToolProvider(provider LLMProvider) *JSONToolProvider {
+	return &JSONToolProvider{LLMProvider: provider}
+}
+
+// jsonToolInstructions is appended to the system prompt, followed by the tools
+const jsonToolInstructions = `
+
+TOOLS:
+You cannot call functions directly. To use a tool, reply with a fenced block
+tagged tool_call that contains one JSON object, for example:
+
+` + "```tool_call" + `
+{"name": "read_file", "arguments": {"path": "~/.config/hypr/hyprland.conf"}}
+` + "```" + `
+
+You may write several blocks to call several tools. The results come back in
+the next message. Write no tool_call block when you are ready to answer.
+
+Available tools:
+`
+
+// Chat sends the conversation without native tools and parses any tool_call
+// blocks in the reply
+func (p *JSONToolProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+	return jsonToolChat(ctx, p.LLMProvider, messages, tools)
+}
+
+// jsonToolChat sends the conversation to provider using the JSON tool protocol
+func jsonToolChat(ctx context.Context, provider LLMProvider, messages []Message, tools []ToolDefinition) (*Message, error) {
+	resp, err := provider.Chat(ctx, jsonToolMessages(messages, tools), nil)
+	if err != nil {
+		return nil, err
+	}
+	calls, text := ParseToolCallBlocks(resp.Content)
+	if len(calls) > 0 {
+		resp.ToolCalls = calls
+		resp.Content = text
+	}
+	return resp, nil
+}
+
+// AutoToolProvider uses the provider's function calling until the model shows
+// it has none, then switches to the JSON tool protocol for the rest of the
+// session. A model has none when the provider rejects the tools (Ollama
+// answers "does not support tools") or when it writes a tool_call block for
+// one of the tools instead of making the call; that call is still run.
+type AutoToolProvider struct {
+	LLMProvider
+	json atomic.Bool
+}
+
+// NewAutoToolProvider wraps provider so it falls back to the JSON tool
+// protocol automatically
+func NewAutoToolProvider(provider LLMProvider) *AutoToolProvider {
+	return &AutoToolProvider{LLMProvider: provider}
+}
+
+// UsesJSON reports whether the provider has switched to the JSON protocol
+func (p *AutoToolProvider) UsesJSON() bool {
+	return p.json.Load()
+}
+
+func (p *AutoToolProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+	if p.json.Load() {
+		return jsonToolChat(ctx, p.LLMProvider, messages, tools)
+	}
+	resp, err := p.LLMProvider.Chat(ctx, messages, tools)
+	if err != nil {
+		if len(tools) == 0 || !toolsUnsupported(err) {
+			return nil, err
+		}
+		p.switchToJSON("the provider rejected the tools")
+		return jsonToolChat(ctx, p.LLMProvider, messages, tools)
+	}
+	p.adoptWrittenCalls(resp, tools)
+	return resp, nil
+}
+
+// ChatStream streams as the wrapped provider does while function calling is
+// in use. Replies under the JSON protocol arrive as one chunk, since the
+// tool_call blocks can only be parsed out of the whole text.
+func (p *AutoToolProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition) (<-chan StreamChunk, error) {
+	sp, ok := p.LLMProvider.(StreamingProvider)
+	if !ok || p.json.Load() {
+		return p.singleChunk(ctx, messages, tools), nil
+	}
+	chunks, err := sp.ChatStream(ctx, messages, tools)
+	if err != nil {
+		if len(tools) == 0 || !toolsUnsupported(err) {
+			return nil, err
+		}
+		p.switchToJSON("the provider rejected the tools")
+		return p.singleChunk(ctx, messages, tools), nil
+	}
+
+	out := make(chan StreamChunk)
+	go func() {
+		defer close(out)
+		for chunk := range chunks {
+			if chunk.Err != nil && len(tools) > 0 && toolsUnsupported(chunk.Err) {
+				p.switchToJSON("the provider rejected the tools")
+				for c := range p.singleChunk(ctx, messages, tools) {
+					out <- c
+				}
+				return
+			}
+			if chunk.Done && chunk.Message != nil {
+				p.adoptWrittenCalls(chunk.Message, tools)
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				return
+			}
+			if chunk.Done || chunk.Err != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// singleChunk answers a stream request with one regular request
+func (p *AutoToolProvider) singleChunk(ctx context.Context, messages []Message, tools []ToolDefinition) <-chan StreamChunk {
+	out := make(chan StreamChunk, 1)
+	go func() {
+		defer close(out)
+		resp, err := p.Chat(ctx, messages, tools)
+		if err != nil {
+			out <- StreamChunk{Err: err}
+			return
+		}
+		out <- StreamChunk{Content: resp.Content, Done: true, Message: resp}
+	}()
+	return out
+}
+
+// adoptWrittenCalls turns tool calls the model wrote as text into real ones,
+// switching to the JSON protocol since the model evidently cannot make them
+func (p *AutoToolProvider) adoptWrittenCalls(resp *Message, tools []ToolDefinition) {
+	if len(tools) == 0 || len(resp.ToolCalls) > 0 {
+		return
+	}
+	// An answer can hold a json snippet with a "name" (a waybar module, say),
+	// so only a tool_call block naming one of the tools counts
+	names := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		names[tool.Name] = true
+	}
+	calls, text := parseToolCallBlocks(resp.Content, func(tag, name string) bool {
+		return tag == "tool_call" && names[name]
+	})
+	if len(calls) == 0 {
+		return
+	}
+	p.switchToJSON("the model wrote a tool call as text")
+	resp.ToolCalls = calls
+	resp.Content = text
+}
+
+func (p *AutoToolProvider) switchToJSON(reason string) {
+	if !p.json.Swap(true) {
+		logger.Warn("%s does not seem to support function calling (%s); describing the tools in the prompt instead. Set tool_mode under [llm] to choose explicitly.", p.Model(), reason)
+	}
+}
+
+// toolsUnsupported reports whether err is a provider refusing a request
+// because the model cannot call tools
+func toolsUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"does not support tools", "does not support function", "tools are not supported", "tool use is not supported", "function calling is not supported"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonToolMessages rewrites the conversation for a model without function
+// calling: the tools are listed in the system prompt, earlier tool calls
+// become tool_call blocks and their results become user messages
+func jsonToolMessages(messages []Message, tools []ToolDefinition) []Message {
+	var b strings.Builder
+	b.WriteString(jsonToolInstructions)
+	for _, tool := range tools {
+		params, _ := json.Marshal(tool.Parameters)
+		fmt.Fprintf(&b, "- %s: %s\n  Arguments schema: %s\n", tool.Name, tool.Description, params)
+	}
+	instructions := b.String()
+
+	out := make([]Message, 0, len(messages)+1)
+	if len(messages) == 0 || messages[0].Role != RoleSystem {
+		out = append(out, Message{Role: RoleSystem, Content: strings.TrimSpace(instructions)})
+	}
+	for i, msg := range messages {
+		switch {
+		case msg.Role == RoleSystem && i == 0:
+			out = append(out, Message{Role: RoleSystem, Content: msg.Content + instructions})
+		case msg.Role == RoleAssistant && len(msg.ToolCalls) > 0:
+			content := msg.Content
+			for _, tc := range msg.ToolCalls {
+				content += fmt.Sprintf("\n```tool_call\n{\"name\": %q, \"arguments\": %s}\n```", tc.Function.Name, orEmptyObject(tc.Function.Arguments))
+			}
+			out = append(out, Message{Role: RoleAssistant, Content: strings.TrimSpace(content), Usage: msg.Usage})
+		case msg.Role == RoleTool:
+			out = append(out, Message{Role: RoleUser, Content: fmt.Sprintf("Result of %s:\n%s", msg.Name, msg.Content)})
+		default:
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// toolCallBlock matches a fenced block holding one JSON object. Untagged and
+// json blocks are accepted too, as long as they look like a tool call.
+var toolCallBlock = regexp.MustCompile("(?s)```(tool_call|json)?[ \t]*\n\\s*(\\{.*?\\})\\s*\n?```")
+
+// ParseToolCallBlocks extracts the tool calls a model wrote as fenced JSON
+// blocks, e.g. {"name": "read_file", "arguments": {"path": "..."}}, and
+// returns them with the remaining text. Blocks that are not tool calls are
+// left in the text.
+func ParseToolCallBlocks(text string) ([]ToolCall, string) {
+	return parseToolCallBlocks(text, nil)
+}
+
+// parseToolCallBlocks is ParseToolCallBlocks taking only the calls keep
+// accepts, given the block's tag and the tool named. A nil keep takes all.
+func parseToolCallBlocks(text string, keep func(tag, name string) bool) ([]ToolCall, string) {
+	var calls []ToolCall
+	rest := toolCallBlock.ReplaceAllStringFunc(text, func(block string) string {
+		m := toolCallBlock.FindStringSubmatch(block)
+		var call struct {
+			Name       string          `json:"name"`
+			Arguments  json.RawMessage `json:"arguments"`
+			Parameters json.RawMessage `json:"parameters"` // Used by some models instead of arguments
+		}
+		if err := json.Unmarshal([]byte(m[2]), &call); err != nil || call.Name == "" {
+			return block
+		}
+		if keep != nil && !keep(m[1], call.Name) {
+			return block
+		}
+		args := call.Arguments
+		if len(args) == 0 {
+			args = call.Parameters
+		}
+		// Some models encode the arguments as a JSON string
+		var encoded string
+		if json.Unmarshal(args, &encoded) == nil {
+			args = json.RawMessage(encoded)
+		}
+		calls = append(calls, ToolCall{
+			ID:       fmt.Sprintf("call_%d", len(calls)+1),
+			Type:     "function",
+			Function: FunctionCall{Name: call.Name, Arguments: orEmptyObject(string(args))},
+		})
+		return ""
+	})
+	return calls, strings.TrimSpace(rest)
+}
+
+// orEmptyObject returns args, or {} if there are none
+func orEmptyObject(args string) string {
+	if strings.TrimSpace(args) == "" || strings.TrimSpace(args) == "null" {
+		return "{}"
+	}
+	return args
+}
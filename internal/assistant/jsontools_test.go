@@ -0,0 +1,182 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseToolCallBlocks(t *testing.T) {
+	text := "Let me look at your config first.\n\n" +
+		"```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"hyprland.conf\"}}\n```\n\n" +
+		"```json\n{\"name\": \"search_config\", \"parameters\": \"{\\\"query\\\": \\\"gaps_in\\\"}\"}\n```\n" +
+		"```json\n{\"gaps_in\": 5}\n```"
+
+	calls, rest := ParseToolCallBlocks(text)
+	if len(calls) != 2 {
+		t.Fatalf("got %d calls, want 2: %+v", len(calls), calls)
+	}
+	if calls[0].Function.Name != "read_file" || calls[0].Function.Arguments != `{"path": "hyprland.conf"}` {
+		t.Errorf("first call = %+v", calls[0].Function)
+	}
+	// Arguments given as an encoded string, under "parameters"
+	if calls[1].Function.Name != "search_config" || calls[1].Function.Arguments != `{"query": "gaps_in"}` {
+		t.Errorf("second call = %+v", calls[1].Function)
+	}
+	if calls[0].ID == calls[1].ID {
+		t.Errorf("calls share ID %q", calls[0].ID)
+	}
+	// Text and JSON that is not a tool call are kept
+	if !strings.HasPrefix(rest, "Let me look at your config first.") || !strings.Contains(rest, `{"gaps_in": 5}`) || strings.Contains(rest, "read_file") {
+		t.Errorf("remaining text = %q", rest)
+	}
+}
+
+func TestParseToolCallBlocksWithoutArguments(t *testing.T) {
+	calls, _ := ParseToolCallBlocks("```tool_call\n{\"name\": \"list_snapshots\"}\n```")
+	if len(calls) != 1 || calls[0].Function.Arguments != "{}" {
+		t.Errorf("got %+v, want one call with empty arguments", calls)
+	}
+}
+
+// scriptedProvider answers each request with the next reply, recording
+// whether it was sent any tools
+type scriptedProvider struct {
+	replies   []func(tools []ToolDefinition) (*Message, error)
+	sentTools []bool
+}
+
+func (p *scriptedProvider) Name() string  { return "test" }
+func (p *scriptedProvider) Model() string { return "test-model" }
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
+	p.sentTools = append(p.sentTools, len(tools) > 0)
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return reply(tools)
+}
+
+var testTools = []ToolDefinition{{Name: "read_file"}}
+
+const writtenCall = "```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"hyprland.conf\"}}\n```"
+
+func TestAutoToolProviderSwitchesWhenToolsAreRejected(t *testing.T) {
+	inner := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		func([]ToolDefinition) (*Message, error) {
+			return nil, errors.New(`ollama returned 400: {"error":"registry.ollama.ai/library/gemma:2b does not support tools"}`)
+		},
+		func([]ToolDefinition) (*Message, error) {
+			return &Message{Role: RoleAssistant, Content: writtenCall}, nil
+		},
+		func([]ToolDefinition) (*Message, error) { return &Message{Role: RoleAssistant, Content: "Done."}, nil },
+	}}
+	p := NewAutoToolProvider(inner)
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, testTools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.UsesJSON() || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Function.Name != "read_file" {
+		t.Fatalf("json = %v, response = %+v; want the JSON protocol and a read_file call", p.UsesJSON(), resp)
+	}
+	// Later requests go straight to the JSON protocol
+	if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, testTools); err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{true, false, false}; !slices.Equal(inner.sentTools, want) {
+		t.Errorf("tools sent = %v, want %v", inner.sentTools, want)
+	}
+}
+
+func TestAutoToolProviderSwitchesWhenCallsAreWrittenOut(t *testing.T) {
+	inner := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		func([]ToolDefinition) (*Message, error) {
+			return &Message{Role: RoleAssistant, Content: "I will read it.\n" + writtenCall}, nil
+		},
+	}}
+	p := NewAutoToolProvider(inner)
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, testTools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.UsesJSON() || len(resp.ToolCalls) != 1 || resp.Content != "I will read it." {
+		t.Errorf("json = %v, response = %+v; want the written call run and the JSON protocol used from now on", p.UsesJSON(), resp)
+	}
+}
+
+func TestAutoToolProviderLeavesJSONSnippetsAlone(t *testing.T) {
+	const answer = "Add this module to your waybar config:\n```json\n{\"name\": \"clock\", \"format\": \"{:%H:%M}\"}\n```"
+	for _, content := range []string{
+		answer,
+		// Tagged, but not one of the tools
+		"```tool_call\n{\"name\": \"clock\", \"arguments\": {}}\n```",
+	} {
+		inner := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+			func([]ToolDefinition) (*Message, error) { return &Message{Role: RoleAssistant, Content: content}, nil },
+		}}
+		p := NewAutoToolProvider(inner)
+
+		resp, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, testTools)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.UsesJSON() || len(resp.ToolCalls) > 0 || resp.Content != content {
+			t.Errorf("json = %v, response = %+v; want %q left as the answer", p.UsesJSON(), resp, content)
+		}
+	}
+}
+
+func TestAutoToolProviderKeepsNativeCalls(t *testing.T) {
+	inner := &scriptedProvider{replies: []func([]ToolDefinition) (*Message, error){
+		func([]ToolDefinition) (*Message, error) {
+			return &Message{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "1", Function: FunctionCall{Name: "read_file", Arguments: "{}"}}}}, nil
+		},
+		func([]ToolDefinition) (*Message, error) { return nil, errors.New("rate limited") },
+	}}
+	p := NewAutoToolProvider(inner)
+
+	if _, err := p.Chat(context.Background(), nil, testTools); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chat(context.Background(), nil, testTools); err == nil {
+		t.Error("expected other errors to be returned")
+	}
+	if p.UsesJSON() {
+		t.Error("switched to the JSON protocol for a model with function calling")
+	}
+}
+
+// streamingProvider streams its reply in two chunks
+type streamingProvider struct {
+	scriptedProvider
+	reply string
+}
+
+func (p *streamingProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition) (<-chan StreamChunk, error) {
+	out := make(chan StreamChunk, 2)
+	half := len(p.reply) / 2
+	out <- StreamChunk{Content: p.reply[:half]}
+	out <- StreamChunk{Content: p.reply[half:], Done: true, Message: &Message{Role: RoleAssistant, Content: p.reply}}
+	close(out)
+	return out, nil
+}
+
+func TestAutoToolProviderStreamAdoptsWrittenCalls(t *testing.T) {
+	p := NewAutoToolProvider(&streamingProvider{reply: writtenCall})
+	chunks, err := p.ChatStream(context.Background(), nil, testTools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var final *Message
+	for chunk := range chunks {
+		if chunk.Done {
+			final = chunk.Message
+		}
+	}
+	if final == nil || len(final.ToolCalls) != 1 || !p.UsesJSON() {
+		t.Errorf("final message = %+v, json = %v; want the written call adopted", final, p.UsesJSON())
+	}
+}
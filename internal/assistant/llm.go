@@ -2,6 +2,8 @@ package assistant
 
 import (
 	"context"
+	"net/http"
+	"time"
 )
 
 // Role represents the role of a message sender
@@ -21,6 +23,18 @@ type Message struct {
 	Name       string // Optional, used for tool responses
 	ToolCalls  []ToolCall
 	ToolCallID string // Used when Role is Tool to link back to the call
+	Usage      *Usage // Token usage reported by the provider (assistant responses only)
+}
+
+// Usage holds the token counts reported by a provider for a single request
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Total returns the prompt and completion tokens combined
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
 }
 
 // ToolCall represents a request from the LLM to execute a tool
@@ -45,8 +59,70 @@ type ToolDefinition struct {
 
 // LLMProvider defines the interface for interacting with LLM backends
 type LLMProvider interface {
+	// Name returns a short identifier for the provider (e.g. "openai", "anthropic")
+	Name() string
+
+	// Model returns the model (or deployment) ID requests are sent to
+	Model() string
+
 	// Chat sends messages to the LLM and returns the response, potentially including tool calls
 	Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error)
 }
 
+// StreamChunk is one piece of a streamed response
+type StreamChunk struct {
+	Content string   // Incremental text
+	Done    bool     // Set on the final chunk
+	Message *Message // Assembled response, only on the final chunk
+	Err     error    // Set if the stream failed; no further chunks follow
+}
+
+// StreamingProvider is implemented by providers that can stream responses
+type StreamingProvider interface {
+	LLMProvider
+
+	// ChatStream behaves like Chat but delivers text incrementally. The
+	// channel is closed after the final chunk or an error.
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition) (<-chan StreamChunk, error)
+}
+
+// Defaults for ProviderOptions fields left at zero
+const (
+	DefaultTimeout    = 120 * time.Second
+	DefaultMaxRetries = 3
+)
 
+// ProviderOptions tunes how a provider talks to its API
+type ProviderOptions struct {
+	Timeout    time.Duration // Limit for a single request
+	MaxRetries int           // Attempts per request, including the first
+	// Temperature and MaxTokens shape each response; zero leaves the
+	// provider's default
+	Temperature float32
+	MaxTokens   int
+	// PromptCaching marks the system prompt and tools as cacheable, for
+	// providers that support it (Anthropic, Bedrock)
+	PromptCaching bool
+	// HTTP supplies the provider's HTTP client. Providers built from the same
+	// factory share its connections; nil gives the provider a pool of its own.
+	HTTP *HTTPClientFactory
+}
+
+// withDefaults fills in zero fields
+func (o ProviderOptions) withDefaults() ProviderOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = DefaultMaxRetries
+	}
+	if o.HTTP == nil {
+		o.HTTP = NewHTTPClientFactory(HTTPOptions{})
+	}
+	return o
+}
+
+// httpClient returns the client for the provider's API requests
+func (o ProviderOptions) httpClient() *http.Client {
+	return o.HTTP.Client(o.Timeout)
+}
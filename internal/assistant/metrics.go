@@ -0,0 +1,100 @@
+package assistant
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RequestSample records the outcome of a single LLM request
+type RequestSample struct {
+	Latency          time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	Failed           bool
+}
+
+// ProviderStats summarises the samples collected for one provider
+type ProviderStats struct {
+	Provider        string
+	Requests        int
+	Failures        int
+	AvgLatency      time.Duration
+	P50Latency      time.Duration
+	P95Latency      time.Duration
+	TokensPerSecond float64 // Completion tokens per second of request latency
+}
+
+// Metrics is a lightweight in-memory collector of per-provider request latency.
+// It only lives for the current session and is safe for concurrent use.
+type Metrics struct {
+	mu      sync.Mutex
+	samples map[string][]RequestSample
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		samples: make(map[string][]RequestSample),
+	}
+}
+
+// Record adds a sample for the given provider
+func (m *Metrics) Record(provider string, sample RequestSample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples[provider] = append(m.samples[provider], sample)
+}
+
+// Stats returns aggregated statistics per provider, sorted by provider name
+func (m *Metrics) Stats() []ProviderStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats []ProviderStats
+	for provider, samples := range m.samples {
+		st := ProviderStats{Provider: provider, Requests: len(samples)}
+
+		var latencies []time.Duration
+		var total time.Duration
+		var completionTokens int
+		for _, s := range samples {
+			if s.Failed {
+				st.Failures++
+				continue
+			}
+			latencies = append(latencies, s.Latency)
+			total += s.Latency
+			completionTokens += s.CompletionTokens
+		}
+
+		if len(latencies) > 0 {
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			st.AvgLatency = total / time.Duration(len(latencies))
+			st.P50Latency = percentile(latencies, 0.50)
+			st.P95Latency = percentile(latencies, 0.95)
+			if total > 0 {
+				st.TokensPerSecond = float64(completionTokens) / total.Seconds()
+			}
+		}
+		stats = append(stats, st)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Provider < stats[j].Provider })
+	return stats
+}
+
+// percentile picks the nearest-rank percentile from an ascending slice
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
@@ -5,20 +5,41 @@ import (
 )
 
 // NewOllamaProvider creates a new OpenAI provider configured for local Ollama
-func NewOllamaProvider(host string, model string) *OpenAIProvider {
+func NewOllamaProvider(host string, model string, opts ProviderOptions) *OpenAIProvider {
 	if host == "" {
 		host = "http://localhost:11434/v1"
 	}
 	if model == "" {
 		model = "llama3" // Default to a reasonable local model
 	}
+	opts = opts.withDefaults()
 
 	config := openai.DefaultConfig("ollama") // API Key is ignored by Ollama usually
 	config.BaseURL = host
+	config.HTTPClient = opts.httpClient()
 
 	// Initialize the OpenAIProvider with a new client based on the config
 	return &OpenAIProvider{
 		client: openai.NewClientWithConfig(config),
 		model:  model,
+		name:   "ollama",
+		opts:   opts,
+	}
+}
+
+// NewOpenAICompatibleProvider creates a new OpenAI provider for any server that
+// implements the OpenAI chat completions API (Mistral, vLLM, LM Studio, ...)
+func NewOpenAICompatibleProvider(baseURL, apiKey, model string, opts ProviderOptions) *OpenAIProvider {
+	opts = opts.withDefaults()
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	config.HTTPClient = opts.httpClient()
+
+	return &OpenAIProvider{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+		name:   "openai-compatible",
+		opts:   opts,
 	}
 }
@@ -0,0 +1,40 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestOpenAICompatibleUsesBaseURLAndModel(t *testing.T) {
+	var url, auth string
+	var body struct {
+		Model string `json:"model"`
+	}
+	server := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		url, auth = req.URL.String(), req.Header.Get("Authorization")
+		data, _ := io.ReadAll(req.Body)
+		json.Unmarshal(data, &body)
+		return jsonResponse(http.StatusOK, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Bonjour"}}]}`), nil
+	})
+	p := NewOpenAICompatibleProvider("https://api.mistral.ai/v1", "mistral-key", "mistral-large-latest", ProviderOptions{HTTP: server})
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Bonjour" {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if url != "https://api.mistral.ai/v1/chat/completions" {
+		t.Errorf("request URL = %s", url)
+	}
+	if body.Model != "mistral-large-latest" || p.Model() != "mistral-large-latest" {
+		t.Errorf("model = %q in the request, %q on the provider", body.Model, p.Model())
+	}
+	if auth != "Bearer mistral-key" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
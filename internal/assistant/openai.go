@@ -2,9 +2,11 @@ package assistant
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"time"
+	"io"
+	"sort"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -13,151 +15,262 @@ import (
 type OpenAIProvider struct {
 	client *openai.Client
 	model  string
+	name   string
+	opts   ProviderOptions
 }
 
 // NewOpenAIProvider creates a new OpenAI provider instance
-func NewOpenAIProvider(apiKey string, model string) *OpenAIProvider {
+func NewOpenAIProvider(apiKey string, model string, opts ProviderOptions) *OpenAIProvider {
 	if model == "" {
 		model = openai.GPT5Mini
 	}
-
-	// Create HTTP client with proper timeouts
-	httpClient := &http.Client{
-		Timeout: 120 * time.Second, // 2 minute timeout for API calls
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     90 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
-		},
-	}
+	opts = opts.withDefaults()
 
 	config := openai.DefaultConfig(apiKey)
-	config.HTTPClient = httpClient
+	config.HTTPClient = opts.httpClient()
 
 	return &OpenAIProvider{
 		client: openai.NewClientWithConfig(config),
 		model:  model,
+		name:   "openai",
+		opts:   opts,
 	}
 }
 
+// Name returns the provider identifier
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+// Model returns the model requests are sent to
+func (p *OpenAIProvider) Model() string {
+	return p.model
+}
+
 // Chat sends messages to the LLM and returns the response
 func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition) (*Message, error) {
-	const maxRetries = 3
-	var lastErr error
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			// Simple exponential backoff: 1s, 2s, 4s
-			time.Sleep(time.Duration(1<<attempt) * time.Second)
+	var result *Message
+	attempts, err := withRetries(ctx, p.opts.MaxRetries, func() error {
+		resp, err := p.client.CreateChatCompletion(ctx, p.buildRequest(messages, tools))
+		if err != nil {
+			return err
+		}
+		if len(resp.Choices) == 0 {
+			return fmt.Errorf("no choices returned")
 		}
 
-		apiMessages := make([]openai.ChatCompletionMessage, len(messages))
-		for i, msg := range messages {
-			role := openai.ChatMessageRoleUser
-			switch msg.Role {
-			case RoleSystem:
-				role = openai.ChatMessageRoleSystem
-			case RoleAssistant:
-				role = openai.ChatMessageRoleAssistant
-			case RoleTool:
-				role = openai.ChatMessageRoleTool
-			}
+		msg := resp.Choices[0].Message
+		result = &Message{
+			Role:    RoleAssistant, // OpenAI responses are always assistant
+			Content: msg.Content,
+			Usage: &Usage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+			},
+		}
 
-			var toolCalls []openai.ToolCall
-			if len(msg.ToolCalls) > 0 {
-				toolCalls = make([]openai.ToolCall, len(msg.ToolCalls))
-				for j, tc := range msg.ToolCalls {
-					toolCalls[j] = openai.ToolCall{
-						ID:   tc.ID,
-						Type: openai.ToolType(tc.Type),
-						Function: openai.FunctionCall{
-							Name:      tc.Function.Name,
-							Arguments: tc.Function.Arguments,
-						},
-					}
+		if len(msg.ToolCalls) > 0 {
+			result.ToolCalls = make([]ToolCall, len(msg.ToolCalls))
+			for i, tc := range msg.ToolCalls {
+				result.ToolCalls[i] = ToolCall{
+					ID:   tc.ID,
+					Type: string(tc.Type),
+					Function: FunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					},
 				}
 			}
+		}
+		return nil
+	})
+	if err != nil {
+		// If context canceled or deadline exceeded, retrying stopped immediately
+		if ctx.Err() != nil {
+			return nil, providerError(p.name, fmt.Errorf("openai completion error (context): %w", ctx.Err()))
+		}
+		return nil, providerError(p.name, fmt.Errorf("openai completion failed after %d attempts: %w", attempts, err))
+	}
+	return result, nil
+}
 
-			// Fix: OpenAI requires Content to be non-null for Assistant messages,
-			// unless there are tool calls. However, some messages might just be empty tool results?
-			// No, actually, if Role is Assistant and it has ToolCalls, Content can be null.
-			// BUT, if Role is Tool, Content CANNOT be null.
-			content := msg.Content
-			if role == openai.ChatMessageRoleTool && content == "" {
-				content = "{}" // Return empty JSON object if content is empty for tool
-			}
-			// Also, for Assistant role, if ToolCalls is present, Content is optional in API but
-			// the Go library might treat empty string as "" which is fine.
-			// The error "Invalid value for 'content': expected a string, got null" often comes
-			// from sending nil where a string is expected, or vice versa.
-			// The go-openai library handles string fields, so empty string is "".
-			// However, if the previous assistant message had tool calls and NO content, we must ensure
-			// we send it back exactly like that.
-
-			apiMessages[i] = openai.ChatCompletionMessage{
-				Role:       role,
-				Content:    content,
-				Name:       msg.Name,
-				ToolCalls:  toolCalls,
-				ToolCallID: msg.ToolCallID,
-			}
+// buildRequest converts the conversation and tools into an OpenAI request
+func (p *OpenAIProvider) buildRequest(messages []Message, tools []ToolDefinition) openai.ChatCompletionRequest {
+	apiMessages := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		role := openai.ChatMessageRoleUser
+		switch msg.Role {
+		case RoleSystem:
+			role = openai.ChatMessageRoleSystem
+		case RoleAssistant:
+			role = openai.ChatMessageRoleAssistant
+		case RoleTool:
+			role = openai.ChatMessageRoleTool
 		}
 
-		var apiTools []openai.Tool
-		if len(tools) > 0 {
-			apiTools = make([]openai.Tool, len(tools))
-			for i, t := range tools {
-				apiTools[i] = openai.Tool{
-					Type: openai.ToolTypeFunction,
-					Function: &openai.FunctionDefinition{
-						Name:        t.Name,
-						Description: t.Description,
-						Parameters:  t.Parameters,
+		var toolCalls []openai.ToolCall
+		if len(msg.ToolCalls) > 0 {
+			toolCalls = make([]openai.ToolCall, len(msg.ToolCalls))
+			for j, tc := range msg.ToolCalls {
+				toolCalls[j] = openai.ToolCall{
+					ID:   tc.ID,
+					Type: openai.ToolType(tc.Type),
+					Function: openai.FunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
 					},
 				}
 			}
 		}
 
-		req := openai.ChatCompletionRequest{
-			Model:    p.model,
-			Messages: apiMessages,
-			Tools:    apiTools,
+		// Fix: OpenAI requires Content to be non-null for Assistant messages,
+		// unless there are tool calls. However, some messages might just be empty tool results?
+		// No, actually, if Role is Assistant and it has ToolCalls, Content can be null.
+		// BUT, if Role is Tool, Content CANNOT be null.
+		content := msg.Content
+		if role == openai.ChatMessageRoleTool && content == "" {
+			content = "{}" // Return empty JSON object if content is empty for tool
 		}
+		// Also, for Assistant role, if ToolCalls is present, Content is optional in API but
+		// the Go library might treat empty string as "" which is fine.
+		// The error "Invalid value for 'content': expected a string, got null" often comes
+		// from sending nil where a string is expected, or vice versa.
+		// The go-openai library handles string fields, so empty string is "".
+		// However, if the previous assistant message had tool calls and NO content, we must ensure
+		// we send it back exactly like that.
 
-		resp, err := p.client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			lastErr = err
-			// If context canceled or deadline exceeded, stop retrying immediately
-			if ctx.Err() != nil {
-				return nil, fmt.Errorf("openai completion error (context): %w", ctx.Err())
+		apiMessages[i] = openai.ChatCompletionMessage{
+			Role:       role,
+			Content:    content,
+			Name:       msg.Name,
+			ToolCalls:  toolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+	}
+
+	var apiTools []openai.Tool
+	if len(tools) > 0 {
+		apiTools = make([]openai.Tool, len(tools))
+		for i, t := range tools {
+			apiTools[i] = openai.Tool{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        t.Name,
+					Description: t.Description,
+					Parameters:  t.Parameters,
+				},
 			}
-			continue // Retry on other errors
 		}
+	}
 
-		choice := resp.Choices[0]
-		msg := choice.Message
+	req := openai.ChatCompletionRequest{
+		Model:       p.model,
+		Messages:    apiMessages,
+		Tools:       apiTools,
+		Temperature: p.opts.Temperature, // Zero is omitted from the request
+	}
+	if p.name == "openai" {
+		// Newer OpenAI models reject max_tokens
+		req.MaxCompletionTokens = p.opts.MaxTokens
+	} else {
+		req.MaxTokens = p.opts.MaxTokens
+	}
+	return req
+}
 
-		result := &Message{
-			Role:    RoleAssistant, // OpenAI responses are always assistant
-			Content: msg.Content,
+// ChatStream sends messages to the LLM and streams the response. Content
+// deltas arrive as chunks; the last chunk has Done set and carries the
+// assembled message, including any tool calls.
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition) (<-chan StreamChunk, error) {
+	req := p.buildRequest(messages, tools)
+	req.Stream = true
+	if p.name == "openai" {
+		// Not every OpenAI-compatible server understands stream_options
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, providerError(p.name, fmt.Errorf("%s stream error: %w", p.name, err))
+	}
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer stream.Close()
+
+		send := func(c StreamChunk) bool {
+			select {
+			case chunks <- c:
+				return true
+			case <-ctx.Done():
+				return false
+			}
 		}
 
-		if len(msg.ToolCalls) > 0 {
-			result.ToolCalls = make([]ToolCall, len(msg.ToolCalls))
-			for i, tc := range msg.ToolCalls {
-				result.ToolCalls[i] = ToolCall{
-					ID:   tc.ID,
-					Type: string(tc.Type),
-					Function: FunctionCall{
-						Name:      tc.Function.Name,
-						Arguments: tc.Function.Arguments,
-					},
+		result := &Message{Role: RoleAssistant}
+		var content strings.Builder
+		calls := make(map[int]*ToolCall)
+		var order []int
+
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				send(StreamChunk{Err: providerError(p.name, fmt.Errorf("%s stream error: %w", p.name, err))})
+				return
+			}
+
+			if resp.Usage != nil {
+				result.Usage = &Usage{
+					PromptTokens:     resp.Usage.PromptTokens,
+					CompletionTokens: resp.Usage.CompletionTokens,
+				}
+			}
+			if len(resp.Choices) == 0 {
+				continue
+			}
+
+			delta := resp.Choices[0].Delta
+			if delta.Content != "" {
+				content.WriteString(delta.Content)
+				if !send(StreamChunk{Content: delta.Content}) {
+					return
 				}
 			}
+
+			// Tool calls arrive in fragments keyed by index
+			for _, tc := range delta.ToolCalls {
+				idx := 0
+				if tc.Index != nil {
+					idx = *tc.Index
+				}
+				call, ok := calls[idx]
+				if !ok {
+					call = &ToolCall{Type: string(openai.ToolTypeFunction)}
+					calls[idx] = call
+					order = append(order, idx)
+				}
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Type != "" {
+					call.Type = string(tc.Type)
+				}
+				call.Function.Name += tc.Function.Name
+				call.Function.Arguments += tc.Function.Arguments
+			}
 		}
 
-		return result, nil
-	}
+		result.Content = content.String()
+		sort.Ints(order)
+		for _, idx := range order {
+			result.ToolCalls = append(result.ToolCalls, *calls[idx])
+		}
+		send(StreamChunk{Done: true, Message: result})
+	}()
 
-	return nil, fmt.Errorf("openai completion failed after %d attempts: %w", maxRetries, lastErr)
+	return chunks, nil
 }
@@ -0,0 +1,87 @@
+package assistant
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sseResponse streams events as server-sent events, ending with [DONE]
+func sseResponse(events ...string) *http.Response {
+	var body strings.Builder
+	for _, e := range events {
+		body.WriteString("data: " + e + "\n\n")
+	}
+	body.WriteString("data: [DONE]\n\n")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body.String())),
+	}
+}
+
+func TestOpenAIStreamAssemblesChunksInOrder(t *testing.T) {
+	stream := fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		return sseResponse(
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Let me "}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"check your "}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"gaps."}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"pa"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"hyprland.conf\"}"}}]}}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":30,"completion_tokens":12,"total_tokens":42}}`,
+		), nil
+	})
+	p := NewOpenAIProvider("key", "gpt-test", ProviderOptions{HTTP: stream})
+
+	chunks, err := p.ChatStream(context.Background(), []Message{{Role: RoleUser, Content: "What are my gaps?"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	var final *Message
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			t.Fatal(chunk.Err)
+		}
+		if chunk.Content != "" {
+			texts = append(texts, chunk.Content)
+		}
+		if chunk.Done {
+			final = chunk.Message
+		}
+	}
+
+	if got := strings.Join(texts, "|"); got != "Let me |check your |gaps." {
+		t.Errorf("chunks = %q, want them in order", got)
+	}
+	if final == nil {
+		t.Fatal("stream ended without a final message")
+	}
+	if final.Content != "Let me check your gaps." {
+		t.Errorf("final content = %q", final.Content)
+	}
+	if len(final.ToolCalls) != 1 || final.ToolCalls[0].ID != "call_1" || final.ToolCalls[0].Function.Arguments != `{"path":"hyprland.conf"}` {
+		t.Errorf("tool calls = %+v, want the fragments joined", final.ToolCalls)
+	}
+	if final.Usage == nil || final.Usage.Total() != 42 {
+		t.Errorf("usage = %+v, want 42 tokens", final.Usage)
+	}
+}
+
+func TestOpenAIRequestUsesGenerationSettings(t *testing.T) {
+	opts := ProviderOptions{Temperature: 0.2, MaxTokens: 1000}
+	messages := []Message{{Role: RoleUser, Content: "Set gaps to 5"}}
+
+	req := NewOpenAIProvider("key", "gpt-test", opts).buildRequest(messages, nil)
+	if req.Temperature != 0.2 || req.MaxCompletionTokens != 1000 || req.MaxTokens != 0 {
+		t.Errorf("openai request: temperature = %v, max_completion_tokens = %d, max_tokens = %d", req.Temperature, req.MaxCompletionTokens, req.MaxTokens)
+	}
+	// Compatible servers still take max_tokens
+	req = NewOpenAICompatibleProvider("http://localhost:11434/v1", "", "llama3", opts).buildRequest(messages, nil)
+	if req.Temperature != 0.2 || req.MaxTokens != 1000 || req.MaxCompletionTokens != 0 {
+		t.Errorf("compatible request: temperature = %v, max_tokens = %d, max_completion_tokens = %d", req.Temperature, req.MaxTokens, req.MaxCompletionTokens)
+	}
+}
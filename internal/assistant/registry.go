@@ -1,18 +1,44 @@
 package assistant
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/reinhart/hyprAgent/internal/safety"
 )
 
+// ConfigLockWait is how long a mutating tool waits for another instance to
+// finish its change before giving up
+const ConfigLockWait = 5 * time.Second
+
 // Tool defines the interface for a tool
 type Tool interface {
 	Definition() ToolDefinition
 	Execute(args string) (string, error)
 }
 
+// ContextTool is implemented by tools that do slow IO (commands, network).
+// The agent calls ExecuteContext instead of Execute, and ctx ends when the
+// tool times out or the request is cancelled.
+type ContextTool interface {
+	Tool
+	ExecuteContext(ctx context.Context, args string) (string, error)
+}
+
+// MutatingTool is implemented by tools that change files or session state.
+// The agent never runs them concurrently with other tools.
+type MutatingTool interface {
+	Tool
+	Mutating() bool
+}
+
 // ToolRegistry manages the available tools
 type ToolRegistry struct {
 	tools map[string]Tool
+	lock  *safety.ConfigLock // Held while a mutating tool runs; nil disables it
 }
 
 // NewToolRegistry creates a new tool registry
@@ -33,6 +59,50 @@ func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	return t, ok
 }
 
+// Call runs the named tool with the given JSON arguments, turning a panic in
+// the tool into an error
+func (r *ToolRegistry) Call(name, args string) (string, error) {
+	t, ok := r.tools[name]
+	if !ok {
+		return "", fmt.Errorf("tool %s not found", name)
+	}
+	return r.run(context.Background(), t, name, args)
+}
+
+// SetLock makes mutating tools run only while lock is held, so that another
+// hyprAgent instance cannot change the same files at the same time
+func (r *ToolRegistry) SetLock(lock *safety.ConfigLock) {
+	r.lock = lock
+}
+
+// run runs a tool, holding the config lock if it is a mutating one
+func (r *ToolRegistry) run(ctx context.Context, t Tool, name, args string) (string, error) {
+	if r.IsMutating(name) {
+		release, err := r.lock.Acquire(ConfigLockWait)
+		if err != nil {
+			return "", err
+		}
+		defer release()
+	}
+	return runTool(ctx, t, name, args)
+}
+
+// IsMutating reports whether the named tool changes files or session state
+func (r *ToolRegistry) IsMutating(name string) bool {
+	t, ok := r.tools[name].(MutatingTool)
+	return ok && t.Mutating()
+}
+
+// Names returns the names of all registered tools, sorted
+func (r *ToolRegistry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Definitions returns the definitions of all registered tools
 func (r *ToolRegistry) Definitions() []ToolDefinition {
 	defs := make([]ToolDefinition, 0, len(r.tools))
@@ -0,0 +1,95 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitError is returned for a 429 response that says how long to wait
+// before retrying
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *RateLimitError) Error() string {
+	msg := fmt.Sprintf("rate limited (retry after %s)", e.RetryAfter)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// retryAfterTransport turns 429 responses carrying a Retry-After header into a
+// RateLimitError. The provider SDKs only expose the status and body of failed
+// requests, so this is the one place the header can still be read.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return resp, nil // Let the SDK report the error and fall back to backoff
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return nil, &RateLimitError{RetryAfter: wait, Body: strings.TrimSpace(string(body))}
+}
+
+// parseRetryAfter reads a Retry-After value, given either in seconds or as an
+// HTTP-date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// withRetries calls fn up to maxRetries times, stopping early once ctx is
+// done. Between attempts it waits for as long as a RateLimitError asks, or
+// otherwise backs off exponentially (2s, 4s, 8s, ...). It returns the number
+// of attempts made and the last error.
+func withRetries(ctx context.Context, maxRetries int, fn func() error) (int, error) {
+	var err error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(1<<attempt) * time.Second
+			var rateLimited *RateLimitError
+			if errors.As(err, &rateLimited) {
+				wait = rateLimited.RetryAfter
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return attempt, err
+			}
+		}
+		if err = fn(); err == nil || ctx.Err() != nil {
+			return attempt + 1, err
+		}
+	}
+	return maxRetries, err
+}
@@ -0,0 +1,91 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failingHTTP answers every request with status and counts them
+func failingHTTP(status int, header http.Header, requests *int) *HTTPClientFactory {
+	return fakeHTTP(func(req *http.Request) (*http.Response, error) {
+		*requests++
+		resp := jsonResponse(status, `{"error":{"message":"try again later","type":"server_error"}}`)
+		for k, v := range header {
+			resp.Header[k] = v
+		}
+		return resp, nil
+	})
+}
+
+func TestMaxRetriesOneAttemptsOnce(t *testing.T) {
+	var requests int
+	p := NewOpenAIProvider("key", "gpt-test", ProviderOptions{MaxRetries: 1, HTTP: failingHTTP(http.StatusInternalServerError, nil, &requests)})
+
+	if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil); err == nil {
+		t.Fatal("Chat succeeded against a failing server")
+	}
+	if requests != 1 {
+		t.Errorf("sent %d requests, want 1", requests)
+	}
+}
+
+func TestRateLimitCarriesRetryAfter(t *testing.T) {
+	var requests int
+	limited := failingHTTP(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"5"}}, &requests)
+	p := NewOpenAIProvider("key", "gpt-test", ProviderOptions{MaxRetries: 1, HTTP: limited})
+
+	_, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil)
+	var rateLimited *RateLimitError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if rateLimited.RetryAfter != 5*time.Second {
+		t.Errorf("RetryAfter = %s, want 5s", rateLimited.RetryAfter)
+	}
+	if !errors.Is(err, ErrRateLimit) {
+		t.Errorf("err = %v, want it classified as ErrRateLimit", err)
+	}
+}
+
+func TestRetriesWaitForRetryAfter(t *testing.T) {
+	// Shorter than the 2s backoff of the first retry, so the test stays quick
+	// and a wait of the wrong length shows
+	const retryAfter = time.Second
+	var attempts []time.Time
+	start := time.Now()
+	n, err := withRetries(context.Background(), 2, func() error {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			return &RateLimitError{RetryAfter: retryAfter}
+		}
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("withRetries() = %d, %v; want success on the second attempt", n, err)
+	}
+	if wait := attempts[1].Sub(start); wait < retryAfter || wait >= 2*time.Second {
+		t.Errorf("retried after %s, want %s", wait, retryAfter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"5", 5 * time.Second, true},
+		{"Sun, 01 Mar 2026 12:00:30 GMT", 30 * time.Second, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	} {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -1,16 +1,23 @@
 package assistant
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 	"unicode/utf8"
 
 	"github.com/reinhart/hyprAgent/internal/configuration"
+	"github.com/reinhart/hyprAgent/internal/hyprctl"
 	"github.com/reinhart/hyprAgent/internal/safety"
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -20,7 +27,7 @@ import (
 // --- Discovery Tools ---
 
 type DetectRootTool struct {
-	Backends []configuration.ConfigBackend
+	Backends []configuration.ConfigBackend // The active backend comes first
 }
 
 func (t *DetectRootTool) Definition() ToolDefinition {
@@ -36,38 +43,243 @@ func (t *DetectRootTool) Definition() ToolDefinition {
 }
 
 func (t *DetectRootTool) Execute(args string) (string, error) {
+	detected := configuration.DetectBackends(t.Backends)
+	if len(detected) == 0 {
+		return `{"type": "unknown"}`, nil
+	}
+
+	// Backends are ordered with the one in use first
+	sources, _ := detected[0].ListSources()
+	result := struct {
+		Type         configuration.ConfigSourceType   `json:"type"`
+		Sources      []string                         `json:"sources"`
+		AlsoDetected []configuration.ConfigSourceType `json:"also_detected,omitempty"`
+	}{Type: detected[0].Type(), Sources: sources}
+	for _, b := range detected[1:] {
+		result.AlsoDetected = append(result.AlsoDetected, b.Type())
+	}
+	return marshalResult(result)
+}
+
+type GatherContextTool struct {
+	Config   *configuration.Config
+	Backends []configuration.ConfigBackend
+}
+
+type contextFile struct {
+	Path            string `json:"path"`
+	Bytes           int    `json:"bytes"`
+	EstimatedTokens int    `json:"estimated_tokens"`
+}
+
+type gatheredContext struct {
+	Backend       configuration.ConfigSourceType `json:"backend"`
+	ConfigRoot    string                         `json:"config_root"`
+	RootEntries   []string                       `json:"root_entries"`
+	MainConfig    string                         `json:"main_config"`
+	MainContent   string                         `json:"main_content,omitempty"`
+	SourcedFiles  []contextFile                  `json:"sourced_files,omitempty"`
+	ParseWarnings []string                       `json:"parse_warnings,omitempty"`
+	Notes         []string                       `json:"notes,omitempty"`
+}
+
+func (t *GatherContextTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "gather_context",
+		Description: "Returns an environment snapshot in one call: the detected installation type, the config root listing, the main config content and the size of every file it sources. Use this at the start of a task instead of separate detect_installation_root, list_dir and read_file calls.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *GatherContextTool) Execute(args string) (string, error) {
+	var backend configuration.ConfigBackend
 	for _, b := range t.Backends {
-		found, err := b.Detect("")
-		if err != nil {
+		if found, err := b.Detect(""); err == nil && found {
+			backend = b
+			break
+		}
+	}
+	if backend == nil {
+		return `{"backend": "unknown"}`, nil
+	}
+
+	sources, err := backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine main config file")
+	}
+	mainConfig := sources[0]
+
+	result := gatheredContext{
+		Backend:    backend.Type(),
+		ConfigRoot: filepath.Dir(mainConfig),
+		MainConfig: mainConfig,
+	}
+
+	if entries, err := os.ReadDir(result.ConfigRoot); err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			result.RootEntries = append(result.RootEntries, name)
+		}
+	} else {
+		result.Notes = append(result.Notes, fmt.Sprintf("could not list config root: %v", err))
+	}
+
+	if allowed, err := t.Config.IsPathAllowed(backend.Type(), mainConfig, configuration.AccessRead); err != nil || !allowed {
+		result.Notes = append(result.Notes, fmt.Sprintf("main config is not readable: %v", err))
+	} else if content, err := os.ReadFile(mainConfig); err != nil {
+		result.Notes = append(result.Notes, fmt.Sprintf("failed to read main config: %v", err))
+	} else if len(content) > maxReadFileSize {
+		result.Notes = append(result.Notes, fmt.Sprintf("main config is too large to include (%d bytes); use grep", len(content)))
+	} else {
+		result.MainContent = string(content)
+	}
+
+	// Sizes of sourced files let the model decide which ones to read next
+	lines, err := configuration.ExpandSources(mainConfig, t.Config.SourceFilter(backend.Type()))
+	if err != nil {
+		result.Notes = append(result.Notes, fmt.Sprintf("failed to follow source= includes: %v", err))
+	}
+	seen := map[string]bool{}
+	contents := map[string]*strings.Builder{}
+	var order []string
+	for _, sl := range lines {
+		if !seen[sl.File] {
+			seen[sl.File] = true
+			contents[sl.File] = &strings.Builder{}
+			order = append(order, sl.File)
+		}
+		contents[sl.File].WriteString(sl.Line.Raw + "\n")
+	}
+	mainAbs, _ := filepath.Abs(mainConfig)
+	for _, file := range order {
+		if file == mainAbs {
 			continue
 		}
-		if found {
-			sources, _ := b.ListSources()
-			return fmt.Sprintf(`{"type": "%s", "sources": %q}`, b.Type(), sources), nil
+		text := contents[file].String()
+		result.SourcedFiles = append(result.SourcedFiles, contextFile{Path: file, Bytes: len(text), EstimatedTokens: estimateTokens(text)})
+	}
+
+	if ir, err := backend.Parse(); err == nil {
+		for _, w := range ir.Warnings {
+			result.ParseWarnings = append(result.ParseWarnings, w.String())
+		}
+	}
+
+	return marshalResult(result)
+}
+
+type BackendHealthTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type backendHealth struct {
+	Backend      configuration.ConfigSourceType `json:"backend"`
+	ConfigRoot   string                         `json:"config_root"`
+	PresentFiles []string                       `json:"present_files"`
+	MissingFiles []string                       `json:"missing_files"`
+	MissingDirs  []string                       `json:"missing_dirs,omitempty"`
+	Note         string                         `json:"note,omitempty"`
+}
+
+func (t *BackendHealthTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "check_backend_health",
+		Description: "Checks which of the active backend's expected files and directories exist under the config root and reports missing ones (e.g. HyDE without keybindings.conf). Read-only; use it to diagnose incomplete installs.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *BackendHealthTool) Execute(args string) (string, error) {
+	sec, err := t.Config.SecurityFor(t.Backend.Type())
+	if err != nil {
+		return "", err
+	}
+
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine config root")
+	}
+	root := filepath.Dir(sources[0])
+
+	health := backendHealth{
+		Backend:      t.Backend.Type(),
+		ConfigRoot:   root,
+		PresentFiles: []string{},
+		MissingFiles: []string{},
+	}
+	for _, name := range sec.AllowedFiles {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			health.PresentFiles = append(health.PresentFiles, name)
+		} else {
+			health.MissingFiles = append(health.MissingFiles, name)
+		}
+	}
+	for _, dir := range sec.AllowedDirs {
+		if info, err := os.Stat(filepath.Join(root, dir)); err != nil || !info.IsDir() {
+			health.MissingDirs = append(health.MissingDirs, dir)
 		}
 	}
-	return `{"type": "unknown"}`, nil
+
+	if len(health.MissingFiles) > 0 {
+		health.Note = "Not every expected file is required (e.g. hyprpaper.conf is only needed when hyprpaper is used). Check whether the main config sources a missing file before calling the install broken."
+	}
+	return marshalResult(health)
 }
 
 // --- File Access Tools ---
 
+// maxReadFileSize is the largest file read_file returns to the model
+const maxReadFileSize = 100 * 1024
+
 type ReadFileTool struct {
 	Config  *configuration.Config
 	Backend configuration.ConfigBackend
+
+	// MaxBytes is the most read_file returns at once; longer content is
+	// truncated. Zero uses maxReadFileSize.
+	MaxBytes int
 }
 
 type ReadFileArgs struct {
-	Path string `json:"path"`
+	Path            string `json:"path"`
+	IncludeMetadata bool   `json:"include_metadata,omitempty"`
+	StartLine       int    `json:"start_line,omitempty"` // 1-based, inclusive
+	EndLine         int    `json:"end_line,omitempty"`   // Inclusive; 0 reads to the end
+}
+
+// fileWithMetadata is read_file's result when include_metadata is set
+type fileWithMetadata struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Mode     string    `json:"mode"`
+	Modified time.Time `json:"modified"`
+	Content  string    `json:"content"`
+	Note     string    `json:"note,omitempty"` // Set when the content was truncated
 }
 
 func (t *ReadFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
 		Name:        "read_file",
-		Description: "Reads the content of a file within the allowed Hyprland configuration directories",
+		Description: "Reads the content of a file within the allowed Hyprland configuration directories. Large files are truncated; use start_line/end_line to read a window of lines, e.g. around a match from search_config. With include_metadata it returns JSON with the file's size, mode and modification time alongside the content.",
 		Parameters: json.RawMessage(`{
 			"type": "object",
 			"properties": {
-				"path": {"type": "string", "description": "The path to the file to read (relative to ~/.config/hypr or absolute)"}
+				"path": {"type": "string", "description": "The path to the file to read (relative to ~/.config/hypr or absolute)"},
+				"include_metadata": {"type": "boolean", "description": "Also return size, mode and modification time, e.g. to check whether the file changed recently or is too large to read"},
+				"start_line": {"type": "integer", "minimum": 1, "description": "First line to read (1-based)"},
+				"end_line": {"type": "integer", "minimum": 1, "description": "Last line to read, inclusive; omit to read to the end"}
 			},
 			"required": ["path"],
 			"additionalProperties": false
@@ -85,20 +297,40 @@ func (t *ReadFileTool) Execute(args string) (string, error) {
 	backendType := t.Backend.Type()
 
 	// Validate path is allowed
-	allowed, err := t.Config.IsPathAllowed(backendType, a.Path)
-	if err != nil || !allowed {
+	path, err := t.Config.AllowedPath(backendType, a.Path, configuration.AccessRead)
+	if err != nil {
 		return "", fmt.Errorf("access denied: %v", err)
 	}
 
-	content, err := os.ReadFile(a.Path)
+	if a.StartLine < 0 || a.EndLine < 0 || (a.EndLine > 0 && a.EndLine < max(a.StartLine, 1)) {
+		return "", fmt.Errorf("invalid line range %d-%d", a.StartLine, a.EndLine)
+	}
+	limit := t.MaxBytes
+	if limit <= 0 {
+		limit = maxReadFileSize
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// 1. Check size limit (e.g. 100KB limit for context)
-	const maxFileSize = 100 * 1024
-	if len(content) > maxFileSize {
-		return "", fmt.Errorf("file too large (%d bytes). Max allowed is %d bytes. Please use 'grep' or read specific sections if possible, or ask the user to summarize", len(content), maxFileSize)
+	// Only the requested lines, up to the limit, are ever held in memory
+	content, window, err := readLines(f, max(a.StartLine, 1), a.EndLine, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if window.lines == 0 && a.StartLine > 1 {
+		return "", fmt.Errorf("start_line %d is past the end of the file", a.StartLine)
+	}
+	var note string
+	if window.truncated {
+		note = fmt.Sprintf("Truncated: showing lines %d-%d (%d bytes) of a %d-byte file. Use search_config to find the relevant lines, then read_file with start_line and end_line.", window.first, window.first+window.lines-1, len(content), info.Size())
 	}
 
 	// 2. Check for binary content
@@ -110,445 +342,2940 @@ func (t *ReadFileTool) Execute(args string) (string, error) {
 		}
 	}
 
+	if a.IncludeMetadata {
+		return marshalResult(fileWithMetadata{
+			Path:     path,
+			Size:     info.Size(),
+			Mode:     info.Mode().String(),
+			Modified: info.ModTime(),
+			Content:  string(content),
+			Note:     note,
+		})
+	}
+	if note != "" {
+		return strings.TrimRight(string(content), "\n") + "\n\n[" + note + "]", nil
+	}
 	return string(content), nil
 }
 
-type GrepTool struct {
+// lineWindow describes the part of a file readLines returned
+type lineWindow struct {
+	first     int  // Line number of the first line returned
+	lines     int  // Number of lines returned
+	truncated bool // Set if the limit cut the range short
+}
+
+// readLines returns lines start through end (1-based, inclusive; end 0 for
+// the rest of the file) of r, stopping before the line that would take the
+// result over limit bytes. A single line longer than limit is cut.
+func readLines(r io.Reader, start, end, limit int) ([]byte, lineWindow, error) {
+	window := lineWindow{first: start}
+	br := bufio.NewReader(r)
+	var out []byte
+	for n := 1; end == 0 || n <= end; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && n >= start {
+			if len(out)+len(line) > limit {
+				if window.lines == 0 {
+					out = append(out, line[:limit]...)
+					window.lines = 1
+				}
+				window.truncated = true
+				break
+			}
+			out = append(out, line...)
+			window.lines++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, window, err
+		}
+	}
+	return out, window, nil
+}
+
+type EstimateTokensTool struct {
 	Config  *configuration.Config
 	Backend configuration.ConfigBackend
 }
 
-type GrepArgs struct {
-	Pattern string `json:"pattern"`
-	Path    string `json:"path"` // Optional, if empty, search all allowed files
+type EstimateTokensArgs struct {
+	Path string `json:"path"`
 }
 
-func (t *GrepTool) Definition() ToolDefinition {
+type tokenEstimate struct {
+	Path            string `json:"path"`
+	Bytes           int64  `json:"bytes"`
+	Lines           int    `json:"lines"`
+	EstimatedTokens int    `json:"estimated_tokens"`
+	Recommendation  string `json:"recommendation"`
+}
+
+// largeFileTokens is the size above which reading a whole file is discouraged
+const largeFileTokens = 4000
+
+func (t *EstimateTokensTool) Definition() ToolDefinition {
 	return ToolDefinition{
-		Name:        "grep",
-		Description: "Search for a regex pattern in files. Useful for finding specific configs in large files.",
+		Name:        "estimate_tokens",
+		Description: "Returns the byte size, line count and an approximate token count of a file without reading its content into the conversation. Use it before read_file on unfamiliar or large files to decide between read_file and grep.",
 		Parameters: json.RawMessage(`{
-            "type": "object",
-            "properties": {
-                "pattern": {"type": "string", "description": "The regex pattern to search for (Go regex syntax)"},
-                "path": {"type": "string", "description": "Optional specific file to search in. If omitted, searches all allowed files."}
-            },
-            "required": ["pattern"],
-            "additionalProperties": false
-        }`),
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "The path to the file (relative to ~/.config/hypr or absolute)"}
+			},
+			"required": ["path"],
+			"additionalProperties": false
+		}`),
 	}
 }
 
-func (t *GrepTool) Execute(args string) (string, error) {
-	var a GrepArgs
+func (t *EstimateTokensTool) Execute(args string) (string, error) {
+	var a EstimateTokensArgs
 	if err := ParseArgs(args, &a); err != nil {
 		return "", err
 	}
 
-	// Compile regex first to fail fast
-	re, err := regexp.Compile(a.Pattern)
+	path, err := t.Config.AllowedPath(t.Backend.Type(), a.Path, configuration.AccessRead)
 	if err != nil {
-		return "", fmt.Errorf("invalid regex pattern: %w", err)
+		return "", fmt.Errorf("access denied: %v", err)
 	}
 
-	backendType := t.Backend.Type()
-	var filesToSearch []string
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
 
-	if a.Path != "" {
-		// Search specific file
-		allowed, err := t.Config.IsPathAllowed(backendType, a.Path)
-		if err != nil || !allowed {
-			return "", fmt.Errorf("access denied: %v", err)
-		}
-		filesToSearch = []string{a.Path}
-	} else {
-		// Search all sources
-		sources, err := t.Backend.ListSources()
-		if err != nil {
-			return "", fmt.Errorf("failed to list sources: %w", err)
-		}
-		filesToSearch = sources
+	est := tokenEstimate{
+		Path:            path,
+		Bytes:           int64(len(content)),
+		Lines:           strings.Count(string(content), "\n"),
+		EstimatedTokens: estimateTokens(string(content)),
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		est.Lines++
 	}
 
-	var results []string
-	const maxResults = 50 // Limit results to avoid context spam
+	switch {
+	case len(content) > maxReadFileSize:
+		est.Recommendation = "Too large to read whole; read_file will truncate it. Use grep or search_config to find the relevant lines, then read_file with start_line/end_line."
+	case est.EstimatedTokens > largeFileTokens:
+		est.Recommendation = "Large file; prefer grep for specific settings and read_file only if the whole file is needed."
+	default:
+		est.Recommendation = "Small enough to read with read_file."
+	}
+	return marshalResult(est)
+}
 
-	for _, file := range filesToSearch {
-		contentBytes, err := os.ReadFile(file)
-		if err != nil {
-			continue // Skip unreadable files
+// estimateTokens approximates the token count of text. Config files are
+// dense with punctuation and short identifiers, so roughly 3.5 characters per
+// token is used instead of the usual 4 for prose; whitespace runs count once.
+func estimateTokens(text string) int {
+	chars := 0
+	inSpace := false
+	for _, r := range text {
+		if r == ' ' || r == '\t' {
+			if inSpace {
+				continue
+			}
+			inSpace = true
+		} else {
+			inSpace = false
 		}
+		chars++
+	}
+	return (chars*2 + 6) / 7
+}
 
-		// Check binary
-		if strings.Contains(string(contentBytes), "\x00") {
-			continue
+type WriteFileTool struct {
+	Config   *configuration.Config
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
+}
+
+type WriteFileArgs struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+func (t *WriteFileTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "write_file",
+		Description: "Creates a new file (or replaces an existing one) within the allowed Hyprland configuration directories, e.g. to split keybinds into keybindings.conf. Existing files are snapshotted first, and the user approves the content before anything is written; prefer make_patch/apply_patch for edits to existing files.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "The path of the file to write (relative to ~/.config/hypr or absolute)"},
+				"content": {"type": "string", "description": "The full content of the file"}
+			},
+			"required": ["path", "content"],
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *WriteFileTool) Mutating() bool {
+	return true
+}
+
+func (t *WriteFileTool) Execute(args string) (string, error) {
+	var a WriteFileArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	targetPath, err := t.Config.AllowedPath(t.Backend.Type(), a.Path, configuration.AccessWrite)
+	if err != nil {
+		return "", fmt.Errorf("write access denied: %v", err)
+	}
+
+	var original string
+	existing, err := os.ReadFile(targetPath)
+	exists := err == nil
+	if exists {
+		original = string(existing)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if t.Confirm != nil {
+		verb := "Create"
+		if exists {
+			verb = "Replace"
 		}
+		action := fmt.Sprintf("%s %s?\n\n%s", verb, targetPath, displayDiff(original, a.Content))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined writing %s; nothing was written", targetPath)
+		}
+	}
 
-		lines := strings.Split(string(contentBytes), "\n")
-		for i, line := range lines {
-			if re.MatchString(line) {
-				// Format: File:Line: Content
-				// Truncate extremely long lines
-				displayLine := line
-				if len(displayLine) > 200 {
-					displayLine = displayLine[:200] + "..."
-				}
-				results = append(results, fmt.Sprintf("%s:%d: %s", file, i+1, displayLine))
-				if len(results) >= maxResults {
-					break
-				}
-			}
+	// Never replace an existing file without a backup of it
+	var snapshotID string
+	if exists {
+		if t.Snapshot == nil {
+			return "", fmt.Errorf("refusing to overwrite %s: snapshot service is not available", targetPath)
 		}
-		if len(results) >= maxResults {
-			break
+		snapshotID, err = snapshotBeforeWrite(t.Snapshot, t.Backend, targetPath, fmt.Sprintf("Replaced %s", targetPath))
+		if err != nil {
+			return "", fmt.Errorf("refusing to overwrite %s: %w", targetPath, err)
 		}
 	}
 
-	if len(results) == 0 {
-		return "No matches found.", nil
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := configuration.WriteFileAtomic(targetPath, []byte(a.Content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if !exists {
+		t.Actions.Record(Action{Tool: "write_file", Path: targetPath, Hash: sha256Hex([]byte(a.Content)), Summary: fmt.Sprintf("Created %s", targetPath)})
+		return fmt.Sprintf("Created %s (%d bytes). Remember to add a source= line for it if Hyprland should load it.", targetPath, len(a.Content)), nil
+	}
+	t.Actions.Record(Action{Tool: "write_file", Path: targetPath, SnapshotID: snapshotID, Hash: sha256Hex([]byte(a.Content)), Summary: fmt.Sprintf("Replaced %s", targetPath)})
+	return fmt.Sprintf("Replaced %s (%d bytes). Snapshot %s was taken first; to undo, call rollback with snapshot_id %q.", targetPath, len(a.Content), snapshotID, snapshotID), nil
+}
+
+type MoveFileTool struct {
+	Config   *configuration.Config
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
+}
+
+type MoveFileArgs struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+func (t *MoveFileTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "move_file",
+		Description: "Moves or renames a file within the allowed Hyprland configuration directories, e.g. binds.conf to keybindings.conf. The file is snapshotted first. Refuses to replace an existing file unless overwrite is set. source= lines naming the old path are not updated; patch them afterwards.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "The file to move (relative to ~/.config/hypr or absolute)"},
+				"to": {"type": "string", "description": "Its new path (relative to ~/.config/hypr or absolute)"},
+				"overwrite": {"type": "boolean", "description": "Replace the destination if it exists; it is snapshotted too"}
+			},
+			"required": ["from", "to"],
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *MoveFileTool) Mutating() bool {
+	return true
+}
+
+func (t *MoveFileTool) Execute(args string) (string, error) {
+	var a MoveFileArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.From == "" || a.To == "" {
+		return "", fmt.Errorf("from and to are required")
+	}
+
+	// The source is read and then removed, so it needs both kinds of access
+	if _, err := t.Config.AllowedPath(t.Backend.Type(), a.From, configuration.AccessRead); err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+	from, err := t.Config.AllowedPath(t.Backend.Type(), a.From, configuration.AccessWrite)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+	to, err := t.Config.AllowedPath(t.Backend.Type(), a.To, configuration.AccessWrite)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", from)
+	}
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return "", fmt.Errorf("from and to are the same file")
+	}
+
+	backup := []string{from}
+	if _, err := os.Stat(to); err == nil {
+		if !a.Overwrite {
+			return "", fmt.Errorf("%s already exists; set overwrite to replace it", to)
+		}
+		backup = append(backup, to)
+	}
+
+	// The move cannot be undone without a copy of the file under its old name
+	if t.Snapshot == nil {
+		return "", fmt.Errorf("refusing to move %s: snapshot service is not available", from)
+	}
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Move %s to %s?", from, to)
+		if len(backup) > 1 {
+			action = fmt.Sprintf("Move %s to %s, replacing the existing file?", from, to)
+		}
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined moving %s; nothing was changed", from)
+		}
+	}
+	summary := fmt.Sprintf("Moved %s to %s", from, to)
+	snapshotID, err := snapshotFiles(t.Snapshot, t.Backend, summary, backup...)
+	if err != nil {
+		return "", fmt.Errorf("refusing to move %s: %w", from, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := moveFile(from, to, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to move file: %w", err)
+	}
+
+	t.Actions.Record(Action{Tool: "move_file", Path: to, Source: from, SnapshotID: snapshotID, Summary: summary})
+	return fmt.Sprintf("%s. Update any source= line that names the old path. Snapshot %s was taken first; rollback with snapshot_id %q restores the file under its old name (the new one is left in place).", summary, snapshotID, snapshotID), nil
+}
+
+// moveFile renames from to to, or copies and deletes it when they are on
+// different filesystems
+func moveFile(from, to string, perm os.FileMode) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := configuration.WriteFileAtomic(to, data, perm); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+type GrepTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type GrepArgs struct {
+	Pattern string `json:"pattern"`
+	Path    string `json:"path"` // Optional, if empty, search all allowed files
+}
+
+func (t *GrepTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "grep",
+		Description: "Search for a regex pattern in files. Useful for finding specific configs in large files.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "pattern": {"type": "string", "description": "The regex pattern to search for (Go regex syntax)"},
+                "path": {"type": "string", "description": "Optional specific file to search in. If omitted, searches all allowed files."}
+            },
+            "required": ["pattern"],
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *GrepTool) Execute(args string) (string, error) {
+	var a GrepArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	// Compile regex first to fail fast
+	re, err := regexp.Compile(a.Pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex pattern: %w", err)
+	}
+
+	backendType := t.Backend.Type()
+	var filesToSearch []string
+
+	if a.Path != "" {
+		// Search specific file
+		path, err := t.Config.AllowedPath(backendType, a.Path, configuration.AccessRead)
+		if err != nil {
+			return "", fmt.Errorf("access denied: %v", err)
+		}
+		filesToSearch = []string{path}
+	} else {
+		// Search all sources
+		sources, err := t.Backend.ListSources()
+		if err != nil {
+			return "", fmt.Errorf("failed to list sources: %w", err)
+		}
+		filesToSearch = sources
+	}
+
+	var results []string
+	const maxResults = 50 // Limit results to avoid context spam
+
+	for _, file := range filesToSearch {
+		contentBytes, err := os.ReadFile(file)
+		if err != nil {
+			continue // Skip unreadable files
+		}
+
+		// Check binary
+		if strings.Contains(string(contentBytes), "\x00") {
+			continue
+		}
+
+		lines := strings.Split(string(contentBytes), "\n")
+		for i, line := range lines {
+			if re.MatchString(line) {
+				// Format: File:Line: Content
+				// Truncate extremely long lines
+				displayLine := line
+				if len(displayLine) > 200 {
+					displayLine = displayLine[:200] + "..."
+				}
+				results = append(results, fmt.Sprintf("%s:%d: %s", file, i+1, displayLine))
+				if len(results) >= maxResults {
+					break
+				}
+			}
+		}
+		if len(results) >= maxResults {
+			break
+		}
+	}
+
+	if len(results) == 0 {
+		return "No matches found.", nil
+	}
+
+	if len(results) >= maxResults {
+		results = append(results, "... (results truncated)")
+	}
+
+	return strings.Join(results, "\n"), nil
+}
+
+type SearchConfigTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type SearchConfigArgs struct {
+	Query string `json:"query"`
+	Regex bool   `json:"regex"`
+	Path  string `json:"path"` // Optional file or directory; defaults to every allowed path
+}
+
+// SearchMatch is one line found by search_config
+type SearchMatch struct {
+	File    string `json:"file"`
+	LineNum int    `json:"line_num"`
+	Line    string `json:"line"`
+}
+
+const (
+	maxSearchMatches  = 100
+	maxSearchFileSize = 1 << 20 // Larger files are not Hyprland configs
+)
+
+func (t *SearchConfigTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "search_config",
+		Description: "Search every allowed config file of the active backend for a substring or regex, including files that are not sourced. Use it to find where a keybind, rule or variable is defined in one call instead of listing and reading files.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Text to search for, e.g. '$mainMod, Q'"},
+				"regex": {"type": "boolean", "description": "Treat query as a Go regex instead of a plain substring (default false)"},
+				"path": {"type": "string", "description": "Optional file or directory to limit the search to"}
+			},
+			"required": ["query"],
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *SearchConfigTool) Execute(args string) (string, error) {
+	var a SearchConfigArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Query == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	match := func(line string) bool { return strings.Contains(line, a.Query) }
+	if a.Regex {
+		re, err := regexp.Compile(a.Query)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		match = re.MatchString
+	}
+
+	backendType := t.Backend.Type()
+	var roots []string
+	if a.Path != "" {
+		path, err := t.Config.AllowedPath(backendType, a.Path, configuration.AccessRead)
+		if err != nil {
+			return "", fmt.Errorf("access denied: %v", err)
+		}
+		roots = []string{path}
+	} else {
+		paths, err := t.Config.AllowedPaths(backendType)
+		if err != nil {
+			return "", fmt.Errorf("failed to list allowed paths: %w", err)
+		}
+		roots = paths
+	}
+
+	matches := []SearchMatch{}
+	truncated := false
+	seen := make(map[string]bool)
+	searchFile := func(path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		// Allowed directories may contain files that are not allowed themselves
+		if allowed, err := t.Config.IsPathAllowed(backendType, path, configuration.AccessRead); err != nil || !allowed {
+			return
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() > maxSearchFileSize {
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || strings.Contains(string(content), "\x00") {
+			return // Skip unreadable and binary files
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			if !match(line) {
+				continue
+			}
+			if len(matches) >= maxSearchMatches {
+				truncated = true
+				return
+			}
+			if len(line) > 200 {
+				line = line[:200] + "..."
+			}
+			matches = append(matches, SearchMatch{File: path, LineNum: i + 1, Line: line})
+		}
+	}
+
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil // Skip unreadable entries
+			}
+			if truncated {
+				return filepath.SkipAll
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir // e.g. .git
+				}
+				return nil
+			}
+			searchFile(path)
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to search %s: %w", root, err)
+		}
+	}
+
+	return marshalResult(struct {
+		Matches   []SearchMatch `json:"matches"`
+		Truncated bool          `json:"truncated,omitempty"`
+	}{matches, truncated})
+}
+
+type ListDirTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type ListDirArgs struct {
+	Path string `json:"path"`
+}
+
+func (t *ListDirTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "list_dir",
+		Description: "Lists the contents of a directory within allowed Hyprland configuration directories",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "The path to the directory to list"}
+			},
+			"required": ["path"],
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ListDirTool) Execute(args string) (string, error) {
+	var a ListDirArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	// Use active backend
+	backendType := t.Backend.Type()
+
+	// Validate path is allowed
+	path, err := t.Config.AllowedPath(backendType, a.Path, configuration.AccessRead)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+
+	result, err := json.Marshal(names)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// --- Parsing Tools ---
+
+type ParseConfigTool struct {
+	Backend configuration.ConfigBackend
+}
+
+type ParseConfigArgs struct {
+	Path string `json:"path"` // Optional, if specific file needed, otherwise uses backend logic
+}
+
+func (t *ParseConfigTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "parse_config",
+		Description: "Parses the configuration into a structured format, following source= includes. Each line carries the SourceFile it came from, its LineNum within that file, and the Section it is in as a colon-separated path (e.g. input:touchpad for a key inside touchpad { } inside input { }) with its nesting Depth. monitor and workspace lines also carry their rule broken into fields (Monitor: name, resolution with width/height/refresh_rate, position with its offset, scale, options; Workspace: selector, rules, monitor, default), as bind lines do in Bind. Lines the parser could not understand are listed in Warnings with their file and line.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string"}
+			},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ParseConfigTool) Execute(args string) (string, error) {
+	// Use active backend directly
+	ir, err := t.Backend.Parse()
+	if err != nil {
+		return "", err
+	}
+	// Serialize IR to JSON for the LLM
+	irJSON, err := json.Marshal(ir)
+	if err != nil {
+		return "", err
+	}
+	return string(irJSON), nil
+}
+
+type ResolveVariablesTool struct {
+	Backend configuration.ConfigBackend
+}
+
+type ResolveVariablesArgs struct {
+	Filter string `json:"filter"` // Optional substring a line must contain
+}
+
+// resolvedLine is a line whose value changed when its variables were expanded
+type resolvedLine struct {
+	File     string `json:"file,omitempty"`
+	LineNum  int    `json:"line_num"`
+	Raw      string `json:"raw"`
+	Key      string `json:"key"`
+	Value    string `json:"value"` // With variables expanded
+	Original string `json:"original"`
+}
+
+func (t *ResolveVariablesTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "resolve_variables",
+		Description: "Expands $variables (e.g. $mainMod = SUPER) across the config, following source= includes. Returns the final value of every variable and each line that references one, with its value expanded, so you can tell what 'bind = $mainMod, Q, ...' actually binds. Undefined variables are left as written.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"filter": {"type": "string", "description": "Only return lines whose raw text contains this substring, e.g. 'bind'"}
+			},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ResolveVariablesTool) Execute(args string) (string, error) {
+	var a ResolveVariablesArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	ir, err := t.Backend.Parse()
+	if err != nil {
+		return "", err
+	}
+	resolved, vars := ir.Resolve()
+
+	lines := []resolvedLine{}
+	for i, line := range resolved.Lines {
+		original := ir.Lines[i].Value
+		if line.Value == original || (a.Filter != "" && !strings.Contains(line.Raw, a.Filter)) {
+			continue
+		}
+		lines = append(lines, resolvedLine{
+			File:     line.SourceFile,
+			LineNum:  line.LineNum,
+			Raw:      line.Raw,
+			Key:      line.Key,
+			Value:    line.Value,
+			Original: original,
+		})
+	}
+
+	return marshalResult(struct {
+		Variables map[string]string `json:"variables"`
+		Lines     []resolvedLine    `json:"lines"`
+	}{vars, lines})
+}
+
+type ExplainLineTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type ExplainLineArgs struct {
+	Path string `json:"path"` // Optional, defaults to the main config
+	Line int    `json:"line"`
+	Raw  string `json:"raw"` // A pasted line, instead of path and line
+}
+
+func (t *ExplainLineTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "explain_line",
+		Description: "Explains what one config line does, without guessing: its category (bind, monitor, exec, option, ...), the parsed fields (e.g. mods, key, dispatcher and params of a bind) and a short description from a built-in table of Hyprland keywords. Pass a file path and line number, or a raw line.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "Config file containing the line. Defaults to the main config."},
+				"line": {"type": "integer", "description": "1-based line number in the file"},
+				"raw": {"type": "string", "description": "A single config line to explain instead, e.g. 'bind = SUPER, Q, killactive'"}
+			},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ExplainLineTool) Execute(args string) (string, error) {
+	var a ExplainLineArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	if a.Raw != "" {
+		ir, err := configuration.ParseString(a.Raw)
+		if err != nil {
+			return "", err
+		}
+		if len(ir.Lines) != 1 {
+			return "", fmt.Errorf("raw must be a single line")
+		}
+		explanation := configuration.ExplainLine(ir.Lines[0], "")
+		explanation.Line = 0
+		return marshalResult(explanation)
+	}
+
+	if a.Line <= 0 {
+		return "", fmt.Errorf("pass either raw, or a line number (and optionally a path)")
+	}
+	path := a.Path
+	if path == "" {
+		sources, err := t.Backend.ListSources()
+		if err != nil || len(sources) == 0 {
+			return "", fmt.Errorf("could not determine the main config file")
+		}
+		path = sources[0]
+	}
+	path, err := t.Config.AllowedPath(t.Backend.Type(), path, configuration.AccessRead)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+
+	ir, err := configuration.ParseFile(path)
+	if err != nil {
+		return "", err
+	}
+	if a.Line > len(ir.Lines) {
+		return "", fmt.Errorf("%s has only %d lines", path, len(ir.Lines))
+	}
+	// Explain what the line means, e.g. with $mainMod expanded
+	sections := configuration.SectionPaths(ir)
+	resolved, _ := ir.Resolve()
+	return marshalResult(configuration.ExplainLine(resolved.Lines[a.Line-1], sections[a.Line-1]))
+}
+
+type ValidateConfigTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type ValidateConfigArgs struct {
+	Content string `json:"content"`
+	Path    string `json:"path"`
+}
+
+func (t *ValidateConfigTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "validate_hyprland_syntax",
+		Description: "Checks Hyprland config content (or a file) for structural errors before it is applied: unbalanced braces, unknown top-level sections, bind lines with too few fields and undefined $variables. Returns a JSON list of {line, severity, message}. Run it on your modified content before make_patch.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"content": {"type": "string", "description": "Config content to validate"},
+				"path": {"type": "string", "description": "File to validate instead of content"}
+			},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ValidateConfigTool) Execute(args string) (string, error) {
+	var a ValidateConfigArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	content := a.Content
+	if content == "" {
+		if a.Path == "" {
+			return "", fmt.Errorf("either content or path is required")
+		}
+		path, err := t.Config.AllowedPath(t.Backend.Type(), a.Path, configuration.AccessRead)
+		if err != nil {
+			return "", fmt.Errorf("access denied: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		content = string(data)
+	}
+
+	ir, err := configuration.ParseString(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse content: %w", err)
+	}
+
+	// Variables defined anywhere in the user's config may be used by a sourced file
+	var knownVars []string
+	if sources, err := t.Backend.ListSources(); err == nil && len(sources) > 0 {
+		if lines, err := configuration.ExpandSources(sources[0], t.Config.SourceFilter(t.Backend.Type())); err == nil {
+			for _, sl := range lines {
+				if sl.Line.Type == configuration.LineTypeVariable && sl.Line.Key != "" {
+					knownVars = append(knownVars, sl.Line.Key)
+				}
+			}
+		}
+	}
+
+	issues := configuration.ValidateConfig(ir, knownVars)
+	if len(issues) == 0 {
+		return "No syntax problems found.", nil
+	}
+	return marshalResult(issues)
+}
+
+type DetectValueConflictsTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+func (t *DetectValueConflictsTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "detect_value_conflicts",
+		Description: "Follows source= includes from the main config and reports options (e.g. general:gaps_in) that are set to different values in more than one file, including which definition takes effect based on source order.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *DetectValueConflictsTool) Execute(args string) (string, error) {
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine main config file")
+	}
+
+	lines, err := configuration.ExpandSources(sources[0], t.Config.SourceFilter(t.Backend.Type()))
+	if err != nil {
+		return "", fmt.Errorf("failed to expand sources: %w", err)
+	}
+
+	conflicts := configuration.FindValueConflicts(lines)
+	if len(conflicts) == 0 {
+		return "No conflicting values found across sourced files.", nil
+	}
+	return marshalResult(conflicts)
+}
+
+type DetectBindConflictsTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+func (t *DetectBindConflictsTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "detect_bind_conflicts",
+		Description: "Follows source= includes from the main config and reports key combinations bound more than once, e.g. SUPER+Q bound to both killactive and exec. Variables like $mainMod are expanded, modifier order is ignored and unbind is honoured. Run it after adding or changing a keybind.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *DetectBindConflictsTool) Execute(args string) (string, error) {
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine main config file")
+	}
+
+	lines, err := configuration.ExpandSources(sources[0], t.Config.SourceFilter(t.Backend.Type()))
+	if err != nil {
+		return "", fmt.Errorf("failed to expand sources: %w", err)
+	}
+
+	conflicts := configuration.FindBindConflicts(lines)
+	if len(conflicts) == 0 {
+		return "No key combination is bound more than once.", nil
+	}
+	return marshalResult(conflicts)
+}
+
+type RiskCheckTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+func (t *RiskCheckTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "check_risks",
+		Description: "Scans the config and all sourced files for patterns known to cause a black screen or login loop (session-killing exec-once, monitor rules with no fallback, disabled autoreload, unmodified exit binds). Run this before suggesting a reload.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *RiskCheckTool) Execute(args string) (string, error) {
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine main config file")
+	}
+
+	lines, err := configuration.ExpandSources(sources[0], t.Config.SourceFilter(t.Backend.Type()))
+	if err != nil {
+		return "", fmt.Errorf("failed to expand sources: %w", err)
+	}
+
+	warnings := configuration.CheckRisks(lines)
+	if len(warnings) == 0 {
+		return "No high-risk patterns found.", nil
+	}
+	return marshalResult(warnings)
+}
+
+type SourceTreeTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type SourceTreeArgs struct {
+	MaxDepth int `json:"max_depth"`
+}
+
+func (t *SourceTreeTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "show_source_tree",
+		Description: "Returns the include graph of the main config as a nested tree: each file lists the files it pulls in via source=, with the directive's line number. Glob patterns list each matching file. Missing files, files outside the allowed paths and circular includes are marked in 'status'. Branches below max_depth are cut and counted in 'truncated'.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"max_depth": {"type": "integer", "description": "How many levels of includes to show (default 6)"}
+			},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *SourceTreeTool) Execute(args string) (string, error) {
+	var a SourceTreeArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.MaxDepth <= 0 {
+		a.MaxDepth = 6
+	}
+
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine main config file")
+	}
+
+	tree, err := configuration.SourceTree(sources[0], a.MaxDepth, t.Config.SourceFilter(t.Backend.Type()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build source tree: %w", err)
+	}
+	return marshalResult(tree)
+}
+
+type ConfigLayoutTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+func (t *ConfigLayoutTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "inspect_config_layout",
+		Description: "Reports whether the config is monolithic (everything in the main file) or fragmented across source= includes, lists the included files and recommends which file to edit for each category (keybinds, window_rules, monitors, workspaces, autostart, environment, animations, appearance, input). Use it to choose the file to patch.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ConfigLayoutTool) Execute(args string) (string, error) {
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine main config file")
+	}
+
+	lines, err := configuration.ExpandSources(sources[0], t.Config.SourceFilter(t.Backend.Type()))
+	if err != nil {
+		return "", fmt.Errorf("failed to expand sources: %w", err)
+	}
+	return marshalResult(configuration.DescribeLayout(sources[0], lines))
+}
+
+// --- Patch Tools ---
+
+type MakePatchTool struct{}
+
+type MakePatchArgs struct {
+	Original     string `json:"original"`
+	Modified     string `json:"modified"`
+	ContextLines *int   `json:"context_lines,omitempty"`
+}
+
+func (t *MakePatchTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "make_patch",
+		Description: "Creates a standard unified diff (as produced by diff -u) between original and modified content. Show it to the user, then pass it EXACTLY as-is to apply_patch.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "original": {"type": "string", "description": "The original file content"},
+                "modified": {"type": "string", "description": "The modified file content"},
+                "context_lines": {"type": "integer", "minimum": 0, "maximum": 50, "description": "Unchanged lines kept around each change (default 3). Every one must still match when applying, so use fewer if the file may change near the edit, more if the same block appears several times."}
+            },
+            "required": ["original", "modified"]
+        }`),
+	}
+}
+
+func (t *MakePatchTool) Execute(args string) (string, error) {
+	var a MakePatchArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	if a.ContextLines == nil {
+		return makePatch(a.Original, a.Modified)
+	}
+	if *a.ContextLines < 0 || *a.ContextLines > configuration.MaxDiffContext {
+		return "", fmt.Errorf("context_lines must be between 0 and %d", configuration.MaxDiffContext)
+	}
+	return makePatchContext(a.Original, a.Modified, *a.ContextLines)
+}
+
+type DiffFilesTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type DiffFilesArgs struct {
+	PathA string `json:"path_a"`
+	PathB string `json:"path_b"`
+}
+
+func (t *DiffFilesTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "diff_files",
+		Description: "Returns a unified diff between two config files, e.g. the current hyprland.conf and a theme file. Read-only; the result is for understanding differences, not for apply_patch.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path_a": {"type": "string", "description": "The first (old) file"},
+				"path_b": {"type": "string", "description": "The second (new) file"}
+			},
+			"required": ["path_a", "path_b"],
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *DiffFilesTool) Execute(args string) (string, error) {
+	var a DiffFilesArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	var contents [2]string
+	for i, p := range []string{a.PathA, a.PathB} {
+		path, err := t.Config.AllowedPath(t.Backend.Type(), p, configuration.AccessRead)
+		if err != nil {
+			return "", fmt.Errorf("access denied: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		contents[i] = string(data)
+	}
+
+	diff := configuration.UnifiedDiff(a.PathA, a.PathB, contents[0], contents[1])
+	if diff == "" {
+		return "The files are identical.", nil
+	}
+	return diff, nil
+}
+
+// makePatch builds the unified diff consumed by apply_patch
+func makePatch(original, modified string) (string, error) {
+	return makePatchContext(original, modified, configuration.DiffContext)
+}
+
+// makePatchContext is makePatch with the given number of context lines
+func makePatchContext(original, modified string, contextLines int) (string, error) {
+	patchText := configuration.UnifiedDiffContext("original", "modified", original, modified, contextLines)
+	if patchText == "" {
+		return "", fmt.Errorf("no changes detected between original and modified content")
+	}
+	return patchText, nil
+}
+
+// displayDiff renders a line diff of the change for the user, showing each
+// changed line with up to two lines of context
+func displayDiff(original, modified string) string {
+	dmp := diffmatchpatch.New()
+	text1, text2, linearray := dmp.DiffLinesToChars(original, modified)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(text1, text2, false), linearray)
+
+	type diffLine struct {
+		op   diffmatchpatch.Operation
+		text string
+	}
+	var lines []diffLine
+	for _, d := range diffs {
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l != "" {
+				lines = append(lines, diffLine{d.Type, strings.TrimSuffix(l, "\n")})
+			}
+		}
+	}
+
+	const context = 2
+	show := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.op == diffmatchpatch.DiffEqual {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(lines) {
+				show[j] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	skipped := false
+	for i, l := range lines {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped && sb.Len() > 0 {
+			sb.WriteString("...\n")
+		}
+		skipped = false
+		switch l.op {
+		case diffmatchpatch.DiffInsert:
+			sb.WriteString("+ ")
+		case diffmatchpatch.DiffDelete:
+			sb.WriteString("- ")
+		default:
+			sb.WriteString("  ")
+		}
+		sb.WriteString(l.text)
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+type ApplyPatchTool struct {
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Config   *configuration.Config
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
+
+	// AutoReload reloads Hyprland and checks for config errors after a
+	// successful apply
+	AutoReload bool
+
+	// RollbackOnError restores the snapshot and reloads again when
+	// Hyprland reports config errors after AutoReload
+	RollbackOnError bool
+}
+
+type ApplyPatchArgs struct {
+	Path        string `json:"path"`
+	Patch       string `json:"patch"`
+	Description string `json:"description"` // What the change does, kept with its snapshot
+}
+
+func (t *ApplyPatchTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "apply_patch",
+		Description: "Applies a patch generated by make_patch. The 'patch' argument MUST be the exact raw output string from a previous make_patch call. REQUIRES user confirmation.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "path": {"type": "string", "description": "Optional path to the file to patch"},
+                "patch": {"type": "string"},
+                "description": {"type": "string", "description": "Short description of the change in the user's terms, e.g. 'increase gaps to 8px'. Shown when listing snapshots."}
+            },
+            "required": ["patch"]
+        }`),
+	}
+}
+
+func (t *ApplyPatchTool) Mutating() bool {
+	return true
+}
+
+func (t *ApplyPatchTool) Execute(args string) (string, error) {
+	var a ApplyPatchArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	// Models often wrap the diff in a markdown fence; lines outside @@ hunks
+	// (fences, file headers, commentary) are ignored when parsing
+	patch := strings.TrimSpace(a.Patch)
+	if !strings.Contains(patch, "@@") {
+		return "", fmt.Errorf("invalid patch format: missing @@ markers. The patch must be in unified diff format generated by make_patch tool")
+	}
+
+	// Use active backend directly
+	activeBackend := t.Backend
+	backendType := t.Backend.Type()
+
+	// Determine target file and validate it's allowed
+	targetPath := a.Path
+	if targetPath == "" {
+		sources, err := activeBackend.ListSources()
+		if err != nil || len(sources) == 0 {
+			return "", fmt.Errorf("could not determine target file")
+		}
+		targetPath = sources[0]
+	}
+
+	// Validate path is allowed for write operations
+	targetPath, err := t.Config.AllowedPath(backendType, targetPath, configuration.AccessWrite)
+	if err != nil {
+		return "", fmt.Errorf("write access denied: %v", err)
+	}
+
+	// Read current file content
+	contentBytes, err := os.ReadFile(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read target file %s: %w", targetPath, err)
+	}
+	originalContent := string(contentBytes)
+
+	newContent, err := configuration.ApplyUnifiedDiff(originalContent, patch)
+	if err != nil {
+		return "", fmt.Errorf("patch application failed: %w. Please re-read the file and regenerate the patch", err)
+	}
+
+	// Ask the user before touching the file, regardless of what the model was told
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Apply patch to %s?\n\n%s", targetPath, displayDiff(originalContent, newContent))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined the patch to %s; nothing was written", targetPath)
+		}
+	}
+
+	summary := fmt.Sprintf("Applied patch to %s", targetPath)
+	if d := strings.TrimSpace(a.Description); d != "" {
+		summary += ": " + d
+	}
+
+	// Errors Hyprland already reports are not the patch's fault, so only new
+	// ones roll it back
+	var errsBefore []string
+	if t.AutoReload && t.RollbackOnError && hyprctl.Available() {
+		errsBefore, _ = hyprctl.ConfigErrors()
+	}
+
+	// Snapshot before applying
+	snapshotID, err := snapshotBeforeWrite(t.Snapshot, activeBackend, targetPath, summary)
+	if err != nil {
+		return "", err
+	}
+
+	// Write the patched content back
+	err = configuration.WriteFileAtomic(targetPath, []byte(newContent), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write patched file: %w", err)
+	}
+
+	t.Actions.Record(Action{Tool: "apply_patch", Path: targetPath, SnapshotID: snapshotID, Hash: sha256Hex([]byte(patch)), Summary: summary})
+
+	result := fmt.Sprintf("Patch applied successfully to %s", targetPath)
+	if snapshotID != "" {
+		result = fmt.Sprintf("Patch applied successfully to %s. Snapshot %s was taken first; to undo this change, call rollback with snapshot_id %q.", targetPath, snapshotID, snapshotID)
+	}
+
+	// Only reached once the apply itself went through the confirmation flow
+	switch {
+	case t.AutoReload && t.RollbackOnError && snapshotID != "":
+		report, rolledBack := t.reloadOrRollback(snapshotID, errsBefore)
+		if rolledBack {
+			// The undo hint above no longer applies
+			result = fmt.Sprintf("Patch applied to %s.", targetPath)
+		}
+		result += "\n" + report
+	case t.AutoReload:
+		result += "\n" + reloadAndVerify(snapshotID)
+	}
+	return result, nil
+}
+
+// PreviewPatchTool dry-runs a patch: it reports which hunks match the file
+// and returns the patched content without writing anything
+type PreviewPatchTool struct {
+	Backend configuration.ConfigBackend
+	Config  *configuration.Config
+}
+
+type PreviewPatchArgs struct {
+	Path  string `json:"path"`
+	Patch string `json:"patch"`
+}
+
+func (t *PreviewPatchTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "preview_patch",
+		Description: "Dry-runs a patch from make_patch against the current file without writing it. Returns whether each hunk matches and the file content after the patch.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "path": {"type": "string", "description": "Optional path to the file to patch (defaults to the main config)"},
+                "patch": {"type": "string"}
+            },
+            "required": ["patch"]
+        }`),
+	}
+}
+
+func (t *PreviewPatchTool) Execute(args string) (string, error) {
+	var a PreviewPatchArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	patch := strings.TrimSpace(a.Patch)
+	if !strings.Contains(patch, "@@") {
+		return "", fmt.Errorf("invalid patch format: missing @@ markers. The patch must be in unified diff format generated by make_patch tool")
+	}
+
+	targetPath := a.Path
+	if targetPath == "" {
+		sources, err := t.Backend.ListSources()
+		if err != nil || len(sources) == 0 {
+			return "", fmt.Errorf("could not determine target file")
+		}
+		targetPath = sources[0]
+	}
+
+	targetPath, err := t.Config.AllowedPath(t.Backend.Type(), targetPath, configuration.AccessRead)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+
+	contentBytes, err := os.ReadFile(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read target file %s: %w", targetPath, err)
+	}
+	originalContent := string(contentBytes)
+
+	newContent, hunks, err := configuration.PreviewUnifiedDiff(originalContent, patch)
+	if err != nil {
+		return "", fmt.Errorf("invalid patch: %w", err)
+	}
+
+	applies := true
+	for _, h := range hunks {
+		applies = applies && h.Applied
+	}
+
+	return marshalResult(map[string]interface{}{
+		"path":    targetPath,
+		"applies": applies,
+		"hunks":   hunks,
+		"diff":    displayDiff(originalContent, newContent),
+		"content": newContent,
+	})
+}
+
+// snapshotBeforeWrite backs up the backend's sources plus the target file
+// before it is modified, labelled with the change about to be made. It
+// returns the snapshot ID, or "" if snapshots are disabled.
+func snapshotBeforeWrite(snapshot *safety.SnapshotService, backend configuration.ConfigBackend, target, label string) (string, error) {
+	return snapshotFiles(snapshot, backend, label, target)
+}
+
+// snapshotFiles snapshots the backend's sources together with the targets
+// that exist
+func snapshotFiles(snapshot *safety.SnapshotService, backend configuration.ConfigBackend, label string, targets ...string) (string, error) {
+	if snapshot == nil {
+		return "", nil
+	}
+
+	sources, _ := backend.ListSources()
+	files := append([]string(nil), sources...)
+	for _, target := range targets {
+		if _, err := os.Stat(target); err == nil && !containsString(files, target) {
+			files = append(files, target)
+		}
+	}
+
+	id, err := snapshot.CreateSnapshot(files, label)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	return id, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Merge Tool ---
+
+type MergeConfigTool struct {
+	Config   *configuration.Config
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
+}
+
+type MergeConfigArgs struct {
+	SourcePath      string   `json:"source_path"`
+	SourceContent   string   `json:"source_content"`
+	TargetPath      string   `json:"target_path"`
+	Apply           bool     `json:"apply"`
+	AcceptConflicts []string `json:"accept_conflicts"`
+}
+
+type mergeResult struct {
+	Target     string `json:"target"`
+	Applied    bool   `json:"applied"`
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	*configuration.MergePlan
+	Overridden []string `json:"overridden,omitempty"`
+	Note       string   `json:"note,omitempty"`
+}
+
+func (t *MergeConfigTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "merge_config",
+		Description: "Merges settings from a second config (a file path or pasted content) into a target config without overwriting it. First call with apply=false to get the list of additions and conflicts (keys set to a different value) and show it to the user. After the user confirms, call again with apply=true; conflicting keys are only overridden if listed in accept_conflicts. A snapshot is taken before writing.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "source_path": {"type": "string", "description": "Path to the config file to merge from (must be in the allowed paths)"},
+                "source_content": {"type": "string", "description": "Pasted config content to merge from, used when source_path is empty"},
+                "target_path": {"type": "string", "description": "Config file to merge into. Defaults to the main config."},
+                "apply": {"type": "boolean", "description": "Write the merge to disk. Only set after the user has reviewed the plan."},
+                "accept_conflicts": {"type": "array", "items": {"type": "string"}, "description": "Conflicting option names (e.g. 'general:gaps_in') whose value should be taken from the source"}
+            },
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *MergeConfigTool) Mutating() bool {
+	return true
+}
+
+func (t *MergeConfigTool) Execute(args string) (string, error) {
+	var a MergeConfigArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	backendType := t.Backend.Type()
+
+	// Load the source settings
+	var source *configuration.IR
+	var err error
+	switch {
+	case a.SourcePath != "":
+		path, err := t.Config.AllowedPath(backendType, a.SourcePath, configuration.AccessRead)
+		if err != nil {
+			return "", fmt.Errorf("access denied: %v", err)
+		}
+		source, err = configuration.ParseFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse source file: %w", err)
+		}
+	case a.SourceContent != "":
+		source, err = configuration.ParseString(a.SourceContent)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse source content: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("either source_path or source_content is required")
+	}
+
+	// Resolve and load the target
+	targetPath, err := resolveTarget(t.Config, t.Backend, a.TargetPath)
+	if err != nil {
+		return "", err
+	}
+	target, err := configuration.ParseFile(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse target file %s: %w", targetPath, err)
+	}
+
+	plan := configuration.PlanMerge(target, source)
+	result := mergeResult{Target: targetPath, MergePlan: plan}
+
+	if !a.Apply {
+		if len(plan.Additions) == 0 && len(plan.Conflicts) == 0 {
+			result.Note = "Nothing to merge: every setting in the source already exists in the target."
+		} else {
+			result.Note = "Show these changes to the user. Ask how to resolve each conflict, then call merge_config again with apply=true and accept_conflicts listing the options to override."
+		}
+		return marshalResult(result)
+	}
+
+	// Only override conflicts the caller explicitly accepted
+	for _, c := range plan.Conflicts {
+		if containsString(a.AcceptConflicts, c.Name()) {
+			result.Overridden = append(result.Overridden, c.Name())
+		}
+	}
+	if len(plan.Additions) == 0 && len(result.Overridden) == 0 {
+		result.Note = "Nothing was written: no additions and no accepted conflicts."
+		return marshalResult(result)
+	}
+
+	merged := configuration.ApplyMerge(target, plan, a.AcceptConflicts)
+	// The model was told to ask first, but the user decides regardless
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Merge into %s?\n\n%s", targetPath, displayDiff(target.String(), merged.String()))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined the merge into %s; nothing was written", targetPath)
+		}
+	}
+
+	summary := fmt.Sprintf("Merged %d addition(s) and %d override(s) into %s", len(plan.Additions), len(result.Overridden), targetPath)
+	snapshotID, err := snapshotBeforeWrite(t.Snapshot, t.Backend, targetPath, summary)
+	if err != nil {
+		return "", err
+	}
+
+	if err := configuration.WriteFileAtomic(targetPath, []byte(merged.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write merged file: %w", err)
+	}
+
+	result.Applied = true
+	result.SnapshotID = snapshotID
+	t.Actions.Record(Action{Tool: "merge_config", Path: targetPath, SnapshotID: snapshotID, Hash: sha256Hex([]byte(merged.String())), Summary: summary})
+	return marshalResult(result)
+}
+
+// resolveTarget returns the file a write tool should modify, defaulting to the
+// backend's main config, and verifies that it may be written
+func resolveTarget(cfg *configuration.Config, backend configuration.ConfigBackend, path string) (string, error) {
+	if path == "" {
+		sources, err := backend.ListSources()
+		if err != nil || len(sources) == 0 {
+			return "", fmt.Errorf("could not determine target file")
+		}
+		path = sources[0]
+	}
+	path, err := cfg.AllowedPath(backend.Type(), path, configuration.AccessWrite)
+	if err != nil {
+		return "", fmt.Errorf("write access denied: %v", err)
+	}
+	return path, nil
+}
+
+func marshalResult(v interface{}) (string, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// --- Preset Tools ---
+
+type ListPresetsTool struct{}
+
+func (t *ListPresetsTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "list_presets",
+		Description: "Lists the built-in curated config presets (e.g. minimal tiling, eye-candy, gaming) with their descriptions and versions",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {},
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *ListPresetsTool) Execute(args string) (string, error) {
+	presets, err := configuration.Presets()
+	if err != nil {
+		return "", fmt.Errorf("failed to load presets: %w", err)
+	}
+	return marshalResult(presets)
+}
+
+type ApplyPresetTool struct {
+	Config   *configuration.Config
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
+}
+
+type ApplyPresetArgs struct {
+	Name        string   `json:"name"`
+	TargetPath  string   `json:"target_path"`
+	Apply       bool     `json:"apply"`
+	KeepCurrent []string `json:"keep_current"`
+}
+
+type presetResult struct {
+	Preset     string `json:"preset"`
+	Version    int    `json:"version"`
+	Target     string `json:"target"`
+	Applied    bool   `json:"applied"`
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	*configuration.MergePlan
+	Diff string `json:"diff,omitempty"`
+	Note string `json:"note,omitempty"`
+}
+
+func (t *ApplyPresetTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "apply_preset",
+		Description: "Previews or applies a built-in preset by merging it into the config. Call with apply=false first and show the returned diff to the user. Preset values replace the current ones except for options listed in keep_current; unrelated settings are never removed. After the user confirms, call again with apply=true. A snapshot is taken before writing.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "name": {"type": "string", "description": "Preset name as returned by list_presets"},
+                "target_path": {"type": "string", "description": "Config file to merge into. Defaults to the main config."},
+                "apply": {"type": "boolean", "description": "Write the change to disk. Only set after the user has reviewed the diff."},
+                "keep_current": {"type": "array", "items": {"type": "string"}, "description": "Option names (e.g. 'general:gaps_in') whose current value should be kept instead of the preset's"}
+            },
+            "required": ["name"],
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *ApplyPresetTool) Mutating() bool {
+	return true
+}
+
+func (t *ApplyPresetTool) Execute(args string) (string, error) {
+	var a ApplyPresetArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	preset, err := configuration.GetPreset(a.Name)
+	if err != nil {
+		return "", err
+	}
+	source, err := configuration.ParseString(preset.Content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse preset %s: %w", preset.Name, err)
+	}
+
+	targetPath, err := resolveTarget(t.Config, t.Backend, a.TargetPath)
+	if err != nil {
+		return "", err
+	}
+	target, err := configuration.ParseFile(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse target file %s: %w", targetPath, err)
+	}
+
+	// Preset values win unless the user asked to keep their own
+	plan := configuration.PlanMerge(target, source)
+	var override []string
+	for _, c := range plan.Conflicts {
+		if !containsString(a.KeepCurrent, c.Name()) {
+			override = append(override, c.Name())
+		}
+	}
+
+	original := target.String()
+	merged := configuration.ApplyMerge(target, plan, override).String()
+
+	result := presetResult{
+		Preset:    preset.Name,
+		Version:   preset.Version,
+		Target:    targetPath,
+		MergePlan: plan,
+	}
+
+	if merged == original {
+		result.Note = "The config already matches this preset; nothing to change."
+		return marshalResult(result)
+	}
+
+	if !a.Apply {
+		diff, err := makePatch(original, merged)
+		if err != nil {
+			return "", err
+		}
+		result.Diff = diff
+		result.Note = "Nothing was written. Calling apply_preset again with apply=true shows the user this diff and writes it only if they accept."
+		return marshalResult(result)
+	}
+
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Apply preset %s to %s?\n\n%s", preset.Name, targetPath, displayDiff(original, merged))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined preset %s; nothing was written", preset.Name)
+		}
+	}
+
+	summary := fmt.Sprintf("Applied preset %s to %s", result.Preset, targetPath)
+	snapshotID, err := snapshotBeforeWrite(t.Snapshot, t.Backend, targetPath, summary)
+	if err != nil {
+		return "", err
+	}
+	if err := configuration.WriteFileAtomic(targetPath, []byte(merged), 0644); err != nil {
+		return "", fmt.Errorf("failed to write preset: %w", err)
+	}
+
+	result.Applied = true
+	result.SnapshotID = snapshotID
+	t.Actions.Record(Action{Tool: "apply_preset", Path: targetPath, SnapshotID: snapshotID, Hash: sha256Hex([]byte(merged)), Summary: summary})
+	return marshalResult(result)
+}
+
+// --- Appearance Tools ---
+
+// gradientOptions are the options that accept a color gradient
+var gradientOptions = []string{
+	"general:col.active_border",
+	"general:col.inactive_border",
+	"group:col.border_active",
+	"group:col.border_inactive",
+	"group:col.border_locked_active",
+	"group:col.border_locked_inactive",
+}
+
+type SetBorderColorsTool struct {
+	Config   *configuration.Config
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
+}
+
+type SetBorderColorsArgs struct {
+	Option     string   `json:"option"`
+	Colors     []string `json:"colors"`
+	Angle      string   `json:"angle"`
+	TargetPath string   `json:"target_path"`
+	Apply      bool     `json:"apply"`
+}
+
+type borderColorsResult struct {
+	Option     string `json:"option"`
+	Value      string `json:"value"`
+	Target     string `json:"target"`
+	Applied    bool   `json:"applied"`
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	Diff       string `json:"diff,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+func (t *SetBorderColorsTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "set_border_colors",
+		Description: "Sets a window or group border to a solid color or gradient. Takes a list of colors and an optional angle and composes the exact Hyprland syntax (e.g. 'rgba(33ccffee) rgba(00ff99ee) 45deg'), rejecting malformed colors, missing 'deg' suffixes and more than 10 stops. Call with apply=false to preview the diff; with apply=true the user is asked to approve it. A snapshot is taken before writing.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "option": {"type": "string", "enum": ["general:col.active_border", "general:col.inactive_border", "group:col.border_active", "group:col.border_inactive", "group:col.border_locked_active", "group:col.border_locked_inactive"], "description": "Border option to set. Defaults to general:col.active_border."},
+                "colors": {"type": "array", "items": {"type": "string"}, "description": "1 to 10 colors, e.g. rgba(33ccffee), rgb(255, 0, 0) or 0xee33ccff"},
+                "angle": {"type": "string", "description": "Gradient angle in degrees, e.g. '45' or '45deg'. Omit for a horizontal gradient or a solid color."},
+                "target_path": {"type": "string", "description": "Config file to edit. Defaults to the main config."},
+                "apply": {"type": "boolean", "description": "Write the change to disk. Only set after the user has reviewed the diff."}
+            },
+            "required": ["colors"],
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *SetBorderColorsTool) Mutating() bool {
+	return true
+}
+
+func (t *SetBorderColorsTool) Execute(args string) (string, error) {
+	var a SetBorderColorsArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Option == "" {
+		a.Option = gradientOptions[0]
+	}
+	if !containsString(gradientOptions, a.Option) {
+		return "", fmt.Errorf("unsupported option %q: expected one of %s", a.Option, strings.Join(gradientOptions, ", "))
+	}
+
+	value, err := configuration.ComposeGradient(a.Colors, a.Angle)
+	if err != nil {
+		return "", err
+	}
+
+	targetPath, err := resolveTarget(t.Config, t.Backend, a.TargetPath)
+	if err != nil {
+		return "", err
+	}
+	ir, err := configuration.ParseFile(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse target file %s: %w", targetPath, err)
+	}
+
+	original := ir.String()
+	split := strings.LastIndex(a.Option, ":")
+	configuration.SetValue(ir, a.Option[:split], a.Option[split+1:], value, false)
+	modified := ir.String()
+
+	result := borderColorsResult{Option: a.Option, Value: value, Target: targetPath}
+	if modified == original {
+		result.Note = fmt.Sprintf("%s is already set to this value; nothing to change.", a.Option)
+		return marshalResult(result)
+	}
+
+	if !a.Apply {
+		diff, err := makePatch(original, modified)
+		if err != nil {
+			return "", err
+		}
+		result.Diff = diff
+		result.Note = "Preview only. With apply=true the user is asked to approve this diff before the border is changed."
+		return marshalResult(result)
+	}
+
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Set %s = %s in %s?\n\n%s", a.Option, value, targetPath, displayDiff(original, modified))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined setting %s; nothing was written", a.Option)
+		}
+	}
+
+	summary := fmt.Sprintf("Set %s = %s", a.Option, value)
+	snapshotID, err := snapshotBeforeWrite(t.Snapshot, t.Backend, targetPath, summary)
+	if err != nil {
+		return "", err
+	}
+	if err := configuration.WriteFileAtomic(targetPath, []byte(modified), 0644); err != nil {
+		return "", fmt.Errorf("failed to write config: %w", err)
+	}
+
+	result.Applied = true
+	result.SnapshotID = snapshotID
+	t.Actions.Record(Action{Tool: "set_border_colors", Path: targetPath, SnapshotID: snapshotID, Hash: sha256Hex([]byte(modified)), Summary: summary})
+	return marshalResult(result)
+}
+
+// --- Idle & Lock Screen Tools ---
+
+// idleLockPath locates hypridle.conf / hyprlock.conf next to the main config
+// and checks that it may be accessed with mode
+func idleLockPath(cfg *configuration.Config, backend configuration.ConfigBackend, name string, mode configuration.AccessMode) (string, error) {
+	sources, err := backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine config root")
+	}
+	path := filepath.Join(filepath.Dir(sources[0]), name)
+	allowed, err := cfg.IsPathAllowed(backend.Type(), path, mode)
+	if err != nil || !allowed {
+		return "", fmt.Errorf("access denied: %v", err)
+	}
+	return path, nil
+}
+
+type idleLockFileInfo struct {
+	Path   string                `json:"path"`
+	Exists bool                  `json:"exists"`
+	Blocks []configuration.Block `json:"blocks,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
+type IdleLockInfoTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+func (t *IdleLockInfoTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "inspect_idle_lock",
+		Description: "Parses hypridle.conf (general and listener blocks: timeout, on-timeout, on-resume) and hyprlock.conf (general, background, input-field, label blocks) and returns their blocks as structured data",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {},
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *IdleLockInfoTool) Execute(args string) (string, error) {
+	result := make(map[string]idleLockFileInfo)
+	for _, name := range []string{configuration.HypridleFile, configuration.HyprlockFile} {
+		info := idleLockFileInfo{}
+		path, err := idleLockPath(t.Config, t.Backend, name, configuration.AccessRead)
+		if err != nil {
+			info.Error = err.Error()
+			result[name] = info
+			continue
+		}
+		info.Path = path
+		if ir, err := configuration.ParseFile(path); err == nil {
+			info.Exists = true
+			info.Blocks = configuration.Blocks(ir)
+		} else if !os.IsNotExist(err) {
+			info.Error = err.Error()
+		}
+		result[name] = info
+	}
+	return marshalResult(result)
+}
+
+type blockEditResult struct {
+	Path  string `json:"path"`
+	Block string `json:"block"`
+	Patch string `json:"patch"`
+	Note  string `json:"note"`
+}
+
+// editIdleLockFile loads the file, applies edit to its IR and returns the
+// edited block together with a patch for apply_patch
+func editIdleLockFile(path string, edit func(ir *configuration.IR) (*configuration.Block, error)) (string, error) {
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	original := string(contentBytes)
+
+	ir, err := configuration.ParseString(original)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	block, err := edit(ir)
+	if err != nil {
+		return "", err
+	}
+
+	patch, err := makePatch(original, ir.String())
+	if err != nil {
+		return "", err
+	}
+
+	return marshalResult(blockEditResult{
+		Path:  path,
+		Block: configuration.BlockText(ir, block),
+		Patch: patch,
+		Note:  "Show the block to the user. After confirmation, call apply_patch with this path and patch.",
+	})
+}
+
+type SetIdleListenerTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type SetIdleListenerArgs struct {
+	Timeout      int    `json:"timeout"`
+	OnTimeout    string `json:"on_timeout"`
+	OnResume     string `json:"on_resume"`
+	MatchTimeout int    `json:"match_timeout"`
+}
+
+func (t *SetIdleListenerTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "set_idle_listener",
+		Description: "Adds or updates a hypridle listener block (timeout in seconds, on-timeout and on-resume commands). Returns the resulting block and a patch; nothing is written until apply_patch is called.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "timeout": {"type": "integer", "description": "Idle time in seconds before on_timeout runs"},
+                "on_timeout": {"type": "string", "description": "Command to run on timeout, e.g. 'loginctl lock-session'"},
+                "on_resume": {"type": "string", "description": "Command to run when activity resumes, e.g. 'hyprctl dispatch dpms on'"},
+                "match_timeout": {"type": "integer", "description": "Timeout of an existing listener to edit. Defaults to timeout; a new listener is added if none matches."}
+            },
+            "required": ["timeout"],
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *SetIdleListenerTool) Execute(args string) (string, error) {
+	var a SetIdleListenerArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.MatchTimeout == 0 {
+		a.MatchTimeout = a.Timeout
+	}
+
+	path, err := idleLockPath(t.Config, t.Backend, configuration.HypridleFile, configuration.AccessWrite)
+	if err != nil {
+		return "", err
+	}
+
+	return editIdleLockFile(path, func(ir *configuration.IR) (*configuration.Block, error) {
+		block, exists := configuration.FindListener(ir, a.MatchTimeout)
+
+		onTimeout, onResume := a.OnTimeout, a.OnResume
+		if exists {
+			if onTimeout == "" {
+				onTimeout = block.Settings["on-timeout"]
+			}
+			if onResume == "" {
+				onResume = block.Settings["on-resume"]
+			}
+		}
+		if err := configuration.ValidateListener(a.Timeout, onTimeout, onResume); err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			settings := []configuration.BlockSetting{{Key: "timeout", Value: fmt.Sprint(a.Timeout)}}
+			if onTimeout != "" {
+				settings = append(settings, configuration.BlockSetting{Key: "on-timeout", Value: onTimeout})
+			}
+			if onResume != "" {
+				settings = append(settings, configuration.BlockSetting{Key: "on-resume", Value: onResume})
+			}
+			return configuration.AppendBlock(ir, "listener", settings...), nil
+		}
+
+		configuration.SetBlockValue(ir, block, "timeout", fmt.Sprint(a.Timeout))
+		if a.OnTimeout != "" {
+			configuration.SetBlockValue(ir, block, "on-timeout", a.OnTimeout)
+		}
+		if a.OnResume != "" {
+			configuration.SetBlockValue(ir, block, "on-resume", a.OnResume)
+		}
+		return block, nil
+	})
+}
+
+type SetLockSettingTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+}
+
+type SetLockSettingArgs struct {
+	Block string `json:"block"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Index int    `json:"index"`
+}
+
+func (t *SetLockSettingTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "set_lock_setting",
+		Description: "Sets a validated hyprlock option in the general, background or input-field block (e.g. background:path, background:blur_passes, input-field:size, input-field:outer_color). Returns the resulting block and a patch; nothing is written until apply_patch is called.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "block": {"type": "string", "enum": ["general", "background", "input-field"]},
+                "key": {"type": "string", "description": "Option name inside the block, e.g. 'blur_passes'"},
+                "value": {"type": "string", "description": "New value, e.g. '3', 'rgba(1e1e2eff)' or '250, 50'"},
+                "index": {"type": "integer", "description": "Which block to edit when there are several of the same kind (0-based, default 0)"}
+            },
+            "required": ["block", "key", "value"],
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *SetLockSettingTool) Execute(args string) (string, error) {
+	var a SetLockSettingArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+	if err := configuration.ValidateHyprlockOption(a.Block, a.Key, a.Value); err != nil {
+		return "", err
+	}
+
+	path, err := idleLockPath(t.Config, t.Backend, configuration.HyprlockFile, configuration.AccessWrite)
+	if err != nil {
+		return "", err
+	}
+
+	return editIdleLockFile(path, func(ir *configuration.IR) (*configuration.Block, error) {
+		block, ok := configuration.FindBlock(ir, a.Block, a.Index)
+		if !ok {
+			if a.Index > 0 {
+				return nil, fmt.Errorf("hyprlock.conf has no %s block with index %d", a.Block, a.Index)
+			}
+			return configuration.AppendBlock(ir, a.Block, configuration.BlockSetting{Key: a.Key, Value: a.Value}), nil
+		}
+		configuration.SetBlockValue(ir, block, a.Key, a.Value)
+		return block, nil
+	})
+}
+
+// --- Hyprland Session Tools ---
+
+// reloadHyprland reloads the running compositor and returns the config
+// errors it reports. failure explains why reloading or checking was not
+// possible.
+func reloadHyprland() (errs []string, failure string) {
+	if err := hyprctl.Check(); err != nil {
+		return nil, fmt.Sprintf("Reload skipped: %v.", err)
+	}
+	if err := hyprctl.Reload(); err != nil {
+		return nil, fmt.Sprintf("Reload failed: %v", err)
+	}
+
+	errs, err := hyprctl.ConfigErrors()
+	if err != nil {
+		return nil, fmt.Sprintf("Reloaded Hyprland, but could not check for config errors: %v", err)
+	}
+	return errs, ""
+}
+
+// reloadAndVerify reloads the running compositor and reports any config
+// errors, suggesting a rollback to snapshotID when there are some
+func reloadAndVerify(snapshotID string) string {
+	errs, failure := reloadHyprland()
+	if failure != "" {
+		return failure
+	}
+	if len(errs) == 0 {
+		return "Reloaded Hyprland with no config errors."
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Reloaded Hyprland, which reported config errors:\n")
+	for _, e := range errs {
+		fmt.Fprintf(&sb, "- %s\n", e)
+	}
+	if snapshotID != "" {
+		fmt.Fprintf(&sb, "Offer the user to undo this change with rollback (snapshot_id %q).", snapshotID)
+	} else {
+		sb.WriteString("Offer the user to undo this change with rollback.")
+	}
+	return sb.String()
+}
+
+// reloadOrRollback reloads Hyprland after a patch, and if it reports config
+// errors that were not in before, restores the snapshot taken before the
+// patch and reloads again, so the broken config does not stay loaded.
+// rolledBack reports whether the snapshot was restored.
+func (t *ApplyPatchTool) reloadOrRollback(snapshotID string, before []string) (report string, rolledBack bool) {
+	errs, failure := reloadHyprland()
+	added := newConfigErrors(errs, before)
+	switch {
+	case failure != "":
+		return failure, false
+	case len(errs) == 0:
+		return "Reloaded Hyprland with no config errors.", false
+	case len(added) == 0:
+		return fmt.Sprintf("Reloaded Hyprland. It still reports the config errors it had before the patch, so the patch was kept: %s.", strings.Join(errs, "; ")), false
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Reloaded Hyprland, which reported new config errors:\n")
+	for _, e := range added {
+		fmt.Fprintf(&sb, "- %s\n", e)
+	}
+
+	restored, err := t.Snapshot.Restore(snapshotID)
+	if err != nil {
+		fmt.Fprintf(&sb, "Rolling back to snapshot %s failed: %v. Tell the user their config has errors and offer rollback (snapshot_id %q).", snapshotID, err, snapshotID)
+		return sb.String(), false
+	}
+	if i, _, ok := t.Actions.LastUndoable(); ok {
+		t.Actions.MarkUndone(i)
+	}
+	t.Actions.Record(Action{Tool: "rollback", Summary: fmt.Sprintf("Rolled back %d file(s) to snapshot %s after Hyprland reported config errors", len(restored), snapshotID)})
+
+	fmt.Fprintf(&sb, "The patch was rolled back automatically: %d file(s) were restored from snapshot %s. ", len(restored), snapshotID)
+	after, failure := reloadHyprland()
+	switch {
+	case failure != "":
+		fmt.Fprintf(&sb, "Reloading the previous config did not work (%s); ask the user to run 'hyprctl reload'.", strings.TrimSuffix(failure, "."))
+	case len(after) > 0:
+		fmt.Fprintf(&sb, "Hyprland still reports errors with the previous config: %s.", strings.Join(after, "; "))
+	default:
+		sb.WriteString("Hyprland was reloaded with the previous config, which has no errors.")
+	}
+	sb.WriteString(" Tell the user what went wrong; the change is no longer applied.")
+	return sb.String(), true
+}
+
+// configErrorLine matches the line number in a Hyprland config error, which
+// shifts when a patch adds or removes lines above it
+var configErrorLine = regexp.MustCompile(`at line \d+`)
+
+// newConfigErrors returns the errors in after that are not in before,
+// ignoring line numbers
+func newConfigErrors(after, before []string) []string {
+	seen := make(map[string]int)
+	for _, e := range before {
+		seen[configErrorLine.ReplaceAllString(e, "at line")]++
+	}
+	var added []string
+	for _, e := range after {
+		key := configErrorLine.ReplaceAllString(e, "at line")
+		if seen[key] > 0 {
+			seen[key]--
+			continue
+		}
+		added = append(added, e)
+	}
+	return added
+}
+
+type ReloadTool struct {
+	// Allowed is set from allow_reload; reloading is refused without it
+	Allowed bool
+}
+
+func (t *ReloadTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "reload",
+		Description: "Runs 'hyprctl reload' in the live Hyprland session and reports any config errors afterwards. Ask the user before reloading.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {},
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *ReloadTool) Mutating() bool {
+	return true
+}
+
+func (t *ReloadTool) Execute(args string) (string, error) {
+	if !t.Allowed {
+		return "Reloading is disabled (set allow_reload = true under [agent] to enable it). Ask the user to run 'hyprctl reload' themselves.", nil
+	}
+	if err := hyprctl.Check(); err != nil {
+		return "", fmt.Errorf("cannot reload: %w", err)
+	}
+	return reloadAndVerify(""), nil
+}
+
+type ConfigErrorsTool struct{}
+
+func (t *ConfigErrorsTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "config_errors",
+		Description: "Returns the config errors reported by the running Hyprland session ('hyprctl configerrors')",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {},
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *ConfigErrorsTool) Execute(args string) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *ConfigErrorsTool) ExecuteContext(ctx context.Context, args string) (string, error) {
+	if !hyprctl.Available() {
+		return "", fmt.Errorf("no running Hyprland session or hyprctl not found")
+	}
+	errs, err := hyprctl.ConfigErrorsContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(errs) == 0 {
+		return "Hyprland reports no config errors.", nil
+	}
+	return marshalResult(errs)
+}
+
+// liveStateQueries are the hyprctl subcommands query_hyprland can run
+var liveStateQueries = []string{"monitors", "workspaces", "activewindow"}
+
+type QueryHyprlandTool struct{}
+
+type QueryHyprlandArgs struct {
+	What string `json:"what"`
+}
+
+func (t *QueryHyprlandTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "query_hyprland",
+		Description: "Returns the live state of the running Hyprland session from hyprctl: the connected monitors (names such as DP-2, resolutions, scale), the workspaces, and the active window. Use it when a request names a monitor, workspace or window, since the config may not list them.",
+		Parameters: json.RawMessage(`{
+            "type": "object",
+            "properties": {
+                "what": {"type": "string", "enum": ["all", "monitors", "workspaces", "activewindow"], "description": "What to query (default: all)"}
+            },
+            "additionalProperties": false
+        }`),
+	}
+}
+
+func (t *QueryHyprlandTool) Execute(args string) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *QueryHyprlandTool) ExecuteContext(ctx context.Context, args string) (string, error) {
+	var a QueryHyprlandArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	queries := liveStateQueries
+	if a.What != "" && a.What != "all" {
+		if !containsString(liveStateQueries, a.What) {
+			return "", fmt.Errorf("unknown query %q; use one of: all, %s", a.What, strings.Join(liveStateQueries, ", "))
+		}
+		queries = []string{a.What}
+	}
+
+	// Without a session the config is all there is; say so instead of failing
+	if err := hyprctl.Check(); err != nil {
+		return fmt.Sprintf("Live state is unavailable: %v. Work from the config files instead, and ask the user for monitor or workspace names if needed.", err), nil
+	}
+
+	result := make(map[string]json.RawMessage)
+	for _, q := range queries {
+		out, err := hyprctl.QueryContext(ctx, q)
+		if err != nil {
+			return "", err
+		}
+		result[q] = out
+	}
+	return marshalResult(result)
+}
+
+// --- Companion App Tools ---
+// Configs of apps such as waybar, rofi and mako that Hyprland launches. They
+// live outside ~/.config/hypr, so access is limited to [security.companions].
+
+type ReadCompanionFileTool struct {
+	Config *configuration.Config
+}
+
+type CompanionFileArgs struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+func (t *ReadCompanionFileTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "read_companion_file",
+		Description: "Reads a config file of a companion app (waybar, rofi, mako, ...) from the directories the user opted in to. Not for Hyprland config files; use read_file for those.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path": {"type": "string", "description": "Path relative to ~/.config (e.g. 'waybar/config.jsonc') or absolute"}
+			},
+			"required": ["path"],
+			"additionalProperties": false
+		}`),
+	}
+}
+
+func (t *ReadCompanionFileTool) Execute(args string) (string, error) {
+	var a CompanionFileArgs
+	if err := ParseArgs(args, &a); err != nil {
+		return "", err
+	}
+
+	path, err := t.Config.CompanionPath(a.Path)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %v", err)
 	}
-
-	if len(results) >= maxResults {
-		results = append(results, "... (results truncated)")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
-
-	return strings.Join(results, "\n"), nil
-}
-
-type ListDirTool struct {
-	Config  *configuration.Config
-	Backend configuration.ConfigBackend
+	if len(content) > maxReadFileSize {
+		return "", fmt.Errorf("file too large (%d bytes). Max allowed is %d bytes", len(content), maxReadFileSize)
+	}
+	if strings.Contains(string(content), "\x00") {
+		return "", fmt.Errorf("file appears to be binary (contains null bytes). Cannot read binary files")
+	}
+	return string(content), nil
 }
 
-type ListDirArgs struct {
-	Path string `json:"path"`
+type WriteCompanionFileTool struct {
+	Config   *configuration.Config
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
 }
 
-func (t *ListDirTool) Definition() ToolDefinition {
+func (t *WriteCompanionFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
-		Name:        "list_dir",
-		Description: "Lists the contents of a directory within allowed Hyprland configuration directories",
+		Name:        "write_companion_file",
+		Description: "Writes the full new content of a companion app config (waybar, rofi, mako, ...) in the directories the user opted in to. The existing file is snapshotted and the user confirms the diff before anything is written. Not for Hyprland config files.",
 		Parameters: json.RawMessage(`{
 			"type": "object",
 			"properties": {
-				"path": {"type": "string", "description": "The path to the directory to list"}
+				"path": {"type": "string", "description": "Path relative to ~/.config (e.g. 'waybar/style.css') or absolute"},
+				"content": {"type": "string", "description": "The full content of the file"}
 			},
-			"required": ["path"],
+			"required": ["path", "content"],
 			"additionalProperties": false
 		}`),
 	}
 }
 
-func (t *ListDirTool) Execute(args string) (string, error) {
-	var a ListDirArgs
+func (t *WriteCompanionFileTool) Mutating() bool {
+	return true
+}
+
+func (t *WriteCompanionFileTool) Execute(args string) (string, error) {
+	var a CompanionFileArgs
 	if err := ParseArgs(args, &a); err != nil {
 		return "", err
 	}
 
-	// Use active backend
-	backendType := t.Backend.Type()
+	path, err := t.Config.CompanionPath(a.Path)
+	if err != nil {
+		return "", fmt.Errorf("write access denied: %v", err)
+	}
 
-	// Validate path is allowed
-	allowed, err := t.Config.IsPathAllowed(backendType, a.Path)
-	if err != nil || !allowed {
-		return "", fmt.Errorf("access denied: %v", err)
+	var original string
+	existing, err := os.ReadFile(path)
+	exists := err == nil
+	if exists {
+		original = string(existing)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if exists && original == a.Content {
+		return fmt.Sprintf("%s already has this content; nothing to change.", path), nil
 	}
 
-	entries, err := os.ReadDir(a.Path)
-	if err != nil {
-		return "", fmt.Errorf("failed to read directory: %w", err)
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Write companion config %s?\n\n%s", path, displayDiff(original, a.Content))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined the change to %s; nothing was written", path)
+		}
 	}
 
-	var names []string
-	for _, entry := range entries {
-		name := entry.Name()
-		if entry.IsDir() {
-			name += "/"
+	// Never replace an existing file without a backup of it
+	var snapshotID string
+	if exists {
+		if t.Snapshot == nil {
+			return "", fmt.Errorf("refusing to overwrite %s: snapshot service is not available", path)
+		}
+		snapshotID, err = t.Snapshot.CreateSnapshot([]string{path}, fmt.Sprintf("Replaced %s", path))
+		if err != nil {
+			return "", fmt.Errorf("refusing to overwrite %s: failed to create snapshot: %w", path, err)
 		}
-		names = append(names, name)
 	}
 
-	result, err := json.Marshal(names)
-	if err != nil {
-		return "", err
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
 	}
-	return string(result), nil
+	if err := configuration.WriteFileAtomic(path, []byte(a.Content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if !exists {
+		t.Actions.Record(Action{Tool: "write_companion_file", Path: path, Hash: sha256Hex([]byte(a.Content)), Summary: fmt.Sprintf("Created %s", path)})
+		return fmt.Sprintf("Created %s (%d bytes). The app may need a restart to pick it up.", path, len(a.Content)), nil
+	}
+	t.Actions.Record(Action{Tool: "write_companion_file", Path: path, SnapshotID: snapshotID, Hash: sha256Hex([]byte(a.Content)), Summary: fmt.Sprintf("Replaced %s", path)})
+	return fmt.Sprintf("Replaced %s (%d bytes). Snapshot %s was taken first; to undo, call rollback with snapshot_id %q. The app may need a restart to pick it up.", path, len(a.Content), snapshotID, snapshotID), nil
 }
 
-// --- Parsing Tools ---
+// --- Rollback Tools ---
 
-type ParseConfigTool struct {
-	Backend configuration.ConfigBackend
+type ListSnapshotsTool struct {
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
 }
 
-type ParseConfigArgs struct {
-	Path string `json:"path"` // Optional, if specific file needed, otherwise uses backend logic
+type ListSnapshotsArgs struct {
+	Limit int `json:"limit"`
 }
 
-func (t *ParseConfigTool) Definition() ToolDefinition {
+type snapshotListing struct {
+	safety.SnapshotInfo
+	Change string `json:"change,omitempty"` // The change made right after the snapshot this session, if the label does not already say so
+}
+
+func (t *ListSnapshotsTool) Definition() ToolDefinition {
 	return ToolDefinition{
-		Name:        "parse_config",
-		Description: "Parses the configuration into a structured format",
+		Name:        "list_snapshots",
+		Description: "Lists the available rollback points, newest first, with when each snapshot was taken, the files it contains and a label describing the change made right after it. Use it to pick the snapshot_id for 'rollback'.",
 		Parameters: json.RawMessage(`{
 			"type": "object",
 			"properties": {
-				"path": {"type": "string"}
+				"limit": {"type": "integer", "description": "Maximum number of snapshots to return (default 20)"}
 			},
 			"additionalProperties": false
 		}`),
 	}
 }
 
-func (t *ParseConfigTool) Execute(args string) (string, error) {
-	// Use active backend directly
-	ir, err := t.Backend.Parse()
-	if err != nil {
+func (t *ListSnapshotsTool) Execute(args string) (string, error) {
+	var a ListSnapshotsArgs
+	if err := ParseArgs(args, &a); err != nil {
 		return "", err
 	}
-	// Serialize IR to JSON for the LLM
-	irJSON, err := json.Marshal(ir)
+	if t.Snapshot == nil {
+		return "", fmt.Errorf("snapshot service is not available")
+	}
+	if a.Limit <= 0 {
+		a.Limit = 20
+	}
+
+	infos, err := t.Snapshot.List()
 	if err != nil {
 		return "", err
 	}
-	return string(irJSON), nil
-}
+	if len(infos) == 0 {
+		return "No snapshots found; nothing has been backed up yet.", nil
+	}
+	if len(infos) > a.Limit {
+		infos = infos[:a.Limit]
+	}
 
-// --- Patch Tools ---
+	changes := make(map[string]string)
+	for _, act := range t.Actions.Entries() {
+		if act.SnapshotID != "" {
+			changes[act.SnapshotID] = act.Summary
+		}
+	}
 
-type MakePatchTool struct{}
+	listing := make([]snapshotListing, len(infos))
+	for i, info := range infos {
+		listing[i] = snapshotListing{SnapshotInfo: info}
+		if change := changes[info.ID]; change != info.Label {
+			listing[i].Change = change
+		}
+	}
+	return marshalResult(listing)
+}
 
-type MakePatchArgs struct {
-	Original string `json:"original"`
-	Modified string `json:"modified"`
+type RollbackTool struct {
+	Backend  configuration.ConfigBackend
+	Snapshot *safety.SnapshotService
+	Actions  *ActionLog
+	Confirm  func(action string) bool // Callback for user confirmation
 }
 
-func (t *MakePatchTool) Definition() ToolDefinition {
+type RollbackArgs struct {
+	SnapshotID string `json:"snapshot_id"` // Optional, if not provided uses latest
+}
+
+func (t *RollbackTool) Definition() ToolDefinition {
 	return ToolDefinition{
-		Name:        "make_patch",
-		Description: "Creates a patch between original and modified content. Returns an INTERNAL OPAQUE STRING. You MUST pass this string EXACTLY as-is to apply_patch. DO NOT try to read, parse, or validate the patch content yourself.",
+		Name:        "rollback",
+		Description: "Restores every file in a previous snapshot to its original location and reports which files were restored",
 		Parameters: json.RawMessage(`{
             "type": "object",
             "properties": {
-                "original": {"type": "string", "description": "The original file content"},
-                "modified": {"type": "string", "description": "The modified file content"}
+                "snapshot_id": {"type": "string", "description": "The ID of the snapshot to restore. If empty, restores the latest."}
             },
-            "required": ["original", "modified"]
+            "additionalProperties": false
         }`),
 	}
 }
 
-func (t *MakePatchTool) Execute(args string) (string, error) {
-	var a MakePatchArgs
+func (t *RollbackTool) Mutating() bool {
+	return true
+}
+
+func (t *RollbackTool) Execute(args string) (string, error) {
+	var a RollbackArgs
 	if err := ParseArgs(args, &a); err != nil {
 		return "", err
 	}
 
-	dmp := diffmatchpatch.New()
+	if t.Snapshot == nil {
+		return "", fmt.Errorf("snapshot service is not available")
+	}
+
+	id := a.SnapshotID
+	if id == "" {
+		latest, err := t.Snapshot.Latest()
+		if err != nil {
+			return "", fmt.Errorf("no snapshot to roll back to: %w", err)
+		}
+		id = latest
+	}
+	m, err := t.Snapshot.ReadManifest(id)
+	if err != nil {
+		return "", fmt.Errorf("rollback failed: %w", err)
+	}
+	var files, current []string
+	for _, entry := range m.Files {
+		files = append(files, entry.Original)
+		if _, err := os.Stat(entry.Original); err == nil {
+			current = append(current, entry.Original)
+		}
+	}
 
-	// Use Line-Mode diffing for safer config patching
-	// This prevents mid-line edits and ensures whole lines are added/removed/kept
-	text1, text2, linearray := dmp.DiffLinesToChars(a.Original, a.Modified)
-	diffs := dmp.DiffMain(text1, text2, false)
-	diffs = dmp.DiffCharsToLines(diffs, linearray)
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Restore snapshot %s?", id)
+		if m.Label != "" {
+			action += fmt.Sprintf(" (taken before: %s)", m.Label)
+		}
+		action += "\nThese files will be overwritten:\n- " + strings.Join(files, "\n- ")
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined restoring snapshot %s; nothing was changed", id)
+		}
+	}
 
-	patches := dmp.PatchMake(a.Original, diffs)
-	patchText := dmp.PatchToText(patches)
+	// The rollback itself can be undone. Pruning after the new snapshot could
+	// delete the one being restored, so it waits until the restore is done
+	unpruned := *t.Snapshot
+	unpruned.MaxSnapshots, unpruned.MaxAge = 0, 0
+	defer t.Snapshot.Prune(t.Snapshot.MaxSnapshots, t.Snapshot.MaxAge)
+	before, err := snapshotFiles(&unpruned, t.Backend, "Before restoring snapshot "+id, current...)
+	if err != nil {
+		return "", fmt.Errorf("refusing to roll back: %w", err)
+	}
 
-	// Validate the patch is not empty
-	if strings.TrimSpace(patchText) == "" {
-		return "", fmt.Errorf("no changes detected between original and modified content")
+	restored, err := t.Snapshot.Restore(id)
+	if err != nil {
+		if len(restored) > 0 {
+			return "", fmt.Errorf("rollback of snapshot %s partially failed after restoring %s; snapshot %s holds the files as they were before: %w", id, strings.Join(restored, ", "), before, err)
+		}
+		return "", fmt.Errorf("rollback failed: %w", err)
 	}
 
-	return patchText, nil
+	summary := fmt.Sprintf("Rolled back %d file(s) to snapshot %s; the replaced files are in snapshot %s", len(restored), id, before)
+	t.Actions.Record(Action{Tool: "rollback", SnapshotID: before, Summary: summary})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Restored %d file(s) from snapshot %s:\n", len(restored), id)
+	if m.Label != "" {
+		fmt.Fprintf(&sb, "(taken before: %s)\n", m.Label)
+	}
+	for _, path := range restored {
+		fmt.Fprintf(&sb, "- %s\n", path)
+	}
+	fmt.Fprintf(&sb, "Snapshot %s holds the files as they were before the rollback; to undo it, call rollback with snapshot_id %q.\n", before, before)
+	return sb.String(), nil
 }
 
-type ApplyPatchTool struct {
+type UndoLastPatchTool struct {
 	Backend  configuration.ConfigBackend
 	Snapshot *safety.SnapshotService
-	Config   *configuration.Config
+	Actions  *ActionLog
 	Confirm  func(action string) bool // Callback for user confirmation
 }
 
-type ApplyPatchArgs struct {
-	Path  string `json:"path"`
-	Patch string `json:"patch"`
-}
-
-func (t *ApplyPatchTool) Definition() ToolDefinition {
+func (t *UndoLastPatchTool) Definition() ToolDefinition {
 	return ToolDefinition{
-		Name:        "apply_patch",
-		Description: "Applies a patch generated by make_patch. The 'patch' argument MUST be the exact raw output string from a previous make_patch call. REQUIRES user confirmation.",
+		Name:        "undo_last_patch",
+		Description: "Undoes only the most recent change made this session (apply_patch, write_file, move_file, ...), restoring just the file it touched; other files are left alone. Call it again to undo the change before. Use rollback to restore a whole snapshot instead.",
 		Parameters: json.RawMessage(`{
-            "type": "object",
-            "properties": {
-                "path": {"type": "string", "description": "Optional path to the file to patch"},
-                "patch": {"type": "string"}
-            },
-            "required": ["patch"]
-        }`),
+			"type": "object",
+			"properties": {},
+			"additionalProperties": false
+		}`),
 	}
 }
 
-func (t *ApplyPatchTool) Execute(args string) (string, error) {
-	var a ApplyPatchArgs
+func (t *UndoLastPatchTool) Mutating() bool {
+	return true
+}
+
+func (t *UndoLastPatchTool) Execute(args string) (string, error) {
+	var a struct{}
 	if err := ParseArgs(args, &a); err != nil {
 		return "", err
 	}
+	if t.Snapshot == nil {
+		return "", fmt.Errorf("snapshot service is not available")
+	}
+	index, act, ok := t.Actions.LastUndoable()
+	if !ok {
+		return "Nothing to undo: every change made this session has already been undone, or none was made.", nil
+	}
 
-	// CLEANUP: Strip code blocks if present
-	patch := a.Patch
-
-	// Remove markdown code blocks (```diff, ```, etc.)
-	if strings.Contains(patch, "```") {
-		lines := strings.Split(patch, "\n")
-		var cleanLines []string
-		inBlock := false
-		for _, line := range lines {
-			trimmed := strings.TrimSpace(line)
-			if strings.HasPrefix(trimmed, "```") {
-				inBlock = !inBlock
+	// A file the change created is deleted, but only if it is still as written
+	paths := []string{act.Path}
+	if act.Source != "" {
+		paths = append(paths, act.Source)
+	}
+	var plan []string
+	for _, path := range paths {
+		if act.SnapshotID != "" {
+			if m, err := t.Snapshot.ReadManifest(act.SnapshotID); err == nil && snapshotContains(m, path) {
+				plan = append(plan, "restore "+path)
 				continue
 			}
-			if !inBlock {
-				cleanLines = append(cleanLines, line)
-			}
 		}
-		patch = strings.Join(cleanLines, "\n")
-	}
-
-	// Remove common LLM conversational wrappers
-	lines := strings.Split(patch, "\n")
-	var filteredLines []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		// Skip decorative lines
-		if strings.HasPrefix(trimmed, "***") ||
-			strings.HasPrefix(trimmed, "---") && !strings.Contains(line, "@@") ||
-			strings.HasPrefix(trimmed, "Here is") ||
-			strings.HasPrefix(trimmed, "Shall I") {
-			continue
+		if act.Tool != "move_file" && act.Hash != "" {
+			data, err := os.ReadFile(path)
+			if err == nil && sha256Hex(data) != act.Hash {
+				return "", fmt.Errorf("refusing to delete %s: it has changed since %q", path, act.Summary)
+			}
 		}
-		filteredLines = append(filteredLines, line)
-	}
-	patch = strings.Join(filteredLines, "\n")
-	patch = strings.TrimSpace(patch)
-
-	// Validate patch format
-	if !strings.Contains(patch, "@@") {
-		return "", fmt.Errorf("invalid patch format: missing @@ markers. The patch must be in unified diff format generated by make_patch tool")
+		plan = append(plan, "delete "+path)
 	}
 
-	// Use active backend directly
-	activeBackend := t.Backend
-	backendType := t.Backend.Type()
-
-	// Determine target file and validate it's allowed
-	targetPath := a.Path
-	if targetPath == "" {
-		sources, err := activeBackend.ListSources()
-		if err != nil || len(sources) == 0 {
-			return "", fmt.Errorf("could not determine target file")
+	if t.Confirm != nil {
+		action := fmt.Sprintf("Undo %q?\nThis will:\n- %s", act.Summary, strings.Join(plan, "\n- "))
+		if !t.Confirm(action) {
+			return "", fmt.Errorf("the user declined undoing %q; nothing was changed", act.Summary)
 		}
-		targetPath = sources[0]
-	}
-
-	// Validate path is allowed for write operations
-	allowed, err := t.Config.IsPathAllowed(backendType, targetPath)
-	if err != nil || !allowed {
-		return "", fmt.Errorf("write access denied: %v", err)
 	}
 
-	// Read current file content
-	contentBytes, err := os.ReadFile(targetPath)
+	// The undo itself can be rolled back
+	label := "Before undoing: " + act.Summary
+	undoSnapshot, err := snapshotFiles(t.Snapshot, t.Backend, label, paths...)
 	if err != nil {
-		return "", fmt.Errorf("failed to read target file %s: %w", targetPath, err)
+		return "", fmt.Errorf("refusing to undo: %w", err)
 	}
-	originalContent := string(contentBytes)
 
-	// Snapshot before applying
-	sources, err := activeBackend.ListSources()
-	if err == nil && t.Snapshot != nil {
-		id, err := t.Snapshot.CreateSnapshot(sources)
-		if err != nil {
-			return "", fmt.Errorf("failed to create snapshot: %w", err)
+	var reverted []string
+	for _, path := range paths {
+		restored := false
+		if act.SnapshotID != "" {
+			restored, err = t.Snapshot.RestoreFile(act.SnapshotID, path)
+			if err != nil {
+				return "", fmt.Errorf("undo failed: %w", err)
+			}
 		}
-		_ = id
-	}
-
-	// Apply Patch using diffmatchpatch
-	dmp := diffmatchpatch.New()
-	patches, err := dmp.PatchFromText(patch)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse patch: %w. Ensure you're using the output from make_patch tool", err)
-	}
-
-	newContent, results := dmp.PatchApply(patches, originalContent)
-
-	// Check if all patches applied successfully
-	var failedPatches []int
-	for i, success := range results {
-		if !success {
-			failedPatches = append(failedPatches, i)
+		if restored {
+			reverted = append(reverted, "restored "+path)
+			continue
 		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("undo failed: %w", err)
+		}
+		reverted = append(reverted, "deleted "+path+" (it did not exist before)")
 	}
+	t.Actions.MarkUndone(index)
+	t.Actions.Record(Action{Tool: "undo_last_patch", SnapshotID: undoSnapshot, Summary: "Undid: " + act.Summary})
 
-	if len(failedPatches) > 0 {
-		return "", fmt.Errorf("patch application failed: %d out of %d hunks failed to apply. The file may have been modified since you read it. Please re-read the file and regenerate the patch", len(failedPatches), len(results))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Undid %q:\n", act.Summary)
+	for _, r := range reverted {
+		fmt.Fprintf(&sb, "- %s\n", r)
 	}
-
-	// Write the patched content back
-	err = os.WriteFile(targetPath, []byte(newContent), 0644)
-	if err != nil {
-		return "", fmt.Errorf("failed to write patched file: %w", err)
+	if undoSnapshot != "" {
+		fmt.Fprintf(&sb, "Snapshot %s holds the files as they were before the undo.\n", undoSnapshot)
 	}
+	return sb.String(), nil
+}
 
-	return fmt.Sprintf("Patch applied successfully to %s", targetPath), nil
+// snapshotContains reports whether a snapshot holds a copy of path
+func snapshotContains(m *safety.Manifest, path string) bool {
+	for _, entry := range m.Files {
+		if entry.Original == path {
+			return true
+		}
+	}
+	return false
 }
 
-// --- Rollback Tool ---
+// --- Version Control Tools ---
 
-type RollbackTool struct {
-	Snapshot *safety.SnapshotService
+type GitCommitTool struct {
+	Config  *configuration.Config
+	Backend configuration.ConfigBackend
+	Actions *ActionLog
 }
 
-type RollbackArgs struct {
-	SnapshotID string `json:"snapshot_id"` // Optional, if not provided uses latest
+type GitCommitArgs struct {
+	Message string   `json:"message"`
+	Files   []string `json:"files"` // Optional, defaults to the files changed this session
 }
 
-func (t *RollbackTool) Definition() ToolDefinition {
+func (t *GitCommitTool) Definition() ToolDefinition {
 	return ToolDefinition{
-		Name:        "rollback",
-		Description: "Restores the configuration from a previous snapshot",
+		Name:        "git_commit",
+		Description: "Commits config files to the git repository the config directory lives in, if any, and returns the commit hash. Only the given files are staged and committed; without 'files', every file changed this session is. Use it after a change the user accepted, with a message describing what was changed.",
 		Parameters: json.RawMessage(`{
-            "type": "object",
-            "properties": {
-                "snapshot_id": {"type": "string", "description": "The ID of the snapshot to restore. If empty, restores the latest."}
-            },
-            "additionalProperties": false
-        }`),
+			"type": "object",
+			"properties": {
+				"message": {"type": "string", "description": "The commit message, e.g. 'hypr: increase gaps_in to 8'"},
+				"files": {"type": "array", "items": {"type": "string"}, "description": "Files to commit (absolute paths). Defaults to the files changed this session."}
+			},
+			"required": ["message"],
+			"additionalProperties": false
+		}`),
 	}
 }
 
-func (t *RollbackTool) Execute(args string) (string, error) {
-	var a RollbackArgs
+func (t *GitCommitTool) Mutating() bool {
+	return true
+}
+
+func (t *GitCommitTool) Execute(args string) (string, error) {
+	var a GitCommitArgs
 	if err := ParseArgs(args, &a); err != nil {
 		return "", err
 	}
+	if strings.TrimSpace(a.Message) == "" {
+		return "", fmt.Errorf("a commit message is required")
+	}
 
-	// TODO: Implement "Latest" logic in SnapshotService if ID is empty
-	// For MVP, we require ID or just look for latest dir.
-	// Let's assume we need to implement FindLatest in SnapshotService.
-	// For now, return instructions if ID missing.
-	if a.SnapshotID == "" {
-		// Quick hack: List snapshots directory and pick last one
-		// In real impl: t.Snapshot.Latest()
-		return "Error: Snapshot ID required (automatic latest detection not implemented yet)", nil
+	sources, err := t.Backend.ListSources()
+	if err != nil || len(sources) == 0 {
+		return "", fmt.Errorf("could not determine the config directory")
 	}
+	root := filepath.Dir(sources[0])
 
-	// We need to know WHAT files to restore. The Snapshot service currently takes targetFiles in Restore.
-	// But we don't know them here without asking backend or storing manifest.
-	// TODO: Implement robust rollback with manifest storage in SnapshotService
-	return "Rollback not fully implemented. Please manually restore from ~/.local/share/hyprAgent/backups/", nil
+	files := make([]string, 0, len(a.Files))
+	for _, f := range a.Files {
+		path, err := t.Config.AllowedPath(t.Backend.Type(), f, configuration.AccessRead)
+		if err != nil {
+			return "", fmt.Errorf("access denied: %v", err)
+		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		// Companion app files live outside the config root, so leave them out
+		seen := make(map[string]bool)
+		for _, act := range t.Actions.Entries() {
+			if act.Path == "" || seen[act.Path] {
+				continue
+			}
+			seen[act.Path] = true
+			if allowed, err := t.Config.IsPathAllowed(t.Backend.Type(), act.Path, configuration.AccessRead); err == nil && allowed {
+				files = append(files, act.Path)
+			}
+		}
+		if len(files) == 0 {
+			return "No config files were changed this session; nothing to commit.", nil
+		}
+	}
+
+	hash, err := safety.GitCommit(root, files, a.Message)
+	switch {
+	case errors.Is(err, safety.ErrNotGitRepo):
+		return fmt.Sprintf("%s is not a git repository, so nothing was committed. Snapshots still cover rollback.", root), nil
+	case errors.Is(err, safety.ErrNothingToCommit):
+		return "The files have no uncommitted changes; nothing to commit.", nil
+	case err != nil:
+		return "", err
+	}
+
+	t.Actions.Record(Action{Tool: "git_commit", Summary: fmt.Sprintf("Committed %d file(s) as %s: %s", len(files), hash, a.Message)})
+	return fmt.Sprintf("Committed %d file(s) as %s.", len(files), hash), nil
 }
 
 // --- Network Tools ---
@@ -575,6 +3302,10 @@ func (t *FetchURLTool) Definition() ToolDefinition {
 }
 
 func (t *FetchURLTool) Execute(args string) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *FetchURLTool) ExecuteContext(ctx context.Context, args string) (string, error) {
 	var a FetchURLArgs
 	if err := ParseArgs(args, &a); err != nil {
 		return "", err
@@ -656,7 +3387,7 @@ func (t *FetchURLTool) Execute(args string) (string, error) {
 	}
 
 	// Perform Request
-	req, err := http.NewRequest("GET", targetURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
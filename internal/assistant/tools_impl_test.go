@@ -0,0 +1,869 @@
+package assistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reinhart/hyprAgent/internal/configuration"
+	"github.com/reinhart/hyprAgent/internal/safety"
+)
+
+// testConfigRoot points the Hyprland config root at a temp directory holding
+// files, keyed by their path relative to the root
+func testConfigRoot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	root := filepath.Join(home, "hypr")
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// testSnapshots returns a snapshot service backed by a temp directory
+func testSnapshots(t *testing.T, root string) *safety.SnapshotService {
+	t.Helper()
+	return &safety.SnapshotService{BackupDir: t.TempDir(), Root: root}
+}
+
+// answer returns a Confirm callback that gives reply and records what it was
+// asked
+func answer(reply bool, asked *[]string) func(string) bool {
+	return func(action string) bool {
+		*asked = append(*asked, action)
+		return reply
+	}
+}
+
+// readString returns the content of path, failing the test if it cannot be read
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestReadFileTruncates(t *testing.T) {
+	testConfigRoot(t, map[string]string{"big.conf": strings.Repeat("general:gaps_in = 5\n", 100)})
+	tool := &ReadFileTool{Config: configuration.DefaultConfig(), Backend: configuration.NewNativeBackend(), MaxBytes: 50}
+
+	out, err := tool.Execute(`{"path": "big.conf"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, note, ok := strings.Cut(out, "\n\n[")
+	if !ok || !strings.HasPrefix(note, "Truncated") {
+		t.Fatalf("expected a truncation note, got %q", out)
+	}
+	if len(content) > 50 {
+		t.Errorf("returned %d bytes, want at most 50", len(content))
+	}
+	if !strings.Contains(note, "search_config") {
+		t.Errorf("note does not suggest search_config: %q", note)
+	}
+}
+
+func TestReadFileLineRange(t *testing.T) {
+	testConfigRoot(t, map[string]string{"hyprland.conf": "one\ntwo\nthree\nfour\n"})
+	tool := &ReadFileTool{Config: configuration.DefaultConfig(), Backend: configuration.NewNativeBackend()}
+
+	out, err := tool.Execute(`{"path": "hyprland.conf", "start_line": 2, "end_line": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "two\nthree\n" {
+		t.Errorf("got %q, want lines 2-3", out)
+	}
+
+	if _, err := tool.Execute(`{"path": "hyprland.conf", "start_line": 10}`); err == nil {
+		t.Error("expected an error for a start_line past the end")
+	}
+	if _, err := tool.Execute(`{"path": "hyprland.conf", "start_line": 3, "end_line": 2}`); err == nil {
+		t.Error("expected an error for an inverted range")
+	}
+}
+
+func TestReadFileIncludesMetadata(t *testing.T) {
+	const content = "general:gaps_in = 5\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": content})
+	path := filepath.Join(root, "hyprland.conf")
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	tool := &ReadFileTool{Config: configuration.DefaultConfig(), Backend: configuration.NewNativeBackend()}
+
+	out, err := tool.Execute(`{"path": "hyprland.conf", "include_metadata": true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got fileWithMetadata
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("result is not JSON: %v\n%s", err, out)
+	}
+	if got.Path != path || got.Size != int64(len(content)) || got.Mode != "-rw-------" || !got.Modified.Equal(modified) || got.Content != content {
+		t.Errorf("got %+v, want the file's path, size %d, mode -rw------- and mtime %v", got, len(content), modified)
+	}
+
+	// Without the flag only the content comes back
+	if out, err := tool.Execute(`{"path": "hyprland.conf"}`); err != nil || out != content {
+		t.Errorf("without metadata = %q, %v; want the bare content", out, err)
+	}
+}
+
+func TestReadFileRelativeToConfigRoot(t *testing.T) {
+	testConfigRoot(t, map[string]string{"hyprland.conf": "from the config root\n"})
+	// A file of the same name in the working directory must not be read
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("hyprland.conf", []byte("from the working directory\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tool := &ReadFileTool{Config: configuration.DefaultConfig(), Backend: configuration.NewNativeBackend()}
+
+	out, err := tool.Execute(`{"path": "hyprland.conf"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "from the config root\n" {
+		t.Errorf("got %q, want the file under the config root", out)
+	}
+}
+
+func TestParseConfigReportsNestedSections(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": "input {\n    kb_layout = us\n    touchpad {\n        natural_scroll = true\n    }\n    sensitivity = 0.5\n}\nmisc:vfr = true\n"})
+	tool := &ParseConfigTool{Backend: &configuration.NativeBackend{ConfigPath: filepath.Join(root, "hyprland.conf")}}
+
+	out, err := tool.Execute("{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ir configuration.IR
+	if err := json.Unmarshal([]byte(out), &ir); err != nil {
+		t.Fatalf("result is not an IR: %v", err)
+	}
+	type placed struct {
+		section string
+		depth   int
+	}
+	got := make(map[string]placed)
+	for _, line := range ir.Lines {
+		if line.Key != "" {
+			got[line.Key] = placed{line.Section, line.Depth}
+		}
+	}
+	for key, want := range map[string]placed{
+		"input":          {"", 0},
+		"kb_layout":      {"input", 1},
+		"touchpad":       {"input", 1},
+		"natural_scroll": {"input:touchpad", 2},
+		"sensitivity":    {"input", 1},
+		"misc:vfr":       {"", 0},
+	} {
+		if got[key] != want {
+			t.Errorf("%s is in section %q at depth %d, want %q at %d", key, got[key].section, got[key].depth, want.section, want.depth)
+		}
+	}
+}
+
+func TestSearchConfigOnlyAllowedFiles(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{
+		"hyprland.conf":      "$mainMod = SUPER\nbind = $mainMod, Q, killactive\n",
+		"conf/binds.conf":    "bind = $mainMod, Q, exec, kitty\n",
+		"private/binds.conf": "bind = $mainMod, Q, exec, secret\n",
+	})
+	t.Chdir(t.TempDir())
+	cfg := configuration.DefaultConfig()
+	cfg.Security.Native = configuration.BackendSecurity{
+		AllowedFiles: []string{"hyprland.conf"},
+		AllowedDirs:  []string{"conf"},
+	}
+	tool := &SearchConfigTool{Config: cfg, Backend: configuration.NewNativeBackend()}
+
+	search := func(args string) []SearchMatch {
+		t.Helper()
+		out, err := tool.Execute(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			Matches []SearchMatch `json:"matches"`
+		}
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Matches
+	}
+
+	matches := search(`{"query": "$mainMod, Q"}`)
+	want := map[string]int{filepath.Join(root, "hyprland.conf"): 2, filepath.Join(root, "conf/binds.conf"): 1}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d: %+v", len(matches), len(want), matches)
+	}
+	for _, m := range matches {
+		if line, ok := want[m.File]; !ok || line != m.LineNum {
+			t.Errorf("unexpected match %+v", m)
+		}
+	}
+
+	// A relative path is searched under the config root, not the working directory
+	matches = search(`{"query": "kitty", "path": "conf"}`)
+	if len(matches) != 1 || matches[0].File != filepath.Join(root, "conf/binds.conf") {
+		t.Errorf("got %+v, want the match in conf/binds.conf", matches)
+	}
+
+	if _, err := tool.Execute(`{"query": "secret", "path": "private"}`); err == nil {
+		t.Error("expected searching a directory that is not allowed to fail")
+	}
+}
+
+func TestMergeConfigAsksBeforeWriting(t *testing.T) {
+	const original = "general {\n    gaps_in = 5 # inner gaps\n}\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	main := filepath.Join(root, "hyprland.conf")
+	backend := configuration.NewNativeBackend()
+	backend.ConfigPath = main
+	var asked []string
+	tool := &MergeConfigTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  backend,
+		Snapshot: testSnapshots(t, root),
+		Actions:  NewActionLog(),
+		Confirm:  answer(false, &asked),
+	}
+	args := `{"source_content": "general:gaps_in = 10", "apply": true, "accept_conflicts": ["general:gaps_in"]}`
+
+	if _, err := tool.Execute(args); err == nil {
+		t.Fatal("expected a declined merge to fail")
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "gaps_in = 10") {
+		t.Errorf("confirmation did not show the change: %q", asked)
+	}
+	if got := readString(t, main); got != original {
+		t.Errorf("declined merge wrote the file:\n%s", got)
+	}
+
+	tool.Confirm = answer(true, &asked)
+	if _, err := tool.Execute(args); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, main); !strings.Contains(got, "gaps_in = 10 # inner gaps") {
+		t.Errorf("merge did not override the value and keep the comment:\n%s", got)
+	}
+}
+
+func TestApplyPresetAsksBeforeWriting(t *testing.T) {
+	const original = "general:gaps_in = 5\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	main := filepath.Join(root, "hyprland.conf")
+	backend := configuration.NewNativeBackend()
+	backend.ConfigPath = main
+	presets, err := configuration.Presets()
+	if err != nil || len(presets) == 0 {
+		t.Fatalf("no presets: %v", err)
+	}
+	var asked []string
+	tool := &ApplyPresetTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  backend,
+		Snapshot: testSnapshots(t, root),
+		Actions:  NewActionLog(),
+		Confirm:  answer(false, &asked),
+	}
+	args := `{"name": "` + presets[0].Name + `", "apply": true}`
+
+	if _, err := tool.Execute(args); err == nil {
+		t.Fatal("expected a declined preset to fail")
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], presets[0].Name) {
+		t.Errorf("confirmation did not name the preset: %q", asked)
+	}
+	if got := readString(t, main); got != original {
+		t.Errorf("declined preset wrote the file:\n%s", got)
+	}
+
+	tool.Confirm = answer(true, &asked)
+	if _, err := tool.Execute(args); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, main); got == original {
+		t.Error("accepted preset did not change the file")
+	}
+}
+
+func TestSetBorderColorsAsksBeforeWriting(t *testing.T) {
+	const original = "general {\n    col.active_border = rgba(ffffffff)\n}\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	main := filepath.Join(root, "hyprland.conf")
+	backend := configuration.NewNativeBackend()
+	backend.ConfigPath = main
+	var asked []string
+	tool := &SetBorderColorsTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  backend,
+		Snapshot: testSnapshots(t, root),
+		Actions:  NewActionLog(),
+		Confirm:  answer(false, &asked),
+	}
+	args := `{"colors": ["rgba(33ccffee)", "rgba(00ff99ee)"], "angle": "45", "apply": true}`
+	const want = "col.active_border = rgba(33ccffee) rgba(00ff99ee) 45deg"
+
+	if _, err := tool.Execute(args); err == nil {
+		t.Fatal("expected a declined change to fail")
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], want) {
+		t.Errorf("confirmation did not show the new value: %q", asked)
+	}
+	if got := readString(t, main); got != original {
+		t.Errorf("declined change wrote the file:\n%s", got)
+	}
+
+	tool.Confirm = answer(true, &asked)
+	if _, err := tool.Execute(args); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, main); !strings.Contains(got, want) {
+		t.Errorf("accepted change was not written:\n%s", got)
+	}
+}
+
+func TestWriteFileCreatesOnlyAllowedFiles(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": "source = keybindings.conf\n"})
+	var asked []string
+	tool := &WriteFileTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: testSnapshots(t, root),
+		Actions:  NewActionLog(),
+		Confirm:  answer(true, &asked),
+	}
+
+	if _, err := tool.Execute(`{"path": "keybindings.conf", "content": "bind = SUPER, Q, killactive\n"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, filepath.Join(root, "keybindings.conf")); got != "bind = SUPER, Q, killactive\n" {
+		t.Errorf("keybindings.conf = %q", got)
+	}
+
+	outside := filepath.Join(t.TempDir(), "evil.conf")
+	if _, err := tool.Execute(`{"path": "` + outside + `", "content": "x"}`); err == nil {
+		t.Error("expected a path outside the config root to be refused")
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the config root: %v", err)
+	}
+	if len(asked) != 1 {
+		t.Errorf("asked %d time(s), want once for the allowed write", len(asked))
+	}
+}
+
+func TestWriteFileAsksBeforeReplacing(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": "general:gaps_in = 5\n"})
+	main := filepath.Join(root, "hyprland.conf")
+	var asked []string
+	tool := &WriteFileTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: testSnapshots(t, root),
+		Actions:  NewActionLog(),
+		Confirm:  answer(false, &asked),
+	}
+
+	if _, err := tool.Execute(`{"path": "hyprland.conf", "content": "general:gaps_in = 20\n"}`); err == nil {
+		t.Fatal("expected a declined write to fail")
+	}
+	if len(asked) != 1 || !strings.HasPrefix(asked[0], "Replace "+main) {
+		t.Errorf("confirmation = %q, want one asking to replace %s", asked, main)
+	}
+	if got := readString(t, main); got != "general:gaps_in = 5\n" {
+		t.Errorf("declined write changed the file: %q", got)
+	}
+}
+
+func TestMoveFileRenameAndRollback(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{
+		"hyprland.conf": "source = binds.conf\n",
+		"binds.conf":    "bind = SUPER, Q, killactive\n",
+	})
+	snapshots := testSnapshots(t, root)
+	actions := NewActionLog()
+	var asked []string
+	tool := &MoveFileTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Actions:  actions,
+		Confirm:  answer(false, &asked),
+	}
+	args := `{"from": "binds.conf", "to": "keybindings.conf"}`
+
+	if _, err := tool.Execute(args); err == nil {
+		t.Fatal("expected a declined move to fail")
+	}
+	if _, err := os.Stat(filepath.Join(root, "binds.conf")); err != nil {
+		t.Fatalf("declined move removed the source: %v", err)
+	}
+
+	tool.Confirm = answer(true, &asked)
+	if _, err := tool.Execute(args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "binds.conf")); !os.IsNotExist(err) {
+		t.Errorf("source still exists after the move: %v", err)
+	}
+	if got := readString(t, filepath.Join(root, "keybindings.conf")); got != "bind = SUPER, Q, killactive\n" {
+		t.Errorf("keybindings.conf = %q", got)
+	}
+
+	// Rolling back puts the file back under its old name
+	last := actions.Entries()[len(actions.Entries())-1]
+	rollback := &RollbackTool{Backend: configuration.NewNativeBackend(), Snapshot: snapshots, Actions: actions}
+	if _, err := rollback.Execute(`{"snapshot_id": "` + last.SnapshotID + `"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, filepath.Join(root, "binds.conf")); got != "bind = SUPER, Q, killactive\n" {
+		t.Errorf("binds.conf after rollback = %q", got)
+	}
+}
+
+func TestRollbackConfirmsAndSnapshotsFirst(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": "general:gaps_in = 5\n"})
+	conf := filepath.Join(root, "hyprland.conf")
+	snapshots := testSnapshots(t, root)
+	id, err := snapshots.CreateSnapshot([]string{conf}, "Set gaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("general:gaps_in = 20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	actions := NewActionLog()
+	var asked []string
+	tool := &RollbackTool{Backend: configuration.NewNativeBackend(), Snapshot: snapshots, Actions: actions, Confirm: answer(false, &asked)}
+	args := `{"snapshot_id": "` + id + `"}`
+
+	if _, err := tool.Execute(args); err == nil {
+		t.Fatal("expected a declined rollback to fail")
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "These files will be overwritten:\n- "+conf) {
+		t.Errorf("asked %q, want the files to be overwritten listed", asked)
+	}
+	if got := readString(t, conf); got != "general:gaps_in = 20\n" {
+		t.Errorf("declined rollback changed the file: %q", got)
+	}
+
+	tool.Confirm = answer(true, &asked)
+	if _, err := tool.Execute(args); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, conf); got != "general:gaps_in = 5\n" {
+		t.Errorf("hyprland.conf after rollback = %q", got)
+	}
+
+	// The replaced file is in a new snapshot, so the rollback can be undone
+	before := actions.Entries()[len(actions.Entries())-1].SnapshotID
+	if before == "" || before == id {
+		t.Fatalf("rollback recorded snapshot %q, want a new one", before)
+	}
+	if _, err := snapshots.Restore(before); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, conf); got != "general:gaps_in = 20\n" {
+		t.Errorf("hyprland.conf after undoing the rollback = %q", got)
+	}
+}
+
+// stubHyprctl puts a fake hyprctl on PATH that reloads successfully and
+// reports a config error for each "bad = <name>" line in conf
+func stubHyprctl(t *testing.T, conf string) {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+reload) echo ok ;;
+"-j configerrors")
+	awk 'BEGIN { printf "[" } /^bad = / { printf "%s\"Config error in file %s at line %d: invalid %s\"", sep, FILENAME, FNR, $3; sep = "," } END { print "]" }' "` + conf + `" ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "hyprctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", "test")
+}
+
+func TestMoreContextSurvivesNearbyEdits(t *testing.T) {
+	const original = "blur {\n    enabled = true\n}\nshadow {\n    enabled = true\n}\n"
+	const modified = "blur {\n    enabled = true\n}\nshadow {\n    enabled = false\n}\n"
+	// Since the patch was made, the blur block above the change grew
+	const live = "blur {\n    size = 3\n    passes = 2\n    enabled = true\n}\nshadow {\n    enabled = true\n}\n"
+
+	for _, tc := range []struct {
+		contextLines int
+		want         string
+	}{
+		// Without context the shifted hunk matches blur's line first
+		{0, "blur {\n    size = 3\n    passes = 2\n    enabled = false\n}\nshadow {\n    enabled = true\n}\n"},
+		{configuration.DiffContext, "blur {\n    size = 3\n    passes = 2\n    enabled = true\n}\nshadow {\n    enabled = false\n}\n"},
+	} {
+		patch, err := (&MakePatchTool{}).Execute(fmt.Sprintf(`{"original": %q, "modified": %q, "context_lines": %d}`, original, modified, tc.contextLines))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := configuration.ApplyUnifiedDiff(live, patch)
+		if err != nil {
+			t.Fatalf("context_lines %d: %v", tc.contextLines, err)
+		}
+		if got != tc.want {
+			t.Errorf("context_lines %d applied as\n%s\nwant\n%s", tc.contextLines, got, tc.want)
+		}
+	}
+}
+
+func TestApplyPatchAsksBeforeWriting(t *testing.T) {
+	const original = "general:gaps_in = 5\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	snapshots := testSnapshots(t, root)
+	var asked []string
+	tool := &ApplyPatchTool{
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Config:   configuration.DefaultConfig(),
+		Actions:  NewActionLog(),
+		Confirm:  answer(false, &asked),
+	}
+	patch, err := makePatch(original, "general:gaps_in = 10\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(ApplyPatchArgs{Path: "hyprland.conf", Patch: patch})
+
+	if _, err := tool.Execute(string(args)); err == nil || !strings.Contains(err.Error(), "declined") {
+		t.Errorf("err = %v, want the patch declined", err)
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "+ general:gaps_in = 10") {
+		t.Errorf("asked %q, want the diff shown once", asked)
+	}
+	if got := readString(t, filepath.Join(root, "hyprland.conf")); got != original {
+		t.Errorf("hyprland.conf = %q, want it untouched", got)
+	}
+	if list, _ := snapshots.List(); len(list) != 0 {
+		t.Errorf("took %d snapshot(s) for a declined patch", len(list))
+	}
+}
+
+func TestUndoLastPatchRevertsOnlyLatestChange(t *testing.T) {
+	const mainBefore, mainAfter = "general:gaps_in = 5\n", "general:gaps_in = 10\n"
+	const bindsBefore, bindsAfter = "bind = SUPER, Q, killactive\n", "bind = SUPER, W, killactive\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": mainBefore, "binds.conf": bindsBefore})
+	main, binds := filepath.Join(root, "hyprland.conf"), filepath.Join(root, "binds.conf")
+	snapshots := testSnapshots(t, root)
+	actions := NewActionLog()
+	var asked []string
+	apply := &ApplyPatchTool{
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Config:   configuration.DefaultConfig(),
+		Actions:  actions,
+		Confirm:  answer(true, &asked),
+	}
+	for _, change := range []struct{ path, before, after string }{
+		{"hyprland.conf", mainBefore, mainAfter},
+		{"binds.conf", bindsBefore, bindsAfter},
+	} {
+		patch, err := makePatch(change.before, change.after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, _ := json.Marshal(ApplyPatchArgs{Path: change.path, Patch: patch})
+		if _, err := apply.Execute(string(args)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asked = nil
+	undo := &UndoLastPatchTool{Backend: configuration.NewNativeBackend(), Snapshot: snapshots, Actions: actions, Confirm: answer(false, &asked)}
+
+	if _, err := undo.Execute("{}"); err == nil {
+		t.Fatal("expected a declined undo to fail")
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "- restore "+binds) {
+		t.Errorf("asked %q, want binds.conf named as restored", asked)
+	}
+	if got := readString(t, binds); got == bindsBefore {
+		t.Error("declined undo reverted binds.conf")
+	}
+
+	undo.Confirm = answer(true, &asked)
+	out, err := undo.Execute("{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "restored "+binds) {
+		t.Errorf("undo reported %q, want binds.conf restored", out)
+	}
+	if got := readString(t, binds); got != bindsBefore {
+		t.Errorf("binds.conf = %q, want it reverted", got)
+	}
+	if got := readString(t, main); got != mainAfter {
+		t.Errorf("hyprland.conf = %q, want the first patch kept", got)
+	}
+
+	// Undoing again goes back one more change
+	if _, err := undo.Execute("{}"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, main); got != mainBefore {
+		t.Errorf("hyprland.conf after a second undo = %q, want it reverted", got)
+	}
+	if got := readString(t, binds); got != bindsBefore {
+		t.Errorf("binds.conf after a second undo = %q", got)
+	}
+}
+
+func TestUndoNamesTheFileItDeletes(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": "source = theme.conf\n"})
+	theme := filepath.Join(root, "theme.conf")
+	snapshots := testSnapshots(t, root)
+	actions := NewActionLog()
+	var asked []string
+	write := &WriteFileTool{
+		Config:   configuration.DefaultConfig(),
+		Backend:  configuration.NewNativeBackend(),
+		Snapshot: snapshots,
+		Actions:  actions,
+		Confirm:  answer(true, &asked),
+	}
+	if _, err := write.Execute(`{"path": "theme.conf", "content": "general:border_size = 2\n"}`); err != nil {
+		t.Fatal(err)
+	}
+	asked = nil
+	undo := &UndoLastPatchTool{Backend: configuration.NewNativeBackend(), Snapshot: snapshots, Actions: actions, Confirm: answer(true, &asked)}
+
+	if _, err := undo.Execute("{}"); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "- delete "+theme) {
+		t.Errorf("asked %q, want theme.conf named as deleted", asked)
+	}
+	if _, err := os.Stat(theme); !os.IsNotExist(err) {
+		t.Errorf("theme.conf still exists after the undo: %v", err)
+	}
+}
+
+func TestApplyPatchRollsBackOnlyOnNewErrors(t *testing.T) {
+	const original = "bad = old\ngeneral:gaps_in = 5\n"
+	for _, tt := range []struct {
+		name, modified string
+		rollback       bool
+	}{
+		// The existing error moves to line 2, but it is still the same error
+		{"pre-existing error", "general:gaps_out = 10\nbad = old\ngeneral:gaps_in = 5\n", false},
+		{"new error", "bad = old\ngeneral:gaps_in = 5\nbad = new\n", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+			main := filepath.Join(root, "hyprland.conf")
+			stubHyprctl(t, main)
+			backend := configuration.NewNativeBackend()
+			backend.ConfigPath = main
+			tool := &ApplyPatchTool{
+				Backend:         backend,
+				Snapshot:        testSnapshots(t, root),
+				Config:          configuration.DefaultConfig(),
+				Actions:         NewActionLog(),
+				AutoReload:      true,
+				RollbackOnError: true,
+			}
+			patch, err := makePatch(original, tt.modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args, _ := json.Marshal(ApplyPatchArgs{Path: "hyprland.conf", Patch: patch})
+
+			out, err := tool.Execute(string(args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.modified
+			if tt.rollback {
+				want = original
+			}
+			if got := readString(t, main); got != want {
+				t.Errorf("hyprland.conf = %q, want %q\n%s", got, want, out)
+			}
+			if rolledBack := strings.Contains(out, "rolled back automatically"); rolledBack != tt.rollback {
+				t.Errorf("rolled back = %v, want %v:\n%s", rolledBack, tt.rollback, out)
+			}
+			if !tt.rollback && !strings.Contains(out, "so the patch was kept") {
+				t.Errorf("report does not explain why the patch was kept:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestReloadReportsConfigErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, conf, want string
+	}{
+		{"clean", "general:gaps_in = 5\n", "Reloaded Hyprland with no config errors."},
+		{"syntax error", "general:gaps_in = 5\nbad = brace\n", "at line 2: invalid brace"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := testConfigRoot(t, map[string]string{"hyprland.conf": tt.conf})
+			stubHyprctl(t, filepath.Join(root, "hyprland.conf"))
+
+			out, err := (&ReloadTool{Allowed: true}).Execute("{}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("reload reported %q, want %q", out, tt.want)
+			}
+		})
+	}
+
+	out, err := (&ReloadTool{}).Execute("{}")
+	if err != nil || !strings.Contains(out, "disabled") {
+		t.Errorf("reload without allow_reload = %q, %v; want it refused", out, err)
+	}
+}
+
+func TestDiffFilesShowsHunks(t *testing.T) {
+	root := testConfigRoot(t, map[string]string{
+		"hyprland.conf":       "general {\n    gaps_in = 5\n    gaps_out = 20\n    border_size = 2\n}\n",
+		"themes/compact.conf": "general {\n    gaps_in = 2\n    gaps_out = 4\n    border_size = 2\n}\n",
+	})
+	outside := filepath.Join(filepath.Dir(root), "waybar.conf")
+	if err := os.WriteFile(outside, []byte("general {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tool := &DiffFilesTool{Config: configuration.DefaultConfig(), Backend: configuration.NewNativeBackend()}
+
+	out, err := tool.Execute(`{"path_a": "hyprland.conf", "path_b": "themes/compact.conf"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--- hyprland.conf\n+++ themes/compact.conf\n",
+		"@@ -1,5 +1,5 @@\n general {\n",
+		"-    gaps_in = 5\n-    gaps_out = 20\n+    gaps_in = 2\n+    gaps_out = 4\n     border_size = 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("diff does not contain %q:\n%s", want, out)
+		}
+	}
+
+	if out, err := tool.Execute(`{"path_a": "hyprland.conf", "path_b": "hyprland.conf"}`); err != nil || out != "The files are identical." {
+		t.Errorf("diff of a file with itself = %q, %v", out, err)
+	}
+	if _, err := tool.Execute(fmt.Sprintf(`{"path_a": "hyprland.conf", "path_b": %q}`, outside)); err == nil {
+		t.Error("compared a file outside the allowed directories")
+	}
+}
+
+func TestPreviewPatchLeavesFileUntouched(t *testing.T) {
+	const original = "general {\n    gaps_in = 5\n    border_size = 2\n}\n"
+	const modified = "general {\n    gaps_in = 10\n    border_size = 2\n}\n"
+	root := testConfigRoot(t, map[string]string{"hyprland.conf": original})
+	main := filepath.Join(root, "hyprland.conf")
+	tool := &PreviewPatchTool{Backend: configuration.NewNativeBackend(), Config: configuration.DefaultConfig()}
+
+	patch, err := makePatch(original, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(PreviewPatchArgs{Path: "hyprland.conf", Patch: patch})
+	out, err := tool.Execute(string(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var preview struct {
+		Path    string                     `json:"path"`
+		Applies bool                       `json:"applies"`
+		Hunks   []configuration.HunkResult `json:"hunks"`
+		Content string                     `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(out), &preview); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !preview.Applies || preview.Path != main || len(preview.Hunks) != 1 || !preview.Hunks[0].Applied {
+		t.Errorf("preview = %s, want one hunk applying to %s", out, main)
+	}
+	if preview.Content != modified {
+		t.Errorf("content = %q, want %q", preview.Content, modified)
+	}
+	if got := readString(t, main); got != original {
+		t.Errorf("hyprland.conf = %q, want it untouched", got)
+	}
+
+	// A patch for content that has since changed reports the failed hunk
+	if err := os.WriteFile(main, []byte("general {\n    gaps_in = 8\n    border_size = 2\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = tool.Execute(string(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(out), &preview); err != nil {
+		t.Fatal(err)
+	}
+	if preview.Applies || len(preview.Hunks) != 1 || preview.Hunks[0].Applied {
+		t.Errorf("preview of a stale patch = %s, want the hunk reported as failed", out)
+	}
+}
+
+func TestQueryHyprlandCombinesLiveState(t *testing.T) {
+	tool := &QueryHyprlandTool{}
+	t.Setenv("PATH", t.TempDir())
+	out, err := tool.Execute(`{}`)
+	if err != nil || !strings.HasPrefix(out, "Live state is unavailable: hyprctl is not installed") {
+		t.Errorf("without hyprctl = %q, %v; want it reported as unavailable", out, err)
+	}
+
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+"-j monitors") echo '[{"name":"DP-2","scale":1.25}]' ;;
+"-j workspaces") echo '[{"id":1,"monitor":"DP-2"}]' ;;
+"-j activewindow") echo '{"class":"kitty"}' ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "hyprctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", "test")
+
+	out, err = tool.Execute(`{"what": "all"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out), &state); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if len(state) != 3 || !strings.Contains(string(state["monitors"]), `"DP-2"`) || !strings.Contains(string(state["activewindow"]), "kitty") {
+		t.Errorf("state = %s, want monitors, workspaces and the active window", out)
+	}
+	if _, err := tool.Execute(`{"what": "clients"}`); err == nil {
+		t.Error("an unknown query succeeded")
+	}
+}
@@ -0,0 +1,52 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// createTemp creates the temporary file WriteFileAtomic writes to
+var createTemp = os.CreateTemp
+
+// WriteFileAtomic replaces the contents of path so that readers (and a crash
+// mid-write) see either the old file or the new one, never a truncated mix.
+// The data goes to a temporary file in the same directory, which is then
+// renamed over the target. An existing file keeps its mode bits; perm is used
+// for new files. Symlinks are followed so that the file they point to is
+// updated rather than replaced by a regular file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := createTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	// Only cleans up on failure; after the rename tmpPath no longer exists
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
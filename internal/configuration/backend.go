@@ -1,6 +1,10 @@
 package configuration
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -27,27 +31,93 @@ const (
 
 // ConfigLine represents a single line in the configuration file
 type ConfigLine struct {
-	LineNum int
-	Raw     string
-	Type    LineType
-	Key     string
-	Value   string
+	LineNum    int
+	Raw        string
+	Type       LineType
+	Key        string
+	Value      string
+	SourceFile string     // File the line was read from (empty for pasted content)
+	Bind       *Bind      `json:",omitempty"` // Parsed fields of bind lines
+	Monitor    *Monitor   `json:",omitempty"` // Parsed fields of monitor lines
+	Workspace  *Workspace `json:",omitempty"` // Parsed fields of workspace lines
+
+	// Section is the colon-separated path of the enclosing sections, e.g.
+	// "input:touchpad", and Depth their number. Section start and end lines
+	// belong to the parent section.
+	Section string `json:",omitempty"`
+	Depth   int    `json:",omitempty"`
+}
+
+// ParseWarning describes a line the parser could not make sense of
+type ParseWarning struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line"`
+	Raw     string `json:"raw"`
+	Message string `json:"message"`
+}
+
+func (w ParseWarning) String() string {
+	loc := fmt.Sprintf("line %d", w.Line)
+	if w.File != "" {
+		loc = fmt.Sprintf("%s:%d", w.File, w.Line)
+	}
+	return fmt.Sprintf("%s: %s: %q", loc, w.Message, w.Raw)
 }
 
 // IR (Intermediate Representation) holds the parsed configuration
 type IR struct {
 	Lines []ConfigLine
+	// Warnings lists problems found while parsing; the IR is still best-effort
+	Warnings []ParseWarning `json:"Warnings,omitempty"`
+	// LineEnding is the line break of the parsed file, "\n" or "\r\n";
+	// empty means "\n". NoFinalNewline is set when its last line has none.
+	LineEnding     string `json:"-"`
+	NoFinalNewline bool   `json:"-"`
 }
 
+// String serializes the lines with the line endings of the parsed file
 func (ir *IR) String() string {
+	ending := ir.LineEnding
+	if ending == "" {
+		ending = "\n"
+	}
 	var sb strings.Builder
-	for _, line := range ir.Lines {
+	for i, line := range ir.Lines {
 		sb.WriteString(line.Raw)
-		sb.WriteString("\n")
+		if i < len(ir.Lines)-1 || !ir.NoFinalNewline {
+			sb.WriteString(ending)
+		}
 	}
 	return sb.String()
 }
 
+// Resolve returns a copy of the IR with $variable references expanded in every
+// Value, and the final value of each variable. Lines are processed in order as
+// Hyprland does, so a variable defined in terms of others holds their expanded
+// value, and a later redefinition only affects the lines after it. References
+// to variables that are not (yet) defined are left literal.
+func (ir *IR) Resolve() (*IR, map[string]string) {
+	vars := make(map[string]string)
+	resolved := &IR{Lines: make([]ConfigLine, len(ir.Lines)), Warnings: ir.Warnings, LineEnding: ir.LineEnding, NoFinalNewline: ir.NoFinalNewline}
+	for i, line := range ir.Lines {
+		line.Value = expandVariables(line.Value, vars)
+		if line.Bind != nil {
+			line.Bind = ParseBind(line.Key, line.Value)
+		}
+		if line.Monitor != nil {
+			line.Monitor = ParseMonitor(line.Key, line.Value)
+		}
+		if line.Workspace != nil {
+			line.Workspace = ParseWorkspace(line.Key, line.Value)
+		}
+		if line.Type == LineTypeVariable && line.Key != "" {
+			vars[line.Key] = line.Value
+		}
+		resolved.Lines[i] = line
+	}
+	return resolved, vars
+}
+
 // ConfigBackend defines the interface for different configuration sources
 type ConfigBackend interface {
 	// Type returns the type of this backend
@@ -68,3 +138,73 @@ type ConfigBackend interface {
 	// ApplyPatch applies a patch to the specified file. If path is empty, applies to main config.
 	ApplyPatch(path string, patch string) error
 }
+
+// DetectBackends returns every backend that matches the default config root,
+// in the order given. Several can match, e.g. HyDE markers next to a plain
+// hyprland.conf.
+func DetectBackends(backends []ConfigBackend) []ConfigBackend {
+	var detected []ConfigBackend
+	for _, b := range backends {
+		if found, err := b.Detect(""); err == nil && found {
+			detected = append(detected, b)
+		}
+	}
+	return detected
+}
+
+// PreferBackend returns backends with the one of type preferred moved to the
+// front, so that code taking the first match picks it
+func PreferBackend(backends []ConfigBackend, preferred ConfigSourceType) []ConfigBackend {
+	ordered := make([]ConfigBackend, 0, len(backends))
+	for _, b := range backends {
+		if b.Type() == preferred {
+			ordered = append(ordered, b)
+		}
+	}
+	for _, b := range backends {
+		if b.Type() != preferred {
+			ordered = append(ordered, b)
+		}
+	}
+	return ordered
+}
+
+// allowedSources returns mainConfig followed by the other config files covered
+// by sec that exist next to it: every allowed or read-only file, and the .conf
+// files directly inside each allowed directory. The main config always comes
+// first since callers treat sources[0] as the file to edit by default.
+func allowedSources(mainConfig string, sec BackendSecurity) []string {
+	root := filepath.Dir(mainConfig)
+	seen := map[string]bool{filepath.Clean(mainConfig): true}
+	var others []string
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if seen[path] {
+			return
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		seen[path] = true
+		others = append(others, path)
+	}
+
+	for _, f := range append(append([]string{}, sec.AllowedFiles...), sec.ReadOnlyFiles...) {
+		add(filepath.Join(root, f))
+	}
+	for _, d := range sec.AllowedDirs {
+		dir := filepath.Join(root, d)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && filepath.Ext(e.Name()) == ".conf" {
+				add(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+
+	sort.Strings(others)
+	return append([]string{mainConfig}, others...)
+}
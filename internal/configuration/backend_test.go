@@ -0,0 +1,167 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// fixtureTree creates files, given relative to a new temp directory, and
+// returns the directory
+func fixtureTree(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# "+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// relSources returns the sources of b relative to root
+func relSources(t *testing.T, b ConfigBackend, root string) []string {
+	t.Helper()
+	sources, err := b.ListSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := make([]string, len(sources))
+	for i, s := range sources {
+		if rel[i], err = filepath.Rel(root, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rel
+}
+
+func TestHyDEListSources(t *testing.T) {
+	t.Setenv("HYDE_CONFIG_HOME", "")
+	root := fixtureTree(t,
+		"hyprland.conf", "hyde.conf", "keybindings.conf", "userprefs.conf",
+		"Configs/animations.conf", "Configs/windowrules.conf", "Configs/README.md",
+		"themes/theme.conf", "private/secrets.conf",
+	)
+	b := &HyDEBackend{Security: DefaultConfig().Security.Hyde}
+	if ok, err := b.Detect(root); !ok || err != nil {
+		t.Fatalf("Detect() = %v, %v", ok, err)
+	}
+
+	want := []string{
+		"hyprland.conf",
+		"Configs/animations.conf", "Configs/windowrules.conf",
+		"hyde.conf", "keybindings.conf", "themes/theme.conf", "userprefs.conf",
+	}
+	if got := relSources(t, b, root); !slices.Equal(got, want) {
+		t.Errorf("ListSources() = %v, want %v", got, want)
+	}
+}
+
+func TestOmarchyListSources(t *testing.T) {
+	root := fixtureTree(t,
+		"hyprland.conf", "monitors.conf", "keybindings.conf",
+		"omarchy/looknfeel.conf", "omarchy/input.conf", "omarchy/notes.txt",
+		"private/secrets.conf",
+	)
+	b := &OmarchyBackend{Security: DefaultConfig().Security.Omarchy}
+	if ok, err := b.Detect(root); !ok || err != nil {
+		t.Fatalf("Detect() = %v, %v", ok, err)
+	}
+
+	// private/ is not in Omarchy's allow-list
+	want := []string{
+		"hyprland.conf",
+		"keybindings.conf", "monitors.conf",
+		"omarchy/input.conf", "omarchy/looknfeel.conf",
+	}
+	if got := relSources(t, b, root); !slices.Equal(got, want) {
+		t.Errorf("ListSources() = %v, want %v", got, want)
+	}
+}
+
+func TestOmarchyNotDetectedWithoutItsDirectory(t *testing.T) {
+	root := fixtureTree(t, "hyprland.conf")
+	if ok, _ := (&OmarchyBackend{}).Detect(root); ok {
+		t.Error("detected Omarchy without an omarchy/ directory")
+	}
+}
+
+func TestResolveNestedVariables(t *testing.T) {
+	ir, err := ParseString(`$terminal = kitty
+$term_cmd = $terminal --single-instance
+$launch = uwsm app -- $term_cmd
+$mod = SUPER
+$modShift = $mod SHIFT
+bind = $modShift, Return, exec, $launch
+$terminal = foot
+exec-once = $terminal $undefined
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, vars := ir.Resolve()
+
+	for name, want := range map[string]string{
+		"$term_cmd": "kitty --single-instance",
+		"$launch":   "uwsm app -- kitty --single-instance",
+		"$modShift": "SUPER SHIFT",
+		"$terminal": "foot", // The redefinition is the final value
+	} {
+		if vars[name] != want {
+			t.Errorf("%s = %q, want %q", name, vars[name], want)
+		}
+	}
+
+	bind := resolved.Lines[5]
+	if bind.Value != "SUPER SHIFT, Return, exec, uwsm app -- kitty --single-instance" {
+		t.Errorf("bind resolved to %q", bind.Value)
+	}
+	if bind.Bind == nil || bind.Bind.Mods != "SUPER SHIFT" || bind.Bind.Args != "uwsm app -- kitty --single-instance" {
+		t.Errorf("bind fields = %+v, want them parsed from the resolved value", bind.Bind)
+	}
+	// Lines after a redefinition see the new value; unknown names stay literal
+	if got := resolved.Lines[7].Value; got != "foot $undefined" {
+		t.Errorf("exec-once resolved to %q", got)
+	}
+	// The original IR is left as written
+	if ir.Lines[5].Value != "$modShift, Return, exec, $launch" {
+		t.Errorf("original bind changed to %q", ir.Lines[5].Value)
+	}
+}
+
+func TestPreferBackendWinsWhenSeveralMatch(t *testing.T) {
+	t.Setenv("HYDE_CONFIG_HOME", "")
+	testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf": "",
+		"hypr/hyde.conf":     "",
+	})
+	backends := []ConfigBackend{&HyDEBackend{}, NewNativeBackend(), &OmarchyBackend{}}
+
+	detected := DetectBackends(backends)
+	if len(detected) != 2 || detected[0].Type() != SourceHyDE || detected[1].Type() != SourceNative {
+		t.Fatalf("DetectBackends() = %v, want hyde and native", backendTypes(detected))
+	}
+
+	// With native configured, it is first whichever order the backends came in
+	preferred := PreferBackend(backends, SourceNative)
+	if got := backendTypes(DetectBackends(preferred)); !slices.Equal(got, []ConfigSourceType{SourceNative, SourceHyDE}) {
+		t.Errorf("detected after preferring native = %v", got)
+	}
+	if len(preferred) != len(backends) {
+		t.Errorf("PreferBackend() returned %d backends, want %d", len(preferred), len(backends))
+	}
+}
+
+// backendTypes returns the type of each backend, in order
+func backendTypes(backends []ConfigBackend) []ConfigSourceType {
+	types := make([]ConfigSourceType, len(backends))
+	for i, b := range backends {
+		types[i] = b.Type()
+	}
+	return types
+}
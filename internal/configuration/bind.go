@@ -0,0 +1,77 @@
+package configuration
+
+import (
+	"sort"
+	"strings"
+)
+
+// Bind is a key binding parsed from a bind line, e.g.
+// "bind = $mainMod SHIFT, Q, exec, kitty" or "bindm = SUPER, mouse:272, movewindow"
+type Bind struct {
+	Flags       string `json:"flags,omitempty"` // Letters after "bind", e.g. "el" for bindel
+	Mods        string `json:"mods"`            // As written, possibly with $variables
+	Key         string `json:"key"`
+	Description string `json:"description,omitempty"` // Only binds with the 'd' flag have one
+	Dispatcher  string `json:"dispatcher"`
+	Args        string `json:"args,omitempty"` // Everything after the dispatcher, commas included
+}
+
+// modAliases maps alternative modifier names to the one Hyprland documents
+var modAliases = map[string]string{
+	"CONTROL": "CTRL",
+	"WIN":     "SUPER",
+	"LOGO":    "SUPER",
+	"MOD4":    "SUPER",
+	"META":    "SUPER",
+	"MOD1":    "ALT",
+}
+
+// ParseBind parses the value of a bind line (bind, bindm, binde, bindld, ...).
+// It returns nil for other keys, including unbind.
+func ParseBind(key, value string) *Bind {
+	if !isBindKey(key) || key == "unbind" {
+		return nil
+	}
+	b := &Bind{Flags: strings.TrimPrefix(key, "bind")}
+
+	fields := []*string{&b.Mods, &b.Key, &b.Dispatcher, &b.Args}
+	if strings.ContainsRune(b.Flags, 'd') {
+		fields = []*string{&b.Mods, &b.Key, &b.Description, &b.Dispatcher, &b.Args}
+	}
+	for i, part := range strings.SplitN(value, ",", len(fields)) {
+		*fields[i] = strings.TrimSpace(part)
+	}
+	return b
+}
+
+// Modifiers returns the bind's modifiers in a canonical form (upper case,
+// aliases folded, sorted, duplicates removed), so "SUPER SHIFT" and
+// "shift_super" compare equal. Resolve the IR first to expand variables such
+// as $mainMod; unexpanded ones are kept as they are.
+func (b *Bind) Modifiers() []string {
+	tokens := strings.FieldsFunc(b.Mods, func(r rune) bool {
+		return r == ' ' || r == '_' || r == '&' || r == '+' || r == '\t'
+	})
+
+	seen := make(map[string]bool)
+	var mods []string
+	for _, t := range tokens {
+		if !strings.HasPrefix(t, "$") {
+			t = strings.ToUpper(t)
+			if alias, ok := modAliases[t]; ok {
+				t = alias
+			}
+		}
+		if !seen[t] {
+			seen[t] = true
+			mods = append(mods, t)
+		}
+	}
+	sort.Strings(mods)
+	return mods
+}
+
+// IsMouse reports whether this is a mouse bind (bindm)
+func (b *Bind) IsMouse() bool {
+	return strings.ContainsRune(b.Flags, 'm')
+}
@@ -0,0 +1,81 @@
+package configuration
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseBindVariants(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want Bind
+	}{
+		{"bind = $mainMod, Q, killactive", Bind{Mods: "$mainMod", Key: "Q", Dispatcher: "killactive"}},
+		{"bind = $mainMod SHIFT, 1, movetoworkspace, 1", Bind{Mods: "$mainMod SHIFT", Key: "1", Dispatcher: "movetoworkspace", Args: "1"}},
+		{"bindm = SUPER, mouse:272, movewindow", Bind{Flags: "m", Mods: "SUPER", Key: "mouse:272", Dispatcher: "movewindow"}},
+		{"binde = , XF86MonBrightnessUp, exec, brightnessctl s 5%+", Bind{Flags: "e", Key: "XF86MonBrightnessUp", Dispatcher: "exec", Args: "brightnessctl s 5%+"}},
+		{"bindl = , switch:on:Lid Switch, exec, hyprlock", Bind{Flags: "l", Key: "switch:on:Lid Switch", Dispatcher: "exec", Args: "hyprlock"}},
+		// Commas after the dispatcher belong to its arguments
+		{"bind = SUPER, R, exec, notify-send 'Reloaded', 'config'", Bind{Mods: "SUPER", Key: "R", Dispatcher: "exec", Args: "notify-send 'Reloaded', 'config'"}},
+		{"bindd = SUPER, Return, Open a terminal, exec, kitty", Bind{Flags: "d", Mods: "SUPER", Key: "Return", Description: "Open a terminal", Dispatcher: "exec", Args: "kitty"}},
+		{"bindrl = SUPER_ALT, L, exec, hyprlock", Bind{Flags: "rl", Mods: "SUPER_ALT", Key: "L", Dispatcher: "exec", Args: "hyprlock"}},
+	} {
+		ir, err := ParseString(tc.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ir.Lines[0].Bind
+		if got == nil {
+			t.Errorf("%q: not parsed as a bind", tc.line)
+			continue
+		}
+		if *got != tc.want {
+			t.Errorf("%q:\n got %+v\nwant %+v", tc.line, *got, tc.want)
+		}
+	}
+
+	ir, err := ParseString("unbind = SUPER, Q\ngeneral:gaps_in = 5\nmonitor = , preferred, auto, 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range ir.Lines {
+		if line.Bind != nil {
+			t.Errorf("%q parsed as a bind", line.Raw)
+		}
+	}
+}
+
+func TestBindModifiersAndMouse(t *testing.T) {
+	for mods, want := range map[string][]string{
+		"SUPER SHIFT":    {"SHIFT", "SUPER"},
+		"shift_super":    {"SHIFT", "SUPER"},
+		"CONTROL + Alt":  {"ALT", "CTRL"},
+		"WIN SUPER":      {"SUPER"},
+		"$mainMod SHIFT": {"$mainMod", "SHIFT"},
+		"":               nil,
+	} {
+		b := &Bind{Mods: mods}
+		if got := b.Modifiers(); !slices.Equal(got, want) {
+			t.Errorf("Modifiers(%q) = %v, want %v", mods, got, want)
+		}
+	}
+
+	if b := ParseBind("bindm", "SUPER, mouse:273, resizewindow"); !b.IsMouse() {
+		t.Error("bindm is not a mouse bind")
+	}
+	if b := ParseBind("binde", "SUPER, right, resizeactive, 10 0"); b.IsMouse() {
+		t.Error("binde is a mouse bind")
+	}
+}
+
+func TestResolvedBindExpandsModVariable(t *testing.T) {
+	ir, err := ParseString("$mainMod = SUPER\nbind = $mainMod SHIFT, Q, killactive\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, _ := ir.Resolve()
+	b := resolved.Lines[1].Bind
+	if b == nil || b.Mods != "SUPER SHIFT" || !slices.Equal(b.Modifiers(), []string{"SHIFT", "SUPER"}) {
+		t.Errorf("resolved bind = %+v, want $mainMod expanded to SUPER", b)
+	}
+}
@@ -4,8 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-
-	"github.com/BurntSushi/toml"
+	"strings"
 )
 
 // Config represents the application configuration
@@ -13,6 +12,14 @@ type Config struct {
 	LLM      LLMConfig      `toml:"llm"`
 	Agent    AgentConfig    `toml:"agent"`
 	Security SecurityConfig `toml:"security"`
+	Safety   SafetyConfig   `toml:"safety"`
+}
+
+// SafetyConfig controls how many snapshots are kept. The most recent snapshot
+// is never pruned.
+type SafetyConfig struct {
+	MaxSnapshots       int `toml:"max_snapshots"`         // 0 keeps every snapshot
+	MaxSnapshotAgeDays int `toml:"max_snapshot_age_days"` // 0 keeps snapshots regardless of age
 }
 
 type LLMConfig struct {
@@ -25,33 +32,142 @@ type LLMConfig struct {
 	GeminiModel    string `toml:"gemini_model"`
 	OllamaHost     string `toml:"ollama_host"`
 	OllamaModel    string `toml:"ollama_model"`
+
+	// Any OpenAI-compatible server (Mistral, vLLM, ...)
+	BaseURL         string `toml:"base_url"`
+	CompatibleKey   string `toml:"compatible_api_key"`
+	CompatibleModel string `toml:"compatible_model"`
+
+	// Groq serves open models through an OpenAI-compatible API
+	GroqKey   string `toml:"groq_api_key"`
+	GroqModel string `toml:"groq_model"`
+
+	// Azure OpenAI routes by deployment name instead of model
+	AzureKey        string `toml:"azure_api_key"`
+	AzureEndpoint   string `toml:"azure_endpoint"`   // e.g. https://my-resource.openai.azure.com
+	AzureDeployment string `toml:"azure_deployment"` // Deployment name configured in the Azure portal
+	AzureAPIVersion string `toml:"azure_api_version"`
+
+	// AWS Bedrock signs requests with the usual AWS credentials
+	BedrockRegion string `toml:"bedrock_region"`
+	BedrockModel  string `toml:"bedrock_model"` // Model or inference profile ID
+
+	// Applied to whichever provider is selected; zero uses the defaults
+	TimeoutSeconds int `toml:"timeout_seconds"` // Per request (default 120)
+	MaxRetries     int `toml:"max_retries"`     // Attempts per request, including the first (default 3)
+
+	// The connection pool shared by every provider
+	MaxIdleConns           int `toml:"max_idle_conns"`            // Idle connections kept for reuse (default 10)
+	IdleConnTimeoutSeconds int `toml:"idle_conn_timeout_seconds"` // How long one is kept (default 90)
+	KeepAliveSeconds       int `toml:"keep_alive_seconds"`        // TCP keep-alive interval; negative disables
+
+	Temperature float32 `toml:"temperature"` // 0 uses the provider default
+	MaxTokens   int     `toml:"max_tokens"`  // Per response; 0 uses the provider default
+
+	PromptCaching bool `toml:"prompt_caching"` // Anthropic and Bedrock: cache the system prompt and tools
+
+	// FallbackProviders are tried in order when the provider fails with a
+	// timeout, rate limit, server error or connection error; each uses its
+	// own settings above
+	FallbackProviders []string `toml:"fallback_providers"`
+
+	// ToolMode is "native" for the provider's function calling, or "json" for
+	// models without it: tools are described in the prompt and called by
+	// writing JSON blocks. "auto" (the default) starts native and switches to
+	// json once the model turns out to have no function calling.
+	ToolMode string `toml:"tool_mode"`
 }
 
 type AgentConfig struct {
-	MaxTurns int  `toml:"max_turns"`
-	Debug    bool `toml:"debug"`
+	MaxTurns int    `toml:"max_turns"`
+	Debug    bool   `toml:"debug"`
+	LogLevel string `toml:"log_level"` // "debug", "info", "warn" or "error"; logs go to debug.log when set
+	DataDir  string `toml:"data_dir"`  // Base directory for snapshots, sessions and logs
+
+	// Backend forces "native", "hyde" or "omarchy" when several are detected
+	Backend string `toml:"backend"`
+
+	// AutoReload runs hyprctl reload and checks config errors after a confirmed apply
+	AutoReload bool `toml:"auto_reload"`
+
+	// RollbackOnError restores the previous config and reloads again when
+	// Hyprland reports errors after an AutoReload
+	RollbackOnError bool `toml:"rollback_on_error"`
+
+	// AllowReload lets the agent run hyprctl reload through the reload tool
+	AllowReload bool `toml:"allow_reload"`
+
+	// ReadOnly runs every session as --dry-run: mutating tools only describe what they would do
+	ReadOnly bool `toml:"read_only"`
+
+	// ContextBudget is the approximate token size of the history sent to the
+	// LLM; older tool results are elided beyond it
+	ContextBudget int `toml:"context_budget"`
+
+	// MaxUnknownToolCalls stops a request after the model calls this many
+	// non-existent tools; ListToolsOnUnknown tells it the valid names the first time
+	MaxUnknownToolCalls int  `toml:"max_unknown_tool_calls"`
+	ListToolsOnUnknown  bool `toml:"list_tools_on_unknown"`
+
+	// SequentialTools runs all tool calls one at a time in the order the
+	// model made them; turns that change files always do
+	SequentialTools bool `toml:"sequential_tools"`
+
+	// ReadMaxBytes caps what read_file returns at once; larger reads are
+	// truncated (default 100 KiB)
+	ReadMaxBytes int `toml:"read_max_bytes"`
+
+	// ToolTimeoutSeconds bounds each read-only tool call (default 30); a
+	// call that takes longer fails and the model carries on without it
+	ToolTimeoutSeconds int `toml:"tool_timeout_seconds"`
 }
 
 type SecurityConfig struct {
-	Native  BackendSecurity `toml:"native"`
-	Hyde    BackendSecurity `toml:"hyde"`
-	Omarchy BackendSecurity `toml:"omarchy"`
+	Native     BackendSecurity   `toml:"native"`
+	Hyde       BackendSecurity   `toml:"hyde"`
+	Omarchy    BackendSecurity   `toml:"omarchy"`
+	Companions CompanionSecurity `toml:"companions"`
+}
+
+// CompanionSecurity opts in to the configs of companion apps (waybar, rofi,
+// mako) that live outside the Hyprland config root. It is disabled by default.
+type CompanionSecurity struct {
+	Enabled     bool     `toml:"enabled"`
+	AllowedDirs []string `toml:"allowed_dirs"` // Relative to ~/.config or absolute, e.g. "waybar"
 }
 
 type BackendSecurity struct {
 	AllowedDirs  []string `toml:"allowed_dirs"`
 	AllowedFiles []string `toml:"allowed_files"`
+	// ReadOnlyFiles may be read but never written, even inside an allowed
+	// directory (e.g. hyde.conf, which HyDE manages itself)
+	ReadOnlyFiles []string `toml:"read_only_files"`
 }
 
+// AccessMode is the kind of access IsPathAllowed checks for
+type AccessMode int
+
+const (
+	AccessRead AccessMode = iota
+	AccessWrite
+)
+
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
 		LLM: LLMConfig{
 			Provider: "openai",
+			ToolMode: "auto",
 		},
 		Agent: AgentConfig{
-			MaxTurns: 25,
-			Debug:    false,
+			MaxTurns:            25,
+			Debug:               false,
+			MaxUnknownToolCalls: 3,
+			ListToolsOnUnknown:  true,
+			RollbackOnError:     true,
+		},
+		Safety: SafetyConfig{
+			MaxSnapshots: 100,
 		},
 		Security: SecurityConfig{
 			Native: BackendSecurity{
@@ -92,17 +208,28 @@ func LoadConfig() (*Config, error) {
 	// Try multiple config locations in order (following XDG and Arch conventions)
 	configPaths := []string{
 		"./config.toml", // Current directory (for development)
-		filepath.Join(os.Getenv("HOME"), ".config", "hypragent", "config.toml"), // User config (XDG)
-		"/etc/hypragent/config.toml", // System-wide config (Arch standard)
 	}
+	if userConfig, err := UserConfigPath(); err == nil {
+		configPaths = append(configPaths, userConfig) // User config (XDG)
+	}
+	configPaths = append(configPaths,
+		"/etc/hypragent/config.toml", // System-wide config (Arch standard)
+	)
 
 	var loaded bool
 	var loadedPath string
 	for _, path := range configPaths {
 		if _, err := os.Stat(path); err == nil {
-			if _, err := toml.DecodeFile(path, config); err != nil {
+			warnings, err := DecodeConfigFile(path, config)
+			if err != nil {
 				return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
 			}
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "⚠️  %s\n", w)
+			}
+			if err := config.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
 			loaded = true
 			loadedPath = path
 			break
@@ -119,6 +246,9 @@ func LoadConfig() (*Config, error) {
 	if key := os.Getenv("GEMINI_API_KEY"); key != "" {
 		config.LLM.GeminiKey = key
 	}
+	if key := os.Getenv("AZURE_OPENAI_API_KEY"); key != "" {
+		config.LLM.AzureKey = key
+	}
 	if provider := os.Getenv("LLM_PROVIDER"); provider != "" {
 		config.LLM.Provider = provider
 	}
@@ -126,51 +256,148 @@ func LoadConfig() (*Config, error) {
 		config.Agent.Debug = true
 	}
 
+	// Diagnostics go to stderr so one-shot mode output stays scriptable
 	if !loaded {
 		// No config file found, using defaults
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Println("⚠️  No config file found. Using default settings.")
-		fmt.Println("")
-		fmt.Println("To configure HyprAgent:")
-		fmt.Println("  1. Copy the example config:")
-		fmt.Println("     mkdir -p ~/.config/hypragent")
-		fmt.Println("     cp /etc/hypragent/config.toml.example ~/.config/hypragent/config.toml")
-		fmt.Println("")
-		fmt.Println("  2. Edit the config to add your API key:")
-		fmt.Println("     nano ~/.config/hypragent/config.toml")
-		fmt.Println("")
-		fmt.Println("  OR use environment variables (temporary):")
-		fmt.Println("     export OPENAI_API_KEY='sk-...'")
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Println("")
+		fmt.Fprintln(os.Stderr, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		fmt.Fprintln(os.Stderr, "⚠️  No config file found. Using default settings.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "To configure HyprAgent:")
+		fmt.Fprintln(os.Stderr, "  1. Write a commented config with the defaults:")
+		fmt.Fprintln(os.Stderr, "     hyprAgent -init")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  2. Edit the config to add your API key:")
+		fmt.Fprintln(os.Stderr, "     nano ~/.config/hypragent/config.toml")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  OR use environment variables (temporary):")
+		fmt.Fprintln(os.Stderr, "     export OPENAI_API_KEY='sk-...'")
+		fmt.Fprintln(os.Stderr, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		fmt.Fprintln(os.Stderr, "")
 	} else {
-		fmt.Printf("✓ Loaded config from: %s\n", loadedPath)
+		fmt.Fprintf(os.Stderr, "✓ Loaded config from: %s\n", loadedPath)
 	}
 
 	return config, nil
 }
 
-// IsPathAllowed checks if a path is within the allowed directories/files for a backend
-func (c *Config) IsPathAllowed(backendType ConfigSourceType, targetPath string) (bool, error) {
-	// Get the appropriate security config
-	var sec BackendSecurity
+// Redacted returns a copy of the config with every API key masked
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, key := range []*string{
+		&redacted.LLM.OpenAIKey,
+		&redacted.LLM.AnthropicKey,
+		&redacted.LLM.GeminiKey,
+		&redacted.LLM.CompatibleKey,
+		&redacted.LLM.AzureKey,
+		&redacted.LLM.GroqKey,
+	} {
+		if *key != "" {
+			*key = "[REDACTED]"
+		}
+	}
+	return &redacted
+}
+
+// String prints the config without its API keys
+func (c *Config) String() string {
+	return fmt.Sprintf("%+v", *c.Redacted())
+}
+
+// DataDir returns the base directory for snapshots, sessions and audit logs.
+// It uses [agent] data_dir when set, then $XDG_DATA_HOME/hyprAgent, and finally
+// ~/.local/share/hyprAgent.
+func (c *Config) DataDir() (string, error) {
+	if c.Agent.DataDir != "" {
+		return ExpandHome(c.Agent.DataDir)
+	}
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		return filepath.Join(xdg, "hyprAgent"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "hyprAgent"), nil
+}
+
+// DataSubdir returns the named directory under DataDir, creating it if needed
+func (c *Config) DataSubdir(name string) (string, error) {
+	base, err := c.DataDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create data directory %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// ConfigHome returns $XDG_CONFIG_HOME, or ~/.config when it is unset
+func ConfigHome() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return xdg, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config"), nil
+}
+
+// HyprConfigRoot returns the Hyprland config directory under ConfigHome
+func HyprConfigRoot() (string, error) {
+	configHome, err := ConfigHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configHome, "hypr"), nil
+}
+
+// SecurityFor returns the allow-lists for the given backend
+func (c *Config) SecurityFor(backendType ConfigSourceType) (BackendSecurity, error) {
 	switch backendType {
 	case SourceNative:
-		sec = c.Security.Native
+		return c.Security.Native, nil
 	case SourceHyDE:
-		sec = c.Security.Hyde
+		return c.Security.Hyde, nil
 	case SourceOmarchy:
-		sec = c.Security.Omarchy
+		return c.Security.Omarchy, nil
 	default:
-		return false, fmt.Errorf("unknown backend type: %s", backendType)
+		return BackendSecurity{}, fmt.Errorf("unknown backend type: %s", backendType)
+	}
+}
+
+// IsPathAllowed checks if a path is within the allowed directories/files for a
+// backend. Read-only files pass for AccessRead and are refused for AccessWrite.
+func (c *Config) IsPathAllowed(backendType ConfigSourceType, targetPath string, mode AccessMode) (bool, error) {
+	// Get the appropriate security config
+	sec, err := c.SecurityFor(backendType)
+	if err != nil {
+		return false, err
 	}
 
 	// Get Hyprland config root
-	home, err := os.UserHomeDir()
+	root, err := HyprConfigRoot()
+	if err != nil {
+		return false, err
+	}
+	configRoot, err := resolveSymlinks(root)
 	if err != nil {
 		return false, err
 	}
-	configRoot := filepath.Join(home, ".config", "hypr")
 
 	// Resolve target path to absolute
 	var absTarget string
@@ -181,8 +408,14 @@ func (c *Config) IsPathAllowed(backendType ConfigSourceType, targetPath string)
 		absTarget = filepath.Clean(absTarget)
 	}
 
+	// Follow symlinks so a link inside the config root cannot point outside it
+	absTarget, err = resolveSymlinks(absTarget)
+	if err != nil {
+		return false, err
+	}
+
 	// Check if target is within config root
-	if !filepath.HasPrefix(absTarget, configRoot) {
+	if !isWithin(configRoot, absTarget) {
 		return false, fmt.Errorf("path %s is outside Hyprland config directory", targetPath)
 	}
 
@@ -192,6 +425,16 @@ func (c *Config) IsPathAllowed(backendType ConfigSourceType, targetPath string)
 		return false, err
 	}
 
+	// Read-only files take precedence over the allowed directories
+	for _, readOnly := range sec.ReadOnlyFiles {
+		if relPath == readOnly || filepath.Base(absTarget) == readOnly {
+			if mode == AccessWrite {
+				return false, fmt.Errorf("path %s is read-only for %s backend", relPath, backendType)
+			}
+			return true, nil
+		}
+	}
+
 	// Check if it's an allowed file directly
 	for _, allowedFile := range sec.AllowedFiles {
 		if relPath == allowedFile || filepath.Base(absTarget) == allowedFile {
@@ -201,13 +444,169 @@ func (c *Config) IsPathAllowed(backendType ConfigSourceType, targetPath string)
 
 	// Check if it's within an allowed directory
 	for _, allowedDir := range sec.AllowedDirs {
-		allowedDirAbs := filepath.Join(configRoot, allowedDir)
-		allowedDirAbs = filepath.Clean(allowedDirAbs)
+		allowedDirAbs, err := resolveSymlinks(filepath.Join(configRoot, allowedDir))
+		if err != nil {
+			continue
+		}
 
-		if absTarget == allowedDirAbs || filepath.HasPrefix(absTarget, allowedDirAbs+string(filepath.Separator)) {
+		if isWithin(allowedDirAbs, absTarget) {
 			return true, nil
 		}
 	}
 
 	return false, fmt.Errorf("path %s is not in the allowed list for %s backend", relPath, backendType)
 }
+
+// AllowedPath checks path as IsPathAllowed does and returns the absolute path
+// to open. Relative paths are taken from the Hyprland config root, never the
+// working directory.
+func (c *Config) AllowedPath(backendType ConfigSourceType, path string, mode AccessMode) (string, error) {
+	if _, err := c.IsPathAllowed(backendType, path, mode); err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	root, err := HyprConfigRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, path), nil
+}
+
+// SourceFilter returns a PathFilter that lets source= expansion read only
+// the files IsPathAllowed permits for the backend
+func (c *Config) SourceFilter(backendType ConfigSourceType) PathFilter {
+	return func(path string) error {
+		_, err := c.IsPathAllowed(backendType, path, AccessRead)
+		return err
+	}
+}
+
+// AllowedPaths returns the absolute allowed directories and files of a
+// backend that exist under the Hyprland config root. Entries in AllowedFiles
+// that only name a file (without a directory) are looked up in the root.
+func (c *Config) AllowedPaths(backendType ConfigSourceType) ([]string, error) {
+	sec, err := c.SecurityFor(backendType)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := HyprConfigRoot()
+	if err != nil {
+		return nil, err
+	}
+	configRoot, err := resolveSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	roots := append(append([]string{}, sec.AllowedDirs...), sec.AllowedFiles...)
+	for _, rel := range append(roots, sec.ReadOnlyFiles...) {
+		p := filepath.Join(configRoot, rel)
+		if seen[p] {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// CompanionPath checks that path is inside one of the opted-in companion
+// directories and returns it resolved. Relative paths are taken from ConfigHome.
+// Files under the Hyprland config root are never companion files; they go
+// through IsPathAllowed instead.
+func (c *Config) CompanionPath(path string) (string, error) {
+	sec := c.Security.Companions
+	if !sec.Enabled {
+		return "", fmt.Errorf("companion config access is disabled; enable it under [security.companions]")
+	}
+
+	configHome, err := ConfigHome()
+	if err != nil {
+		return "", err
+	}
+	hyprRoot, err := resolveSymlinks(filepath.Join(configHome, "hypr"))
+	if err != nil {
+		return "", err
+	}
+
+	resolve := func(p string) (string, error) {
+		p, err := ExpandHome(p)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(configHome, p)
+		}
+		return resolveSymlinks(p)
+	}
+
+	target, err := resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if isWithin(hyprRoot, target) {
+		return "", fmt.Errorf("path %s is inside the Hyprland config directory; use the regular file tools", path)
+	}
+
+	for _, dir := range sec.AllowedDirs {
+		allowed, err := resolve(dir)
+		if err != nil {
+			continue
+		}
+		// An entry covering all of ~/.config (or more) would defeat the allow-list
+		if isWithin(allowed, configHome) || isWithin(allowed, hyprRoot) {
+			continue
+		}
+		if isWithin(allowed, target) {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("path %s is not in [security.companions] allowed_dirs", path)
+}
+
+// isWithin reports whether path is root or inside it. Both must be clean and
+// absolute; the comparison is on whole path segments, so ~/.config/hypr-evil
+// is not inside ~/.config/hypr.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// resolveSymlinks evaluates symlinks in path. Files that do not exist yet are
+// resolved through their nearest existing parent directory.
+func resolveSymlinks(path string) (string, error) {
+	path = filepath.Clean(path)
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		// A dangling symlink exists but points nowhere; its target is unknown
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", fmt.Errorf("failed to resolve %s: dangling symlink", path)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		missing = append(missing, filepath.Base(path))
+		path = parent
+	}
+}
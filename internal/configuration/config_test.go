@@ -0,0 +1,144 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testConfigHome points XDG_CONFIG_HOME at a temp directory holding files,
+// keyed by their path relative to it, and returns the directory
+func testConfigHome(t *testing.T, files map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	for name, content := range files {
+		path := filepath.Join(home, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestIsPathAllowedRejectsSiblingDirectory(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf":      "",
+		"hypr-evil/hyprland.conf": "",
+	})
+	cfg := DefaultConfig()
+
+	for _, path := range []string{
+		filepath.Join(home, "hypr-evil", "hyprland.conf"),
+		"../hypr-evil/hyprland.conf",
+	} {
+		if ok, err := cfg.IsPathAllowed(SourceNative, path, AccessRead); ok || err == nil {
+			t.Errorf("IsPathAllowed(%s) = %v, %v; want it refused", path, ok, err)
+		}
+	}
+	if ok, err := cfg.IsPathAllowed(SourceNative, filepath.Join(home, "hypr", "hyprland.conf"), AccessRead); !ok {
+		t.Errorf("hyprland.conf refused: %v", err)
+	}
+}
+
+func TestIsPathAllowedRejectsSymlinkOutOfRoot(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf": "",
+		"secrets/token.conf": "api_key = sk-secret",
+	})
+	cfg := DefaultConfig()
+	root := filepath.Join(home, "hypr")
+	// A file link and a directory link, both under allowed names
+	if err := os.Symlink(filepath.Join(home, "secrets", "token.conf"), filepath.Join(root, "monitors.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(home, "secrets"), filepath.Join(root, "themes")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"monitors.conf", "themes/token.conf", "themes/new.conf"} {
+		for _, mode := range []AccessMode{AccessRead, AccessWrite} {
+			if ok, err := cfg.IsPathAllowed(SourceNative, path, mode); ok || err == nil {
+				t.Errorf("IsPathAllowed(%s, %v) = %v, %v; want it refused", path, mode, ok, err)
+			}
+		}
+	}
+}
+
+func TestReadOnlyFileIsReadableNotWritable(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf":     "",
+		"hypr/hyde.conf":         "",
+		"hypr/themes/theme.conf": "",
+	})
+	cfg := DefaultConfig()
+	cfg.Security.Hyde.ReadOnlyFiles = []string{"hyde.conf", "themes/theme.conf"}
+
+	for _, path := range []string{"hyde.conf", filepath.Join(home, "hypr", "hyde.conf"), "themes/theme.conf"} {
+		if ok, err := cfg.IsPathAllowed(SourceHyDE, path, AccessRead); !ok {
+			t.Errorf("reading %s refused: %v", path, err)
+		}
+		ok, err := cfg.IsPathAllowed(SourceHyDE, path, AccessWrite)
+		if ok || err == nil || !strings.Contains(err.Error(), "read-only") {
+			t.Errorf("writing %s = %v, %v; want it refused as read-only", path, ok, err)
+		}
+		if _, err := cfg.AllowedPath(SourceHyDE, path, AccessWrite); err == nil {
+			t.Errorf("AllowedPath(%s) allowed a write", path)
+		}
+	}
+	// Other files in the same directories stay writable
+	if ok, err := cfg.IsPathAllowed(SourceHyDE, "hyprland.conf", AccessWrite); !ok {
+		t.Errorf("writing hyprland.conf refused: %v", err)
+	}
+}
+
+func TestConfigRootFollowsXDGConfigHome(t *testing.T) {
+	t.Setenv("HYDE_CONFIG_HOME", "")
+	// A config in the default place that must not be picked up
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	decoy := filepath.Join(home, ".config", "hypr", "hyprland.conf")
+	if err := os.MkdirAll(filepath.Dir(decoy), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(decoy, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	xdg := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf":        "",
+		"hypr/omarchy/default.conf": "",
+	})
+	root := filepath.Join(xdg, "hypr")
+
+	if got, err := HyprConfigRoot(); err != nil || got != root {
+		t.Fatalf("HyprConfigRoot() = %s, %v; want %s", got, err, root)
+	}
+	native := NewNativeBackend()
+	if ok, err := native.Detect(""); !ok || err != nil || native.ConfigPath != filepath.Join(root, "hyprland.conf") {
+		t.Errorf("native Detect() = %v, %v with %s; want the config under XDG_CONFIG_HOME", ok, err, native.ConfigPath)
+	}
+	if ok, err := (&OmarchyBackend{}).Detect(""); !ok || err != nil {
+		t.Errorf("omarchy Detect() = %v, %v; want the omarchy directory under XDG_CONFIG_HOME found", ok, err)
+	}
+	if ok, _ := (&HyDEBackend{}).Detect(""); ok {
+		t.Error("HyDE detected without any of its markers")
+	}
+
+	cfg := DefaultConfig()
+	if path, err := cfg.AllowedPath(SourceNative, "hyprland.conf", AccessWrite); err != nil || path != filepath.Join(root, "hyprland.conf") {
+		t.Errorf("AllowedPath(hyprland.conf) = %s, %v; want it under XDG_CONFIG_HOME", path, err)
+	}
+	if ok, err := cfg.IsPathAllowed(SourceNative, decoy, AccessRead); ok || err == nil {
+		t.Errorf("IsPathAllowed(%s) = %v, %v; want the default location refused", decoy, ok, err)
+	}
+
+	// Unset, it falls back to ~/.config
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if got, err := HyprConfigRoot(); err != nil || got != filepath.Dir(decoy) {
+		t.Errorf("HyprConfigRoot() without XDG_CONFIG_HOME = %s, %v; want %s", got, err, filepath.Dir(decoy))
+	}
+}
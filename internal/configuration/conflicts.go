@@ -0,0 +1,164 @@
+package configuration
+
+import (
+	"sort"
+	"strings"
+)
+
+// ValueDefinition is one place where an option is set
+type ValueDefinition struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Value string `json:"value"`
+}
+
+// ValueConflict is an option that is set to different values in more than one file
+type ValueConflict struct {
+	Option      string            `json:"option"`
+	Effective   ValueDefinition   `json:"effective"` // The definition Hyprland applies (the last one evaluated)
+	Definitions []ValueDefinition `json:"definitions"`
+}
+
+// FindValueConflicts reports options that are defined with different values
+// in more than one file. lines must be in evaluation order (see ExpandSources)
+// so that the last definition of each option is the one that takes effect.
+func FindValueConflicts(lines []SourcedLine) []ValueConflict {
+	defs := make(map[string][]ValueDefinition)
+	var order []string
+
+	for _, sl := range lines {
+		if !isSetting(sl.Line) {
+			continue
+		}
+		// Repeatable keys (binds, exec-once, ...) accumulate rather than override.
+		// Named entries like monitor=DP-1,... still override per name.
+		if IsRepeatableKey(sl.Line.Key) && !fieldKeyedKeys[sl.Line.Key] {
+			continue
+		}
+		id := settingIdentity(sl.Section, sl.Line)
+		if _, ok := defs[id]; !ok {
+			order = append(order, id)
+		}
+		defs[id] = append(defs[id], ValueDefinition{
+			File:  sl.File,
+			Line:  sl.Line.LineNum,
+			Value: sl.Line.Value,
+		})
+	}
+
+	var conflicts []ValueConflict
+	for _, id := range order {
+		d := defs[id]
+		files := make(map[string]bool)
+		values := make(map[string]bool)
+		for _, def := range d {
+			files[def.File] = true
+			values[normalizeValue(def.Value)] = true
+		}
+		if len(files) < 2 || len(values) < 2 {
+			continue
+		}
+		conflicts = append(conflicts, ValueConflict{
+			Option:      id,
+			Effective:   d[len(d)-1],
+			Definitions: d,
+		})
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].Option < conflicts[j].Option })
+	return conflicts
+}
+
+// BindDefinition is one bind line for a key combination
+type BindDefinition struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Raw        string `json:"raw"`
+	Dispatcher string `json:"dispatcher"`
+	Args       string `json:"args,omitempty"`
+}
+
+// BindConflict is a key combination bound more than once
+type BindConflict struct {
+	Key    string           `json:"key"`              // e.g. "SHIFT + SUPER + Q"
+	Submap string           `json:"submap,omitempty"` // Binds in different submaps never clash
+	Binds  []BindDefinition `json:"binds"`
+}
+
+// FindBindConflicts reports key combinations that are bound more than once.
+// lines must be in evaluation order (see ExpandSources): variables such as
+// $mainMod are expanded as Hyprland would, modifiers are compared as sets (so
+// "SUPER SHIFT" equals "SHIFT SUPER"), and unbind removes earlier binds.
+// Release binds (bindr) are kept apart from press binds, with which they can
+// legitimately share a key.
+func FindBindConflicts(lines []SourcedLine) []BindConflict {
+	vars := make(map[string]string)
+	binds := make(map[string][]BindDefinition)
+	names := make(map[string]BindConflict)
+	var order []string
+	submap := ""
+
+	for _, sl := range lines {
+		line := sl.Line
+		value := expandVariables(line.Value, vars)
+		if line.Type == LineTypeVariable && line.Key != "" {
+			vars[line.Key] = value
+			continue
+		}
+		if line.Type != LineTypeKeyValue || sl.Section != "" {
+			continue
+		}
+
+		switch {
+		case line.Key == "submap":
+			submap = value
+			if submap == "reset" {
+				submap = ""
+			}
+		case line.Key == "unbind":
+			b := ParseBind("bind", value)
+			for _, release := range []bool{false, true} {
+				delete(binds, bindIdentity(submap, b, release))
+			}
+		default:
+			b := ParseBind(line.Key, value)
+			if b == nil || b.Key == "" {
+				continue
+			}
+			id := bindIdentity(submap, b, strings.ContainsRune(b.Flags, 'r'))
+			if _, ok := names[id]; !ok {
+				order = append(order, id)
+				combo := append(b.Modifiers(), b.Key)
+				names[id] = BindConflict{Key: strings.Join(combo, " + "), Submap: submap}
+			}
+			binds[id] = append(binds[id], BindDefinition{
+				File:       sl.File,
+				Line:       line.LineNum,
+				Raw:        strings.TrimSpace(line.Raw),
+				Dispatcher: b.Dispatcher,
+				Args:       b.Args,
+			})
+		}
+	}
+
+	var conflicts []BindConflict
+	for _, id := range order {
+		if len(binds[id]) < 2 {
+			continue
+		}
+		c := names[id]
+		c.Binds = binds[id]
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
+
+// bindIdentity is the key combination a bind reacts to. Key names are matched
+// case-insensitively, as Hyprland does.
+func bindIdentity(submap string, b *Bind, release bool) string {
+	id := submap + "|" + strings.Join(b.Modifiers(), " ") + "|" + strings.ToLower(b.Key)
+	if release {
+		id += "|release"
+	}
+	return id
+}
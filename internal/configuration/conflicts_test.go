@@ -0,0 +1,45 @@
+package configuration
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFindBindConflictsReportsDuplicate(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf": `$mainMod = SUPER
+source = binds.conf
+bind = SHIFT SUPER, q, exec, kitty
+bindr = $mainMod SHIFT, Q, exec, notify-send released
+bind = $mainMod, F, fullscreen
+unbind = SUPER, F
+bind = $mainMod, F, togglefloating
+
+submap = resize
+bind = $mainMod SHIFT, Q, submap, reset
+submap = reset
+`,
+		"hypr/binds.conf": "bind = $mainMod SHIFT, Q, killactive\nbind = $mainMod, Return, exec, kitty\n",
+	})
+	main := filepath.Join(home, "hypr", "hyprland.conf")
+	lines, err := ExpandSources(main, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conflicts := FindBindConflicts(lines)
+	if len(conflicts) != 1 {
+		t.Fatalf("FindBindConflicts() = %+v, want only SUPER SHIFT Q", conflicts)
+	}
+	c := conflicts[0]
+	if c.Key != "SHIFT + SUPER + Q" || c.Submap != "" || len(c.Binds) != 2 {
+		t.Fatalf("conflict = %+v", c)
+	}
+	first, second := c.Binds[0], c.Binds[1]
+	if first.File != filepath.Join(home, "hypr", "binds.conf") || first.Line != 1 || first.Dispatcher != "killactive" {
+		t.Errorf("first bind = %+v, want killactive from binds.conf", first)
+	}
+	if second.File != main || second.Line != 3 || second.Dispatcher != "exec" || second.Args != "kitty" {
+		t.Errorf("second bind = %+v, want exec kitty from hyprland.conf", second)
+	}
+}
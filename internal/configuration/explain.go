@@ -0,0 +1,308 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field is one named part of a directive's value
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// LineExplanation describes what a single config line does
+type LineExplanation struct {
+	Line        int     `json:"line,omitempty"`
+	Raw         string  `json:"raw"`
+	Category    string  `json:"category"`          // e.g. "bind", "monitor", "exec", "option"
+	Section     string  `json:"section,omitempty"` // Colon-separated section path
+	Key         string  `json:"key,omitempty"`
+	Value       string  `json:"value,omitempty"`
+	Fields      []Field `json:"fields,omitempty"`
+	Explanation string  `json:"explanation"`
+}
+
+// keywordHelp explains the top-level keywords that take a structured value
+var keywordHelp = map[string]string{
+	"monitor":       "Configures a display: its mode, position in the layout and scale.",
+	"exec":          "Runs a command every time the config is loaded or reloaded.",
+	"exec-once":     "Runs a command once, when Hyprland starts.",
+	"execr":         "Runs a command without a shell every time the config is loaded.",
+	"execr-once":    "Runs a command without a shell once, when Hyprland starts.",
+	"exec-shutdown": "Runs a command when Hyprland exits.",
+	"env":           "Sets an environment variable for Hyprland and the programs it starts.",
+	"source":        "Includes another config file at this point.",
+	"windowrule":    "Applies a rule to windows that match the given criteria.",
+	"windowrulev2":  "Applies a rule to windows that match the given criteria (older v2 syntax).",
+	"layerrule":     "Applies a rule to layer-shell surfaces such as bars and notifications.",
+	"workspace":     "Sets rules for a workspace, such as the monitor it lives on.",
+	"animation":     "Controls one animation: whether it is on, its speed, curve and style.",
+	"bezier":        "Defines a named bezier curve that animations can use.",
+	"unbind":        "Removes an earlier key binding.",
+	"plugin":        "Loads a Hyprland plugin from a shared library.",
+	"permission":    "Grants or denies a program access to a protected capability.",
+	"gesture":       "Binds a touchpad gesture to an action.",
+}
+
+// optionHelp explains commonly used options, keyed by qualified name
+var optionHelp = map[string]string{
+	"general:gaps_in":                "Gap between neighbouring windows, in pixels.",
+	"general:gaps_out":               "Gap between windows and the edges of the monitor, in pixels.",
+	"general:border_size":            "Width of window borders, in pixels.",
+	"general:col.active_border":      "Border color (or gradient) of the focused window.",
+	"general:col.inactive_border":    "Border color (or gradient) of unfocused windows.",
+	"general:layout":                 "Tiling layout to use: dwindle or master.",
+	"general:resize_on_border":       "Lets you resize windows by dragging their borders.",
+	"general:allow_tearing":          "Allows screen tearing for windows with the immediate rule, lowering latency in games.",
+	"decoration:rounding":            "Corner radius of windows, in pixels.",
+	"decoration:active_opacity":      "Opacity of the focused window (0.0 to 1.0).",
+	"decoration:inactive_opacity":    "Opacity of unfocused windows (0.0 to 1.0).",
+	"decoration:dim_inactive":        "Dims unfocused windows.",
+	"decoration:blur:enabled":        "Turns background blur behind transparent windows on or off.",
+	"decoration:blur:size":           "Blur radius; larger values blur more.",
+	"decoration:blur:passes":         "Number of blur passes; more look smoother but cost more GPU time.",
+	"decoration:shadow:enabled":      "Turns window drop shadows on or off.",
+	"decoration:shadow:range":        "How far window shadows extend, in pixels.",
+	"animations:enabled":             "Turns all animations on or off.",
+	"input:kb_layout":                "Keyboard layout(s), e.g. us or us,de.",
+	"input:kb_variant":               "Keyboard layout variant, e.g. dvorak.",
+	"input:kb_options":               "XKB options, e.g. caps:escape.",
+	"input:follow_mouse":             "How focus follows the mouse: 0 off, 1 always, 2 and 3 looser modes.",
+	"input:sensitivity":              "Mouse sensitivity adjustment, from -1.0 to 1.0.",
+	"input:natural_scroll":           "Reverses the scroll direction.",
+	"input:touchpad:natural_scroll":  "Reverses the touchpad scroll direction.",
+	"input:touchpad:tap-to-click":    "Lets a tap on the touchpad count as a click.",
+	"dwindle:pseudotile":             "Allows pseudotiling, where a tiled window keeps its own size.",
+	"dwindle:preserve_split":         "Keeps the split direction when windows are rearranged.",
+	"master:new_status":              "Whether new windows become master, slave or inherit.",
+	"misc:disable_hyprland_logo":     "Hides the Hyprland logo and anime wallpaper.",
+	"misc:force_default_wallpaper":   "Chooses the built-in wallpaper: -1 random, 0 or 1 without anime, 2 anime.",
+	"misc:vfr":                       "Lowers the refresh rate when nothing changes on screen, saving power.",
+	"cursor:no_hardware_cursors":     "Draws the cursor in software; fixes invisible cursors on some GPUs.",
+	"xwayland:force_zero_scaling":    "Stops scaling XWayland apps, making them sharp but small on HiDPI.",
+	"gestures:workspace_swipe":       "Switches workspaces with a touchpad swipe (older versions).",
+	"binds:workspace_back_and_forth": "Selecting the current workspace again goes back to the previous one.",
+	"ecosystem:no_update_news":       "Hides the news dialog shown after Hyprland updates.",
+	"render:direct_scanout":          "Sends fullscreen windows straight to the display, lowering latency.",
+	"experimental:hdr":               "Enables HDR output where supported.",
+	"group:col.border_active":        "Border color of the focused window group.",
+	"debug:disable_logs":             "Turns Hyprland's debug log off.",
+}
+
+// dispatcherHelp explains the dispatchers most often used in binds
+var dispatcherHelp = map[string]string{
+	"exec":                   "runs a command",
+	"killactive":             "closes the focused window",
+	"forcekillactive":        "kills the focused window's process",
+	"exit":                   "quits Hyprland",
+	"workspace":              "switches to a workspace",
+	"movetoworkspace":        "moves the focused window to a workspace and follows it",
+	"movetoworkspacesilent":  "moves the focused window to a workspace without following it",
+	"togglefloating":         "toggles the focused window between tiled and floating",
+	"fullscreen":             "toggles fullscreen for the focused window",
+	"pseudo":                 "toggles pseudotiling for the focused window",
+	"togglesplit":            "switches the split direction (dwindle)",
+	"movefocus":              "moves focus in a direction",
+	"movewindow":             "moves a window",
+	"resizewindow":           "resizes a window",
+	"resizeactive":           "resizes the focused window",
+	"swapwindow":             "swaps the focused window with a neighbour",
+	"togglespecialworkspace": "shows or hides a special (scratchpad) workspace",
+	"togglegroup":            "turns the focused window into a group or ungroups it",
+	"changegroupactive":      "switches to another window in the group",
+	"cyclenext":              "focuses the next window",
+	"focusmonitor":           "focuses a monitor",
+	"pin":                    "pins a floating window to every workspace",
+	"centerwindow":           "centers a floating window",
+	"pass":                   "passes the key to a specific window",
+	"submap":                 "switches to a submap (a mode with its own binds)",
+}
+
+// bindFlags explains the letters that may follow "bind"
+var bindFlags = map[rune]string{
+	'l': "works while the screen is locked",
+	'r': "triggers on key release",
+	'o': "triggers on a long press",
+	'e': "repeats while held",
+	'n': "does not consume the key, so the focused window still receives it",
+	'm': "is a mouse bind",
+	't': "is transparent to other binds",
+	'i': "ignores modifiers",
+	's': "combines keys into a sequence",
+	'd': "has a description",
+	'p': "bypasses the app's shortcut inhibitor",
+	'c': "triggers on a click",
+	'g': "triggers on a drag",
+}
+
+// ExplainLine describes what line does. section is the colon-separated path
+// of the block containing it, as returned by SectionPaths.
+func ExplainLine(line ConfigLine, section string) LineExplanation {
+	e := LineExplanation{Line: line.LineNum, Raw: line.Raw, Section: section, Key: line.Key, Value: line.Value}
+
+	switch line.Type {
+	case LineTypeEmpty:
+		e.Category = "empty"
+		e.Explanation = "An empty line; it has no effect."
+	case LineTypeComment:
+		e.Category = "comment"
+		e.Explanation = "A comment; Hyprland ignores it."
+	case LineTypeVariable:
+		e.Category = "variable"
+		e.Fields = []Field{{"name", line.Key}, {"value", line.Value}}
+		e.Explanation = fmt.Sprintf("Defines the variable %s. Later lines can write %s instead of repeating %q.", line.Key, line.Key, line.Value)
+	case LineTypeSectionStart:
+		e.Category = "section"
+		name := QualifiedName(section, line.Key)
+		e.Explanation = fmt.Sprintf("Opens the %s section; the settings up to the matching } are %s:<option> options.", name, name)
+	case LineTypeSectionEnd:
+		e.Category = "section_end"
+		e.Explanation = "Closes the current section."
+	case LineTypeKeyValue:
+		explainKeyValue(&e, line, section)
+	default:
+		e.Category = "unknown"
+		e.Explanation = "Hyprland does not recognise this line; settings need the form key = value."
+	}
+	return e
+}
+
+func explainKeyValue(e *LineExplanation, line ConfigLine, section string) {
+	key, value := line.Key, line.Value
+	if section == "" && line.Bind != nil {
+		explainBind(e, line.Bind)
+		return
+	}
+
+	help, known := keywordHelp[key]
+	if !known || section != "" {
+		e.Category = "option"
+		name := QualifiedName(section, key)
+		e.Fields = []Field{{"option", name}, {"value", value}}
+		if help, ok := optionHelp[name]; ok {
+			e.Explanation = fmt.Sprintf("Sets %s to %s. %s", name, value, help)
+		} else {
+			e.Explanation = fmt.Sprintf("Sets the option %s to %s.", name, value)
+		}
+		return
+	}
+
+	parts := splitFields(value, -1)
+	e.Explanation = help
+	switch key {
+	case "monitor":
+		e.Category = "monitor"
+		e.Fields = nameFields(parts, "name", "resolution", "position", "scale")
+		if len(parts) >= 2 && parts[1] == "disable" {
+			e.Fields = []Field{{"name", parts[0]}, {"state", "disable"}}
+			e.Explanation += fmt.Sprintf(" This turns %s off.", monitorName(parts[0]))
+		} else if len(parts) >= 4 {
+			e.Explanation += fmt.Sprintf(" %s runs at %s, placed at %s with scale %s.", capitalize(monitorName(parts[0])), parts[1], parts[2], parts[3])
+		}
+	case "exec", "exec-once", "execr", "execr-once", "exec-shutdown":
+		e.Category = "exec"
+		e.Fields = []Field{{"command", value}}
+	case "env":
+		e.Category = "env"
+		parts = splitFields(value, 2)
+		e.Fields = nameFields(parts, "name", "value")
+	case "source":
+		e.Category = "source"
+		e.Fields = []Field{{"path", value}}
+	case "windowrule", "windowrulev2", "layerrule":
+		e.Category = key
+		parts = splitFields(value, 2)
+		e.Fields = nameFields(parts, "rule", "match")
+	case "workspace":
+		e.Category = "workspace"
+		parts = splitFields(value, 2)
+		e.Fields = nameFields(parts, "workspace", "rules")
+	case "animation":
+		e.Category = "animation"
+		e.Fields = nameFields(parts, "name", "enabled", "speed", "curve", "style")
+	case "bezier":
+		e.Category = "bezier"
+		e.Fields = nameFields(parts, "name", "x0", "y0", "x1", "y1")
+	default:
+		e.Category = key
+		e.Fields = []Field{{"value", value}}
+	}
+}
+
+// explainBind describes a bind line from its parsed fields
+func explainBind(e *LineExplanation, b *Bind) {
+	e.Category = "bind"
+	e.Fields = []Field{{"mods", b.Mods}, {"key", b.Key}}
+	if strings.ContainsRune(b.Flags, 'd') {
+		e.Fields = append(e.Fields, Field{"description", b.Description})
+	}
+	e.Fields = append(e.Fields, Field{"dispatcher", b.Dispatcher})
+	if b.Args != "" {
+		e.Fields = append(e.Fields, Field{"args", b.Args})
+	}
+
+	combo := b.Key
+	if mods := b.Modifiers(); len(mods) > 0 {
+		combo = strings.Join(mods, " + ") + " + " + combo
+	}
+	action := fmt.Sprintf("runs the %s dispatcher", b.Dispatcher)
+	if help, ok := dispatcherHelp[b.Dispatcher]; ok {
+		action = help
+	}
+	if b.Args != "" {
+		action += fmt.Sprintf(" (%s)", b.Args)
+	}
+	e.Explanation = fmt.Sprintf("Pressing %s %s.", combo, action)
+	if b.IsMouse() {
+		e.Explanation = fmt.Sprintf("Holding %s and dragging the mouse %s.", combo, action)
+	}
+
+	var notes []string
+	for _, f := range b.Flags {
+		if note, ok := bindFlags[f]; ok && f != 'm' && f != 'd' {
+			notes = append(notes, note)
+		}
+	}
+	if len(notes) > 0 {
+		e.Explanation += " The bind " + strings.Join(notes, ", ") + "."
+	}
+}
+
+// splitFields splits a comma-separated value into at most n trimmed fields
+func splitFields(value string, n int) []string {
+	parts := strings.SplitN(value, ",", n)
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// nameFields pairs values with names; values beyond the names are joined
+// back into the last field
+func nameFields(values []string, names ...string) []Field {
+	var fields []Field
+	for i, v := range values {
+		if i >= len(names) {
+			last := &fields[len(fields)-1]
+			last.Value += ", " + v
+			continue
+		}
+		fields = append(fields, Field{Name: names[i], Value: v})
+	}
+	return fields
+}
+
+func monitorName(name string) string {
+	if name == "" {
+		return "any monitor without a rule of its own"
+	}
+	return "monitor " + name
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
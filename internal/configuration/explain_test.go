@@ -0,0 +1,70 @@
+package configuration
+
+import (
+	"slices"
+	"testing"
+)
+
+// explain parses raw, a single top-level line, and explains it
+func explain(t *testing.T, raw string) LineExplanation {
+	t.Helper()
+	ir, err := ParseString(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ir.Lines) != 1 {
+		t.Fatalf("%q parsed as %d lines", raw, len(ir.Lines))
+	}
+	return ExplainLine(ir.Lines[0], "")
+}
+
+func TestExplainBindLine(t *testing.T) {
+	for _, tc := range []struct {
+		raw         string
+		fields      []Field
+		explanation string
+	}{
+		{
+			"bind = SUPER SHIFT, Q, killactive",
+			[]Field{{"mods", "SUPER SHIFT"}, {"key", "Q"}, {"dispatcher", "killactive"}},
+			"Pressing SHIFT + SUPER + Q closes the focused window.",
+		},
+		{
+			"bindd = SUPER, Return, Terminal, exec, kitty",
+			[]Field{{"mods", "SUPER"}, {"key", "Return"}, {"description", "Terminal"}, {"dispatcher", "exec"}, {"args", "kitty"}},
+			"Pressing SUPER + Return runs a command (kitty).",
+		},
+		{
+			"bindel = , XF86AudioRaiseVolume, exec, wpctl set-volume @DEFAULT_AUDIO_SINK@ 5%+",
+			[]Field{{"mods", ""}, {"key", "XF86AudioRaiseVolume"}, {"dispatcher", "exec"}, {"args", "wpctl set-volume @DEFAULT_AUDIO_SINK@ 5%+"}},
+			"Pressing XF86AudioRaiseVolume runs a command (wpctl set-volume @DEFAULT_AUDIO_SINK@ 5%+). The bind repeats while held, works while the screen is locked.",
+		},
+	} {
+		e := explain(t, tc.raw)
+		if e.Category != "bind" {
+			t.Errorf("%q: category = %q, want bind", tc.raw, e.Category)
+		}
+		if !slices.Equal(e.Fields, tc.fields) {
+			t.Errorf("%q: fields = %v, want %v", tc.raw, e.Fields, tc.fields)
+		}
+		if e.Explanation != tc.explanation {
+			t.Errorf("%q: explanation = %q, want %q", tc.raw, e.Explanation, tc.explanation)
+		}
+	}
+}
+
+func TestExplainMonitorLine(t *testing.T) {
+	e := explain(t, "monitor = DP-1, 2560x1440@144, 1920x0, 1.25")
+	want := []Field{{"name", "DP-1"}, {"resolution", "2560x1440@144"}, {"position", "1920x0"}, {"scale", "1.25"}}
+	if e.Category != "monitor" || !slices.Equal(e.Fields, want) {
+		t.Errorf("category = %q, fields = %v; want monitor with %v", e.Category, e.Fields, want)
+	}
+	if want := keywordHelp["monitor"] + " Monitor DP-1 runs at 2560x1440@144, placed at 1920x0 with scale 1.25."; e.Explanation != want {
+		t.Errorf("explanation = %q, want %q", e.Explanation, want)
+	}
+
+	e = explain(t, "monitor = HDMI-A-1, disable")
+	if want := []Field{{"name", "HDMI-A-1"}, {"state", "disable"}}; !slices.Equal(e.Fields, want) {
+		t.Errorf("disabled monitor fields = %v, want %v", e.Fields, want)
+	}
+}
@@ -0,0 +1,200 @@
+package configuration
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configDocs holds the comment written above each table and key by
+// DefaultConfigTOML, keyed by the dotted toml name
+var configDocs = map[string]string{
+	"llm":                   "LLM provider settings. API keys can also be set via environment variables",
+	"llm.provider":          "LLM Provider: " + strings.Join(KnownProviders, ", "),
+	"llm.openai_api_key":    "OpenAI API key (or OPENAI_API_KEY)",
+	"llm.anthropic_api_key": "Anthropic API key (or ANTHROPIC_API_KEY)",
+	"llm.gemini_api_key":    "Gemini API key (or GEMINI_API_KEY)",
+	"llm.openai_model":      "Model overrides; empty uses each provider's default",
+	"llm.ollama_host":       "Ollama server for local models, e.g. http://localhost:11434/v1",
+	"llm.base_url":          "Any OpenAI-compatible server (Mistral, vLLM, LM Studio, ...)",
+	"llm.groq_api_key":      "Groq API key (or GROQ_API_KEY); the model defaults to llama-3.3-70b-versatile",
+	"llm.azure_api_key":     "Azure OpenAI routes requests to a deployment instead of a model name",
+	"llm.azure_endpoint":    "e.g. https://my-resource.openai.azure.com",
+	"llm.bedrock_region": "AWS Bedrock. Credentials come from AWS_ACCESS_KEY_ID /\n" +
+		"AWS_SECRET_ACCESS_KEY or the AWS_PROFILE profile in ~/.aws/credentials",
+	"llm.bedrock_model":      "Model or inference profile ID",
+	"llm.timeout_seconds":    "Request timeout in seconds (0 uses 120)",
+	"llm.max_retries":        "Attempts per request, including the first (0 uses 3)",
+	"llm.max_idle_conns":     "Idle connections every provider can reuse (0 uses 10), and seconds each is kept (0 uses 90)",
+	"llm.keep_alive_seconds": "TCP keep-alive interval, e.g. for a local Ollama (0 uses Go's default, -1 disables)",
+	"llm.temperature":        "Sampling temperature; 0 uses the provider's default",
+	"llm.max_tokens":         "Response length limit; 0 uses the provider's default",
+	"llm.prompt_caching":     "Let Anthropic (or Bedrock) cache the system prompt and tool definitions",
+	"llm.fallback_providers": "Providers to try in order when the provider above is down or rate limited,\ne.g. [\"ollama\"]; each uses its own settings from this section",
+	"llm.tool_mode": "How the model calls tools: \"native\" function calling, \"json\" for models\n" +
+		"without it, which describe tool calls as JSON blocks in their reply, or \"auto\"\n" +
+		"(default) to switch to json when the model turns out to have no function calling",
+
+	"agent":                        "Agent behaviour",
+	"agent.max_turns":              "Maximum turns the agent can take before stopping",
+	"agent.debug":                  "Enable debug logging",
+	"agent.log_level":              "Only log messages at or above this level to debug.log: \"debug\", \"info\", \"warn\" or \"error\"",
+	"agent.data_dir":               "Base directory for snapshots, sessions and audit logs\n(default $XDG_DATA_HOME/hyprAgent or ~/.local/share/hyprAgent)",
+	"agent.backend":                "Which setup to configure when more than one is detected: \"native\", \"hyde\" or \"omarchy\"",
+	"agent.auto_reload":            "Reload Hyprland and check for config errors right after a confirmed apply",
+	"agent.rollback_on_error":      "With auto_reload, undo the change and reload again if Hyprland reports errors",
+	"agent.allow_reload":           "Let the agent run 'hyprctl reload' when you agree to it",
+	"agent.read_only":              "Never write anything; changes are only described (same as --dry-run)",
+	"agent.context_budget":         "Approximate token budget for the conversation sent to the LLM; older\ntool results are elided beyond it",
+	"agent.max_unknown_tool_calls": "Stop a request after the model calls this many tools that do not exist",
+	"agent.list_tools_on_unknown":  "Tell the model the valid tool names the first time it calls an unknown one",
+	"agent.sequential_tools":       "Run every tool call one by one; turns that change files always do",
+	"agent.read_max_bytes":         "Most bytes read_file returns at once (0 uses 100 KiB)",
+	"agent.tool_timeout_seconds":   "Seconds a tool that only reads may take before it fails (0 uses 30)",
+
+	"security": "Allowed files and directories for file operations. The agent can ONLY\n" +
+		"read/write files within them. Paths are relative to the Hyprland config\n" +
+		"root (~/.config/hypr)",
+	"security.native":                  "Native Hyprland installation",
+	"security.hyde":                    "HyDE installation",
+	"security.omarchy":                 "Omarchy installation",
+	"read_only_files":                  "Readable but never written, even inside an allowed directory",
+	"security.companions":              "Companion apps (waybar, rofi, mako, ...) whose configs live outside\n~/.config/hypr. Disabled by default",
+	"security.companions.allowed_dirs": "Relative to ~/.config or absolute, e.g. [\"waybar\", \"rofi\"]",
+
+	"safety":                       "A snapshot is taken before every change. The most recent one is always kept",
+	"safety.max_snapshots":         "Delete the oldest snapshots beyond this many (0 keeps all)",
+	"safety.max_snapshot_age_days": "Delete snapshots older than this many days (0 disables)",
+}
+
+// UserConfigPath returns the per-user config file, under ConfigHome
+func UserConfigPath() (string, error) {
+	configHome, err := ConfigHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configHome, "hypragent", "config.toml"), nil
+}
+
+// WriteDefaultConfig writes DefaultConfigTOML to path, refusing to replace
+// an existing file unless force is set
+func WriteDefaultConfig(path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", path)
+	}
+	data, err := DefaultConfigTOML()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	// The file may hold API keys once edited
+	return WriteFileAtomic(path, data, 0600)
+}
+
+// DefaultConfigTOML renders DefaultConfig as a commented config.toml. Settings
+// with a default are written out; the rest are commented out, so the file
+// decodes back to DefaultConfig.
+func DefaultConfigTOML() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("# HyprAgent Configuration File\n# Generated by hyprAgent -init with the default settings\n")
+	if err := writeTable(&b, reflect.ValueOf(*DefaultConfig()), ""); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeTable writes the keys of a config struct, then each of its tables
+func writeTable(b *bytes.Buffer, v reflect.Value, prefix string) error {
+	var tables []int
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			tables = append(tables, i)
+			continue
+		}
+
+		value, err := encodeValue(v.Field(i).Interface())
+		if err != nil {
+			return fmt.Errorf("failed to encode %s%s: %w", prefix, name, err)
+		}
+		// A documented key starts a new group of settings
+		if doc := docFor(prefix+name, name); doc != "" && i > 0 {
+			b.WriteString("\n")
+		}
+		writeDoc(b, prefix+name, name)
+		if v.Field(i).IsZero() {
+			fmt.Fprintf(b, "# %s = %s\n", name, value)
+		} else {
+			fmt.Fprintf(b, "%s = %s\n", name, value)
+		}
+	}
+
+	for _, i := range tables {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("toml"), ",")
+		b.WriteString("\n")
+		writeDoc(b, prefix+name, name)
+		fmt.Fprintf(b, "[%s%s]\n", prefix, name)
+		if err := writeTable(b, v.Field(i), prefix+name+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDoc writes the comment for key, if it has one
+func writeDoc(b *bytes.Buffer, key, name string) {
+	doc := docFor(key, name)
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(b, "# %s\n", line)
+	}
+}
+
+// docFor returns the comment for key, falling back to the doc shared by
+// every key with that name (such as read_only_files)
+func docFor(key, name string) string {
+	if doc, ok := configDocs[key]; ok {
+		return doc
+	}
+	return configDocs[name]
+}
+
+// encodeValue formats a single value as TOML. String lists are written one
+// item per line.
+func encodeValue(value any) (string, error) {
+	if list, ok := value.([]string); ok {
+		if len(list) == 0 {
+			return "[]", nil
+		}
+		var b strings.Builder
+		b.WriteString("[\n")
+		for _, item := range list {
+			encoded, err := encodeValue(item)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "    %s,\n", encoded)
+		}
+		b.WriteString("]")
+		return b.String(), nil
+	}
+
+	data, err := toml.Marshal(map[string]any{"v": value})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(data), "v = ")), nil
+}
@@ -1,12 +1,15 @@
 package configuration
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 type HyDEBackend struct {
 	NativeBackend
+	// Security lists the files that make up the config besides hyprland.conf
+	Security BackendSecurity
 }
 
 func (b *HyDEBackend) Type() ConfigSourceType {
@@ -15,11 +18,11 @@ func (b *HyDEBackend) Type() ConfigSourceType {
 
 func (b *HyDEBackend) Detect(rootPath string) (bool, error) {
 	if rootPath == "" {
-		home, err := os.UserHomeDir()
+		root, err := HyprConfigRoot()
 		if err != nil {
 			return false, err
 		}
-		rootPath = filepath.Join(home, ".config", "hypr")
+		rootPath = root
 	}
 
 	// HyDE Detection:
@@ -54,4 +57,13 @@ func (b *HyDEBackend) Detect(rootPath string) (bool, error) {
 	return false, nil
 }
 
-// Reuse NativeBackend's ListSources, Parse, GeneratePatch, ApplyPatch
+// ListSources returns hyprland.conf followed by the allowed config files that
+// exist, such as keybindings.conf, userprefs.conf and the files in Configs/
+func (b *HyDEBackend) ListSources() ([]string, error) {
+	if b.ConfigPath == "" {
+		return nil, fmt.Errorf("config path not detected")
+	}
+	return allowedSources(b.ConfigPath, b.Security), nil
+}
+
+// Reuse NativeBackend's Parse, GeneratePatch, ApplyPatch
@@ -0,0 +1,228 @@
+package configuration
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	HypridleFile = "hypridle.conf"
+	HyprlockFile = "hyprlock.conf"
+)
+
+// Block is a top-level `name { ... }` section such as a hypridle listener
+type Block struct {
+	Name     string            `json:"name"`
+	Index    int               `json:"index"` // Occurrence among blocks with the same name
+	Line     int               `json:"line"`  // 1-based line of the opening brace
+	Settings map[string]string `json:"settings"`
+
+	start, end int // Indices of the opening and closing lines in the IR
+}
+
+// Blocks returns every top-level block in the IR in file order
+func Blocks(ir *IR) []Block {
+	var blocks []Block
+	counts := make(map[string]int)
+	paths := SectionPaths(ir)
+
+	for i, line := range ir.Lines {
+		if line.Type != LineTypeSectionStart || paths[i] != "" {
+			continue
+		}
+		end := matchingBrace(ir, i)
+		if end < 0 {
+			end = len(ir.Lines) - 1
+		}
+
+		b := Block{
+			Name:     line.Key,
+			Index:    counts[line.Key],
+			Line:     line.LineNum,
+			Settings: make(map[string]string),
+			start:    i,
+			end:      end,
+		}
+		counts[line.Key]++
+
+		for j := i + 1; j < end; j++ {
+			if isSetting(ir.Lines[j]) && paths[j] == line.Key {
+				b.Settings[ir.Lines[j].Key] = ir.Lines[j].Value
+			}
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// FindBlock returns the index-th top-level block with the given name
+func FindBlock(ir *IR, name string, index int) (*Block, bool) {
+	for _, b := range Blocks(ir) {
+		if b.Name == name && b.Index == index {
+			return &b, true
+		}
+	}
+	return nil, false
+}
+
+// BlockText renders the raw lines of a block for review
+func BlockText(ir *IR, b *Block) string {
+	var sb strings.Builder
+	for i := b.start; i <= b.end && i < len(ir.Lines); i++ {
+		sb.WriteString(ir.Lines[i].Raw)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// SetBlockValue updates key inside the block, or inserts it before the
+// block's closing brace if it is not set yet
+func SetBlockValue(ir *IR, b *Block, key, value string) {
+	for i := b.start + 1; i < b.end; i++ {
+		line := ir.Lines[i]
+		if isSetting(line) && line.Key == key {
+			ir.Lines[i].Value = value
+			ir.Lines[i].Raw = leadingWhitespace(line.Raw) + key + " = " + value
+			b.Settings[key] = value
+			return
+		}
+	}
+
+	insertLines(ir, b.end, ConfigLine{
+		Raw:   "    " + key + " = " + value,
+		Type:  LineTypeKeyValue,
+		Key:   key,
+		Value: value,
+	})
+	b.end++
+	b.Settings[key] = value
+	renumber(ir)
+}
+
+// BlockSetting is a key/value pair written into a new block
+type BlockSetting struct {
+	Key   string
+	Value string
+}
+
+// AppendBlock adds a new top-level block with the given settings (in order)
+// and returns it
+func AppendBlock(ir *IR, name string, settings ...BlockSetting) *Block {
+	var lines []ConfigLine
+	if n := len(ir.Lines); n > 0 && ir.Lines[n-1].Type != LineTypeEmpty {
+		lines = append(lines, ConfigLine{Type: LineTypeEmpty})
+	}
+	lines = append(lines, ConfigLine{Raw: name + " {", Type: LineTypeSectionStart, Key: name})
+	for _, kv := range settings {
+		lines = append(lines, ConfigLine{Raw: "    " + kv.Key + " = " + kv.Value, Type: LineTypeKeyValue, Key: kv.Key, Value: kv.Value})
+	}
+	lines = append(lines, ConfigLine{Raw: "}", Type: LineTypeSectionEnd})
+
+	insertLines(ir, len(ir.Lines), lines...)
+	renumber(ir)
+
+	blocks := Blocks(ir)
+	b := blocks[len(blocks)-1]
+	return &b
+}
+
+// FindListener returns the hypridle listener with the given timeout
+func FindListener(ir *IR, timeout int) (*Block, bool) {
+	for _, b := range Blocks(ir) {
+		if b.Name != "listener" {
+			continue
+		}
+		if t, err := strconv.Atoi(strings.TrimSpace(b.Settings["timeout"])); err == nil && t == timeout {
+			return &b, true
+		}
+	}
+	return nil, false
+}
+
+// ValidateListener checks the settings of a hypridle listener
+func ValidateListener(timeout int, onTimeout, onResume string) error {
+	if timeout <= 0 {
+		return fmt.Errorf("timeout must be a positive number of seconds, got %d", timeout)
+	}
+	if strings.TrimSpace(onTimeout) == "" && strings.TrimSpace(onResume) == "" {
+		return fmt.Errorf("a listener needs at least an on-timeout or on-resume command")
+	}
+	return nil
+}
+
+// hyprlockOptions lists the commonly edited hyprlock options per block
+var hyprlockOptions = map[string]map[string]ValueKind{
+	"general": {
+		"hide_cursor":         ValueBool,
+		"grace":               ValueInt,
+		"disable_loading_bar": ValueBool,
+		"ignore_empty_input":  ValueBool,
+		"immediate_render":    ValueBool,
+		"no_fade_in":          ValueBool,
+		"no_fade_out":         ValueBool,
+	},
+	"background": {
+		"monitor":           ValueString,
+		"path":              ValueString,
+		"color":             ValueColor,
+		"blur_passes":       ValueInt,
+		"blur_size":         ValueInt,
+		"noise":             ValueFloat,
+		"contrast":          ValueFloat,
+		"brightness":        ValueFloat,
+		"vibrancy":          ValueFloat,
+		"vibrancy_darkness": ValueFloat,
+	},
+	"input-field": {
+		"monitor":           ValueString,
+		"size":              ValueVec2,
+		"position":          ValueVec2,
+		"outline_thickness": ValueInt,
+		"dots_size":         ValueFloat,
+		"dots_spacing":      ValueFloat,
+		"dots_center":       ValueBool,
+		"outer_color":       ValueColor,
+		"inner_color":       ValueColor,
+		"font_color":        ValueColor,
+		"check_color":       ValueColor,
+		"fail_color":        ValueColor,
+		"fade_on_empty":     ValueBool,
+		"placeholder_text":  ValueString,
+		"fail_text":         ValueString,
+		"hide_input":        ValueBool,
+		"rounding":          ValueInt,
+		"halign":            ValueString,
+		"valign":            ValueString,
+	},
+}
+
+// ValidateHyprlockOption checks that key is a known option of the hyprlock
+// block and that value has the right type
+func ValidateHyprlockOption(block, key, value string) error {
+	options, ok := hyprlockOptions[block]
+	if !ok {
+		return fmt.Errorf("unsupported hyprlock block %q (supported: general, background, input-field)", block)
+	}
+	kind, ok := options[key]
+	if !ok {
+		known := make([]string, 0, len(options))
+		for k := range options {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown %s option %q (known: %s)", block, key, strings.Join(known, ", "))
+	}
+	if key == "halign" || key == "valign" {
+		allowed := map[string]bool{"left": key == "halign", "right": key == "halign", "top": key == "valign", "bottom": key == "valign", "center": true, "none": true}
+		if !allowed[strings.TrimSpace(value)] {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		return nil
+	}
+	if err := ValidateValue(kind, value); err != nil {
+		return fmt.Errorf("%s:%s: %w", block, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Layout kinds reported by DescribeLayout
+const (
+	LayoutMonolithic = "monolithic" // Everything lives in the main config
+	LayoutFragmented = "fragmented" // The main config pulls settings in via source=
+)
+
+// IncludedFile is a file pulled in by a source= directive
+type IncludedFile struct {
+	Path     string `json:"path"`
+	Settings int    `json:"settings"` // Number of key = value lines in the file
+}
+
+// EditTarget is the file where settings of one category should be edited
+type EditTarget struct {
+	Category string `json:"category"`
+	File     string `json:"file"`
+	Settings int    `json:"settings"` // Existing settings of this category in File
+	Reason   string `json:"reason"`
+}
+
+// ConfigLayout describes how a config is split across files
+type ConfigLayout struct {
+	Layout      string         `json:"layout"`
+	MainConfig  string         `json:"main_config"`
+	SourceCount int            `json:"source_count"` // Number of source= directives
+	Includes    []IncludedFile `json:"includes,omitempty"`
+	EditTargets []EditTarget   `json:"edit_targets"`
+}
+
+// layoutCategory groups settings that users tend to keep in the same file.
+// nameHints are substrings of file names conventionally used for it.
+type layoutCategory struct {
+	name      string
+	nameHints []string
+	match     func(sl SourcedLine) bool
+}
+
+func topLevelKey(keys ...string) func(sl SourcedLine) bool {
+	return func(sl SourcedLine) bool {
+		if sl.Section != "" {
+			return false
+		}
+		for _, k := range keys {
+			if sl.Line.Key == k || strings.HasPrefix(sl.Line.Key, k) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func inSection(sections ...string) func(sl SourcedLine) bool {
+	return func(sl SourcedLine) bool {
+		root := strings.SplitN(sl.Section, ":", 2)[0]
+		for _, s := range sections {
+			if root == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var layoutCategories = []layoutCategory{
+	{"keybinds", []string{"keybind", "bind", "keys"}, topLevelKey("bind", "unbind")},
+	{"window_rules", []string{"windowrule", "rules"}, topLevelKey("windowrule", "layerrule")},
+	{"monitors", []string{"monitor"}, topLevelKey("monitor")},
+	{"workspaces", []string{"workspace"}, topLevelKey("workspace")},
+	{"autostart", []string{"autostart", "exec", "startup"}, topLevelKey("exec")},
+	{"environment", []string{"env"}, topLevelKey("env")},
+	{"animations", []string{"animation"}, inSection("animations")},
+	{"appearance", []string{"decoration", "theme", "look", "appearance"}, inSection("general", "decoration", "group")},
+	{"input", []string{"input"}, inSection("input", "device", "gestures")},
+}
+
+// DescribeLayout reports whether the config is monolithic or fragmented and
+// which file each category of settings should be edited in. lines must come
+// from ExpandSources(mainConfig).
+func DescribeLayout(mainConfig string, lines []SourcedLine) ConfigLayout {
+	mainAbs, err := filepath.Abs(mainConfig)
+	if err != nil {
+		mainAbs = mainConfig
+	}
+
+	layout := ConfigLayout{Layout: LayoutMonolithic, MainConfig: mainAbs}
+	perFile := make(map[string]int)
+	vars := make(map[string]string)
+	var files []string
+	addFile := func(f string) {
+		if _, ok := perFile[f]; !ok {
+			perFile[f] = 0
+			files = append(files, f)
+		}
+	}
+	for _, sl := range lines {
+		addFile(sl.File)
+		if sl.Line.Type == LineTypeVariable && sl.Line.Key != "" {
+			vars[sl.Line.Key] = sl.Line.Value
+		}
+		if sl.Section == "" && sl.Line.Key == "source" {
+			layout.SourceCount++
+			// Empty includes contribute no lines but are still edit targets
+			if target, err := resolveSourcePath(sl.Line.Value, vars, filepath.Dir(sl.File)); err == nil {
+				if _, err := os.Stat(target); err == nil {
+					addFile(target)
+				}
+			}
+		}
+		if isSetting(sl.Line) {
+			perFile[sl.File]++
+		}
+	}
+	for _, f := range files {
+		if f != mainAbs {
+			layout.Includes = append(layout.Includes, IncludedFile{Path: f, Settings: perFile[f]})
+		}
+	}
+	if len(layout.Includes) > 0 {
+		layout.Layout = LayoutFragmented
+	}
+
+	for _, cat := range layoutCategories {
+		layout.EditTargets = append(layout.EditTargets, editTarget(cat, mainAbs, files, lines))
+	}
+	return layout
+}
+
+// editTarget picks the file that already holds most settings of the category,
+// then a sourced file named after it, and finally the main config
+func editTarget(cat layoutCategory, mainConfig string, files []string, lines []SourcedLine) EditTarget {
+	counts := make(map[string]int)
+	for _, sl := range lines {
+		if isSetting(sl.Line) && cat.match(sl) {
+			counts[sl.File]++
+		}
+	}
+
+	best := ""
+	for _, f := range files {
+		if counts[f] > counts[best] {
+			best = f
+		}
+	}
+	if best != "" {
+		reason := "holds most existing " + cat.name + " settings"
+		if len(counts) > 1 {
+			reason += "; other files also define some, and later definitions win"
+		}
+		return EditTarget{Category: cat.name, File: best, Settings: counts[best], Reason: reason}
+	}
+
+	for _, f := range files {
+		base := strings.ToLower(filepath.Base(f))
+		for _, hint := range cat.nameHints {
+			if f != mainConfig && strings.Contains(base, hint) {
+				return EditTarget{Category: cat.name, File: f, Reason: "no existing settings; file name suggests it is meant for " + cat.name}
+			}
+		}
+	}
+	return EditTarget{Category: cat.name, File: mainConfig, Reason: "no existing settings; add them to the main config"}
+}
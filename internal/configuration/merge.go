@@ -0,0 +1,346 @@
+package configuration
+
+import (
+	"strings"
+)
+
+// MergeChangeKind describes how a setting from the source relates to the target
+type MergeChangeKind string
+
+const (
+	MergeAdd      MergeChangeKind = "add"      // Setting does not exist in the target
+	MergeConflict MergeChangeKind = "conflict" // Setting exists in the target with a different value
+)
+
+// MergeChange is a single setting the merge would add or override
+type MergeChange struct {
+	Kind       MergeChangeKind `json:"kind"`
+	Section    string          `json:"section,omitempty"` // Colon-separated section path, e.g. "decoration:blur"
+	Key        string          `json:"key"`
+	Value      string          `json:"value"`
+	Current    string          `json:"current,omitempty"` // Existing target value (conflicts only)
+	SourceLine int             `json:"source_line"`
+
+	targetIdx int // Index of the conflicting line in the target IR
+}
+
+// Name returns the fully-qualified Hyprland option name (e.g. "general:gaps_in")
+func (c MergeChange) Name() string {
+	return QualifiedName(c.Section, c.Key)
+}
+
+// MergePlan lists the changes required to merge a source config into a target
+type MergePlan struct {
+	Additions []MergeChange `json:"additions"`
+	Conflicts []MergeChange `json:"conflicts"`
+	Unchanged int           `json:"unchanged"` // Settings already identical in the target
+}
+
+// repeatableKeys may legitimately appear many times in the same scope. They
+// are identified by their whole value (or leading field) rather than by key.
+var repeatableKeys = map[string]bool{
+	"source": true, "exec": true, "exec-once": true, "exec-shutdown": true,
+	"execr": true, "execr-once": true, "env": true,
+	"windowrule": true, "windowrulev2": true, "layerrule": true, "workspace": true,
+	"monitor": true, "animation": true, "bezier": true, "plugin": true,
+	"gesture": true, "permission": true,
+}
+
+// fieldKeyedKeys are repeatable keys where the first comma field names the
+// entry, so a different value for the same name is a conflict.
+var fieldKeyedKeys = map[string]bool{
+	"monitor": true, "animation": true, "bezier": true, "env": true,
+}
+
+// QualifiedName joins a section path and key the way hyprctl expects
+func QualifiedName(section, key string) string {
+	if section == "" {
+		return key
+	}
+	return section + ":" + key
+}
+
+// IsRepeatableKey reports whether key may appear multiple times in one scope
+func IsRepeatableKey(key string) bool {
+	return repeatableKeys[key] || isBindKey(key)
+}
+
+func isBindKey(key string) bool {
+	return strings.HasPrefix(key, "bind") || key == "unbind"
+}
+
+// SectionPaths returns, for every line of the IR, the colon-separated path of
+// the section that contains it. Section start lines report their parent.
+func SectionPaths(ir *IR) []string {
+	paths := make([]string, len(ir.Lines))
+	var stack []string
+	for i, line := range ir.Lines {
+		if line.Type == LineTypeSectionEnd && len(stack) > 0 {
+			stack = stack[:len(stack)-1]
+		}
+		paths[i] = strings.Join(stack, ":")
+		if line.Type == LineTypeSectionStart {
+			stack = append(stack, line.Key)
+		}
+	}
+	return paths
+}
+
+// setSections fills in the Section and Depth of every line
+func setSections(ir *IR) {
+	for i, path := range SectionPaths(ir) {
+		ir.Lines[i].Section = path
+		ir.Lines[i].Depth = 0
+		if path != "" {
+			ir.Lines[i].Depth = strings.Count(path, ":") + 1
+		}
+	}
+}
+
+// settingIdentity returns the key used to match a setting between configs
+func settingIdentity(section string, line ConfigLine) string {
+	id := QualifiedName(section, line.Key)
+	if fieldKeyedKeys[line.Key] {
+		first := strings.TrimSpace(strings.SplitN(line.Value, ",", 2)[0])
+		return id + "=" + first
+	}
+	if IsRepeatableKey(line.Key) {
+		return id + "=" + normalizeValue(line.Value)
+	}
+	return id
+}
+
+// normalizeValue ignores whitespace and trailing comments, so values that
+// only differ in those are not conflicts
+func normalizeValue(v string) string {
+	v, _ = splitComment(v)
+	return strings.Join(strings.Fields(v), " ")
+}
+
+func isSetting(line ConfigLine) bool {
+	return (line.Type == LineTypeKeyValue || line.Type == LineTypeVariable) && line.Key != ""
+}
+
+// PlanMerge computes which settings from source are missing from or differ in target
+func PlanMerge(target, source *IR) *MergePlan {
+	plan := &MergePlan{}
+
+	targetPaths := SectionPaths(target)
+	existing := make(map[string]int)
+	for i, line := range target.Lines {
+		if isSetting(line) {
+			existing[settingIdentity(targetPaths[i], line)] = i
+		}
+	}
+
+	seen := make(map[string]bool)
+	sourcePaths := SectionPaths(source)
+	for i, line := range source.Lines {
+		if !isSetting(line) {
+			continue
+		}
+		section := sourcePaths[i]
+		id := settingIdentity(section, line)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		change := MergeChange{
+			Section:    section,
+			Key:        line.Key,
+			Value:      line.Value,
+			SourceLine: line.LineNum,
+		}
+
+		idx, ok := existing[id]
+		if !ok {
+			change.Kind = MergeAdd
+			plan.Additions = append(plan.Additions, change)
+			continue
+		}
+
+		current := target.Lines[idx].Value
+		if normalizeValue(current) == normalizeValue(line.Value) {
+			plan.Unchanged++
+			continue
+		}
+		change.Kind = MergeConflict
+		change.Current = current
+		change.targetIdx = idx
+		plan.Conflicts = append(plan.Conflicts, change)
+	}
+
+	return plan
+}
+
+// ApplyMerge returns a copy of target with all additions applied and the
+// conflicts named in acceptConflicts overridden with the source value.
+func ApplyMerge(target *IR, plan *MergePlan, acceptConflicts []string) *IR {
+	result := &IR{Lines: append([]ConfigLine(nil), target.Lines...), LineEnding: target.LineEnding, NoFinalNewline: target.NoFinalNewline}
+
+	accepted := make(map[string]bool)
+	for _, name := range acceptConflicts {
+		accepted[name] = true
+	}
+
+	// Overrides first, while target indices are still valid
+	for _, c := range plan.Conflicts {
+		if !accepted[c.Name()] {
+			continue
+		}
+		line := &result.Lines[c.targetIdx]
+		line.Value = keepComment(c.Value, line.Value)
+		line.Raw = leadingWhitespace(line.Raw) + line.Key + " = " + line.Value
+	}
+
+	for _, c := range plan.Additions {
+		SetValue(result, c.Section, c.Key, c.Value, true)
+	}
+
+	renumber(result)
+	return result
+}
+
+// SetValue sets key inside the given section path, creating the section if
+// needed. When add is true the setting is always appended (for repeatable keys);
+// otherwise an existing setting with the same key is updated in place.
+func SetValue(ir *IR, section, key, value string, add bool) {
+	paths := SectionPaths(ir)
+	if !add {
+		for i, line := range ir.Lines {
+			if isSetting(line) && paths[i] == section && line.Key == key {
+				ir.Lines[i].Value = keepComment(value, line.Value)
+				ir.Lines[i].Raw = leadingWhitespace(line.Raw) + key + " = " + ir.Lines[i].Value
+				return
+			}
+		}
+	}
+
+	var segments []string
+	if section != "" {
+		segments = strings.Split(section, ":")
+	}
+	depth := len(segments)
+	insertAt := ensureSection(ir, segments)
+	if section == "" && strings.HasPrefix(key, "$") {
+		// Variables must be defined before they are referenced
+		insertAt = 0
+		for i, line := range ir.Lines {
+			if line.Type == LineTypeVariable && paths[i] == "" {
+				insertAt = i + 1
+			}
+		}
+	}
+	newLine := ConfigLine{
+		Raw:   strings.Repeat("    ", depth) + key + " = " + value,
+		Type:  LineTypeKeyValue,
+		Key:   key,
+		Value: value,
+	}
+	if strings.HasPrefix(key, "$") {
+		newLine.Type = LineTypeVariable
+	} else {
+		newLine.Bind = ParseBind(key, value)
+		newLine.Monitor = ParseMonitor(key, value)
+		newLine.Workspace = ParseWorkspace(key, value)
+	}
+	insertLines(ir, insertAt, newLine)
+	renumber(ir)
+}
+
+// ensureSection makes sure the nested section exists and returns the index at
+// which a new setting for it should be inserted (just before its closing brace,
+// or the end of the file for top-level settings).
+func ensureSection(ir *IR, segments []string) int {
+	if len(segments) == 0 {
+		return len(ir.Lines)
+	}
+
+	start, end := 0, len(ir.Lines)
+	depth := 0
+	for _, name := range segments {
+		open, close := findSection(ir, start, end, name)
+		if open < 0 {
+			indent := strings.Repeat("    ", depth)
+			block := []ConfigLine{{Raw: indent + name + " {", Type: LineTypeSectionStart, Key: name}}
+			closing := ConfigLine{Raw: indent + "}", Type: LineTypeSectionEnd}
+			insertAt := end
+			if depth == 0 && insertAt > 0 && ir.Lines[insertAt-1].Type != LineTypeEmpty {
+				block = append([]ConfigLine{{Type: LineTypeEmpty}}, block...)
+			}
+			insertLines(ir, insertAt, append(block, closing)...)
+			open = insertAt + len(block) - 1
+			close = open + 1
+		}
+		start, end = open+1, close
+		depth++
+	}
+	return end
+}
+
+// findSection locates a direct child section named name between [start, end)
+// and returns the indices of its opening and closing lines, or -1 if absent.
+func findSection(ir *IR, start, end int, name string) (int, int) {
+	depth := 0
+	for i := start; i < end; i++ {
+		line := ir.Lines[i]
+		switch line.Type {
+		case LineTypeSectionStart:
+			if depth == 0 && line.Key == name {
+				if close := matchingBrace(ir, i); close >= 0 {
+					return i, close
+				}
+			}
+			depth++
+		case LineTypeSectionEnd:
+			depth--
+		}
+	}
+	return -1, -1
+}
+
+// matchingBrace returns the index of the section end matching the start at idx
+func matchingBrace(ir *IR, idx int) int {
+	depth := 0
+	for i := idx; i < len(ir.Lines); i++ {
+		switch ir.Lines[i].Type {
+		case LineTypeSectionStart:
+			depth++
+		case LineTypeSectionEnd:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func insertLines(ir *IR, at int, lines ...ConfigLine) {
+	ir.Lines = append(ir.Lines[:at], append(lines, ir.Lines[at:]...)...)
+}
+
+func renumber(ir *IR) {
+	for i := range ir.Lines {
+		ir.Lines[i].LineNum = i + 1
+	}
+	setSections(ir)
+}
+
+// keepComment returns value with the trailing comment of the value it
+// replaces, unless it has a comment of its own, so rewriting a setting keeps
+// the note written next to it
+func keepComment(value, old string) string {
+	if _, comment := splitComment(value); comment != "" {
+		return value
+	}
+	if _, comment := splitComment(old); comment != "" {
+		return value + " " + comment
+	}
+	return value
+}
+
+func leadingWhitespace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
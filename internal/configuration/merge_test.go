@@ -0,0 +1,52 @@
+package configuration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyMergeKeepsTrailingComment(t *testing.T) {
+	target, err := ParseString("general {\n    gaps_in = 5 # inner gaps\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := ParseString("general {\n    gaps_in = 10\n    gaps_out = 20\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := PlanMerge(target, source)
+	if len(plan.Conflicts) != 1 || len(plan.Additions) != 1 {
+		t.Fatalf("plan has %d conflict(s) and %d addition(s), want 1 and 1", len(plan.Conflicts), len(plan.Additions))
+	}
+	merged := ApplyMerge(target, plan, []string{"general:gaps_in"}).String()
+	if !strings.Contains(merged, "    gaps_in = 10 # inner gaps\n") {
+		t.Errorf("override lost the comment or indent:\n%s", merged)
+	}
+	if !strings.Contains(merged, "gaps_out = 20") {
+		t.Errorf("addition missing:\n%s", merged)
+	}
+}
+
+func TestPlanMergeIgnoresCommentOnlyDifferences(t *testing.T) {
+	target, _ := ParseString("general:gaps_in = 5 # inner gaps\n")
+	source, _ := ParseString("general:gaps_in = 5\n")
+	if plan := PlanMerge(target, source); len(plan.Conflicts) != 0 || plan.Unchanged != 1 {
+		t.Errorf("got %d conflict(s), %d unchanged; want the setting unchanged", len(plan.Conflicts), plan.Unchanged)
+	}
+}
+
+func TestSplitComment(t *testing.T) {
+	for _, tt := range []struct{ in, value, comment string }{
+		{"5", "5", ""},
+		{"5 # inner gaps", "5", "# inner gaps"},
+		{"DP-1, preferred, auto, 1 # main", "DP-1, preferred, auto, 1", "# main"},
+		{"notify-send ##1", "notify-send ##1", ""},
+		{"notify-send ##1 # note", "notify-send ##1", "# note"},
+	} {
+		value, comment := splitComment(tt.in)
+		if value != tt.value || comment != tt.comment {
+			t.Errorf("splitComment(%q) = %q, %q; want %q, %q", tt.in, value, comment, tt.value, tt.comment)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package configuration
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Monitor is a display rule parsed from a monitor line, e.g.
+// "monitor = DP-1, 2560x1440@144, 0x0, 1" or "monitor = , preferred, auto, 1"
+type Monitor struct {
+	Name     string `json:"name"`               // Output name or desc:..., empty for the fallback rule
+	Disabled bool   `json:"disabled,omitempty"` // "monitor = DP-1, disable"
+
+	// Resolution is as written: WxH[@Hz] or a mode such as "preferred",
+	// "highres" or "highrr". Width, Height and RefreshRate are only set for
+	// the WxH form, and RefreshRate only when it is given.
+	Resolution  string  `json:"resolution,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	RefreshRate float64 `json:"refresh_rate,omitempty"`
+
+	// Position is as written: XxY or "auto", "auto-right", ... Offset holds
+	// the coordinates of the XxY form and is nil otherwise.
+	Position string `json:"position,omitempty"`
+	Offset   *Point `json:"offset,omitempty"`
+
+	// Scale is as written: a number or "auto". ScaleFactor is zero for "auto".
+	Scale       string  `json:"scale,omitempty"`
+	ScaleFactor float64 `json:"scale_factor,omitempty"`
+
+	// Options holds the trailing key, value pairs, e.g. transform, 1 or
+	// mirror, DP-2
+	Options map[string]string `json:"options,omitempty"`
+
+	// Reserved is the area kept free at the top, bottom, left and right edges
+	// by "monitor = DP-1, addreserved, 10, 0, 0, 0"
+	Reserved []int `json:"reserved,omitempty"`
+}
+
+// Point is a position in the layout, in pixels
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Workspace is a workspace rule parsed from a workspace line, e.g.
+// "workspace = 1, monitor:DP-1, default:true"
+type Workspace struct {
+	// Selector is as written: an ID, name:..., special:... or a selector
+	// such as r[1-5] or w[tv1]
+	Selector string `json:"selector"`
+	// Rules maps each rule to its value, e.g. monitor to DP-1. Rules
+	// without a value map to "".
+	Rules map[string]string `json:"rules,omitempty"`
+	// Monitor and Default repeat the monitor: and default: rules
+	Monitor string `json:"monitor,omitempty"`
+	Default bool   `json:"default,omitempty"`
+}
+
+// ParseMonitor parses the value of a monitor line, ignoring a trailing
+// comment. It returns nil for other keys.
+func ParseMonitor(key, value string) *Monitor {
+	if key != "monitor" {
+		return nil
+	}
+	value, _ = splitComment(value)
+	parts := splitFields(value, -1)
+	m := &Monitor{Name: parts[0]}
+	if len(parts) < 2 {
+		return m
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "disable", "disabled":
+		m.Disabled = true
+		return m
+	case "addreserved":
+		for _, p := range parts[2:] {
+			n, _ := strconv.Atoi(p)
+			m.Reserved = append(m.Reserved, n)
+		}
+		return m
+	}
+
+	m.Resolution = parts[1]
+	size, rate, _ := strings.Cut(parts[1], "@")
+	if w, h, ok := parseSize(size); ok {
+		m.Width, m.Height = w, h
+		m.RefreshRate, _ = strconv.ParseFloat(rate, 64)
+	}
+
+	if len(parts) > 2 {
+		m.Position = parts[2]
+		if x, y, ok := parseSize(parts[2]); ok {
+			m.Offset = &Point{X: x, Y: y}
+		}
+	}
+	if len(parts) > 3 {
+		m.Scale = parts[3]
+		m.ScaleFactor, _ = strconv.ParseFloat(parts[3], 64)
+	}
+	for i := 4; i < len(parts); i += 2 {
+		if m.Options == nil {
+			m.Options = make(map[string]string)
+		}
+		if i+1 < len(parts) {
+			m.Options[parts[i]] = parts[i+1]
+		} else {
+			m.Options[parts[i]] = ""
+		}
+	}
+	return m
+}
+
+// parseSize parses "AxB" as two integers, as used for sizes and positions
+func parseSize(s string) (int, int, bool) {
+	a, b, ok := strings.Cut(s, "x")
+	if !ok {
+		return 0, 0, false
+	}
+	x, errX := strconv.Atoi(strings.TrimSpace(a))
+	y, errY := strconv.Atoi(strings.TrimSpace(b))
+	return x, y, errX == nil && errY == nil
+}
+
+// ParseWorkspace parses the value of a workspace line, ignoring a trailing
+// comment. It returns nil for other keys.
+func ParseWorkspace(key, value string) *Workspace {
+	if key != "workspace" {
+		return nil
+	}
+	value, _ = splitComment(value)
+	parts := splitFields(value, -1)
+	w := &Workspace{Selector: parts[0]}
+	for _, rule := range parts[1:] {
+		if rule == "" {
+			continue
+		}
+		if w.Rules == nil {
+			w.Rules = make(map[string]string)
+		}
+		name, arg, _ := strings.Cut(rule, ":")
+		name, arg = strings.TrimSpace(name), strings.TrimSpace(arg)
+		w.Rules[name] = arg
+		switch name {
+		case "monitor":
+			w.Monitor = arg
+		case "default":
+			w.Default = isTruthy(arg)
+		}
+	}
+	return w
+}
@@ -0,0 +1,79 @@
+package configuration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMonitorMultiMonitor(t *testing.T) {
+	ir, err := ParseString(`monitor = DP-1, 2560x1440@144, 0x0, 1 # main
+monitor = HDMI-A-1, 1920x1080@60.00, 2560x0, 1.25, transform, 1
+monitor = eDP-1, disable
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*Monitor
+	for _, line := range ir.Lines {
+		if line.Monitor != nil {
+			got = append(got, line.Monitor)
+		}
+	}
+	want := []*Monitor{
+		{Name: "DP-1", Resolution: "2560x1440@144", Width: 2560, Height: 1440, RefreshRate: 144, Position: "0x0", Offset: &Point{}, Scale: "1", ScaleFactor: 1},
+		{Name: "HDMI-A-1", Resolution: "1920x1080@60.00", Width: 1920, Height: 1080, RefreshRate: 60, Position: "2560x0", Offset: &Point{X: 2560}, Scale: "1.25", ScaleFactor: 1.25, Options: map[string]string{"transform": "1"}},
+		{Name: "eDP-1", Disabled: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		for i := range max(len(got), len(want)) {
+			if i >= len(got) || i >= len(want) || !reflect.DeepEqual(got[i], want[i]) {
+				t.Errorf("monitor %d: got %+v, want %+v", i, at(got, i), at(want, i))
+			}
+		}
+	}
+}
+
+// at returns s[i], or nil past the end
+func at(s []*Monitor, i int) *Monitor {
+	if i < len(s) {
+		return s[i]
+	}
+	return nil
+}
+
+func TestParseMonitorPreferredAuto(t *testing.T) {
+	got := ParseMonitor("monitor", ", preferred, auto, auto # fallback for anything else")
+	want := &Monitor{Resolution: "preferred", Position: "auto", Scale: "auto"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got = ParseMonitor("monitor", "DP-1, highrr, auto-right, 2")
+	want = &Monitor{Name: "DP-1", Resolution: "highrr", Position: "auto-right", Scale: "2", ScaleFactor: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMonitorReserved(t *testing.T) {
+	got := ParseMonitor("monitor", "DP-1, addreserved, 10, 0, 0, 0")
+	if !reflect.DeepEqual(got.Reserved, []int{10, 0, 0, 0}) {
+		t.Errorf("reserved = %v", got.Reserved)
+	}
+	if ParseMonitor("bind", "SUPER, Q, killactive") != nil {
+		t.Error("non-monitor key parsed as a monitor")
+	}
+}
+
+func TestParseWorkspace(t *testing.T) {
+	got := ParseWorkspace("workspace", "1, monitor:DP-1, default:true # main screen")
+	want := &Workspace{Selector: "1", Rules: map[string]string{"monitor": "DP-1", "default": "true"}, Monitor: "DP-1", Default: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got = ParseWorkspace("workspace", "special:scratch, gapsout:50, on-created-empty:kitty")
+	if got.Selector != "special:scratch" || got.Rules["gapsout"] != "50" || got.Rules["on-created-empty"] != "kitty" || got.Default {
+		t.Errorf("got %+v", got)
+	}
+}
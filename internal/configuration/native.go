@@ -3,15 +3,16 @@ package configuration
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 type NativeBackend struct {
 	ConfigPath string
+	// Allow, if set, checks each file Parse follows a source= directive to
+	Allow PathFilter
 }
 
 func NewNativeBackend() *NativeBackend {
@@ -24,11 +25,11 @@ func (b *NativeBackend) Type() ConfigSourceType {
 
 func (b *NativeBackend) Detect(rootPath string) (bool, error) {
 	if rootPath == "" {
-		home, err := os.UserHomeDir()
+		root, err := HyprConfigRoot()
 		if err != nil {
 			return false, err
 		}
-		rootPath = filepath.Join(home, ".config", "hypr")
+		rootPath = root
 	}
 
 	configPath := filepath.Join(rootPath, "hyprland.conf")
@@ -46,82 +47,200 @@ func (b *NativeBackend) ListSources() ([]string, error) {
 	return []string{b.ConfigPath}, nil
 }
 
+// Parse reads the main config and, in place of each source= directive, the
+// lines of the files it includes. Every line is tagged with its SourceFile.
 func (b *NativeBackend) Parse() (*IR, error) {
 	if b.ConfigPath == "" {
 		return nil, fmt.Errorf("config path not set")
 	}
 
-	file, err := os.Open(b.ConfigPath)
+	e := newExpander()
+	e.allow = b.Allow
+	if err := e.expand(b.ConfigPath, true); err != nil {
+		return nil, err
+	}
+
+	ir := &IR{Lines: make([]ConfigLine, 0, len(e.lines)), Warnings: e.warnings, LineEnding: e.lineEnding, NoFinalNewline: e.noFinalNewline}
+	for _, sl := range e.lines {
+		ir.Lines = append(ir.Lines, sl.Line)
+	}
+	return ir, nil
+}
+
+// ParseFile reads a Hyprland-style config file into an IR
+func ParseFile(path string) (*IR, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	var lines []ConfigLine
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
+	ir, err := ParseReader(file)
+	if ir != nil {
+		for i := range ir.Lines {
+			ir.Lines[i].SourceFile = path
+		}
+		for i := range ir.Warnings {
+			ir.Warnings[i].File = path
+		}
+	}
+	if err != nil {
+		return ir, fmt.Errorf("%s: %w", path, err)
+	}
+	return ir, nil
+}
+
+// ParseString parses config content that is not backed by a file (e.g. pasted text)
+func ParseString(content string) (*IR, error) {
+	return ParseReader(strings.NewReader(content))
+}
 
-	for scanner.Scan() {
-		lineNum++
-		raw := scanner.Text()
-		trimmed := strings.TrimSpace(raw)
+// ParseReader classifies each line read from r into the IR. Lines that cannot
+// be classified are kept and reported in IR.Warnings rather than aborting. If
+// reading fails part-way, the lines read so far are returned with the error.
+func ParseReader(r io.Reader) (*IR, error) {
+	ir := &IR{}
+	reader := bufio.NewReader(r)
+	lineNum := 0
+	var open []ConfigLine // Unclosed section starts
 
-		line := ConfigLine{
-			LineNum: lineNum,
-			Raw:     raw,
-		}
+	for {
+		raw, err := reader.ReadString('\n')
+		if raw != "" {
+			lineNum++
+			// The first line break sets the style String writes back
+			if ir.LineEnding == "" && strings.HasSuffix(raw, "\n") {
+				ir.LineEnding = "\n"
+				if strings.HasSuffix(raw, "\r\n") {
+					ir.LineEnding = "\r\n"
+				}
+			}
+			ir.NoFinalNewline = !strings.HasSuffix(raw, "\n")
+			raw = strings.TrimSuffix(strings.TrimSuffix(raw, "\n"), "\r")
+			line := classifyLine(lineNum, raw)
+			ir.Lines = append(ir.Lines, line)
 
-		if trimmed == "" {
-			line.Type = LineTypeEmpty
-		} else if strings.HasPrefix(trimmed, "#") {
-			line.Type = LineTypeComment
-		} else if strings.HasPrefix(trimmed, "$") {
-			line.Type = LineTypeVariable
-			parts := strings.SplitN(trimmed, "=", 2)
-			if len(parts) == 2 {
-				line.Key = strings.TrimSpace(parts[0])
-				line.Value = strings.TrimSpace(parts[1])
+			switch line.Type {
+			case LineTypeSectionStart:
+				open = append(open, line)
+			case LineTypeSectionEnd:
+				if len(open) == 0 {
+					ir.Warnings = append(ir.Warnings, ParseWarning{Line: lineNum, Raw: raw, Message: "closing brace without a matching section"})
+				} else {
+					open = open[:len(open)-1]
+				}
+			}
+			if w := lineWarning(line); w != "" {
+				ir.Warnings = append(ir.Warnings, ParseWarning{Line: lineNum, Raw: raw, Message: w})
 			}
-		} else if strings.HasSuffix(trimmed, "{") {
-			line.Type = LineTypeSectionStart
-			line.Key = strings.TrimSuffix(trimmed, "{")
-			line.Key = strings.TrimSpace(line.Key)
-		} else if trimmed == "}" {
-			line.Type = LineTypeSectionEnd
-		} else if strings.Contains(trimmed, "=") {
-			line.Type = LineTypeKeyValue
-			parts := strings.SplitN(trimmed, "=", 2)
-			line.Key = strings.TrimSpace(parts[0])
-			line.Value = strings.TrimSpace(parts[1])
-		} else {
-			// Fallback for things like 'exec-once ...' without equals if valid,
-			// or complex binds. Hyprland usually requires =, but sometimes syntax varies.
-			// Treating as generic content for now.
-			line.Type = LineTypeUnknown
 		}
 
-		lines = append(lines, line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			setSections(ir)
+			return ir, fmt.Errorf("read failed after line %d: %w", lineNum, err)
+		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	for _, section := range open {
+		ir.Warnings = append(ir.Warnings, ParseWarning{
+			Line:    section.LineNum,
+			Raw:     section.Raw,
+			Message: fmt.Sprintf("section %q is never closed", section.Key),
+		})
 	}
 
-	return &IR{Lines: lines}, nil
+	setSections(ir)
+	return ir, nil
 }
 
-func (b *NativeBackend) GeneratePatch(oldIR, newIR *IR) (string, error) {
-	dmp := diffmatchpatch.New()
-	text1 := oldIR.String()
-	text2 := newIR.String()
+// lineWarning returns a description of what is wrong with a classified line
+func lineWarning(line ConfigLine) string {
+	switch line.Type {
+	case LineTypeUnknown:
+		return "not a setting, section or comment (expected key = value)"
+	case LineTypeVariable:
+		if line.Key == "" {
+			return "variable definition without '='"
+		}
+	case LineTypeKeyValue:
+		if line.Key == "" {
+			return "assignment without a key"
+		}
+	case LineTypeSectionStart:
+		if line.Key == "" {
+			return "section without a name"
+		}
+	}
+	return ""
+}
+
+// classifyLine determines the type, key and value of a single raw line
+func classifyLine(lineNum int, raw string) ConfigLine {
+	trimmed := strings.TrimSpace(raw)
+
+	line := ConfigLine{
+		LineNum: lineNum,
+		Raw:     raw,
+	}
 
-	diffs := dmp.DiffMain(text1, text2, false)
-	// Simplify diffs (cleanup semantic)
-	// dmp.DiffCleanupSemantic(diffs)
+	if trimmed == "" {
+		line.Type = LineTypeEmpty
+	} else if strings.HasPrefix(trimmed, "#") {
+		line.Type = LineTypeComment
+	} else if strings.HasPrefix(trimmed, "$") {
+		line.Type = LineTypeVariable
+		parts := strings.SplitN(trimmed, "=", 2)
+		if len(parts) == 2 {
+			line.Key = strings.TrimSpace(parts[0])
+			line.Value = strings.TrimSpace(parts[1])
+		}
+	} else if strings.HasSuffix(trimmed, "{") {
+		line.Type = LineTypeSectionStart
+		line.Key = strings.TrimSuffix(trimmed, "{")
+		line.Key = strings.TrimSpace(line.Key)
+	} else if trimmed == "}" {
+		line.Type = LineTypeSectionEnd
+	} else if strings.Contains(trimmed, "=") {
+		line.Type = LineTypeKeyValue
+		parts := strings.SplitN(trimmed, "=", 2)
+		line.Key = strings.TrimSpace(parts[0])
+		line.Value = strings.TrimSpace(parts[1])
+		line.Bind = ParseBind(line.Key, line.Value)
+		line.Monitor = ParseMonitor(line.Key, line.Value)
+		line.Workspace = ParseWorkspace(line.Key, line.Value)
+	} else {
+		// Fallback for things like 'exec-once ...' without equals if valid,
+		// or complex binds. Hyprland usually requires =, but sometimes syntax varies.
+		// Treating as generic content for now.
+		line.Type = LineTypeUnknown
+	}
+
+	return line
+}
+
+// splitComment splits a value from its trailing comment, e.g. "5 # inner
+// gaps" into "5" and "# inner gaps". As in Hyprland, "##" is a literal "#"
+// rather than the start of a comment.
+func splitComment(value string) (string, string) {
+	for i := 0; i < len(value); i++ {
+		if value[i] != '#' {
+			continue
+		}
+		if i+1 < len(value) && value[i+1] == '#' {
+			i++
+			continue
+		}
+		return strings.TrimSpace(value[:i]), value[i:]
+	}
+	return value, ""
+}
 
-	// Create a patch
-	patches := dmp.PatchMake(text1, diffs)
-	return dmp.PatchToText(patches), nil
+func (b *NativeBackend) GeneratePatch(oldIR, newIR *IR) (string, error) {
+	name := filepath.Base(b.ConfigPath)
+	return UnifiedDiff("a/"+name, "b/"+name, oldIR.String(), newIR.String()), nil
 }
 
 func (b *NativeBackend) ApplyPatch(path string, patchText string) error {
@@ -138,52 +257,29 @@ func (b *NativeBackend) ApplyPatch(path string, patchText string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read config file %s: %w", targetPath, err)
 	}
-	text := string(contentBytes)
 
-	dmp := diffmatchpatch.New()
-	patches, err := dmp.PatchFromText(patchText)
+	newText, err := ApplyUnifiedDiff(string(contentBytes), patchText)
 	if err != nil {
-		return fmt.Errorf("failed to parse patch: %w", err)
-	}
-
-	newText, results := dmp.PatchApply(patches, text)
-
-	// Check if all patches applied successfully
-	for _, success := range results {
-		if !success {
-			return fmt.Errorf("some patches failed to apply")
-		}
+		return fmt.Errorf("failed to apply patch: %w", err)
 	}
 
-	// Write back
-	file, err := os.Create(targetPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = file.WriteString(newText)
-	return err
+	return WriteFileAtomic(targetPath, []byte(newText), 0644)
 }
 
-// Save writes the IR back to the file (Overwrite)
+// Save writes the IR back to the file (Overwrite). Lines that came from
+// sourced files are skipped so they are not inlined into the main config.
 func (b *NativeBackend) Save(ir *IR) error {
 	if b.ConfigPath == "" {
 		return fmt.Errorf("config path not set")
 	}
 
-	file, err := os.Create(b.ConfigPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	w := bufio.NewWriter(file)
+	mainPath, _ := filepath.Abs(b.ConfigPath)
+	var sb strings.Builder
 	for _, line := range ir.Lines {
-		_, err := w.WriteString(line.Raw + "\n")
-		if err != nil {
-			return err
+		if line.SourceFile != "" && line.SourceFile != b.ConfigPath && line.SourceFile != mainPath {
+			continue
 		}
+		sb.WriteString(line.Raw + "\n")
 	}
-	return w.Flush()
+	return WriteFileAtomic(b.ConfigPath, []byte(sb.String()), 0644)
 }
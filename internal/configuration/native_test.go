@@ -0,0 +1,88 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNativeParseFollowsSources(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf":      "$mod = SUPER\nsource = ./monitors.conf\ngeneral {\n    gaps_in = 5\n}\nsource = themes/colors.conf\n",
+		"hypr/monitors.conf":      "monitor = DP-1, 2560x1440@144, 0x0, 1\n",
+		"hypr/themes/colors.conf": "$accent = rgb(88c0d0)\n",
+	})
+	root := filepath.Join(home, "hypr")
+	main := filepath.Join(root, "hyprland.conf")
+	monitors := filepath.Join(root, "monitors.conf")
+	colors := filepath.Join(root, "themes", "colors.conf")
+
+	b := &NativeBackend{ConfigPath: main}
+	ir, err := b.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make(map[string]string)
+	var order []string
+	for _, line := range ir.Lines {
+		if line.Key != "" {
+			keys[line.Key] = line.SourceFile
+			order = append(order, line.Key)
+		}
+	}
+	for key, want := range map[string]string{
+		"$mod":    main,
+		"gaps_in": main,
+		"monitor": monitors,
+		"$accent": colors,
+	} {
+		if got, ok := keys[key]; !ok {
+			t.Errorf("%s is missing from the IR", key)
+		} else if got != want {
+			t.Errorf("%s has SourceFile %s, want %s", key, got, want)
+		}
+	}
+	// Sourced lines follow the source= line that includes them
+	if want := []string{"$mod", "source", "monitor", "general", "gaps_in", "source", "$accent"}; !slices.Equal(order, want) {
+		t.Errorf("keys in order %v, want %v", order, want)
+	}
+}
+
+func TestPatchRoundTripKeepsCRLF(t *testing.T) {
+	const original = "general {\r\n    gaps_in = 5   \r\n    gaps_out = 20\r\n}\r\n# trailing spaces matter  \r\n"
+	home := testConfigHome(t, map[string]string{"hypr/hyprland.conf": original})
+	path := filepath.Join(home, "hypr", "hyprland.conf")
+	b := &NativeBackend{ConfigPath: path}
+
+	ir, err := b.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ir.String() != original {
+		t.Fatalf("IR.String() = %q, want the file unchanged", ir.String())
+	}
+	changed := &IR{Lines: slices.Clone(ir.Lines), LineEnding: ir.LineEnding, NoFinalNewline: ir.NoFinalNewline}
+	for i, line := range changed.Lines {
+		if line.Key == "gaps_out" {
+			changed.Lines[i].Raw = "    gaps_out = 10"
+		}
+	}
+
+	patch, err := b.GeneratePatch(ir, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ApplyPatch("", patch); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(original, "gaps_out = 20", "gaps_out = 10", 1); string(data) != want {
+		t.Errorf("patched file = %q, want %q", data, want)
+	}
+}
@@ -1,12 +1,15 @@
 package configuration
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 type OmarchyBackend struct {
 	NativeBackend
+	// Security lists the files that make up the config besides hyprland.conf
+	Security BackendSecurity
 }
 
 func (b *OmarchyBackend) Type() ConfigSourceType {
@@ -15,11 +18,11 @@ func (b *OmarchyBackend) Type() ConfigSourceType {
 
 func (b *OmarchyBackend) Detect(rootPath string) (bool, error) {
 	if rootPath == "" {
-		home, err := os.UserHomeDir()
+		root, err := HyprConfigRoot()
 		if err != nil {
 			return false, err
 		}
-		rootPath = filepath.Join(home, ".config", "hypr")
+		rootPath = root
 	}
 
 	// Omarchy Detection (Assumption): Look for "omarchy" folder or specific file
@@ -37,3 +40,12 @@ func (b *OmarchyBackend) Detect(rootPath string) (bool, error) {
 
 	return false, nil
 }
+
+// ListSources returns hyprland.conf followed by the allowed config files that
+// exist, including those under omarchy/
+func (b *OmarchyBackend) ListSources() ([]string, error) {
+	if b.ConfigPath == "" {
+		return nil, fmt.Errorf("config path not detected")
+	}
+	return allowedSources(b.ConfigPath, b.Security), nil
+}
@@ -0,0 +1,354 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DiffContext is the number of unchanged lines shown around each change
+const DiffContext = 3
+
+// MaxDiffContext bounds the context lines UnifiedDiffContext accepts
+const MaxDiffContext = 50
+
+const noNewlineMarker = `\ No newline at end of file`
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffLine is one line of a diff. text excludes the line break; noNewline is
+// set for a final line that has none.
+type diffLine struct {
+	op        byte // ' ', '-' or '+'
+	text      string
+	noNewline bool
+}
+
+// UnifiedDiff returns the change from original to modified in unified diff
+// format (as produced by diff -u), labelled with oldName and newName. It
+// returns "" when the contents are equal.
+func UnifiedDiff(oldName, newName, original, modified string) string {
+	return UnifiedDiffContext(oldName, newName, original, modified, DiffContext)
+}
+
+// UnifiedDiffContext is UnifiedDiff with contextLines unchanged lines around
+// each change instead of DiffContext. ApplyUnifiedDiff must find every context
+// line, so fewer lines tolerate edits near the change better, while more lines
+// pin a hunk down in files that repeat the same block.
+func UnifiedDiffContext(oldName, newName, original, modified string, contextLines int) string {
+	contextLines = max(0, min(contextLines, MaxDiffContext))
+	// Line endings are not part of the change; ApplyUnifiedDiff keeps the
+	// file's own, so a CRLF file does not differ on every line
+	original, modified = stripCR(original), stripCR(modified)
+	if original == modified {
+		return ""
+	}
+
+	dmp := diffmatchpatch.New()
+	text1, text2, lineArray := dmp.DiffLinesToChars(original, modified)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(text1, text2, false), lineArray)
+
+	var lines []diffLine
+	for _, d := range diffs {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		}
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l == "" {
+				continue
+			}
+			lines = append(lines, diffLine{op: op, text: strings.TrimSuffix(l, "\n"), noNewline: !strings.HasSuffix(l, "\n")})
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// oldPos/newPos are the 1-based line numbers of lines[i] on each side
+	oldPos, newPos := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			oldPos++
+			newPos++
+			i++
+			continue
+		}
+
+		// A hunk starts contextLines lines before the change and ends once
+		// more than 2*contextLines unchanged lines follow the last change
+		start := i
+		for start > 0 && i-start < contextLines && lines[start-1].op == ' ' {
+			start--
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].op == ' ' {
+				run++
+			}
+			if run == len(lines) || run-end > 2*contextLines {
+				end += min(run-end, contextLines)
+				break
+			}
+			end = run
+		}
+
+		hunkOld, hunkNew := oldPos-(i-start), newPos-(i-start)
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+			body.WriteByte(l.op)
+			body.WriteString(l.text)
+			body.WriteString("\n")
+			if l.noNewline {
+				body.WriteString(noNewlineMarker + "\n")
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		sb.WriteString(body.String())
+
+		for _, l := range lines[i:end] {
+			if l.op != '+' {
+				oldPos++
+			}
+			if l.op != '-' {
+				newPos++
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// stripCR turns CRLF line breaks into LF
+func stripCR(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// hunkRange formats the start,count pair of a hunk header. An empty range
+// refers to the line before it, as in diff -u.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// hunk is one @@ section of a parsed unified diff
+type hunk struct {
+	header   string
+	oldStart int
+	lines    []diffLine
+}
+
+// parseUnifiedDiff extracts the hunks of a unified diff. Anything outside a
+// hunk (file headers, commentary) is ignored.
+func parseUnifiedDiff(patch string) ([]hunk, error) {
+	var hunks []hunk
+	var current *hunk
+	for _, raw := range strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n") {
+		if m := hunkHeaderRe.FindStringSubmatch(raw); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, hunk{header: strings.TrimSpace(raw), oldStart: start})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch {
+		case raw == noNewlineMarker:
+			if n := len(current.lines); n > 0 {
+				current.lines[n-1].noNewline = true
+			}
+		case raw == "":
+			// Editors and models often strip the space of blank context lines
+			current.lines = append(current.lines, diffLine{op: ' '})
+		case raw[0] == ' ' || raw[0] == '-' || raw[0] == '+':
+			current.lines = append(current.lines, diffLine{op: raw[0], text: raw[1:]})
+		default:
+			// End of this hunk (e.g. the --- header of the next file)
+			current = nil
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("no @@ hunks found; the patch must be a unified diff")
+	}
+	for i := range hunks {
+		// Trailing blank lines are usually an artifact of how the patch was copied
+		for n := len(hunks[i].lines); n > 0 && hunks[i].lines[n-1] == (diffLine{op: ' '}); n-- {
+			hunks[i].lines = hunks[i].lines[:n-1]
+		}
+	}
+	return hunks, nil
+}
+
+// HunkResult reports whether one hunk of a patch matched the file
+type HunkResult struct {
+	Header  string `json:"header"`
+	Applied bool   `json:"applied"`
+	Line    int    `json:"line,omitempty"` // Where it landed in the patched content, 1-based
+}
+
+// ApplyUnifiedDiff applies a unified diff to content. Each hunk is located
+// by its context and removed lines, searching outward from the line number in
+// its header so that a file which shifted slightly still patches cleanly.
+// Context lines are kept as they are in content, and added lines get its line
+// ending, so CRLF files and trailing whitespace survive the round trip.
+func ApplyUnifiedDiff(content, patch string) (string, error) {
+	result, hunks, err := PreviewUnifiedDiff(content, patch)
+	if err != nil {
+		return "", err
+	}
+	for n, h := range hunks {
+		if !h.Applied {
+			return "", fmt.Errorf("hunk %d (%s) does not match the file; it may have changed since the patch was made", n+1, h.Header)
+		}
+	}
+	return result, nil
+}
+
+// PreviewUnifiedDiff applies the hunks of a patch that match content and
+// reports each one, so a partly stale patch shows which hunks failed. Failed
+// hunks are left out of the result; only a malformed patch is an error.
+func PreviewUnifiedDiff(content, patch string) (string, []HunkResult, error) {
+	hunks, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return "", nil, err
+	}
+	results := make([]HunkResult, len(hunks))
+
+	lines := strings.Split(content, "\n")
+	trailingNewline := strings.HasSuffix(content, "\n")
+	if trailingNewline || content == "" {
+		lines = lines[:len(lines)-1]
+	}
+	// Lines are matched without the \r of a CRLF break, which cr restores
+	cr := make([]bool, len(lines))
+	for i, l := range lines {
+		lines[i], cr[i] = strings.CutSuffix(l, "\r")
+	}
+	crlf := len(cr) > 0 && cr[0]
+
+	offset := 0 // Lines added minus removed by earlier hunks
+	minPos := 0 // Hunks must not overlap or go backwards
+	for n, h := range hunks {
+		results[n].Header = h.header
+		var old, repl []diffLine
+		for _, l := range h.lines {
+			if l.op != '+' {
+				old = append(old, l)
+			}
+			if l.op != '-' {
+				repl = append(repl, l)
+			}
+		}
+
+		want := h.oldStart - 1 + offset
+		if len(old) == 0 {
+			want++ // An empty old range names the line before the insertion
+		}
+		pos := findHunk(lines, old, want, minPos)
+		if pos < 0 {
+			continue
+		}
+		results[n].Applied = true
+		results[n].Line = pos + 1
+
+		end := pos + len(old)
+		replText := make([]string, 0, len(repl))
+		replCR := make([]bool, 0, len(repl))
+		next := pos // The file line the next context or removed line matched
+		for _, l := range h.lines {
+			switch l.op {
+			case ' ':
+				replText = append(replText, lines[next])
+				replCR = append(replCR, cr[next])
+				next++
+			case '-':
+				next++
+			case '+':
+				replText = append(replText, l.text)
+				replCR = append(replCR, crlf && !l.noNewline)
+			}
+		}
+		if end == len(lines) {
+			switch {
+			case len(repl) > 0:
+				trailingNewline = !repl[len(repl)-1].noNewline
+			case len(old) > 0 && old[len(old)-1].noNewline:
+				// Removing the unterminated last line leaves the previous one last
+				trailingNewline = true
+			}
+		}
+
+		lines = append(lines[:pos], append(replText, lines[end:]...)...)
+		cr = append(cr[:pos], append(replCR, cr[end:]...)...)
+		offset += len(repl) - len(old)
+		minPos = pos + len(repl)
+	}
+
+	var result strings.Builder
+	for i, l := range lines {
+		result.WriteString(l)
+		if cr[i] {
+			result.WriteString("\r")
+		}
+		if i < len(lines)-1 || trailingNewline {
+			result.WriteString("\n")
+		}
+	}
+	return result.String(), results, nil
+}
+
+// findHunk returns the index at which old matches lines, preferring the
+// position closest to want. Exact matches win over matches that only agree
+// after trimming whitespace. It returns -1 if there is no match.
+func findHunk(lines []string, old []diffLine, want, minPos int) int {
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+	} {
+		matches := func(pos int) bool {
+			if pos < minPos || pos+len(old) > len(lines) {
+				return false
+			}
+			for i, l := range old {
+				if !equal(lines[pos+i], l.text) {
+					return false
+				}
+			}
+			return true
+		}
+		for delta := 0; delta <= len(lines); delta++ {
+			if matches(want - delta) {
+				return want - delta
+			}
+			if delta > 0 && matches(want+delta) {
+				return want + delta
+			}
+		}
+	}
+	return -1
+}
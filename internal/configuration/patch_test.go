@@ -0,0 +1,64 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns "line 1\n" through "line n\n"
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	original := numberedLines(20)
+	modified := strings.Replace(original, "line 2\n", "line two\n", 1)
+	modified = strings.Replace(modified, "line 15\n", "line fifteen\n", 1)
+	modified = strings.Replace(modified, "line 18\n", "", 1)
+
+	// As diff -u prints it
+	want := `--- a/hyprland.conf
++++ b/hyprland.conf
+@@ -1,5 +1,5 @@
+ line 1
+-line 2
++line two
+ line 3
+ line 4
+ line 5
+@@ -12,9 +12,8 @@
+ line 12
+ line 13
+ line 14
+-line 15
++line fifteen
+ line 16
+ line 17
+-line 18
+ line 19
+ line 20
+`
+	got := UnifiedDiff("a/hyprland.conf", "b/hyprland.conf", original, modified)
+	if got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	patched, err := ApplyUnifiedDiff(original, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched != modified {
+		t.Errorf("applying the diff gave\n%s\nwant\n%s", patched, modified)
+	}
+}
+
+func TestUnifiedDiffEqual(t *testing.T) {
+	if got := UnifiedDiff("a", "b", "gaps_in = 5\n", "gaps_in = 5\r\n"); got != "" {
+		t.Errorf("UnifiedDiff() = %q for contents that differ only in line endings", got)
+	}
+}
@@ -0,0 +1,89 @@
+package configuration
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed presets/*.conf
+var presetFS embed.FS
+
+// Preset is a curated config snippet that can be merged into a user's config.
+// Metadata is read from "# key: value" header comments in the embedded file.
+type Preset struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     int    `json:"version"`
+	Content     string `json:"-"`
+}
+
+// Presets returns all embedded presets sorted by name
+func Presets() ([]Preset, error) {
+	entries, err := presetFS.ReadDir("presets")
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []Preset
+	for _, entry := range entries {
+		p, err := loadPreset(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, *p)
+	}
+
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+// GetPreset returns the embedded preset with the given name
+func GetPreset(name string) (*Preset, error) {
+	if strings.ContainsAny(name, "/\\") {
+		return nil, fmt.Errorf("invalid preset name %q", name)
+	}
+	p, err := loadPreset(name + ".conf")
+	if err != nil {
+		return nil, fmt.Errorf("unknown preset %q", name)
+	}
+	return p, nil
+}
+
+func loadPreset(file string) (*Preset, error) {
+	data, err := presetFS.ReadFile(path.Join("presets", file))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Preset{
+		Name:    strings.TrimSuffix(file, ".conf"),
+		Content: string(data),
+	}
+
+	for _, line := range strings.Split(p.Content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(trimmed, "#")), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "title":
+			p.Title = value
+		case "description":
+			p.Description = value
+		case "version":
+			p.Version, _ = strconv.Atoi(value)
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,204 @@
+package configuration
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RiskSeverity ranks how likely a pattern is to lock the user out
+type RiskSeverity string
+
+const (
+	RiskCritical RiskSeverity = "critical" // Likely black screen, crash or login loop
+	RiskWarning  RiskSeverity = "warning"  // Can leave the session unusable or confusing
+)
+
+// Risk is a high-risk pattern found in the config
+type Risk struct {
+	Rule       string       `json:"rule"`
+	Severity   RiskSeverity `json:"severity"`
+	File       string       `json:"file,omitempty"`
+	Line       int          `json:"line,omitempty"`
+	Message    string       `json:"message"`
+	Suggestion string       `json:"suggestion"`
+}
+
+// riskRule inspects the expanded config. lines are in evaluation order and
+// vars holds the $variables defined up to the end of the config.
+type riskRule struct {
+	id       string
+	severity RiskSeverity
+	check    func(lines []SourcedLine, vars map[string]string) []Risk
+}
+
+// sessionKillers are commands that end the Hyprland session when run at startup
+var sessionKillers = regexp.MustCompile(`(?i)(hyprctl\s+dispatch\s+exit|(pkill|killall)\s+(-\S+\s+)*hyprland\b|loginctl\s+(terminate-session|terminate-user|kill-session|kill-user)|pkill\s+(-\S+\s+)*-u\b|kill\s+-9\s+-1\b|systemctl\s+(--user\s+)?(stop|exit)\b.*(graphical-session|hyprland|wayland-wm))`)
+
+var riskRules = []riskRule{
+	{
+		id:       "exec-kills-session",
+		severity: RiskCritical,
+		check: func(lines []SourcedLine, vars map[string]string) []Risk {
+			var out []Risk
+			for _, sl := range lines {
+				if sl.Section != "" || (sl.Line.Key != "exec-once" && sl.Line.Key != "exec" && sl.Line.Key != "execr-once" && sl.Line.Key != "execr") {
+					continue
+				}
+				cmd := expandVariables(sl.Line.Value, vars)
+				if !sessionKillers.MatchString(cmd) {
+					continue
+				}
+				out = append(out, Risk{
+					File:       sl.File,
+					Line:       sl.Line.LineNum,
+					Message:    sl.Line.Key + " runs a command that ends the session (" + strings.TrimSpace(sl.Line.Value) + "); this causes an immediate logout or login loop",
+					Suggestion: "Remove this " + sl.Line.Key + " line or bind the command to a key instead",
+				})
+			}
+			return out
+		},
+	},
+	{
+		id:       "monitors-all-disabled",
+		severity: RiskCritical,
+		check: func(lines []SourcedLine, vars map[string]string) []Risk {
+			monitors := monitorRules(lines, vars)
+			if len(monitors) == 0 {
+				return nil
+			}
+			for _, m := range monitors {
+				if m.name == "" || !m.disabled {
+					return nil
+				}
+			}
+			last := monitors[len(monitors)-1]
+			return []Risk{{
+				File:       last.line.File,
+				Line:       last.line.Line.LineNum,
+				Message:    "Every monitor rule disables its output and there is no fallback rule; this results in a black screen",
+				Suggestion: "Keep at least one output enabled or add 'monitor = , preferred, auto, 1'",
+			}}
+		},
+	},
+	{
+		id:       "monitor-no-fallback",
+		severity: RiskWarning,
+		check: func(lines []SourcedLine, vars map[string]string) []Risk {
+			monitors := monitorRules(lines, vars)
+			if len(monitors) == 0 {
+				return nil
+			}
+			for _, m := range monitors {
+				if m.name == "" {
+					return nil
+				}
+			}
+			first := monitors[0]
+			return []Risk{{
+				File:       first.line.File,
+				Line:       first.line.Line.LineNum,
+				Message:    "Monitors are configured by name only, with no catch-all rule; if the output names change (new GPU, dock, driver update) the screen may stay black",
+				Suggestion: "Add a fallback rule: 'monitor = , preferred, auto, 1'",
+			}}
+		},
+	},
+	{
+		id:       "autoreload-disabled",
+		severity: RiskWarning,
+		check: func(lines []SourcedLine, vars map[string]string) []Risk {
+			var last *SourcedLine
+			for i, sl := range lines {
+				if isSetting(sl.Line) && QualifiedName(sl.Section, sl.Line.Key) == "misc:disable_autoreload" {
+					last = &lines[i]
+				}
+			}
+			if last == nil || !isTruthy(expandVariables(last.Line.Value, vars)) {
+				return nil
+			}
+			return []Risk{{
+				File:       last.File,
+				Line:       last.Line.LineNum,
+				Message:    "misc:disable_autoreload is enabled, so saved changes (including fixes) are not applied until a manual 'hyprctl reload'",
+				Suggestion: "Run 'hyprctl reload' after applying changes, or set misc:disable_autoreload = false",
+			}}
+		},
+	},
+	{
+		id:       "exit-bind-without-modifier",
+		severity: RiskWarning,
+		check: func(lines []SourcedLine, vars map[string]string) []Risk {
+			var out []Risk
+			for _, sl := range lines {
+				if sl.Section != "" || !strings.HasPrefix(sl.Line.Key, "bind") {
+					continue
+				}
+				fields := strings.Split(expandVariables(sl.Line.Value, vars), ",")
+				if len(fields) < 3 || strings.TrimSpace(fields[0]) != "" {
+					continue
+				}
+				if strings.TrimSpace(fields[2]) != "exit" {
+					continue
+				}
+				out = append(out, Risk{
+					File:       sl.File,
+					Line:       sl.Line.LineNum,
+					Message:    "The exit dispatcher is bound to a key without a modifier (" + strings.TrimSpace(sl.Line.Value) + "); a single keypress ends the session",
+					Suggestion: "Add a modifier such as SUPER SHIFT to this bind",
+				})
+			}
+			return out
+		},
+	},
+}
+
+type monitorRule struct {
+	name     string
+	disabled bool
+	line     SourcedLine
+}
+
+// monitorRules returns the top-level monitor= rules in evaluation order
+func monitorRules(lines []SourcedLine, vars map[string]string) []monitorRule {
+	var out []monitorRule
+	for _, sl := range lines {
+		if sl.Section != "" || sl.Line.Key != "monitor" {
+			continue
+		}
+		fields := strings.Split(expandVariables(sl.Line.Value, vars), ",")
+		rule := monitorRule{name: strings.TrimSpace(fields[0]), line: sl}
+		if len(fields) > 1 && strings.TrimSpace(fields[1]) == "disable" {
+			rule.disabled = true
+		}
+		out = append(out, rule)
+	}
+	return out
+}
+
+func isTruthy(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// CheckRisks scans the expanded config (see ExpandSources) for patterns known
+// to cause black screens, crashes on login or login loops.
+func CheckRisks(lines []SourcedLine) []Risk {
+	vars := make(map[string]string)
+	for _, sl := range lines {
+		if sl.Line.Type == LineTypeVariable && sl.Line.Key != "" {
+			vars[sl.Line.Key] = sl.Line.Value
+		}
+	}
+
+	var warnings []Risk
+	for _, rule := range riskRules {
+		for _, w := range rule.check(lines, vars) {
+			w.Rule = rule.id
+			w.Severity = rule.severity
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings
+}
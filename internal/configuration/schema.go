@@ -0,0 +1,122 @@
+package configuration
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// KnownProviders lists the values accepted for [llm] provider
+var KnownProviders = []string{
+	"openai", "openai-compatible", "groq", "azure", "anthropic", "bedrock", "gemini", "ollama",
+}
+
+// DecodeConfigFile decodes path into config. Keys that do not exist in
+// Config are ignored by the decoder, so each one is returned as a warning
+// naming the key and the file, with the closest valid key when it looks
+// like a typo.
+func DecodeConfigFile(path string, config *Config) ([]string, error) {
+	meta, err := toml.DecodeFile(path, config)
+	if err != nil {
+		return nil, err
+	}
+
+	known := knownKeys(reflect.TypeOf(*config), "")
+	undecoded := make(map[string]bool)
+	for _, key := range meta.Undecoded() {
+		undecoded[key.String()] = true
+	}
+
+	var warnings []string
+	for _, key := range meta.Undecoded() {
+		// Report an unknown table once rather than every key inside it
+		if len(key) > 1 && undecoded[key[:len(key)-1].String()] {
+			continue
+		}
+		warning := fmt.Sprintf("%s: unknown key %q is ignored", path, key.String())
+		if suggestion := closestKey(key, known); suggestion != "" {
+			warning += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, nil
+}
+
+// Validate checks the settings that have a fixed set of valid values
+func (c *Config) Validate() error {
+	if !slices.Contains(KnownProviders, strings.ToLower(c.LLM.Provider)) {
+		return fmt.Errorf("[llm] provider %q is not supported; use one of: %s", c.LLM.Provider, strings.Join(KnownProviders, ", "))
+	}
+	for _, name := range c.LLM.FallbackProviders {
+		if !slices.Contains(KnownProviders, strings.ToLower(name)) {
+			return fmt.Errorf("[llm] fallback_providers: %q is not supported; use any of: %s", name, strings.Join(KnownProviders, ", "))
+		}
+	}
+	if c.Agent.MaxTurns <= 0 {
+		return fmt.Errorf("[agent] max_turns must be positive, got %d", c.Agent.MaxTurns)
+	}
+	return nil
+}
+
+// knownKeys returns the dotted toml keys of a config struct and its tables
+func knownKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		keys = append(keys, prefix+name)
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, knownKeys(field.Type, prefix+name+".")...)
+		}
+	}
+	return keys
+}
+
+// closestKey returns the known key in the same table as key whose name is
+// within two edits of it, or "" if there is none
+func closestKey(key toml.Key, known []string) string {
+	prefix := ""
+	if len(key) > 1 {
+		prefix = key[:len(key)-1].String() + "."
+	}
+	name := key[len(key)-1]
+
+	best, bestDistance := "", 3
+	for _, candidate := range known {
+		rest, ok := strings.CutPrefix(candidate, prefix)
+		if !ok || strings.Contains(rest, ".") {
+			continue
+		}
+		if d := editDistance(name, rest); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,81 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodeConfigFileWarnsOnUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	config := `[llm]
+provider = "anthropic"
+anthropic_modal = "claude-test"
+
+[agent]
+max_turns = 10
+
+[plugins]
+enabled = true
+names = ["a"]
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	warnings, err := DecodeConfigFile(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		path + `: unknown key "llm.anthropic_modal" is ignored (did you mean "llm.anthropic_model"?)`,
+		path + `: unknown key "plugins" is ignored`,
+	}
+	slices.Sort(warnings)
+	if !slices.Equal(warnings, want) {
+		t.Errorf("warnings =\n%s\nwant\n%s", strings.Join(warnings, "\n"), strings.Join(want, "\n"))
+	}
+	// The known keys are still decoded
+	if cfg.LLM.Provider != "anthropic" || cfg.Agent.MaxTurns != 10 {
+		t.Errorf("decoded provider %q and max_turns %d", cfg.LLM.Provider, cfg.Agent.MaxTurns)
+	}
+}
+
+func TestValidateRejectsBadSettings(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   string // Empty when the config is valid
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"provider case", func(c *Config) { c.LLM.Provider = "Anthropic" }, ""},
+		{"unknown provider", func(c *Config) { c.LLM.Provider = "antropic" }, `[llm] provider "antropic" is not supported`},
+		{"unknown fallback", func(c *Config) { c.LLM.FallbackProviders = []string{"ollama", "mistral"} }, `fallback_providers: "mistral" is not supported`},
+		{"zero max_turns", func(c *Config) { c.Agent.MaxTurns = 0 }, "[agent] max_turns must be positive, got 0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tc.change(cfg)
+			err := cfg.Validate()
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("Validate() = %v, want no error", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("Validate() = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRefusesInvalidProvider(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("config.toml", []byte("[llm]\nprovider = \"antropic\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid config file ./config.toml") {
+		t.Errorf("LoadConfig() = %v, want the config file refused", err)
+	}
+}
@@ -0,0 +1,298 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SourcedLine is a parsed config line together with the file it came from
+type SourcedLine struct {
+	File    string
+	Section string // Colon-separated section path
+	Line    ConfigLine
+}
+
+// PathFilter decides whether a sourced file may be read. Files it returns an
+// error for are left out of the expansion.
+type PathFilter func(path string) error
+
+// ExpandSources parses mainConfig and every file it pulls in via source=,
+// returning all lines in the order Hyprland evaluates them: a sourced file's
+// lines appear at the position of the source= directive that includes it.
+// Glob patterns such as themes/*.conf include every match in lexical order.
+// Missing files, and files allow rejects (if it is non-nil), are skipped. A
+// file is never expanded twice in one chain; if one sources itself, directly
+// or through others, the lines are returned with a *SourceCycleError.
+func ExpandSources(mainConfig string, allow PathFilter) ([]SourcedLine, error) {
+	e := newExpander()
+	e.allow = allow
+	if err := e.expand(mainConfig, true); err != nil {
+		return e.lines, err
+	}
+	if e.cycle != nil {
+		return e.lines, e.cycle
+	}
+	return e.lines, nil
+}
+
+// SourceCycleError reports a file that sources itself. Files lists the chain
+// of includes, starting and ending with that file.
+type SourceCycleError struct {
+	Files []string
+}
+
+func (e *SourceCycleError) Error() string {
+	return "circular source= include: " + strings.Join(e.Files, " -> ")
+}
+
+// Statuses of a SourceNode that could not be expanded
+const (
+	SourceMissing = "missing" // The sourced file does not exist
+	SourceCycle   = "cycle"   // The file is already being expanded further up the chain
+	SourceError   = "error"   // The path could not be resolved or the file not parsed
+	SourceDenied  = "denied"  // The file is outside the allowed paths
+)
+
+// SourceNode is one file in the include graph
+type SourceNode struct {
+	Path      string        `json:"path"`
+	Line      int           `json:"line,omitempty"` // Line of the source= directive in the parent
+	Status    string        `json:"status,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Includes  []*SourceNode `json:"includes,omitempty"`
+	Truncated int           `json:"truncated,omitempty"` // Descendants left out beyond the depth limit
+}
+
+// SourceTree returns the include graph of mainConfig: the files it sources,
+// the files those source, and so on. Nodes deeper than maxDepth (if positive)
+// are left out and counted in Truncated. Files allow rejects are marked
+// SourceDenied and not expanded.
+func SourceTree(mainConfig string, maxDepth int, allow PathFilter) (*SourceNode, error) {
+	abs, err := filepath.Abs(mainConfig)
+	if err != nil {
+		return nil, err
+	}
+	e := newExpander()
+	e.allow = allow
+	e.node = &SourceNode{Path: abs}
+	if err := e.expand(abs, true); err != nil {
+		return nil, err
+	}
+	if maxDepth > 0 {
+		pruneTree(e.node, maxDepth)
+	}
+	return e.node, nil
+}
+
+// pruneTree drops the includes of nodes at depth and returns how many nodes
+// the subtree contained below the root
+func pruneTree(n *SourceNode, depth int) int {
+	count := 0
+	for _, child := range n.Includes {
+		count += 1 + pruneTree(child, depth-1)
+	}
+	if depth <= 0 && len(n.Includes) > 0 {
+		n.Truncated = count
+		n.Includes = nil
+	}
+	return count
+}
+
+// expander accumulates the state of one ExpandSources run
+type expander struct {
+	vars     map[string]string
+	active   map[string]int    // Files in the current include chain, by canonical path, to their index in chain
+	chain    []string          // The current include chain, outermost first
+	cycle    *SourceCycleError // The first circular include found
+	lines    []SourcedLine
+	warnings []ParseWarning
+	node     *SourceNode // Node of the file being expanded, when building a SourceTree
+	allow    PathFilter  // Checks each sourced file before it is read; nil allows all
+
+	// The line break style of the main config, for IR.String
+	lineEnding     string
+	noFinalNewline bool
+}
+
+func newExpander() *expander {
+	return &expander{vars: make(map[string]string), active: make(map[string]int)}
+}
+
+// expand appends the lines of path. Only a failure to read the main config is
+// fatal; problems with sourced files are recorded as warnings.
+func (e *expander) expand(path string, main bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	key := canonicalPath(abs)
+	if _, ok := e.active[key]; ok {
+		return nil
+	}
+	e.active[key] = len(e.chain)
+	e.chain = append(e.chain, abs)
+	defer func() {
+		delete(e.active, key)
+		e.chain = e.chain[:len(e.chain)-1]
+	}()
+
+	ir, err := ParseFile(abs)
+	if ir != nil {
+		e.warnings = append(e.warnings, ir.Warnings...)
+	}
+	if err != nil {
+		if main || ir == nil {
+			return err
+		}
+		e.warnings = append(e.warnings, ParseWarning{File: abs, Line: len(ir.Lines), Message: err.Error()})
+	}
+	if main {
+		e.lineEnding, e.noFinalNewline = ir.LineEnding, ir.NoFinalNewline
+	}
+
+	paths := SectionPaths(ir)
+	for i, line := range ir.Lines {
+		e.lines = append(e.lines, SourcedLine{File: abs, Section: paths[i], Line: line})
+
+		switch {
+		case line.Type == LineTypeVariable && line.Key != "":
+			e.vars[line.Key] = line.Value
+		case line.Type == LineTypeKeyValue && line.Key == "source" && paths[i] == "":
+			target, err := resolveSourcePath(line.Value, e.vars, filepath.Dir(abs))
+			if err != nil {
+				e.warnings = append(e.warnings, ParseWarning{File: abs, Line: line.LineNum, Raw: line.Raw, Message: err.Error()})
+				e.addNode(target, line.LineNum).mark(SourceError, err.Error())
+				continue
+			}
+			if !isGlob(target) {
+				e.include(abs, line, target)
+				continue
+			}
+
+			// Hyprland expands patterns itself; one that matches nothing is
+			// almost always a typo, so it is reported rather than ignored
+			matches, err := filepath.Glob(target)
+			if err != nil {
+				e.warnings = append(e.warnings, ParseWarning{File: abs, Line: line.LineNum, Raw: line.Raw, Message: fmt.Sprintf("invalid source pattern %s: %v", target, err)})
+				e.addNode(target, line.LineNum).mark(SourceError, err.Error())
+				continue
+			}
+			if len(matches) == 0 {
+				e.warnings = append(e.warnings, ParseWarning{File: abs, Line: line.LineNum, Raw: line.Raw, Message: "source pattern matched no files: " + target})
+				e.addNode(target, line.LineNum).mark(SourceMissing, "pattern matched no files")
+				continue
+			}
+			for _, match := range matches {
+				e.include(abs, line, match)
+			}
+		}
+	}
+	return nil
+}
+
+// include expands one file sourced by the directive line of from
+func (e *expander) include(from string, line ConfigLine, target string) {
+	child := e.addNode(target, line.LineNum)
+	if _, err := os.Stat(target); err != nil {
+		e.warnings = append(e.warnings, ParseWarning{File: from, Line: line.LineNum, Raw: line.Raw, Message: "sourced file not found: " + target})
+		child.mark(SourceMissing, "")
+		return
+	}
+	// Checked for every file, so a pattern cannot pull in one outside the sandbox
+	if e.allow != nil {
+		if err := e.allow(target); err != nil {
+			e.warnings = append(e.warnings, ParseWarning{File: from, Line: line.LineNum, Raw: line.Raw, Message: "sourced file not allowed: " + err.Error()})
+			child.mark(SourceDenied, err.Error())
+			return
+		}
+	}
+	if start, ok := e.active[canonicalPath(target)]; ok {
+		cycle := &SourceCycleError{Files: append(append([]string{}, e.chain[start:]...), target)}
+		if e.cycle == nil {
+			e.cycle = cycle
+		}
+		e.warnings = append(e.warnings, ParseWarning{File: from, Line: line.LineNum, Raw: line.Raw, Message: cycle.Error()})
+		child.mark(SourceCycle, cycle.Error())
+		return
+	}
+
+	parent := e.node
+	e.node = child
+	err := e.expand(target, false)
+	e.node = parent
+	if err != nil {
+		e.warnings = append(e.warnings, ParseWarning{File: from, Line: line.LineNum, Raw: line.Raw, Message: err.Error()})
+		child.mark(SourceError, err.Error())
+	}
+}
+
+// canonicalPath resolves symlinks in an absolute path, so a file reached
+// through a link is recognised as the same file
+func canonicalPath(abs string) string {
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// isGlob reports whether a source path contains glob metacharacters
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// addNode records a source= directive in the tree being built, if any. It
+// returns nil when no tree is being built.
+func (e *expander) addNode(path string, line int) *SourceNode {
+	if e.node == nil {
+		return nil
+	}
+	child := &SourceNode{Path: path, Line: line}
+	if path == "" {
+		child.Path = "(unresolved)"
+	}
+	e.node.Includes = append(e.node.Includes, child)
+	return child
+}
+
+// mark sets the status of a node; it is a no-op on nil
+func (n *SourceNode) mark(status, msg string) {
+	if n == nil {
+		return
+	}
+	n.Status = status
+	n.Error = msg
+}
+
+// resolveSourcePath expands $variables and ~ in a source= value and resolves
+// relative paths against the directory of the file containing the directive
+func resolveSourcePath(value string, vars map[string]string, baseDir string) (string, error) {
+	expanded := expandVariables(value, vars)
+	expanded, err := ExpandHome(strings.TrimSpace(expanded))
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(baseDir, expanded)
+	}
+	return filepath.Clean(expanded), nil
+}
+
+// expandVariables substitutes $name references, longest names first so that
+// $mainMod is not clobbered by a $main definition
+func expandVariables(s string, vars map[string]string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		s = strings.ReplaceAll(s, name, vars[name])
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package configuration
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandSourcesWildcard(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf":        "source = themes/*.conf\ngeneral:gaps_in = 5\nsource = missing/*.conf\n",
+		"hypr/themes/blur.conf":     "decoration:blur:enabled = true\n",
+		"hypr/themes/borders.conf":  "general:border_size = 2\n",
+		"hypr/themes/colors.conf":   "$accent = rgb(cba6f7)\n",
+		"hypr/themes/README.md":     "not_sourced = true\n",
+		"hypr/themes/old/skip.conf": "general:gaps_out = 99\n",
+	})
+	root := filepath.Join(home, "hypr")
+	main := filepath.Join(root, "hyprland.conf")
+
+	lines, err := ExpandSources(main, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, sl := range lines {
+		rel, _ := filepath.Rel(root, sl.File)
+		got = append(got, rel+": "+sl.Line.Key)
+	}
+	// Each match is parsed in lexical order where the pattern is sourced
+	want := []string{
+		"hyprland.conf: source",
+		"themes/blur.conf: decoration:blur:enabled",
+		"themes/borders.conf: general:border_size",
+		"themes/colors.conf: $accent",
+		"hyprland.conf: general:gaps_in",
+		"hyprland.conf: source",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expanded lines =\n%q\nwant\n%q", got, want)
+	}
+
+	// The pattern matching nothing is reported in the include graph
+	tree, err := SourceTree(main, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, n := range tree.Includes {
+		rel, _ := filepath.Rel(root, n.Path)
+		statuses = append(statuses, rel+" "+n.Status)
+	}
+	if want := []string{"themes/blur.conf ", "themes/borders.conf ", "themes/colors.conf ", "missing/*.conf missing"}; !slices.Equal(statuses, want) {
+		t.Errorf("includes = %q, want %q", statuses, want)
+	}
+}
+
+func TestExpandSourcesReportsCycle(t *testing.T) {
+	home := testConfigHome(t, map[string]string{
+		"hypr/hyprland.conf": "source = conf/a.conf\ngeneral:gaps_in = 5\n",
+		"hypr/conf/a.conf":   "source = b.conf\ngeneral:border_size = 2\n",
+		"hypr/conf/b.conf":   "source = a.conf\ndecoration:rounding = 8\n",
+	})
+	root := filepath.Join(home, "hypr")
+	a, b := filepath.Join(root, "conf", "a.conf"), filepath.Join(root, "conf", "b.conf")
+
+	lines, err := ExpandSources(filepath.Join(root, "hyprland.conf"), nil)
+	var cycle *SourceCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("err = %v, want a SourceCycleError", err)
+	}
+	if want := []string{a, b, a}; !slices.Equal(cycle.Files, want) {
+		t.Errorf("cycle = %v, want %v", cycle.Files, want)
+	}
+	if !strings.Contains(err.Error(), "circular source= include: "+a+" -> "+b+" -> "+a) {
+		t.Errorf("error = %q", err)
+	}
+
+	// Each file is still expanded once, so the lines are usable
+	var keys []string
+	for _, sl := range lines {
+		if sl.Line.Key != "source" {
+			keys = append(keys, sl.Line.Key)
+		}
+	}
+	if want := []string{"decoration:rounding", "general:border_size", "general:gaps_in"}; !slices.Equal(keys, want) {
+		t.Errorf("expanded keys = %v, want %v", keys, want)
+	}
+}
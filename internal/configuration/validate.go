@@ -0,0 +1,141 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Severity of a validation issue
+const (
+	SeverityError   = "error"   // Hyprland will reject or misread the line
+	SeverityWarning = "warning" // Probably a mistake, but Hyprland may accept it
+)
+
+// ValidationIssue is a problem found by ValidateConfig
+type ValidationIssue struct {
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// knownSections are the categories Hyprland accepts at the top level
+var knownSections = map[string]bool{
+	"general": true, "decoration": true, "animations": true, "input": true,
+	"gestures": true, "group": true, "misc": true, "binds": true,
+	"xwayland": true, "opengl": true, "render": true, "cursor": true,
+	"ecosystem": true, "experimental": true, "debug": true, "dwindle": true,
+	"master": true, "plugin": true, "device": true, "quirks": true,
+}
+
+var variableRef = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// ValidateConfig checks a parsed config for structural problems: unbalanced
+// braces, unknown top-level sections, binds with too few fields and references
+// to undefined $variables. knownVars lists variables defined elsewhere (e.g.
+// in the file that sources this one).
+func ValidateConfig(ir *IR, knownVars []string) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(line int, severity, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Unbalanced braces and unclassifiable lines are already found by the parser
+	for _, w := range ir.Warnings {
+		add(w.Line, SeverityError, "%s", w.Message)
+	}
+
+	defined := make(map[string]int) // Variable -> line of first definition
+	for _, line := range ir.Lines {
+		if line.Type == LineTypeVariable && line.Key != "" {
+			if _, ok := defined[line.Key]; !ok {
+				defined[line.Key] = line.LineNum
+			}
+		}
+	}
+	known := make(map[string]bool)
+	for _, v := range knownVars {
+		known[v] = true
+	}
+
+	paths := SectionPaths(ir)
+	for i, line := range ir.Lines {
+		switch line.Type {
+		case LineTypeSectionStart:
+			if paths[i] == "" && line.Key != "" && !knownSections[line.Key] {
+				add(line.LineNum, SeverityWarning, "unknown section %q", line.Key)
+			}
+		case LineTypeKeyValue:
+			if paths[i] == "" {
+				if msg := checkBind(line); msg != "" {
+					add(line.LineNum, SeverityError, "%s", msg)
+				}
+			}
+		}
+
+		if line.Type != LineTypeKeyValue && line.Type != LineTypeVariable {
+			continue
+		}
+		for _, ref := range variableRef.FindAllString(line.Value, -1) {
+			if known[ref] || isEnvStyle(ref) {
+				continue
+			}
+			def, ok := defined[ref]
+			switch {
+			case !ok:
+				add(line.LineNum, SeverityError, "undefined variable %s", ref)
+			case def > line.LineNum:
+				add(line.LineNum, SeverityError, "variable %s is used before it is defined on line %d", ref, def)
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+// checkBind verifies that a bind line has enough comma-separated fields. The
+// d flag (bindd) adds a description field before the dispatcher.
+func checkBind(line ConfigLine) string {
+	if line.Key == "unbind" {
+		if n := len(strings.Split(line.Value, ",")); n < 2 {
+			return fmt.Sprintf("unbind needs MODS, key (got %d field)", n)
+		}
+		return ""
+	}
+	if !strings.HasPrefix(line.Key, "bind") {
+		return ""
+	}
+
+	flags := strings.TrimPrefix(line.Key, "bind")
+	for _, f := range flags {
+		if !strings.ContainsRune("lrcgoenmtidspu", f) {
+			return fmt.Sprintf("unknown bind flag %q in %s", f, line.Key)
+		}
+	}
+
+	want := 3
+	usage := "MODS, key, dispatcher[, params]"
+	if strings.ContainsRune(flags, 'd') {
+		want = 4
+		usage = "MODS, key, description, dispatcher[, params]"
+	}
+	if n := len(strings.Split(line.Value, ",")); n < want {
+		return fmt.Sprintf("%s needs %s (got %d fields)", line.Key, usage, n)
+	}
+	return ""
+}
+
+// isEnvStyle reports whether ref looks like a shell environment variable
+// ($HOME, $XDG_CONFIG_HOME), which Hyprland leaves for the shell to expand
+func isEnvStyle(ref string) bool {
+	name := strings.TrimPrefix(ref, "$")
+	for _, r := range name {
+		if unicode.IsLower(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package configuration
+
+import (
+	"strings"
+	"testing"
+)
+
+// validate parses content and returns the issues ValidateConfig finds in it
+func validate(t *testing.T, content string, knownVars ...string) []ValidationIssue {
+	t.Helper()
+	ir, err := ParseString(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ValidateConfig(ir, knownVars)
+}
+
+// hasIssue reports whether issues include an error on line whose message
+// contains text
+func hasIssue(issues []ValidationIssue, line int, text string) bool {
+	for _, issue := range issues {
+		if issue.Line == line && issue.Severity == SeverityError && strings.Contains(issue.Message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateUnbalancedBraces(t *testing.T) {
+	issues := validate(t, "general {\n    gaps_in = 5\n\ndecoration {\n    rounding = 10\n}\n")
+	if len(issues) == 0 || issues[0].Severity != SeverityError {
+		t.Fatalf("issues = %+v, want an error for the unclosed section", issues)
+	}
+
+	issues = validate(t, "general {\n    gaps_in = 5\n}\n}\n")
+	if !hasIssue(issues, 4, "") {
+		t.Errorf("issues = %+v, want an error for the stray brace on line 4", issues)
+	}
+}
+
+func TestValidateUndefinedVariable(t *testing.T) {
+	content := "$mainMod = SUPER\nbind = $mainMod, Q, exec, $terminal\nbind = $mainMod, E, exec, $fileManager\n$fileManager = dolphin\nexec-once = $HOME/bin/start.sh\n"
+
+	issues := validate(t, content)
+	if !hasIssue(issues, 2, "undefined variable $terminal") {
+		t.Errorf("issues = %+v, want $terminal reported as undefined", issues)
+	}
+	if !hasIssue(issues, 3, "used before it is defined on line 4") {
+		t.Errorf("issues = %+v, want $fileManager reported as used before its definition", issues)
+	}
+	if len(issues) != 2 {
+		t.Errorf("issues = %+v, want only those two ($HOME is left to the shell)", issues)
+	}
+
+	// A variable defined in the file that sources this one is known
+	if issues := validate(t, content, "$terminal"); hasIssue(issues, 2, "$terminal") {
+		t.Errorf("issues = %+v, want $terminal accepted as known", issues)
+	}
+}
@@ -0,0 +1,187 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValueKind is the expected type of a config option value
+type ValueKind int
+
+const (
+	ValueString ValueKind = iota
+	ValueInt
+	ValueFloat
+	ValueBool
+	ValueColor
+	ValueVec2     // Two comma-separated numbers, e.g. "200, 50"
+	ValueGradient // One or more colors followed by an optional angle, e.g. "rgba(33ccffee) rgba(00ff99ee) 45deg"
+)
+
+// maxGradientStops is the most colors Hyprland accepts in a gradient
+const maxGradientStops = 10
+
+var (
+	hexColorRe    = regexp.MustCompile(`^(?i)(rgba\([0-9a-f]{8}\)|rgb\([0-9a-f]{6}\)|0x[0-9a-f]{8})$`)
+	rgbaDecimalRe = regexp.MustCompile(`^(?i)rgba\(\s*(\d{1,3})\s*,\s*(\d{1,3})\s*,\s*(\d{1,3})\s*,\s*([0-9]*\.?[0-9]+)\s*\)$`)
+	rgbDecimalRe  = regexp.MustCompile(`^(?i)rgb\(\s*(\d{1,3})\s*,\s*(\d{1,3})\s*,\s*(\d{1,3})\s*\)$`)
+	angleRe       = regexp.MustCompile(`^-?\d+deg$`)
+	bareAngleRe   = regexp.MustCompile(`^-?\d+$`)
+)
+
+// ValidateColor checks a single Hyprland color value: rgba(RRGGBBAA),
+// rgb(RRGGBB), rgba(r, g, b, a), rgb(r, g, b) or the legacy 0xAARRGGBB form
+func ValidateColor(s string) error {
+	s = strings.TrimSpace(s)
+	if hexColorRe.MatchString(s) {
+		return nil
+	}
+
+	var channels []string
+	if m := rgbaDecimalRe.FindStringSubmatch(s); m != nil {
+		channels = m[1:4]
+		alpha, _ := strconv.ParseFloat(m[4], 64)
+		if alpha < 0 || alpha > 1 {
+			return fmt.Errorf("invalid color %q: alpha must be between 0 and 1", s)
+		}
+	} else if m := rgbDecimalRe.FindStringSubmatch(s); m != nil {
+		channels = m[1:4]
+	} else {
+		return fmt.Errorf("invalid color %q: expected rgba(RRGGBBAA), rgb(RRGGBB), rgba(r, g, b, a) or 0xAARRGGBB", s)
+	}
+
+	for _, c := range channels {
+		if n, _ := strconv.Atoi(c); n > 255 {
+			return fmt.Errorf("invalid color %q: channel %s is out of range 0-255", s, c)
+		}
+	}
+	return nil
+}
+
+// ValidateGradient checks a border gradient: 1 to 10 colors separated by
+// spaces, optionally followed by an angle such as 45deg
+func ValidateGradient(s string) error {
+	tokens := splitGradient(s)
+	if len(tokens) == 0 {
+		return fmt.Errorf("gradient must contain at least one color")
+	}
+
+	colors := tokens
+	last := tokens[len(tokens)-1]
+	if angleRe.MatchString(last) {
+		colors = tokens[:len(tokens)-1]
+		if len(colors) == 0 {
+			return fmt.Errorf("invalid gradient %q: an angle needs at least one color before it", s)
+		}
+	}
+	if len(colors) > maxGradientStops {
+		return fmt.Errorf("invalid gradient %q: %d colors given, Hyprland accepts at most %d", s, len(colors), maxGradientStops)
+	}
+
+	for i, c := range colors {
+		switch {
+		case angleRe.MatchString(c):
+			return fmt.Errorf("invalid gradient %q: the angle %s must come after all colors", s, c)
+		case bareAngleRe.MatchString(c) && i == len(colors)-1:
+			return fmt.Errorf("invalid gradient %q: angle %s is missing the deg suffix (use %sdeg)", s, c, c)
+		}
+		if err := ValidateColor(c); err != nil {
+			return fmt.Errorf("invalid gradient %q: %v", s, err)
+		}
+	}
+	return nil
+}
+
+// ComposeGradient builds a gradient value from colors and an optional angle
+// in degrees ("" for none; "45" and "45deg" are both accepted)
+func ComposeGradient(colors []string, angle string) (string, error) {
+	parts := make([]string, 0, len(colors)+1)
+	for _, c := range colors {
+		if c = strings.TrimSpace(c); c != "" {
+			parts = append(parts, c)
+		}
+	}
+	if angle = strings.TrimSpace(angle); angle != "" {
+		deg := strings.TrimSuffix(angle, "deg")
+		if !bareAngleRe.MatchString(deg) {
+			return "", fmt.Errorf("invalid angle %q: expected whole degrees such as 45 or 45deg", angle)
+		}
+		parts = append(parts, deg+"deg")
+	}
+
+	value := strings.Join(parts, " ")
+	if err := ValidateGradient(value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// splitGradient splits a gradient on whitespace outside parentheses, so
+// rgba(r, g, b, a) stays one token
+func splitGradient(s string) []string {
+	var tokens []string
+	var current strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case (r == ' ' || r == '\t') && depth == 0:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// ValidateValue checks that value matches the expected kind
+func ValidateValue(kind ValueKind, value string) error {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case ValueInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+	case ValueFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+	case ValueBool:
+		switch strings.ToLower(value) {
+		case "true", "false", "yes", "no", "on", "off", "1", "0":
+		default:
+			return fmt.Errorf("expected a boolean (true/false), got %q", value)
+		}
+	case ValueColor:
+		return ValidateColor(value)
+	case ValueGradient:
+		return ValidateGradient(value)
+	case ValueVec2:
+		parts := strings.Split(value, ",")
+		if len(parts) != 2 {
+			return fmt.Errorf("expected two comma-separated numbers, got %q", value)
+		}
+		for _, p := range parts {
+			p = strings.TrimSuffix(strings.TrimSpace(p), "%")
+			if _, err := strconv.ParseFloat(p, 64); err != nil {
+				return fmt.Errorf("expected two comma-separated numbers, got %q", value)
+			}
+		}
+	case ValueString:
+		if value == "" {
+			return fmt.Errorf("value must not be empty")
+		}
+	}
+	return nil
+}
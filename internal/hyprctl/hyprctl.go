@@ -0,0 +1,92 @@
+package hyprctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// run executes hyprctl with the given arguments and returns its output. It is
+// killed if ctx ends first.
+var run = func(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "hyprctl", args...).CombinedOutput()
+}
+
+// Available reports whether a live Hyprland session is running and hyprctl
+// can be used to talk to it
+func Available() bool {
+	return Check() == nil
+}
+
+// Check explains why hyprctl cannot be used, or returns nil if it can
+func Check() error {
+	if _, err := exec.LookPath("hyprctl"); err != nil {
+		return fmt.Errorf("hyprctl is not installed or not on PATH")
+	}
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") == "" {
+		return fmt.Errorf("Hyprland is not running in this session (HYPRLAND_INSTANCE_SIGNATURE is unset)")
+	}
+	return nil
+}
+
+// Reload asks the running compositor to re-read its configuration
+func Reload() error {
+	out, err := run(context.Background(), "reload")
+	if err != nil {
+		return fmt.Errorf("hyprctl reload failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if resp := strings.TrimSpace(string(out)); resp != "ok" {
+		return fmt.Errorf("hyprctl reload failed: %s", resp)
+	}
+	return nil
+}
+
+// ConfigErrors returns the errors Hyprland reported for the loaded config
+func ConfigErrors() ([]string, error) {
+	return ConfigErrorsContext(context.Background())
+}
+
+// ConfigErrorsContext is ConfigErrors, giving up when ctx ends
+func ConfigErrorsContext(ctx context.Context) ([]string, error) {
+	out, err := run(ctx, "-j", "configerrors")
+	if err != nil {
+		return nil, fmt.Errorf("hyprctl configerrors failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	var raw []string
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse hyprctl configerrors output: %w", err)
+	}
+
+	// Hyprland reports [""] when there are no errors
+	var errs []string
+	for _, e := range raw {
+		for _, line := range strings.Split(e, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				errs = append(errs, line)
+			}
+		}
+	}
+	return errs, nil
+}
+
+// Query runs 'hyprctl -j <subcommand>' (e.g. monitors, workspaces,
+// activewindow) and returns its JSON output
+func Query(subcommand string) (json.RawMessage, error) {
+	return QueryContext(context.Background(), subcommand)
+}
+
+// QueryContext is Query, giving up when ctx ends
+func QueryContext(ctx context.Context, subcommand string) (json.RawMessage, error) {
+	out, err := run(ctx, "-j", subcommand)
+	if err != nil {
+		return nil, fmt.Errorf("hyprctl %s failed: %v: %s", subcommand, err, strings.TrimSpace(string(out)))
+	}
+	if !json.Valid(out) {
+		return nil, fmt.Errorf("hyprctl %s returned invalid JSON: %s", subcommand, strings.TrimSpace(string(out)))
+	}
+	return json.RawMessage(out), nil
+}
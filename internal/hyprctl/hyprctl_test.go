@@ -0,0 +1,116 @@
+package hyprctl
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// stubRun replaces hyprctl with a function of its arguments for the test
+func stubRun(t *testing.T, fn func(args string) (string, error)) {
+	t.Helper()
+	orig := run
+	run = func(ctx context.Context, args ...string) ([]byte, error) {
+		out, err := fn(strings.Join(args, " "))
+		return []byte(out), err
+	}
+	t.Cleanup(func() { run = orig })
+}
+
+func TestReloadSucceeds(t *testing.T) {
+	stubRun(t, func(args string) (string, error) {
+		switch args {
+		case "reload":
+			return "ok\n", nil
+		case "-j configerrors":
+			return `[""]`, nil
+		}
+		return "", errors.New("unexpected call: " + args)
+	})
+
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	errs, err := ConfigErrors()
+	if err != nil || len(errs) != 0 {
+		t.Errorf("ConfigErrors() = %q, %v; want none", errs, err)
+	}
+}
+
+func TestReloadWithSyntaxError(t *testing.T) {
+	stubRun(t, func(args string) (string, error) {
+		switch args {
+		case "reload":
+			return "ok", nil
+		case "-j configerrors":
+			return `["Config error in file /home/u/.config/hypr/hyprland.conf at line 12: missing closing brace\nConfig error in file /home/u/.config/hypr/hyprland.conf at line 30: invalid field gaps"]`, nil
+		}
+		return "", errors.New("unexpected call: " + args)
+	})
+
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	errs, err := ConfigErrors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Config error in file /home/u/.config/hypr/hyprland.conf at line 12: missing closing brace",
+		"Config error in file /home/u/.config/hypr/hyprland.conf at line 30: invalid field gaps",
+	}
+	if !slices.Equal(errs, want) {
+		t.Errorf("ConfigErrors() = %q, want %q", errs, want)
+	}
+}
+
+func TestReloadRefused(t *testing.T) {
+	stubRun(t, func(args string) (string, error) {
+		return "error: no such instance", nil
+	})
+	if err := Reload(); err == nil || !strings.Contains(err.Error(), "no such instance") {
+		t.Errorf("Reload() = %v, want the hyprctl response as the error", err)
+	}
+}
+
+func TestQueryReturnsLiveState(t *testing.T) {
+	canned := map[string]string{
+		"-j monitors":     `[{"id":0,"name":"DP-2","width":2560,"height":1440,"refreshRate":143.97,"scale":1.25,"focused":true}]`,
+		"-j workspaces":   `[{"id":1,"name":"1","monitor":"DP-2","windows":3},{"id":2,"name":"2","monitor":"DP-2","windows":0}]`,
+		"-j activewindow": `{"class":"kitty","title":"~/.config/hypr","workspace":{"id":1,"name":"1"}}`,
+	}
+	stubRun(t, func(args string) (string, error) {
+		if out, ok := canned[args]; ok {
+			return out, nil
+		}
+		return "", errors.New("unexpected call: " + args)
+	})
+
+	for _, sub := range []string{"monitors", "workspaces", "activewindow"} {
+		out, err := Query(sub)
+		if err != nil {
+			t.Fatalf("Query(%s): %v", sub, err)
+		}
+		if string(out) != canned["-j "+sub] {
+			t.Errorf("Query(%s) = %s, want hyprctl's output", sub, out)
+		}
+	}
+}
+
+func TestQueryFailures(t *testing.T) {
+	stubRun(t, func(args string) (string, error) {
+		if args == "-j monitors" {
+			return "HYPRLAND_INSTANCE_SIGNATURE not set!", nil
+		}
+		return "Couldn't connect to the socket", errors.New("exit status 1")
+	})
+
+	if _, err := Query("monitors"); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("Query(monitors) = %v, want the non-JSON output reported", err)
+	}
+	if _, err := Query("workspaces"); err == nil || !strings.Contains(err.Error(), "Couldn't connect to the socket") {
+		t.Errorf("Query(workspaces) = %v, want hyprctl's message", err)
+	}
+}
@@ -1,16 +1,59 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"regexp"
+	"strings"
 )
 
+// LogLevel is the severity of a log message
+type LogLevel int
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[LogLevel]string{
+	DebugLevel: "DEBUG",
+	InfoLevel:  "INFO",
+	WarnLevel:  "WARN",
+	ErrorLevel: "ERROR",
+}
+
+func (l LogLevel) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses "debug", "info", "warn" (or "warning") or "error"
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", s)
+}
+
 var DebugMode bool
 
+// Level is the threshold below which messages are dropped
+var Level = InfoLevel
+
 func Init() {
 	if os.Getenv("DEBUG") == "true" {
 		DebugMode = true
+		Level = DebugLevel
 	} else {
 		// By default, discard all logs to prevent TUI corruption
 		log.SetOutput(io.Discard)
@@ -22,14 +65,80 @@ func SetOutput(w io.Writer) {
 	log.SetOutput(w)
 }
 
-func Debug(format string, v ...interface{}) {
-	if DebugMode {
-		log.Printf("[DEBUG] "+format, v...)
+// logf writes a message tagged with its level if it meets the threshold
+func logf(level LogLevel, format string, v ...interface{}) {
+	if level < Level {
+		return
 	}
+	log.Print("[" + level.String() + "] " + Redact(fmt.Sprintf(format, v...)))
+}
+
+// redacted replaces secrets found in log messages and errors
+const redacted = "[REDACTED]"
+
+var (
+	// Secrets recognised by their shape: OpenAI, Anthropic and Groq keys, Google
+	// API keys and AWS access key IDs
+	secretPattern = regexp.MustCompile(`sk-[A-Za-z0-9_-]{6,}|gsk_[A-Za-z0-9]{20,}|AIza[0-9A-Za-z_-]{20,}|\b(AKIA|ASIA)[0-9A-Z]{16}\b`)
+
+	// Values of credential-looking fields, headers and query parameters
+	credentialPattern = regexp.MustCompile(`(?i)((?:api[_-]?key|access[_-]?key|secret(?:[_-]?access)?[_-]?key|session[_-]?token|x-amz-security-token|password|[?&]key)["']?\s*[:=]\s*["']?)[^\s"'&,}]+|(bearer\s+)[^\s"',}]+`)
+
+	// Long hex or base64 runs such as tokens and signatures
+	tokenPattern = regexp.MustCompile(`\b[0-9a-fA-F]{32,}\b|[A-Za-z0-9+/_-]{40,}={0,2}`)
+)
+
+// Redact masks API keys and other credentials in s
+func Redact(s string) string {
+	s = secretPattern.ReplaceAllString(s, redacted)
+	s = credentialPattern.ReplaceAllString(s, "${1}${2}"+redacted)
+	return tokenPattern.ReplaceAllStringFunc(s, func(tok string) string {
+		// Long words and paths are not tokens; real ones mix cases and digits
+		if strings.ContainsAny(tok, "0123456789") && strings.ToLower(tok) != tok && strings.ToUpper(tok) != tok || isHex(tok) {
+			return redacted
+		}
+		return tok
+	})
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// redactedError masks credentials in an error's message while keeping the
+// original for errors.Is and errors.As
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string { return Redact(e.err.Error()) }
+func (e redactedError) Unwrap() error { return e.err }
+
+// RedactError wraps err so that its message never shows credentials
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return redactedError{err}
+}
+
+func Debug(format string, v ...interface{}) {
+	logf(DebugLevel, format, v...)
 }
 
 func Info(format string, v ...interface{}) {
-	// Always log info if debug is enabled, or if we have a specific InfoMode?
-	// For now, let's just use standard log which goes to wherever SetOutput pointed it
-	log.Printf("[INFO] "+format, v...)
+	logf(InfoLevel, format, v...)
+}
+
+func Warn(format string, v ...interface{}) {
+	logf(WarnLevel, format, v...)
+}
+
+func Error(format string, v ...interface{}) {
+	logf(ErrorLevel, format, v...)
 }
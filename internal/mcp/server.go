@@ -0,0 +1,287 @@
+// Package mcp serves the agent's tools over the Model Context Protocol (MCP)
+// so that editors can call them directly. It speaks newline-delimited
+// JSON-RPC 2.0 over stdio and supports tools and elicitation, which is used to
+// ask the user before a tool writes anything.
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/reinhart/hyprAgent/internal/assistant"
+	"github.com/reinhart/hyprAgent/internal/logger"
+)
+
+// ProtocolVersion is the MCP revision this server implements
+const ProtocolVersion = "2025-06-18"
+
+// confirmTimeout bounds how long a tool waits for the user to answer
+const confirmTimeout = 5 * time.Minute
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type toolInfo struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"inputSchema"`
+}
+
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type callResult struct {
+	Content []textContent `json:"content"`
+	IsError bool          `json:"isError"`
+}
+
+// Server exposes the tools of a ToolRegistry as MCP tools
+type Server struct {
+	registry *assistant.ToolRegistry
+	version  string
+	// ReadOnly refuses mutating tools, as --dry-run does for the agent
+	ReadOnly bool
+
+	out     io.Writer
+	writeMu sync.Mutex
+	callMu  sync.Mutex // Tools run one at a time, like mutating tools in the agent
+
+	mu        sync.Mutex
+	nextID    int
+	pending   map[string]chan message // Responses to our requests, by ID
+	canElicit bool
+}
+
+// NewServer creates a server for the tools in registry
+func NewServer(registry *assistant.ToolRegistry, version string) *Server {
+	return &Server{
+		registry: registry,
+		version:  version,
+		pending:  make(map[string]chan message),
+	}
+}
+
+// Serve reads requests from r and writes responses to w until r is closed
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	var calls sync.WaitGroup
+	defer calls.Wait()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.respondError(nil, codeParseError, "invalid JSON: "+err.Error())
+			continue
+		}
+
+		switch {
+		case msg.Method == "" && msg.ID != nil:
+			s.deliver(msg)
+		case msg.Method == "tools/call":
+			// Run in the background so elicitation responses can still be read
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				s.handleCall(msg)
+			}()
+		default:
+			s.handle(msg)
+		}
+	}
+	return scanner.Err()
+}
+
+// handle answers every request except tools/call
+func (s *Server) handle(msg message) {
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			Capabilities struct {
+				Elicitation *json.RawMessage `json:"elicitation"`
+			} `json:"capabilities"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		s.mu.Lock()
+		s.canElicit = params.Capabilities.Elicitation != nil
+		s.mu.Unlock()
+
+		s.respond(msg.ID, map[string]interface{}{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "hyprAgent", "version": s.version},
+		})
+	case "ping":
+		s.respond(msg.ID, map[string]interface{}{})
+	case "tools/list":
+		tools := []toolInfo{}
+		for _, name := range s.registry.Names() {
+			t, _ := s.registry.Get(name)
+			def := t.Definition()
+			tools = append(tools, toolInfo{Name: def.Name, Description: def.Description, InputSchema: def.Parameters})
+		}
+		s.respond(msg.ID, map[string]interface{}{"tools": tools})
+	default:
+		if msg.ID == nil {
+			return // Notifications such as notifications/initialized need no answer
+		}
+		s.respondError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	}
+}
+
+func (s *Server) handleCall(msg message) {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.Name == "" {
+		s.respondError(msg.ID, codeInvalidParams, "tools/call needs a tool name")
+		return
+	}
+	if _, ok := s.registry.Get(params.Name); !ok {
+		s.respondError(msg.ID, codeInvalidParams, "unknown tool: "+params.Name)
+		return
+	}
+
+	args := string(params.Arguments)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+
+	var result callResult
+	if s.ReadOnly && s.registry.IsMutating(params.Name) {
+		result = callResult{Content: []textContent{{Type: "text", Text: fmt.Sprintf("%s was not run: the server is read-only (--dry-run).", params.Name)}}, IsError: true}
+	} else {
+		s.callMu.Lock()
+		output, err := s.registry.Call(params.Name, args)
+		s.callMu.Unlock()
+		if err != nil {
+			logger.Warn("MCP tool %s failed: %v", params.Name, err)
+			result = callResult{Content: []textContent{{Type: "text", Text: "Error: " + err.Error()}}, IsError: true}
+		} else {
+			result = callResult{Content: []textContent{{Type: "text", Text: output}}}
+		}
+	}
+	s.respond(msg.ID, result)
+}
+
+// Confirm asks the user to approve action through an MCP elicitation. It
+// declines when the client does not support elicitation or does not answer
+// in time. It can be used as the Confirm callback of writing tools.
+func (s *Server) Confirm(action string) bool {
+	s.mu.Lock()
+	if !s.canElicit || s.out == nil {
+		s.mu.Unlock()
+		logger.Info("MCP client cannot confirm changes; declined: %s", action)
+		return false
+	}
+	s.nextID++
+	id := fmt.Sprintf(`"confirm-%d"`, s.nextID)
+	reply := make(chan message, 1)
+	s.pending[id] = reply
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	params, _ := json.Marshal(map[string]interface{}{
+		"message": action + "\n\nApply this change?",
+		"requestedSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"approve": map[string]interface{}{"type": "boolean", "title": "Apply the change"},
+			},
+			"required": []string{"approve"},
+		},
+	})
+	s.write(message{JSONRPC: "2.0", ID: json.RawMessage(id), Method: "elicitation/create", Params: params})
+
+	select {
+	case resp := <-reply:
+		if resp.Error != nil {
+			return false
+		}
+		var result struct {
+			Action  string `json:"action"`
+			Content struct {
+				Approve bool `json:"approve"`
+			} `json:"content"`
+		}
+		if err := json.Unmarshal(resp.Result, &result); err != nil {
+			return false
+		}
+		return result.Action == "accept" && result.Content.Approve
+	case <-time.After(confirmTimeout):
+		return false
+	}
+}
+
+// deliver hands a response from the client to the request waiting for it
+func (s *Server) deliver(msg message) {
+	s.mu.Lock()
+	reply, ok := s.pending[string(msg.ID)]
+	s.mu.Unlock()
+	if ok {
+		reply <- msg
+	}
+}
+
+func (s *Server) respond(id json.RawMessage, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		s.respondError(id, codeInvalidRequest, err.Error())
+		return
+	}
+	s.write(message{JSONRPC: "2.0", ID: id, Result: data})
+}
+
+func (s *Server) respondError(id json.RawMessage, code int, msg string) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	s.write(message{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg}})
+}
+
+func (s *Server) write(msg message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("MCP: failed to encode message: %v", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
@@ -0,0 +1,128 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reinhart/hyprAgent/internal/assistant"
+	"github.com/reinhart/hyprAgent/internal/configuration"
+)
+
+// client talks to a Server over pipes, as an editor would over stdio
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Scanner
+	nextID int
+}
+
+// startServer serves registry for the rest of the test
+func startServer(t *testing.T, registry *assistant.ToolRegistry) *client {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(registry, "test").Serve(reqR, respW)
+		respW.Close()
+	}()
+	t.Cleanup(func() {
+		reqW.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() = %v", err)
+		}
+	})
+	return &client{t: t, in: reqW, out: bufio.NewScanner(respR)}
+}
+
+// call sends a request and decodes the result of its response into result
+func (c *client) call(method string, params interface{}, result interface{}) {
+	c.t.Helper()
+	c.nextID++
+	req, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	if _, err := fmt.Fprintf(c.in, "%s\n", req); err != nil {
+		c.t.Fatal(err)
+	}
+	if !c.out.Scan() {
+		c.t.Fatalf("no response to %s: %v", method, c.out.Err())
+	}
+	var resp message
+	if err := json.Unmarshal(c.out.Bytes(), &resp); err != nil {
+		c.t.Fatalf("invalid response to %s: %v", method, err)
+	}
+	if string(resp.ID) != fmt.Sprint(c.nextID) {
+		c.t.Fatalf("response ID %s, want %d", resp.ID, c.nextID)
+	}
+	if resp.Error != nil {
+		c.t.Fatalf("%s failed: %s", method, resp.Error.Message)
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		c.t.Fatalf("invalid result of %s: %v", method, err)
+	}
+}
+
+// notify sends a notification, which gets no response
+func (c *client) notify(method string) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.in, `{"jsonrpc":"2.0","method":%q}`+"\n", method); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestListAndCallTools(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, "hypr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "hypr", "hyprland.conf"), []byte("general:gaps_in = 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry := assistant.NewToolRegistry()
+	registry.Register(&assistant.ReadFileTool{Config: configuration.DefaultConfig(), Backend: configuration.NewNativeBackend()})
+	c := startServer(t, registry)
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	c.call("initialize", map[string]interface{}{"protocolVersion": ProtocolVersion, "capabilities": map[string]interface{}{}}, &init)
+	if init.ProtocolVersion != ProtocolVersion || init.ServerInfo.Name != "hyprAgent" {
+		t.Errorf("initialize = %+v", init)
+	}
+	c.notify("notifications/initialized")
+
+	var list struct {
+		Tools []struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			InputSchema struct {
+				Type       string                     `json:"type"`
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	c.call("tools/list", map[string]interface{}{}, &list)
+	if len(list.Tools) != 1 || list.Tools[0].Name != "read_file" {
+		t.Fatalf("tools/list = %+v, want read_file", list.Tools)
+	}
+	schema := list.Tools[0].InputSchema
+	if schema.Type != "object" || schema.Properties["path"] == nil || len(schema.Required) != 1 || schema.Required[0] != "path" {
+		t.Errorf("read_file schema = %+v, want a required path", schema)
+	}
+
+	var result callResult
+	c.call("tools/call", map[string]interface{}{"name": "read_file", "arguments": map[string]string{"path": "hyprland.conf"}}, &result)
+	if result.IsError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, "gaps_in = 5") {
+		t.Errorf("tools/call = %+v, want the file content", result)
+	}
+}
@@ -0,0 +1,192 @@
+package safety
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Export writes the given snapshot, manifest included, to destPath as a
+// .tar.gz that Import can read on another machine
+func (s *SnapshotService) Export(id, destPath string) error {
+	manifest, err := s.ReadManifest(id)
+	if err != nil {
+		return err
+	}
+	snapshotDir := filepath.Join(s.BackupDir, id)
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", destPath, err)
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	err = addToArchive(tw, snapshotDir, ManifestFile)
+	for _, entry := range manifest.Files {
+		if err != nil {
+			break
+		}
+		err = addToArchive(tw, snapshotDir, entry.Stored)
+	}
+	for _, closeErr := range []error{tw.Close(), gz.Close(), out.Close()} {
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return fmt.Errorf("failed to export snapshot %s: %w", id, err)
+	}
+	return nil
+}
+
+// addToArchive adds the file at the slash-separated path name inside dir
+func addToArchive(tw *tar.Writer, dir, name string) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import adds the snapshot in an archive written by Export to the backup
+// directory and returns its ID. The snapshot gets a new ID as if it had just
+// been taken, so it is the latest one and pruning does not remove it at once.
+// Its files are restored under this machine's config root rather than the
+// exporting machine's; archives holding files from outside the config root
+// (e.g. companion app configs) are refused, since their paths would be the
+// exporting machine's.
+func (s *SnapshotService) Import(srcPath string) (string, error) {
+	if s.Root == "" {
+		return "", fmt.Errorf("no Hyprland config root to import the snapshot into")
+	}
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a snapshot archive: %w", srcPath, err)
+	}
+	defer gz.Close()
+
+	// Unpack next to the snapshots, so the final rename cannot cross filesystems
+	tmpDir, err := os.MkdirTemp(s.BackupDir, ".import-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractArchive(tar.NewReader(gz), tmpDir); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, ManifestFile))
+	if err != nil {
+		return "", fmt.Errorf("%s has no snapshot manifest", srcPath)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("invalid manifest in %s: %w", srcPath, err)
+	}
+	for i, entry := range manifest.Files {
+		if !filepath.IsLocal(filepath.FromSlash(entry.Stored)) {
+			return "", fmt.Errorf("invalid stored path %q in %s", entry.Stored, srcPath)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(entry.Stored))); err != nil {
+			return "", fmt.Errorf("%s is missing %s", srcPath, entry.Stored)
+		}
+		rel, ok := strings.CutPrefix(entry.Stored, "files/")
+		if !ok {
+			return "", fmt.Errorf("%s contains %s, which is outside the Hyprland config root; only config files can be imported", srcPath, entry.Original)
+		}
+		manifest.Files[i].Original = filepath.Join(s.Root, filepath.FromSlash(rel))
+	}
+
+	now := time.Now()
+	label := "imported"
+	if manifest.ID != "" {
+		label += " " + manifest.ID
+	}
+	if manifest.Label != "" {
+		label += ": " + manifest.Label
+	}
+	id := s.newID(now)
+	manifest.ID, manifest.CreatedAt, manifest.Label = id, now, label
+
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ManifestFile), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmpDir, filepath.Join(s.BackupDir, id)); err != nil {
+		return "", fmt.Errorf("failed to import snapshot: %w", err)
+	}
+	return id, nil
+}
+
+// extractArchive unpacks the regular files of an archive into dir, refusing
+// any path that would land outside it
+func extractArchive(tr *tar.Reader, dir string) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected entry %s in archive", header.Name)
+		}
+		name := filepath.FromSlash(path.Clean(header.Name))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("unsafe path %s in archive", header.Name)
+		}
+
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package safety
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := newTestService(t)
+	main := filepath.Join(src.Root, "hyprland.conf")
+	binds := filepath.Join(src.Root, "conf", "binds.conf")
+	writeFile(t, main, "source = conf/binds.conf\n")
+	writeFile(t, binds, "bind = SUPER, Q, killactive\n")
+	id, err := src.CreateSnapshot([]string{main, binds}, "known good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	if err := src.Export(id, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another machine, whose backups already hold a snapshot taken later
+	// than the one being imported
+	dst := newTestService(t)
+	writeFile(t, filepath.Join(dst.Root, "hyprland.conf"), "general:gaps_in = 5\n")
+	time.Sleep(time.Second) // IDs have one-second resolution
+	if _, err := dst.CreateSnapshot([]string{filepath.Join(dst.Root, "hyprland.conf")}, "local"); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := dst.Import(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := dst.Latest(); err != nil || latest != imported {
+		t.Errorf("Latest() = %q, %v; want the imported snapshot %s", latest, err, imported)
+	}
+	if deleted, err := dst.Prune(1, time.Hour); err != nil || len(deleted) != 1 || deleted[0] == imported {
+		t.Errorf("Prune deleted %v, %v; want only the local snapshot", deleted, err)
+	}
+
+	manifest, err := dst.ReadManifest(imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Label != "imported "+id+": known good" {
+		t.Errorf("label = %q", manifest.Label)
+	}
+
+	restored, err := dst.Restore(imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("restored %v, want both files", restored)
+	}
+	// Under this machine's config root, not the exporting one's
+	assertContent(t, filepath.Join(dst.Root, "hyprland.conf"), "source = conf/binds.conf\n")
+	assertContent(t, filepath.Join(dst.Root, "conf", "binds.conf"), "bind = SUPER, Q, killactive\n")
+}
+
+func TestImportRefusesFilesOutsideConfigRoot(t *testing.T) {
+	src := newTestService(t)
+	external := filepath.Join(t.TempDir(), "waybar", "config")
+	writeFile(t, external, "{}\n")
+	id, err := src.CreateSnapshot([]string{external}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	if err := src.Export(id, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestService(t)
+	if _, err := dst.Import(archive); err == nil {
+		t.Fatal("expected an archive with an external file to be refused")
+	}
+	if list, err := dst.List(); err != nil || len(list) != 0 {
+		t.Errorf("List() = %v, %v; want no snapshots after a refused import", list, err)
+	}
+}
@@ -0,0 +1,61 @@
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotGitRepo is returned by GitCommit when the directory is not inside a
+// git work tree
+var ErrNotGitRepo = errors.New("not a git repository")
+
+// ErrNothingToCommit is returned by GitCommit when the files have no changes
+var ErrNothingToCommit = errors.New("nothing to commit")
+
+// runGit executes git in dir and returns its trimmed output
+var runGit = func(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GitCommit stages files and commits them in the repository containing dir,
+// returning the short hash of the new commit. Only the given files are
+// committed, so unrelated work in the repository is left alone.
+func GitCommit(dir string, files []string, message string) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", fmt.Errorf("git is not installed or not on PATH")
+	}
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return "", ErrNotGitRepo
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files to commit")
+	}
+
+	paths := make([]string, len(files))
+	for i, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return "", err
+		}
+		paths[i] = abs
+	}
+
+	if _, err := runGit(dir, append([]string{"add", "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	if _, err := runGit(dir, append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...); err == nil {
+		return "", ErrNothingToCommit
+	}
+	if _, err := runGit(dir, append([]string{"commit", "-m", message, "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	return runGit(dir, "rev-parse", "--short", "HEAD")
+}
@@ -0,0 +1,76 @@
+package safety
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testRepo creates a git repository in a temp directory, with an identity of
+// its own so the user's git config is never read
+func testRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	dir := t.TempDir()
+	if _, err := runGit(dir, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGitCommitStagesOnlyGivenFiles(t *testing.T) {
+	dir := testRepo(t)
+	main := filepath.Join(dir, "hyprland.conf")
+	binds := filepath.Join(dir, "conf", "binds.conf")
+	other := filepath.Join(dir, "notes.txt")
+	writeFile(t, main, "general:gaps_in = 5\n")
+	writeFile(t, binds, "bind = SUPER, Q, killactive\n")
+	writeFile(t, other, "work in progress\n")
+
+	hash, err := GitCommit(dir, []string{main, binds}, "Set gaps to 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := runGit(dir, "rev-parse", "--short", "HEAD"); hash != head {
+		t.Errorf("GitCommit() = %q, want HEAD %q", hash, head)
+	}
+	if msg, _ := runGit(dir, "log", "-1", "--format=%s"); msg != "Set gaps to 5" {
+		t.Errorf("commit message = %q", msg)
+	}
+	out, err := runGit(dir, "show", "--name-only", "--format=", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := strings.Split(out, "\n"); !slices.Equal(files, []string{"conf/binds.conf", "hyprland.conf"}) {
+		t.Errorf("committed files = %v", files)
+	}
+	if status, _ := runGit(dir, "status", "--porcelain"); status != "?? notes.txt" {
+		t.Errorf("status after commit = %q, want notes.txt left untracked", status)
+	}
+
+	if _, err := GitCommit(dir, []string{main}, "Again"); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("committing an unchanged file = %v, want ErrNothingToCommit", err)
+	}
+}
+
+func TestGitCommitOutsideRepo(t *testing.T) {
+	testRepo(t) // for the isolated git config
+	dir := t.TempDir()
+	// Do not find a repository the temp directory itself happens to be in
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	writeFile(t, filepath.Join(dir, "hyprland.conf"), "")
+	if _, err := GitCommit(dir, []string{filepath.Join(dir, "hyprland.conf")}, "Change"); !errors.Is(err, ErrNotGitRepo) {
+		t.Errorf("GitCommit() outside a repository = %v, want ErrNotGitRepo", err)
+	}
+}
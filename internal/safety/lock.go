@@ -0,0 +1,92 @@
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LockFile is the name of the config lock inside the data directory
+const LockFile = "hyprAgent.lock"
+
+// ConfigLock is an advisory lock that keeps two hyprAgent instances from
+// snapshotting and writing the same files at once. It is only held while a
+// change is being made, so other instances can still read the config and
+// propose changes in the meantime. The holder's PID is written to the lock
+// file so the other instances can name it.
+type ConfigLock struct {
+	Path string
+}
+
+func NewConfigLock(path string) *ConfigLock {
+	return &ConfigLock{Path: path}
+}
+
+// LockedError is returned by Acquire when another process holds the lock
+type LockedError struct {
+	PID int // Zero if the holder has not written its PID yet
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return "another hyprAgent instance is changing the config; try again once it has finished"
+	}
+	return fmt.Sprintf("another hyprAgent instance (PID %d) is changing the config; try again once it has finished", e.PID)
+}
+
+// Acquire takes the lock, waiting up to wait for another process to release
+// it, and returns the function that releases it. It is safe to call on a nil
+// lock, which never blocks.
+func (l *ConfigLock) Acquire(wait time.Duration) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(l.Path), err)
+	}
+	f, err := os.OpenFile(l.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", l.Path, err)
+		}
+		if !time.Now().Before(deadline) {
+			pid := readPID(f)
+			f.Close()
+			return nil, &LockedError{PID: pid}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// The PID is only informative, so failing to write it does not matter
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() {
+		f.Truncate(0)
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// readPID reads the PID the holder of the lock wrote to it
+func readPID(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	return pid
+}
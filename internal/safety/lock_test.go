@@ -0,0 +1,79 @@
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigLockRefusesSecondHolder(t *testing.T) {
+	lock := NewConfigLock(filepath.Join(t.TempDir(), "state", LockFile))
+	release, err := lock.Acquire(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flock is per open file, so a second acquisition conflicts even in the
+	// same process, as another instance's would
+	done := make(chan error)
+	go func() {
+		_, err := lock.Acquire(0)
+		done <- err
+	}()
+	err = <-done
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.PID != os.Getpid() {
+		t.Fatalf("second Acquire() = %v, want a LockedError naming PID %d", err, os.Getpid())
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("PID %d", os.Getpid())) {
+		t.Errorf("error = %q, want the holder's PID", err)
+	}
+
+	release()
+	again, err := lock.Acquire(0)
+	if err != nil {
+		t.Fatalf("Acquire() after release = %v", err)
+	}
+	again()
+}
+
+func TestConfigLockWaitsForRelease(t *testing.T) {
+	lock := NewConfigLock(filepath.Join(t.TempDir(), LockFile))
+	release, err := lock.Acquire(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const held = 200 * time.Millisecond
+	start := time.Now()
+	done := make(chan error)
+	go func() {
+		release, err := lock.Acquire(5 * time.Second)
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	time.Sleep(held)
+	release()
+
+	if err := <-done; err != nil {
+		t.Fatalf("waiting Acquire() = %v, want the lock once it was released", err)
+	}
+	if waited := time.Since(start); waited < held {
+		t.Errorf("Acquire() returned after %s, before the lock was released", waited)
+	}
+}
+
+func TestNilConfigLockNeverBlocks(t *testing.T) {
+	var lock *ConfigLock
+	release, err := lock.Acquire(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
@@ -1,76 +1,380 @@
 package safety
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/reinhart/hyprAgent/internal/configuration"
 )
 
 type SnapshotService struct {
 	BackupDir string
+	// Root is the Hyprland config root. Files under it keep their relative
+	// path inside a snapshot; others are stored by their absolute path.
+	Root string
+	// MaxSnapshots and MaxAge bound the snapshots kept after each new one is
+	// created; zero disables the limit
+	MaxSnapshots int
+	MaxAge       time.Duration
+	// AllowRestore decides whether a snapshot may write a file back to its
+	// absolute path, returning why not otherwise. When nil, only files under
+	// Root are restored.
+	AllowRestore func(path string) error
 }
 
+// NewSnapshotService stores snapshots in backupDir, normally
+// Config.DataSubdir("backups")
 func NewSnapshotService(backupDir string) (*SnapshotService, error) {
 	if backupDir == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, err
-		}
-		backupDir = filepath.Join(home, ".local", "share", "hyprAgent", "backups")
+		return nil, fmt.Errorf("no backup directory given")
 	}
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return nil, err
 	}
-	return &SnapshotService{BackupDir: backupDir}, nil
+	root, err := configuration.HyprConfigRoot()
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotService{BackupDir: backupDir, Root: root}, nil
 }
 
-// CreateSnapshot creates a backup of the specified files
-func (s *SnapshotService) CreateSnapshot(files []string) (string, error) {
-	id := time.Now().Format("20060102-150405")
+// snapshotIDFormat is the time layout used for snapshot directory names
+const snapshotIDFormat = "20060102-150405"
+
+// ManifestFile is the name of the file describing a snapshot's contents
+const ManifestFile = "manifest.json"
+
+// ManifestEntry maps a file's original location to its copy in the snapshot
+type ManifestEntry struct {
+	Original string `json:"original"` // Absolute path the file was copied from
+	Stored   string `json:"stored"`   // Slash-separated path inside the snapshot directory
+}
+
+// Manifest records what a snapshot contains so it can be restored in place
+type Manifest struct {
+	ID        string          `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Label     string          `json:"label,omitempty"` // The change the snapshot was taken before
+	Files     []ManifestEntry `json:"files"`
+}
+
+// CreateSnapshot creates a backup of the specified files. label describes
+// the change about to be made, so the snapshot can be recognised later.
+func (s *SnapshotService) CreateSnapshot(files []string, label string) (string, error) {
+	now := time.Now()
+	id := s.newID(now)
 	snapshotDir := filepath.Join(s.BackupDir, id)
 	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
 		return "", err
 	}
 
+	manifest := Manifest{ID: id, CreatedAt: now, Label: label}
+	seen := make(map[string]bool)
 	for _, src := range files {
-		// Determine destination path inside snapshot
-		// We flatly store them or mimic structure?
-		// For simplicity, flat storage with name handling or preserving relative structure is hard.
-		// Let's just store basenames for MVP, assuming unique filenames or single main config.
-		// If we have multiple files, this needs better logic (e.g., storing metadata).
-		base := filepath.Base(src)
-		dst := filepath.Join(snapshotDir, base)
-
-		if err := copyFile(src, dst); err != nil {
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", src, err)
+		}
+		stored := s.storedPath(abs)
+		if seen[stored] {
+			continue
+		}
+		seen[stored] = true
+		if err := copyFile(abs, filepath.Join(snapshotDir, filepath.FromSlash(stored))); err != nil {
 			return "", fmt.Errorf("failed to copy %s: %w", src, err)
 		}
+		manifest.Files = append(manifest.Files, ManifestEntry{Original: abs, Stored: stored})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(snapshotDir, ManifestFile), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
 	}
+
+	// The new snapshot is already safe; failing to clean up old ones is not an error
+	_, _ = s.Prune(s.MaxSnapshots, s.MaxAge)
 	return id, nil
 }
 
-// Restore restores the files from the snapshot
-func (s *SnapshotService) Restore(id string, targetFiles []string) error {
+// newID returns an unused snapshot ID for the given time. Several writes can
+// happen within the same second, so a snapshot is never reused.
+func (s *SnapshotService) newID(at time.Time) string {
+	id := at.Format(snapshotIDFormat)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(s.BackupDir, id)); os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", at.Format(snapshotIDFormat), n)
+	}
+}
+
+// Prune deletes snapshots beyond the newest keep, and snapshots older than
+// maxAge. Zero disables either limit. The most recent snapshot is always kept,
+// however old. It returns the IDs of the deleted snapshots.
+func (s *SnapshotService) Prune(keep int, maxAge time.Duration) ([]string, error) {
+	if keep <= 0 && maxAge <= 0 {
+		return nil, nil
+	}
+	infos, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var deleted []string
+	for i, info := range infos {
+		if i == 0 {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && now.Sub(info.CreatedAt) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.BackupDir, info.ID)); err != nil {
+			return deleted, fmt.Errorf("failed to delete snapshot %s: %w", info.ID, err)
+		}
+		deleted = append(deleted, info.ID)
+	}
+	return deleted, nil
+}
+
+// storedPath returns where a file is kept inside a snapshot: files/<path
+// relative to Root> for config files, external/<absolute path> for the rest
+// (e.g. companion app configs). Both mirror the directory structure, so files
+// with the same name in different directories never collide.
+func (s *SnapshotService) storedPath(abs string) string {
+	if s.Root != "" {
+		if rel, err := filepath.Rel(s.Root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "files/" + filepath.ToSlash(rel)
+		}
+	}
+	return "external/" + strings.TrimPrefix(filepath.ToSlash(abs), "/")
+}
+
+// ReadManifest loads the manifest of the given snapshot. Only IDs of the form
+// CreateSnapshot generates are accepted, so an ID can never name a directory
+// outside BackupDir.
+func (s *SnapshotService) ReadManifest(id string) (*Manifest, error) {
+	if _, _, ok := parseSnapshotID(id); !ok {
+		return nil, fmt.Errorf("invalid snapshot ID %q", id)
+	}
 	snapshotDir := filepath.Join(s.BackupDir, id)
 	if _, err := os.Stat(snapshotDir); os.IsNotExist(err) {
-		return fmt.Errorf("snapshot %s not found", id)
+		return nil, fmt.Errorf("snapshot %s not found", id)
 	}
 
-	// This simplistic restore assumes targetFiles match what's in snapshot by name
-	// In a real system, we need a manifest.
-	for _, target := range targetFiles {
-		base := filepath.Base(target)
-		src := filepath.Join(snapshotDir, base)
-		if _, err := os.Stat(src); err == nil {
-			if err := copyFile(src, target); err != nil {
-				return fmt.Errorf("failed to restore %s: %w", target, err)
-			}
+	data, err := os.ReadFile(filepath.Join(snapshotDir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s has no readable manifest: %w", id, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest in snapshot %s: %w", id, err)
+	}
+	return &manifest, nil
+}
+
+// Restore writes every file in the snapshot back to the location recorded in
+// its manifest and returns the restored paths. Every entry is checked before
+// anything is written, so a manifest naming a file that may not be written
+// restores nothing.
+func (s *SnapshotService) Restore(id string) ([]string, error) {
+	manifest, err := s.ReadManifest(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Files {
+		if err := s.checkEntry(entry); err != nil {
+			return nil, err
 		}
 	}
+
+	snapshotDir := filepath.Join(s.BackupDir, id)
+	var restored []string
+	for _, entry := range manifest.Files {
+		if err := restoreEntry(snapshotDir, entry); err != nil {
+			return restored, err
+		}
+		restored = append(restored, entry.Original)
+	}
+	return restored, nil
+}
+
+// RestoreFile copies one file of the snapshot back to its original location,
+// leaving the others alone. It reports false if the snapshot does not
+// contain path.
+func (s *SnapshotService) RestoreFile(id, path string) (bool, error) {
+	manifest, err := s.ReadManifest(id)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range manifest.Files {
+		if entry.Original != path {
+			continue
+		}
+		if err := s.checkEntry(entry); err != nil {
+			return false, err
+		}
+		if err := restoreEntry(filepath.Join(s.BackupDir, id), entry); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// checkEntry refuses manifest entries that would read from outside the
+// snapshot or write somewhere AllowRestore (or Root, without it) does not
+// permit. Manifests are plain files, and imported ones come from elsewhere.
+func (s *SnapshotService) checkEntry(entry ManifestEntry) error {
+	if !filepath.IsLocal(filepath.FromSlash(entry.Stored)) {
+		return fmt.Errorf("refusing to restore %s: stored path %q is outside the snapshot", entry.Original, entry.Stored)
+	}
+	if !filepath.IsAbs(entry.Original) || filepath.Clean(entry.Original) != entry.Original {
+		return fmt.Errorf("refusing to restore %q: not a clean absolute path", entry.Original)
+	}
+	if s.AllowRestore != nil {
+		if err := s.AllowRestore(entry.Original); err != nil {
+			return fmt.Errorf("refusing to restore %s: %w", entry.Original, err)
+		}
+		return nil
+	}
+	if s.Root == "" || !strings.HasPrefix(s.storedPath(entry.Original), "files/") {
+		return fmt.Errorf("refusing to restore %s: it is outside the Hyprland config root", entry.Original)
+	}
 	return nil
 }
 
+// restoreEntry writes one stored file back atomically, so a failed restore
+// never leaves a half-written config behind
+func restoreEntry(snapshotDir string, entry ManifestEntry) error {
+	src := filepath.Join(snapshotDir, filepath.FromSlash(entry.Stored))
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.Original, err)
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(src); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Original), 0755); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.Original, err)
+	}
+	if err := configuration.WriteFileAtomic(entry.Original, data, perm); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.Original, err)
+	}
+	return nil
+}
+
+// SnapshotInfo summarises one snapshot for listing
+type SnapshotInfo struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Label      string    `json:"label,omitempty"`
+	Files      []string  `json:"files"`      // Original paths, or stored names for snapshots without a manifest
+	Restorable bool      `json:"restorable"` // False for old snapshots taken before manifests existed
+	at         time.Time // Parsed from the ID, for ordering
+	seq        int
+}
+
+// List returns all snapshots, newest first
+func (s *SnapshotService) List() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(s.BackupDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory %s: %w", s.BackupDir, err)
+	}
+
+	var infos []SnapshotInfo
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		at, seq, ok := parseSnapshotID(e.Name())
+		if !ok {
+			continue
+		}
+		info := SnapshotInfo{ID: e.Name(), CreatedAt: at, at: at, seq: seq}
+
+		if m, err := s.ReadManifest(e.Name()); err == nil {
+			info.Restorable = true
+			info.Label = m.Label
+			if !m.CreatedAt.IsZero() {
+				info.CreatedAt = m.CreatedAt
+			}
+			for _, f := range m.Files {
+				info.Files = append(info.Files, f.Original)
+			}
+		} else {
+			stored, _ := os.ReadDir(filepath.Join(s.BackupDir, e.Name()))
+			for _, f := range stored {
+				info.Files = append(info.Files, f.Name())
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	// IDs have one-second resolution, so same-second snapshots are ordered by sequence
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].at.Equal(infos[j].at) {
+			return infos[i].at.After(infos[j].at)
+		}
+		return infos[i].seq > infos[j].seq
+	})
+	return infos, nil
+}
+
+// Latest returns the ID of the most recent restorable snapshot. Directory
+// names are parsed as snapshot timestamps, so unrelated directories are ignored
+// and same-second snapshots (-2, -3, ...) are ordered correctly.
+func (s *SnapshotService) Latest() (string, error) {
+	infos, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		if info.Restorable {
+			return info.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no snapshots found in %s; nothing has been backed up yet", s.BackupDir)
+}
+
+// parseSnapshotID splits an ID like 20060102-150405 or 20060102-150405-2 into
+// its timestamp and same-second sequence number
+func parseSnapshotID(id string) (time.Time, int, bool) {
+	if len(id) < len(snapshotIDFormat) {
+		return time.Time{}, 0, false
+	}
+	at, err := time.ParseInLocation(snapshotIDFormat, id[:len(snapshotIDFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	rest := id[len(snapshotIDFormat):]
+	if rest == "" {
+		return at, 1, true
+	}
+	if !strings.HasPrefix(rest, "-") {
+		return time.Time{}, 0, false
+	}
+	seq, err := strconv.Atoi(rest[1:])
+	if err != nil || seq < 2 {
+		return time.Time{}, 0, false
+	}
+	return at, seq, true
+}
+
 func copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
@@ -78,6 +382,9 @@ func copyFile(src, dst string) error {
 	}
 	defer sourceFile.Close()
 
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
 	destFile, err := os.Create(dst)
 	if err != nil {
 		return err
@@ -87,6 +394,3 @@ func copyFile(src, dst string) error {
 	_, err = io.Copy(destFile, sourceFile)
 	return err
 }
-
-
-
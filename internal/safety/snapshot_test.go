@@ -0,0 +1,349 @@
+package safety
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestService returns a service with its own backup directory and config
+// root, so tests never touch the real ones
+func newTestService(t *testing.T) *SnapshotService {
+	t.Helper()
+	dir := t.TempDir()
+	s := &SnapshotService{BackupDir: filepath.Join(dir, "backups"), Root: filepath.Join(dir, "hypr")}
+	if err := os.MkdirAll(s.BackupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// writeFile creates path with content, making its directory as needed
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertContent fails unless path holds exactly want
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+}
+
+func TestRestoreFilesInTwoDirectories(t *testing.T) {
+	s := newTestService(t)
+	// Same name in both, so restoring by basename would mix them up
+	main := filepath.Join(s.Root, "hyprland.conf")
+	theme := filepath.Join(s.Root, "themes", "hyprland.conf")
+	writeFile(t, main, "general:gaps_in = 5\n")
+	writeFile(t, theme, "decoration:rounding = 10\n")
+
+	id, err := s.CreateSnapshot([]string{main, theme}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, main, "general:gaps_in = 20\n")
+	writeFile(t, theme, "decoration:rounding = 0\n")
+
+	restored, err := s.Restore(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("restored %v, want both files", restored)
+	}
+	assertContent(t, main, "general:gaps_in = 5\n")
+	assertContent(t, theme, "decoration:rounding = 10\n")
+}
+
+func TestSnapshotMirrorsDirectories(t *testing.T) {
+	s := newTestService(t)
+	companions := t.TempDir()
+	s.AllowRestore = func(path string) error { return nil }
+	files := map[string]string{
+		filepath.Join(s.Root, "hyprland.conf"):             "general:gaps_in = 5\n",
+		filepath.Join(s.Root, "conf", "hyprland.conf"):     "decoration:rounding = 10\n",
+		filepath.Join(companions, "waybar", "config.conf"): "layer = top\n",
+		filepath.Join(companions, "mako", "config.conf"):   "font = monospace 10\n",
+	}
+	var paths []string
+	for path, content := range files {
+		writeFile(t, path, content)
+		paths = append(paths, path)
+	}
+
+	id, err := s.CreateSnapshot(paths, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.ReadManifest(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := make(map[string]bool)
+	for _, entry := range m.Files {
+		stored[entry.Stored] = true
+	}
+	if len(stored) != len(files) || !stored["files/hyprland.conf"] || !stored["files/conf/hyprland.conf"] {
+		t.Errorf("stored as %v, want one entry per file mirroring its directory", m.Files)
+	}
+
+	// Each file comes back from its own copy
+	for path := range files {
+		writeFile(t, path, "changed\n")
+	}
+	for path, content := range files {
+		ok, err := s.RestoreFile(id, path)
+		if err != nil || !ok {
+			t.Fatalf("RestoreFile(%s) = %v, %v", path, ok, err)
+		}
+		assertContent(t, path, content)
+	}
+}
+
+func TestRestoreRejectsIDsOutsideBackupDir(t *testing.T) {
+	s := newTestService(t)
+	writeFile(t, filepath.Join(s.Root, "hyprland.conf"), "a\n")
+	id, err := s.CreateSnapshot([]string{filepath.Join(s.Root, "hyprland.conf")}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{"../backups/" + id, id + "/..", "manifest"} {
+		if _, err := s.Restore(bad); err == nil {
+			t.Errorf("Restore(%q) succeeded, want an invalid ID error", bad)
+		}
+		if _, err := s.RestoreFile(bad, filepath.Join(s.Root, "hyprland.conf")); err == nil {
+			t.Errorf("RestoreFile(%q) succeeded, want an invalid ID error", bad)
+		}
+	}
+}
+
+func TestRestoreRefusesPathsThatAreNotAllowed(t *testing.T) {
+	s := newTestService(t)
+	inside := filepath.Join(s.Root, "hyprland.conf")
+	writeFile(t, inside, "original\n")
+	id, err := s.CreateSnapshot([]string{inside}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A tampered manifest pointing the stored file somewhere else
+	outside := filepath.Join(t.TempDir(), "bashrc")
+	writeFile(t, outside, "untouched\n")
+	manifest, err := s.ReadManifest(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Files = append(manifest.Files, ManifestEntry{Original: outside, Stored: manifest.Files[0].Stored})
+	data, _ := json.Marshal(manifest)
+	writeFile(t, filepath.Join(s.BackupDir, id, ManifestFile), string(data))
+	writeFile(t, inside, "changed\n")
+
+	if _, err := s.Restore(id); err == nil {
+		t.Fatal("expected a file outside the config root to be refused")
+	}
+	// Nothing is written when any entry is refused
+	assertContent(t, inside, "changed\n")
+	assertContent(t, outside, "untouched\n")
+
+	s.AllowRestore = func(string) error { return nil }
+	if _, err := s.Restore(id); err != nil {
+		t.Fatalf("restore allowed by AllowRestore failed: %v", err)
+	}
+	assertContent(t, outside, "original\n")
+}
+
+// writeSnapshot stores a snapshot of files under the given ID, so tests
+// control its timestamp
+func writeSnapshot(t *testing.T, s *SnapshotService, id, label string, files ...string) {
+	t.Helper()
+	at, _, ok := parseSnapshotID(id)
+	if !ok {
+		t.Fatalf("bad snapshot ID %q", id)
+	}
+	m := Manifest{ID: id, CreatedAt: at, Label: label}
+	for _, f := range files {
+		stored := s.storedPath(f)
+		writeFile(t, filepath.Join(s.BackupDir, id, filepath.FromSlash(stored)), "copy of "+f)
+		m.Files = append(m.Files, ManifestEntry{Original: f, Stored: stored})
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(s.BackupDir, id, ManifestFile), string(data))
+}
+
+func TestLatestReturnsNewestSnapshot(t *testing.T) {
+	s := newTestService(t)
+	conf := filepath.Join(s.Root, "hyprland.conf")
+	// Created out of order, with two in the same second
+	writeSnapshot(t, s, "20260301-120000", "gaps", conf)
+	writeSnapshot(t, s, "20260301-120500", "border", conf)
+	writeSnapshot(t, s, "20260301-120500-2", "rounding", conf)
+	writeSnapshot(t, s, "20260228-235959", "blur", conf)
+	// An unrelated directory, and a newer snapshot that cannot be restored
+	writeFile(t, filepath.Join(s.BackupDir, "notes", "todo.txt"), "")
+	writeFile(t, filepath.Join(s.BackupDir, "20991231-000000", "hyprland.conf"), "no manifest")
+
+	latest, err := s.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != "20260301-120500-2" {
+		t.Errorf("Latest() = %s, want 20260301-120500-2", latest)
+	}
+}
+
+func TestLatestWithoutSnapshots(t *testing.T) {
+	if _, err := newTestService(t).Latest(); err == nil {
+		t.Error("Latest() succeeded with no snapshots")
+	}
+}
+
+func TestListNewestFirstWithFiles(t *testing.T) {
+	s := newTestService(t)
+	main := filepath.Join(s.Root, "hyprland.conf")
+	anims := filepath.Join(s.Root, "conf", "animations.conf")
+	writeFile(t, main, "general:gaps_in = 5\n")
+	writeFile(t, anims, "animations:enabled = true\n")
+
+	first, err := s.CreateSnapshot([]string{main}, "Set gaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Usually taken within the same second, so ordered by sequence number
+	second, err := s.CreateSnapshot([]string{main, anims}, "Tweak animations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != second || list[1].ID != first {
+		t.Fatalf("List() = %+v, want %s then %s", list, second, first)
+	}
+	if !slices.Equal(list[0].Files, []string{main, anims}) || !slices.Equal(list[1].Files, []string{main}) {
+		t.Errorf("files = %v and %v", list[0].Files, list[1].Files)
+	}
+	if !list[0].Restorable || list[0].Label != "Tweak animations" {
+		t.Errorf("newest = %+v, want it restorable and labelled", list[0])
+	}
+}
+
+func TestSnapshotLabelRoundTrips(t *testing.T) {
+	s := newTestService(t)
+	main := filepath.Join(s.Root, "hyprland.conf")
+	writeFile(t, main, "general:gaps_in = 5\n")
+	const label = "Apply patch to hyprland.conf: \"fix my gaps\"\n(second try)"
+
+	labelled, err := s.CreateSnapshot([]string{main}, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := s.CreateSnapshot([]string{main}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]string)
+	for _, info := range list {
+		labels[info.ID] = info.Label
+	}
+	if labels[labelled] != label || labels[plain] != "" {
+		t.Errorf("listed labels = %q", labels)
+	}
+	m, err := s.ReadManifest(labelled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Label != label {
+		t.Errorf("manifest label = %q, want %q", m.Label, label)
+	}
+}
+
+// snapshotIDs returns the IDs s lists, newest first
+func snapshotIDs(t *testing.T, s *SnapshotService) []string {
+	t.Helper()
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(list))
+	for i, info := range list {
+		ids[i] = info.ID
+	}
+	return ids
+}
+
+func TestPruneKeepsNewest(t *testing.T) {
+	s := newTestService(t)
+	conf := filepath.Join(s.Root, "hyprland.conf")
+	for _, id := range []string{"20260301-120000", "20260301-120100", "20260301-120200", "20260301-120300", "20260301-120400"} {
+		writeSnapshot(t, s, id, "", conf)
+	}
+
+	deleted, err := s.Prune(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20260301-120100", "20260301-120000"}; !slices.Equal(deleted, want) {
+		t.Errorf("Prune(3) deleted %v, want %v", deleted, want)
+	}
+	if got, want := snapshotIDs(t, s), []string{"20260301-120400", "20260301-120300", "20260301-120200"}; !slices.Equal(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+}
+
+func TestPruneByAgeKeepsLatest(t *testing.T) {
+	s := newTestService(t)
+	conf := filepath.Join(s.Root, "hyprland.conf")
+	// All of them are far older than the limit
+	writeSnapshot(t, s, "20200101-000000", "", conf)
+	writeSnapshot(t, s, "20200102-000000", "", conf)
+
+	if _, err := s.Prune(0, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotIDs(t, s); !slices.Equal(got, []string{"20200102-000000"}) {
+		t.Errorf("kept %v, want only the latest", got)
+	}
+}
+
+func TestCreateSnapshotPrunes(t *testing.T) {
+	s := newTestService(t)
+	s.MaxSnapshots = 2
+	conf := filepath.Join(s.Root, "hyprland.conf")
+	writeFile(t, conf, "general:gaps_in = 5\n")
+	writeSnapshot(t, s, "20260301-120000", "", conf)
+	writeSnapshot(t, s, "20260301-120100", "", conf)
+
+	id, err := s.CreateSnapshot([]string{conf}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotIDs(t, s); !slices.Equal(got, []string{id, "20260301-120100"}) {
+		t.Errorf("kept %v after a new snapshot, want it and the one before", got)
+	}
+}
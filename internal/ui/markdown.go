@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Markdown styles, on the same Mocha palette as the rest of the UI
+var (
+	styleMdHeading = lipgloss.NewStyle().Foreground(colorMauve).Bold(true)
+	styleMdBold    = lipgloss.NewStyle().Foreground(mochaText).Bold(true)
+	styleMdItalic  = lipgloss.NewStyle().Foreground(mochaText).Italic(true)
+	styleMdCode    = lipgloss.NewStyle().Foreground(colorCoffee)
+	styleMdLink    = lipgloss.NewStyle().Foreground(colorMauve).Underline(true)
+	styleMdQuote   = lipgloss.NewStyle().Foreground(mochaSubtext).Italic(true)
+	styleMdMarker  = lipgloss.NewStyle().Foreground(colorMatcha)
+	styleMdRule    = lipgloss.NewStyle().Foreground(colorBorder)
+)
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdNumber  = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	mdRule    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+
+	// Inline spans, tried in this order so code is never formatted inside
+	mdInline = regexp.MustCompile("`[^`]+`" + `|\*\*[^*]+\*\*|__[^_]+__|\*[^*\s][^*]*\*|\[[^\]]+\]\([^)]+\)`)
+)
+
+// renderMarkdown renders the common markdown of assistant replies: headings,
+// lists, quotes, rules, fenced code blocks and inline bold, italics, code and
+// links. Fenced diffs get the same coloring as proposed changes. Anything else
+// is shown as plain text, so a half-streamed reply still renders sensibly.
+func renderMarkdown(text string) string {
+	var out []string
+	var fence []string
+	inFence, fenceLang := false, ""
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inFence {
+				out = append(out, renderCodeBlock(fenceLang, fence))
+				fence, inFence = nil, false
+			} else {
+				inFence, fenceLang = true, strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			}
+			continue
+		}
+		if inFence {
+			fence = append(fence, line)
+			continue
+		}
+
+		switch {
+		case mdHeading.MatchString(line):
+			m := mdHeading.FindStringSubmatch(line)
+			out = append(out, styleMdHeading.Render(m[2]))
+		case mdRule.MatchString(line):
+			out = append(out, styleMdRule.Render(strings.Repeat("─", 20)))
+		case mdBullet.MatchString(line):
+			m := mdBullet.FindStringSubmatch(line)
+			out = append(out, m[1]+styleMdMarker.Render("•")+" "+renderInline(m[2]))
+		case mdNumber.MatchString(line):
+			m := mdNumber.FindStringSubmatch(line)
+			out = append(out, m[1]+styleMdMarker.Render(m[2])+" "+renderInline(m[3]))
+		case strings.HasPrefix(trimmed, ">"):
+			quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			out = append(out, styleMdRule.Render("│ ")+styleMdQuote.Render(quote))
+		default:
+			out = append(out, renderInline(line))
+		}
+	}
+
+	// An unclosed fence is still being streamed
+	if inFence {
+		out = append(out, renderCodeBlock(fenceLang, fence))
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderCodeBlock renders the lines of a fenced block, indented
+func renderCodeBlock(lang string, lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	var body string
+	if lang == "diff" || lang == "patch" {
+		body = renderDiff(strings.Join(lines, "\n"))
+	} else {
+		styled := make([]string, len(lines))
+		for i, line := range lines {
+			styled[i] = styleMdCode.Render(line)
+		}
+		body = strings.Join(styled, "\n")
+	}
+	return "  " + strings.ReplaceAll(body, "\n", "\n  ")
+}
+
+// renderInline styles the inline spans of one line of text
+func renderInline(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range mdInline.FindAllStringIndex(line, -1) {
+		if loc[0] > last {
+			b.WriteString(styleBase.Render(line[last:loc[0]]))
+		}
+		span := line[loc[0]:loc[1]]
+		switch {
+		case strings.HasPrefix(span, "`"):
+			b.WriteString(styleMdCode.Render(span[1 : len(span)-1]))
+		case strings.HasPrefix(span, "**"), strings.HasPrefix(span, "__"):
+			b.WriteString(styleMdBold.Render(span[2 : len(span)-2]))
+		case strings.HasPrefix(span, "["):
+			label, url, _ := strings.Cut(span[1:len(span)-1], "](")
+			b.WriteString(styleMdLink.Render(label) + styleMdQuote.Render(" ("+url+")"))
+		default:
+			b.WriteString(styleMdItalic.Render(span[1 : len(span)-1]))
+		}
+		last = loc[1]
+	}
+	if last < len(line) {
+		b.WriteString(styleBase.Render(line[last:]))
+	}
+	return b.String()
+}
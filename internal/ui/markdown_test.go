@@ -0,0 +1,42 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownStylesCodeFence(t *testing.T) {
+	withColors(t)
+	const reply = "Add this to hyprland.conf:\n```ini\ngeneral {\n    gaps_in = 5\n}\n```\ngaps_in = 5 sets the inner gaps."
+
+	lines := strings.Split(renderMarkdown(reply), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("rendered %d lines, want 5 with the fence markers dropped: %q", len(lines), lines)
+	}
+	if want := "  " + styleMdCode.Render("    gaps_in = 5"); lines[2] != want {
+		t.Errorf("code line = %q, want %q", lines[2], want)
+	}
+	// The same text outside the fence is plain
+	plain := lines[4]
+	if plain != styleBase.Render("gaps_in = 5 sets the inner gaps.") || strings.Contains(plain, styleMdCode.Render("gaps_in = 5")) {
+		t.Errorf("plain line = %q, want it unstyled as code", plain)
+	}
+	if lines[2] == "  "+styleBase.Render("    gaps_in = 5") {
+		t.Error("code is styled the same as plain text")
+	}
+
+	// A fence still being streamed is already shown as code
+	if md := renderMarkdown("```\nbind = SUPER, Q, killactive"); md != "  "+styleMdCode.Render("bind = SUPER, Q, killactive") {
+		t.Errorf("unclosed fence rendered as %q", md)
+	}
+}
+
+func TestRenderMarkdownInline(t *testing.T) {
+	withColors(t)
+	got := renderMarkdown("## Gaps\n- Set **gaps_in** with `hyprctl keyword`")
+	want := styleMdHeading.Render("Gaps") + "\n" +
+		styleMdMarker.Render("•") + " " + styleBase.Render("Set ") + styleMdBold.Render("gaps_in") + styleBase.Render(" with ") + styleMdCode.Render("hyprctl keyword")
+	if got != want {
+		t.Errorf("renderMarkdown() =\n%q\nwant\n%q", got, want)
+	}
+}
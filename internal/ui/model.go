@@ -2,16 +2,23 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/reinhart/hyprAgent/internal/assistant"
+	"github.com/reinhart/hyprAgent/internal/configuration"
+	"github.com/reinhart/hyprAgent/internal/safety"
 )
 
 // --- Mocha Palette & Styles ---
@@ -27,6 +34,7 @@ var (
 	colorMatcha = lipgloss.Color("#a6e3a1") // Green-ish (Agent)
 	colorCoffee = lipgloss.Color("#fab387") // Peach/Brown
 	colorMauve  = lipgloss.Color("#cba6f7") // Purple/Accent
+	colorRed    = lipgloss.Color("#f38ba8")
 
 	colorBorder = lipgloss.Color("#45475a") // Soft gray-blue border
 	colorActive = lipgloss.Color("#f9e2af") // Yellow/Gold focus
@@ -42,6 +50,11 @@ var (
 	styleFocusBorder = styleBorder.Copy().
 				BorderForeground(colorActive)
 
+	styleTitle = lipgloss.NewStyle().
+			Foreground(colorMauve).
+			Bold(true).
+			PaddingLeft(1)
+
 	styleUserHeader = lipgloss.NewStyle().
 			Foreground(colorLatte).
 			Bold(true).
@@ -53,13 +66,18 @@ var (
 				MarginTop(1)
 
 	styleError = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#f38ba8")). // Red
+			Foreground(colorRed).
 			Bold(true)
 
 	styleStatus = lipgloss.NewStyle().
 			Foreground(colorSubtext).
 			Italic(true)
 
+	// Diff Styles
+	styleDiffAdd     = lipgloss.NewStyle().Foreground(colorMatcha)
+	styleDiffDel     = lipgloss.NewStyle().Foreground(colorRed)
+	styleDiffContext = lipgloss.NewStyle().Foreground(colorSubtext)
+
 	colorSubtext = lipgloss.Color("#9399b2")
 )
 
@@ -68,6 +86,8 @@ type State int
 const (
 	StateReady State = iota
 	StateThinking
+	StateConfirming      // Waiting for the user to approve a tool action
+	StatePickingSnapshot // Choosing a snapshot to restore with /snapshots
 )
 
 type Model struct {
@@ -77,13 +97,48 @@ type Model struct {
 	spinner       spinner.Model
 	state         State
 	statusHistory []string
+	content       string // Full transcript rendered into the viewport
+	streaming     string // Partial response text shown below the transcript
+	confirm       *assistant.ConfirmRequest
+
+	// cancel aborts the in-flight request. cancelled stays set until that
+	// request has returned, so a new one cannot start while it winds down.
+	cancel    context.CancelFunc
+	cancelled bool
+
+	// provider and model are shown in the header, e.g. anthropic/claude-sonnet-4-5
+	provider    string
+	model       string
+	newProvider ProviderFactory // Builds the LLM for /model; nil disables it
+
+	// snapshots backs /snapshots; nil disables it. snapshotList holds the
+	// snapshots shown while picking one, and snapshotCursor the selected one.
+	snapshots      *safety.SnapshotService
+	snapshotList   []safety.SnapshotInfo
+	snapshotCursor int
+	restoring      *safety.SnapshotInfo // Picked snapshot awaiting confirmation
+
+	tokens int    // Running total reported by the agent
+	notice string // Shown in place of "Ready to serve." until the next request
+
+	// What Ctrl+Y copies: the diff proposed during the latest request, or
+	// else the last response
+	lastDiff     string
+	lastResponse string
 
 	// Layout
 	width  int
 	height int
 }
 
-func NewModel(agent *assistant.Agent) Model {
+// ProviderFactory creates an LLM provider by name, e.g. "anthropic", from the
+// config and environment. A non-empty model overrides the configured one.
+type ProviderFactory func(provider, model string) (assistant.LLMProvider, error)
+
+// NewModel creates the UI for agent. provider and model name the LLM in use
+// and are shown in the header; newProvider lets /model switch to another, and
+// snapshots lets /snapshots restore one.
+func NewModel(agent *assistant.Agent, provider, model string, newProvider ProviderFactory, snapshots *safety.SnapshotService) Model {
 	ta := textarea.New()
 	ta.Placeholder = "Order a coffee or ask a question..."
 	ta.Focus()
@@ -99,9 +154,13 @@ func NewModel(agent *assistant.Agent) Model {
 	ta.FocusedStyle.Text = lipgloss.NewStyle().Foreground(colorCream)
 
 	vp := viewport.New(80, 20)
-	// Initial welcome message
-	welcomeMsg := styleAgentHeader.Render("HyprAgent") + "\n" +
-		styleBase.Render("Welcome! I'm ready to help you configure your system.")
+	// Letters and arrows belong to the input; the transcript scrolls with
+	// PageUp/PageDown, Home/End and the mouse wheel
+	vp.KeyMap = viewport.KeyMap{
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+	}
+	welcomeMsg := welcomeMessage() + resumedTranscript(agent.History())
 	vp.SetContent(welcomeMsg)
 
 	s := spinner.New()
@@ -110,16 +169,48 @@ func NewModel(agent *assistant.Agent) Model {
 
 	return Model{
 		agent:         agent,
+		provider:      provider,
+		model:         model,
+		newProvider:   newProvider,
+		snapshots:     snapshots,
 		textarea:      ta,
 		viewport:      vp,
 		spinner:       s,
 		state:         StateReady,
 		statusHistory: []string{},
+		content:       welcomeMsg,
+	}
+}
+
+// welcomeMessage is the greeting shown at the top of a new conversation
+func welcomeMessage() string {
+	return styleAgentHeader.Render("HyprAgent") + "\n" +
+		styleBase.Render("Welcome! I'm ready to help you configure your system.")
+}
+
+// resumedTranscript renders the user and assistant messages of a resumed
+// conversation; tool calls and results are left out
+func resumedTranscript(history []assistant.Message) string {
+	var b strings.Builder
+	for _, msg := range history {
+		if msg.Content == "" {
+			continue
+		}
+		switch msg.Role {
+		case assistant.RoleUser:
+			b.WriteString("\n" + styleUserHeader.Render("You") + "\n" + styleBase.Render(msg.Content) + "\n")
+		case assistant.RoleAssistant:
+			b.WriteString("\n" + styleAgentHeader.Render("HyprAgent") + "\n" + renderMarkdown(msg.Content) + "\n")
+		}
 	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n" + styleStatus.Render("Resumed previous session") + "\n" + b.String()
 }
 
 func (m Model) Init() tea.Cmd {
-	return tea.Batch(textarea.Blink, m.spinner.Tick)
+	return tea.Batch(textarea.Blink, m.spinner.Tick, listenForConfirmations(m.agent.Confirmations()))
 }
 
 type agentMsg struct {
@@ -128,8 +219,11 @@ type agentMsg struct {
 }
 
 type statusMsg struct {
-	msg  string
-	diff string
+	msg    string
+	diff   string
+	note   string
+	chunk  string
+	tokens int
 }
 
 func listenForUpdates(sub <-chan assistant.StatusUpdate) tea.Cmd {
@@ -138,14 +232,47 @@ func listenForUpdates(sub <-chan assistant.StatusUpdate) tea.Cmd {
 		if !ok {
 			return nil
 		}
-		return statusMsg{msg: update.Message, diff: update.Diff}
+		return statusMsg{msg: update.Message, diff: update.Diff, note: update.Note, chunk: update.Chunk, tokens: update.Tokens}
+	}
+}
+
+type confirmMsg struct {
+	req *assistant.ConfirmRequest
+}
+
+func listenForConfirmations(sub <-chan *assistant.ConfirmRequest) tea.Cmd {
+	return func() tea.Msg {
+		req, ok := <-sub
+		if !ok {
+			return nil
+		}
+		return confirmMsg{req: req}
 	}
 }
 
-func (m Model) processInput(input string) tea.Cmd {
+// answerConfirmation replies to the pending confirmation and resumes the agent
+func (m *Model) answerConfirmation(approved bool) tea.Cmd {
+	if m.restoring != nil {
+		return m.answerRestore(approved)
+	}
+	m.confirm.Respond(approved)
+	m.confirm = nil
+	m.state = StateThinking
+
+	if approved {
+		m.appendContent(styleStatus.Render("✔ Approved") + "\n")
+	} else {
+		m.appendContent(styleStatus.Render("✘ Declined") + "\n")
+	}
+	return listenForConfirmations(m.agent.Confirmations())
+}
+
+func (m *Model) processInput(input string) tea.Cmd {
+	// Create a context with timeout to prevent indefinite hangs
+	ctx, cancel := context.WithTimeout(context.Background(), 180*time.Second) // 3 minutes
+	m.cancel = cancel
+
 	return func() tea.Msg {
-		// Create a context with timeout to prevent indefinite hangs
-		ctx, cancel := context.WithTimeout(context.Background(), 180*time.Second) // 3 minutes
 		defer cancel()
 
 		resp, err := m.agent.ProcessMessage(ctx, input)
@@ -153,6 +280,245 @@ func (m Model) processInput(input string) tea.Cmd {
 	}
 }
 
+// cancelRequest aborts the in-flight request and returns to the prompt
+func (m *Model) cancelRequest() {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.cancelled = true
+	m.state = StateReady
+	m.streaming = ""
+	m.appendContent("\n" + styleStatus.Render("✘ Cancelled") + "\n")
+	m.textarea.Focus()
+}
+
+// renderDiff colors a unified diff line by line: additions green, removals
+// red, and context, file and @@ headers dimmed
+func renderDiff(diff string) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[i] = styleDiffContext.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = styleDiffAdd.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = styleDiffDel.Render(line)
+		default:
+			lines[i] = styleDiffContext.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// appendContent adds rendered text to the transcript and scrolls to the bottom
+func (m *Model) appendContent(s string) {
+	m.content += s
+	m.refreshViewport()
+}
+
+// refreshViewport renders the transcript plus any partial streamed response.
+// It follows new output at the bottom, unless the user has scrolled up to
+// read earlier output.
+func (m *Model) refreshViewport() {
+	follow := m.viewport.AtBottom()
+	m.renderViewport()
+	if follow {
+		m.viewport.GotoBottom()
+	}
+}
+
+// renderViewport sets the viewport content, wrapped to its width. The
+// transcript is kept unwrapped so it can be wrapped again after a resize.
+func (m *Model) renderViewport() {
+	view := m.content
+	if m.streaming != "" {
+		view += "\n" + styleAgentHeader.Render("HyprAgent") + "\n" + renderMarkdown(m.streaming)
+	}
+	if m.viewport.Width > 0 {
+		// Breaks at spaces where possible and mid-word (paths, diffs) where not
+		view = ansi.Wrap(view, m.viewport.Width, "")
+	}
+	m.viewport.SetContent(view)
+}
+
+// scrollbar renders a one-column scroll indicator next to the viewport, or ""
+// when the whole transcript fits
+func (m Model) scrollbar() string {
+	height, total := m.viewport.Height, m.viewport.TotalLineCount()
+	if height <= 0 || total <= height {
+		return ""
+	}
+	thumb := max(1, height*height/total)
+	start := int(m.viewport.ScrollPercent()*float64(height-thumb) + 0.5)
+
+	track := lipgloss.NewStyle().Foreground(colorBorder).Render("│")
+	bar := lipgloss.NewStyle().Foreground(colorActive).Render("┃")
+	rows := make([]string, height)
+	for i := range rows {
+		rows[i] = track
+		if i >= start && i < start+thumb {
+			rows[i] = bar
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+// handleCommand runs a slash command typed into the input box.
+// It returns false if the input is not a known command.
+func (m *Model) handleCommand(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch fields[0] {
+	case "/stats":
+		m.appendContent("\n" + styleAgentHeader.Render("Session Stats") + "\n" + styleBase.Render(formatStats(m.agent.Metrics().Stats())) + "\n")
+		return true
+	case "/new":
+		// Only reachable in StateReady, so no request is using the history
+		m.agent.Reset()
+		m.content = welcomeMessage()
+		m.streaming = ""
+		m.lastDiff, m.lastResponse = "", ""
+		m.notice = "Conversation reset."
+		m.renderViewport()
+		m.viewport.GotoTop()
+		return true
+	case "/model":
+		m.notice = m.switchModel(fields[1:])
+		return true
+	case "/save":
+		m.notice = m.saveTranscript(fields[1:])
+		return true
+	case "/snapshots":
+		m.notice = m.openSnapshotPicker()
+		return true
+	}
+	return false
+}
+
+// saveTranscript handles /save [--tools] [path] and returns the notice
+// describing the result. The default path is ~/hypragent-session-<time>.md.
+func (m *Model) saveTranscript(args []string) string {
+	includeTools := false
+	path := ""
+	for _, arg := range args {
+		if arg == "--tools" {
+			includeTools = true
+			continue
+		}
+		path = arg
+	}
+	if path == "" {
+		path = "~/hypragent-session-" + time.Now().Format("20060102-150405") + ".md"
+	}
+	path, err := configuration.ExpandHome(path)
+	if err != nil {
+		return fmt.Sprintf("Could not save the transcript: %v", err)
+	}
+	if err := m.agent.SaveTranscript(path, includeTools); err != nil {
+		return fmt.Sprintf("Could not save the transcript: %v", err)
+	}
+	return "Transcript saved to " + path
+}
+
+// switchModel handles /model <provider> [model] and returns the notice
+// describing the result. The conversation carries over to the new model.
+func (m *Model) switchModel(args []string) string {
+	if len(args) == 0 || len(args) > 2 {
+		return "Usage: /model <provider> [model]"
+	}
+	if m.newProvider == nil {
+		return "Switching models is not available in this session."
+	}
+	model := ""
+	if len(args) == 2 {
+		model = args[1]
+	}
+	llm, err := m.newProvider(args[0], model)
+	if err != nil {
+		return fmt.Sprintf("Could not switch to %s: %v", args[0], err)
+	}
+	// Only reachable in StateReady, so no request is using the provider
+	m.agent.SetProvider(llm)
+	m.provider, m.model = llm.Name(), llm.Model()
+	if m.model == "" {
+		return fmt.Sprintf("Switched to %s.", m.provider)
+	}
+	return fmt.Sprintf("Switched to %s/%s.", m.provider, m.model)
+}
+
+// writeClipboard copies text to the system clipboard; a variable so it can be
+// replaced where no clipboard is available
+var writeClipboard = clipboard.WriteAll
+
+// copyLast copies the last proposed diff, or the last response if the latest
+// request had no diff, and returns the notice describing what happened
+func (m *Model) copyLast() string {
+	text, what := m.lastDiff, "diff"
+	if text == "" {
+		text, what = m.lastResponse, "response"
+	}
+	if text == "" {
+		return "Nothing to copy yet."
+	}
+	if err := writeClipboard(text); err != nil {
+		// Headless sessions have no xclip, xsel or wl-copy to hand it to
+		return fmt.Sprintf("Could not copy the %s: %v", what, err)
+	}
+	return fmt.Sprintf("Copied the last %s to the clipboard.", what)
+}
+
+// errorHint suggests what to do about a failed request, or returns "" when
+// the error does not point at anything the user can fix
+func errorHint(err error) string {
+	var rateLimited *assistant.RateLimitError
+	switch {
+	case errors.Is(err, assistant.ErrAuth):
+		return "Check the API key for this provider in config.toml or its environment variable."
+	case errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0:
+		return fmt.Sprintf("The provider is rate limiting requests; wait %s and try again.", rateLimited.RetryAfter.Round(time.Second))
+	case errors.Is(err, assistant.ErrRateLimit):
+		return "The provider is rate limiting requests; wait a moment and try again."
+	case errors.Is(err, assistant.ErrTimeout):
+		return "Try again, or raise timeout_seconds in config.toml if the model is slow."
+	case errors.Is(err, assistant.ErrToolExecution):
+		return "Try rephrasing the request, or switch to a more capable model."
+	}
+	return ""
+}
+
+// formatCount renders n with thousands separators, e.g. 12,430
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatStats renders provider metrics as a small table
+func formatStats(stats []assistant.ProviderStats) string {
+	if len(stats) == 0 {
+		return "No requests have been made yet."
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-12s %5s %5s %9s %9s %9s %8s\n", "PROVIDER", "REQS", "FAIL", "AVG", "P50", "P95", "TOK/S")
+	for _, st := range stats {
+		fmt.Fprintf(&sb, "%-12s %5d %5d %9s %9s %9s %8.1f\n",
+			st.Provider, st.Requests, st.Failures,
+			st.AvgLatency.Round(time.Millisecond),
+			st.P50Latency.Round(time.Millisecond),
+			st.P95Latency.Round(time.Millisecond),
+			st.TokensPerSecond)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
@@ -166,36 +532,97 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Header (1) + Viewport (dynamic) + Status(1) + Input(5)
 		// Input is usually height 3 + 2 border lines = 5 lines total
 
-		verticalMargins := 7 // Borders + Status + Padding
+		verticalMargins := 8 // Header + Borders + Status + Padding
 		viewportHeight := msg.Height - verticalMargins
 		if viewportHeight < 5 {
 			viewportHeight = 5
 		}
 
-		m.viewport.Width = msg.Width - 4 // Minus borders/padding
+		// Minus borders/padding and the scrollbar column
+		wasAtBottom := m.viewport.AtBottom()
+		m.viewport.Width = msg.Width - 5
 		m.viewport.Height = viewportHeight
+		m.renderViewport()
+		if wasAtBottom {
+			m.viewport.GotoBottom()
+		}
 
 		m.textarea.SetWidth(msg.Width - 4)
 
 	case tea.KeyMsg:
+		// The transcript scrolls in every state, even while a request runs
+		switch msg.Type {
+		case tea.KeyPgUp, tea.KeyPgDown:
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		case tea.KeyHome:
+			m.viewport.GotoTop()
+			return m, nil
+		case tea.KeyEnd:
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+
+		// While a confirmation is pending only y/n (and quitting) are accepted
+		if m.state == StateConfirming {
+			switch {
+			case msg.Type == tea.KeyCtrlC:
+				m.answerConfirmation(false)
+				return m, tea.Quit
+			case msg.Type == tea.KeyEsc, msg.String() == "n", msg.String() == "N":
+				return m, m.answerConfirmation(false)
+			case msg.String() == "y", msg.String() == "Y":
+				return m, m.answerConfirmation(true)
+			}
+			return m, nil
+		}
+
+		if m.state == StatePickingSnapshot {
+			return m, m.updateSnapshotPicker(msg)
+		}
+
 		switch msg.Type {
 		case tea.KeyCtrlC:
 			return m, tea.Quit
 		case tea.KeyEsc:
+			if m.state == StateThinking {
+				m.cancelRequest()
+				return m, nil
+			}
 			return m, tea.Quit
+		case tea.KeyCtrlX:
+			if m.state == StateThinking {
+				m.cancelRequest()
+			}
+			return m, nil
+		case tea.KeyCtrlY:
+			m.notice = m.copyLast()
+			return m, nil
 		case tea.KeyEnter:
 			if !msg.Alt && m.state == StateReady {
 				input := m.textarea.Value()
 				if strings.TrimSpace(input) == "" {
 					break
 				}
+				if m.cancelled {
+					m.appendContent(styleStatus.Render("Still stopping the cancelled request, try again in a moment.") + "\n")
+					return m, nil
+				}
+
+				// Slash commands are handled locally and never reach the LLM
+				if strings.HasPrefix(strings.TrimSpace(input), "/") && m.handleCommand(strings.TrimSpace(input)) {
+					m.textarea.Reset()
+					return m, nil
+				}
+
+				m.notice = ""
+				m.lastDiff = ""
 
 				// Format User Message
 				userHeader := styleUserHeader.Render("You")
 				userBody := styleBase.Render(input)
 
-				newContent := m.viewport.View() + "\n" + userHeader + "\n" + userBody + "\n"
-				m.viewport.SetContent(newContent)
+				m.appendContent("\n" + userHeader + "\n" + userBody + "\n")
 				m.viewport.GotoBottom()
 
 				m.state = StateThinking
@@ -230,6 +657,25 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case statusMsg:
+		if msg.chunk != "" {
+			m.streaming += msg.chunk
+			m.refreshViewport()
+			if m.state != StateReady {
+				cmds = append(cmds, listenForUpdates(m.agent.Updates()))
+			}
+			return m, tea.Batch(cmds...)
+		}
+
+		if msg.tokens > 0 {
+			m.tokens = msg.tokens
+			if msg.msg == "" {
+				if m.state != StateReady {
+					cmds = append(cmds, listenForUpdates(m.agent.Updates()))
+				}
+				return m, tea.Batch(cmds...)
+			}
+		}
+
 		m.statusHistory = append(m.statusHistory, msg.msg)
 		if len(m.statusHistory) > 3 {
 			m.statusHistory = m.statusHistory[len(m.statusHistory)-3:]
@@ -237,40 +683,55 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// If there's a diff, render it immediately to the viewport
 		if msg.diff != "" {
+			m.lastDiff = msg.diff
 			diffHeader := styleAgentHeader.Render(" Proposed Changes:")
-			// Use a simple style for diff content, maybe syntax highlight later
-			diffBody := lipgloss.NewStyle().Foreground(colorSubtext).Render(msg.diff)
-			// Wrap in code block style or similar
-			diffBlock := fmt.Sprintf("\n%s\n```diff\n%s\n```\n", diffHeader, diffBody)
+			m.appendContent(fmt.Sprintf("\n%s\n%s\n", diffHeader, renderDiff(msg.diff)))
+		}
 
-			newContent := m.viewport.View() + diffBlock
-			m.viewport.SetContent(newContent)
-			m.viewport.GotoBottom()
+		// Applied changes are noted in the transcript together with their undo snapshot
+		if msg.note != "" {
+			m.appendContent("\n" + styleStatus.Render("✔ "+msg.note) + "\n")
 		}
 
-		if m.state == StateThinking {
+		if m.state != StateReady {
 			cmds = append(cmds, listenForUpdates(m.agent.Updates()))
 		}
 
+	case confirmMsg:
+		m.confirm = msg.req
+		m.state = StateConfirming
+		header := styleAgentHeader.Render("Confirmation required")
+		m.appendContent("\n" + header + "\n" + styleBase.Render(msg.req.Action) + "\n")
+		return m, nil
+
 	case agentMsg:
+		m.cancel = nil
+		if m.cancelled {
+			// The cancellation was already shown; drop its error
+			m.cancelled = false
+			return m, nil
+		}
 		m.state = StateReady
+		m.streaming = "" // Replaced by the final response below
 		var output string
 		agentHeader := styleAgentHeader.Render("HyprAgent")
 
 		if msg.err != nil {
 			output = agentHeader + "\n" + styleError.Render(fmt.Sprintf("Error: %v", msg.err))
+			if hint := errorHint(msg.err); hint != "" {
+				output += "\n" + styleStatus.Render(hint)
+			}
 		} else {
-			output = agentHeader + "\n" + styleBase.Render(msg.response)
+			output = agentHeader + "\n" + renderMarkdown(msg.response)
+			m.lastResponse = msg.response
 		}
 
 		// Append Assistant Response
 		// Add a subtle separator
 		separator := lipgloss.NewStyle().Foreground(colorBorder).Render(strings.Repeat("─", m.width/2))
 
-		newContent := m.viewport.View() + output + "\n\n" + separator + "\n"
-		m.viewport.SetContent(newContent)
-
-		// Force scroll to bottom AFTER setting content
+		// Scroll to bottom AFTER setting content, so the answer is in view
+		m.appendContent(output + "\n\n" + separator + "\n")
 		m.viewport.GotoBottom()
 
 		// Ensure viewport processes the scroll by updating it immediately
@@ -283,7 +744,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(cmds...)
 
 	case spinner.TickMsg:
-		if m.state == StateThinking {
+		if m.state != StateReady {
 			m.spinner, cmd = m.spinner.Update(msg)
 			cmds = append(cmds, cmd)
 		}
@@ -305,17 +766,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m Model) View() string {
 	// 1. Header / Chat Viewport
-	chatView := styleBorder.Width(m.width - 2).Height(m.viewport.Height + 2).Render(m.viewport.View())
+	header := styleTitle.Render("HyprAgent")
+	if m.provider != "" {
+		name := m.provider
+		if m.model != "" {
+			name += "/" + m.model
+		}
+		header += styleStatus.Render(" · " + name)
+	}
+	chatView := styleBorder.Width(m.width - 2).Height(m.viewport.Height + 2).Render(lipgloss.JoinHorizontal(lipgloss.Top, m.viewport.View(), m.scrollbar()))
 
 	// 2. Status Area
 	var statusStr string
-	if m.state == StateThinking {
+	if m.state == StateConfirming {
+		statusStr = fmt.Sprintf(" %s %s", m.spinner.View(), styleStatus.Render("Waiting for your approval..."))
+	} else if m.state == StateThinking {
 		// Show last 3 statuses joined
 		fullStatus := strings.Join(m.statusHistory, "  ➜  ")
-		statusStr = fmt.Sprintf(" %s %s", m.spinner.View(), styleStatus.Render(fullStatus))
+		statusStr = fmt.Sprintf(" %s %s", m.spinner.View(), styleStatus.Render(fullStatus+"  (Esc to cancel)"))
+	} else if m.state == StatePickingSnapshot && m.notice == "" {
+		statusStr = styleStatus.Render(" Restore a snapshot: ↑/↓ select · Enter restore · Esc cancel")
+	} else if m.notice != "" {
+		statusStr = styleStatus.Render(" " + m.notice)
 	} else {
 		statusStr = styleStatus.Render(" Ready to serve.")
 	}
+	if m.tokens > 0 {
+		statusStr += styleStatus.Render("  ·  Tokens: " + formatCount(m.tokens))
+	}
 	// Pad status to width
 	statusView := lipgloss.NewStyle().Width(m.width).PaddingLeft(1).Render(statusStr)
 
@@ -326,9 +804,21 @@ func (m Model) View() string {
 	inputContent := lipgloss.JoinHorizontal(lipgloss.Top, prompt, m.textarea.View())
 
 	inputView := styleFocusBorder.Width(m.width - 2).Render(inputContent)
+	if m.state == StateConfirming {
+		ask := "Apply this change?"
+		if m.restoring != nil {
+			ask = "Restore this snapshot?"
+		}
+		question := lipgloss.NewStyle().Foreground(colorActive).Bold(true).Render(ask) +
+			styleBase.Render("  [y] yes   [n] no")
+		inputView = styleFocusBorder.Width(m.width - 2).Render(question)
+	} else if m.state == StatePickingSnapshot {
+		inputView = styleFocusBorder.Width(m.width - 2).Render(m.snapshotPickerView())
+	}
 
 	// Layout Composition
 	return lipgloss.JoinVertical(lipgloss.Left,
+		header,
 		chatView,
 		statusView,
 		inputView,
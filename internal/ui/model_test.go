@@ -0,0 +1,343 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+	"github.com/reinhart/hyprAgent/internal/assistant"
+)
+
+// testModel returns a model for an agent without a provider, sized as a
+// terminal of width x height would make it
+func testModel(width, height int) Model {
+	agent := assistant.NewAgent(nil, assistant.NewToolRegistry(), "", assistant.AgentOptions{})
+	updated, _ := NewModel(agent, "", "", nil, nil).Update(tea.WindowSizeMsg{Width: width, Height: height})
+	return updated.(Model)
+}
+
+// update sends msg to the model and returns the updated model
+func update(m Model, msg tea.Msg) Model {
+	updated, _ := m.Update(msg)
+	return updated.(Model)
+}
+
+// thinking puts m in the middle of a request whose context is returned
+func thinking(m Model) (Model, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.state = StateThinking
+	m.textarea.Blur()
+	return m, ctx
+}
+
+func TestCancelRequest(t *testing.T) {
+	for _, key := range []tea.KeyMsg{{Type: tea.KeyEsc}, {Type: tea.KeyCtrlX}} {
+		t.Run(key.String(), func(t *testing.T) {
+			m, ctx := thinking(testModel(80, 24))
+
+			m = update(m, key)
+			if m.state != StateReady || !m.cancelled || m.cancel != nil {
+				t.Fatalf("state = %v, cancelled = %v after %s; want ready and cancelled", m.state, m.cancelled, key)
+			}
+			if ctx.Err() == nil {
+				t.Error("the request context was not cancelled")
+			}
+			if !strings.Contains(m.content, "Cancelled") {
+				t.Error("the cancellation is not shown in the transcript")
+			}
+
+			// A new request waits until the cancelled one has returned
+			m.textarea.SetValue("Set gaps to 5")
+			m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+			if m.state != StateReady || !strings.Contains(m.content, "Still stopping") {
+				t.Errorf("state = %v; want the new request held back", m.state)
+			}
+
+			// Its error is dropped, as the cancellation was already shown
+			m = update(m, agentMsg{err: errors.New("request was cancelled")})
+			if m.cancelled || m.state != StateReady || strings.Contains(m.content, "Error:") {
+				t.Errorf("cancelled = %v, state = %v after the request returned", m.cancelled, m.state)
+			}
+		})
+	}
+}
+
+func TestEscQuitsWhenIdle(t *testing.T) {
+	_, cmd := testModel(80, 24).Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if cmd == nil {
+		t.Fatal("Esc did nothing while idle")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("Esc while idle does not quit")
+	}
+}
+
+// withColors renders in true color for the rest of the test, as in a terminal
+func withColors(t *testing.T) {
+	t.Helper()
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+}
+
+func TestRenderDiffColorsLines(t *testing.T) {
+	withColors(t)
+	const (
+		green = "\x1b[38;2;166;227;161m" // colorMatcha
+		red   = "\x1b[38;2;243;139;168m" // colorRed
+	)
+	diff := "--- a/hyprland.conf\n+++ b/hyprland.conf\n@@ -1,2 +1,2 @@\n general {\n-    gaps_in = 2\n+    gaps_in = 5\n"
+
+	lines := strings.Split(renderDiff(diff), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("rendered %d lines, want 6", len(lines))
+	}
+	for i, want := range []struct {
+		color string
+		text  string
+	}{
+		{"", "--- a/hyprland.conf"},
+		{"", "+++ b/hyprland.conf"},
+		{"", "@@ -1,2 +1,2 @@"},
+		{"", " general {"},
+		{red, "-    gaps_in = 2"},
+		{green, "+    gaps_in = 5"},
+	} {
+		line := lines[i]
+		if !strings.Contains(line, want.text) {
+			t.Errorf("line %d = %q, want %q", i, line, want.text)
+		}
+		colored := strings.HasPrefix(line, green) || strings.HasPrefix(line, red)
+		if want.color != "" && !strings.HasPrefix(line, want.color) {
+			t.Errorf("line %d = %q, want it styled %q", i, line, want.color)
+		} else if want.color == "" && colored {
+			t.Errorf("line %d = %q, want it dimmed, not colored", i, line)
+		}
+	}
+
+	// Diffs in a reply are colored the same way
+	if md := renderMarkdown("Here is the change:\n```diff\n+    gaps_in = 5\n```"); !strings.Contains(md, green+"+    gaps_in = 5") {
+		t.Errorf("fenced diff rendered as %q, want the added line green", md)
+	}
+}
+
+// replyProvider answers every request with the same text
+type replyProvider struct{ reply string }
+
+func (p replyProvider) Name() string  { return "reply" }
+func (p replyProvider) Model() string { return "reply-model" }
+func (p replyProvider) Chat(ctx context.Context, messages []assistant.Message, tools []assistant.ToolDefinition) (*assistant.Message, error) {
+	return &assistant.Message{Role: assistant.RoleAssistant, Content: p.reply}, nil
+}
+
+func TestNewCommandResetsConversation(t *testing.T) {
+	m := testModel(80, 24)
+	m.agent.SetProvider(replyProvider{reply: "Gaps are now 5."})
+	if _, err := m.agent.ProcessMessage(context.Background(), "Set gaps to 5"); err != nil {
+		t.Fatal(err)
+	}
+	m.appendContent("\nSet gaps to 5\nGaps are now 5.\n")
+	m.lastResponse = "Gaps are now 5."
+
+	// Ignored while a request is using the history
+	m, _ = thinking(m)
+	m.textarea.SetValue("/new")
+	m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.agent.History()) == 0 {
+		t.Fatal("/new cleared the history during a request")
+	}
+
+	m.state = StateReady
+	m.cancel = nil
+	m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if h := m.agent.History(); len(h) != 0 {
+		t.Errorf("history after /new has %d messages, want none", len(h))
+	}
+	if m.content != welcomeMessage() || m.lastResponse != "" {
+		t.Errorf("transcript after /new = %q, want the welcome message", m.content)
+	}
+	if m.notice != "Conversation reset." || m.textarea.Value() != "" {
+		t.Errorf("notice = %q, input = %q after /new", m.notice, m.textarea.Value())
+	}
+}
+
+func TestSaveCommandWritesTranscript(t *testing.T) {
+	m := testModel(80, 24)
+	m.agent.SetProvider(replyProvider{reply: "Gaps are now 5."})
+	if _, err := m.agent.ProcessMessage(context.Background(), "Set gaps to 5"); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HyprAgent session\n\n## You\n\nSet gaps to 5\n\n## HyprAgent\n\nGaps are now 5.\n"
+
+	path := filepath.Join(t.TempDir(), "notes", "session.md")
+	m.textarea.SetValue("/save " + path)
+	m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.notice != "Transcript saved to "+path {
+		t.Fatalf("notice = %q", m.notice)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != want {
+		t.Errorf("transcript = %q, %v; want %q", data, err, want)
+	}
+
+	// Without a path it goes in the home directory
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	m.textarea.SetValue("/save")
+	m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	saved, _ := filepath.Glob(filepath.Join(home, "hypragent-session-*.md"))
+	if len(saved) != 1 || m.notice != "Transcript saved to "+saved[0] {
+		t.Fatalf("saved %v with notice %q, want one session file in the home directory", saved, m.notice)
+	}
+	if data, err := os.ReadFile(saved[0]); err != nil || string(data) != want {
+		t.Errorf("transcript = %q, %v; want %q", data, err, want)
+	}
+}
+
+func TestTranscriptScrollsInEveryState(t *testing.T) {
+	ready := testModel(80, 24)
+	for i := range 100 {
+		ready.appendContent(fmt.Sprintf("line %d\n", i))
+	}
+	ready.viewport.GotoBottom()
+	busy, _ := thinking(ready)
+
+	for name, m := range map[string]Model{"ready": ready, "thinking": busy} {
+		bottom := m.viewport.YOffset
+		m = update(m, tea.KeyMsg{Type: tea.KeyPgUp})
+		if m.viewport.YOffset >= bottom {
+			t.Errorf("%s: PageUp left the offset at %d, want it above %d", name, m.viewport.YOffset, bottom)
+		}
+		if m.textarea.Value() != "" {
+			t.Errorf("%s: PageUp typed %q into the input", name, m.textarea.Value())
+		}
+		m = update(m, tea.KeyMsg{Type: tea.KeyPgDown})
+		if m.viewport.YOffset != bottom {
+			t.Errorf("%s: PageDown moved to %d, want back at %d", name, m.viewport.YOffset, bottom)
+		}
+
+		m = update(m, tea.MouseMsg{Button: tea.MouseButtonWheelUp, Action: tea.MouseActionPress})
+		if m.viewport.YOffset >= bottom {
+			t.Errorf("%s: the mouse wheel did not scroll up", name)
+		}
+		if m = update(m, tea.KeyMsg{Type: tea.KeyHome}); !m.viewport.AtTop() {
+			t.Errorf("%s: Home did not reach the top", name)
+		}
+		if m = update(m, tea.KeyMsg{Type: tea.KeyEnd}); !m.viewport.AtBottom() {
+			t.Errorf("%s: End did not reach the bottom", name)
+		}
+	}
+}
+
+func TestWideMessageWrapsToViewport(t *testing.T) {
+	m := testModel(40, 20)
+	path := "/home/user/.config/hypr/" + strings.Repeat("very-long-directory-name/", 6) + "hyprland.conf"
+	m.appendContent("\n" + styleAgentHeader.Render("HyprAgent") + "\n" +
+		styleBase.Render("Your gaps are set in "+path+" and the border is set a few lines below it, next to the rounding.") + "\n" +
+		renderDiff("+  general:col.active_border = rgba(33ccffee) rgba(00ff99ee) 45deg rgba(ff0000ee) rgba(0000ffee)") + "\n")
+
+	check := func(m Model) {
+		t.Helper()
+		for i, line := range strings.Split(m.viewport.View(), "\n") {
+			if w := ansi.StringWidth(line); w > m.viewport.Width {
+				t.Errorf("viewport line %d is %d wide, over %d: %q", i, w, m.viewport.Width, ansi.Strip(line))
+			}
+		}
+		for i, line := range strings.Split(m.View(), "\n") {
+			if w := ansi.StringWidth(line); w > m.width {
+				t.Errorf("screen line %d is %d wide, over the %d-column terminal", i, w, m.width)
+			}
+		}
+	}
+	check(m)
+	if !strings.Contains(strings.ReplaceAll(ansi.Strip(m.viewport.View()), "\n", ""), "very-long-directory-name/hyprland.conf") {
+		t.Error("the wrapped path lost text")
+	}
+
+	// Shrinking the terminal wraps the transcript again
+	check(update(m, tea.WindowSizeMsg{Width: 30, Height: 20}))
+}
+
+// stubClipboard records what is copied for the rest of the test, or fails
+// with err if it is non-nil
+func stubClipboard(t *testing.T, err error) *[]string {
+	t.Helper()
+	var copied []string
+	orig := writeClipboard
+	writeClipboard = func(text string) error {
+		if err != nil {
+			return err
+		}
+		copied = append(copied, text)
+		return nil
+	}
+	t.Cleanup(func() { writeClipboard = orig })
+	return &copied
+}
+
+func TestCopyLastDiffThenResponse(t *testing.T) {
+	copied := stubClipboard(t, nil)
+	const diff = "--- a/hyprland.conf\n+++ b/hyprland.conf\n@@ -1 +1 @@\n-general:gaps_in = 2\n+general:gaps_in = 5\n"
+	m, _ := thinking(testModel(80, 24))
+
+	m = update(m, statusMsg{msg: "Proposing a patch", diff: diff})
+	if m.lastDiff != diff {
+		t.Fatalf("lastDiff = %q, want the proposed diff kept", m.lastDiff)
+	}
+	m = update(m, agentMsg{response: "Gaps are now 5."})
+	m = update(m, tea.KeyMsg{Type: tea.KeyCtrlY})
+	if len(*copied) != 1 || (*copied)[0] != diff || m.notice != "Copied the last diff to the clipboard." {
+		t.Errorf("copied %q with notice %q, want the diff", *copied, m.notice)
+	}
+
+	// A request without a diff copies its response instead
+	m.textarea.SetValue("Thanks")
+	m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	m = update(m, agentMsg{response: "You're welcome."})
+	m = update(m, tea.KeyMsg{Type: tea.KeyCtrlY})
+	if len(*copied) != 2 || (*copied)[1] != "You're welcome." {
+		t.Errorf("copied %q, want the last response", *copied)
+	}
+}
+
+func TestCopyLastWithoutClipboard(t *testing.T) {
+	stubClipboard(t, errors.New("no clipboard utilities available"))
+	m := testModel(80, 24)
+	if m = update(m, tea.KeyMsg{Type: tea.KeyCtrlY}); m.notice != "Nothing to copy yet." {
+		t.Errorf("notice = %q before anything was said", m.notice)
+	}
+	m.lastResponse = "Gaps are now 5."
+	if m = update(m, tea.KeyMsg{Type: tea.KeyCtrlY}); !strings.Contains(m.notice, "Could not copy the response: no clipboard") {
+		t.Errorf("notice = %q, want the clipboard error", m.notice)
+	}
+}
+
+func TestHeaderShowsProviderAndModel(t *testing.T) {
+	agent := assistant.NewAgent(nil, assistant.NewToolRegistry(), "", assistant.AgentOptions{})
+	factory := func(provider, model string) (assistant.LLMProvider, error) {
+		return replyProvider{}, nil
+	}
+	m := update(NewModel(agent, "anthropic", "claude-test", factory, nil), tea.WindowSizeMsg{Width: 80, Height: 24})
+
+	header := func(m Model) string {
+		return ansi.Strip(strings.SplitN(m.View(), "\n", 2)[0])
+	}
+	if got := header(m); !strings.Contains(got, "HyprAgent · anthropic/claude-test") {
+		t.Errorf("header = %q, want the provider and model", got)
+	}
+
+	// Switching with /model updates it
+	m.textarea.SetValue("/model reply")
+	m = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if got := header(m); !strings.Contains(got, "HyprAgent · reply/reply-model") {
+		t.Errorf("header after /model = %q, want the new provider and model", got)
+	}
+}
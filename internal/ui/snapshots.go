@@ -0,0 +1,186 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/reinhart/hyprAgent/internal/assistant"
+	"github.com/reinhart/hyprAgent/internal/safety"
+)
+
+// snapshotRows is how many snapshots the picker shows at once
+const snapshotRows = 5
+
+// openSnapshotPicker handles /snapshots. It lists the snapshots, newest
+// first, for the user to pick one to restore, and returns the notice to show
+// when there is nothing to pick.
+func (m *Model) openSnapshotPicker() string {
+	if m.snapshots == nil {
+		return "Snapshots are not available in this session."
+	}
+	list, err := m.snapshots.List()
+	if err != nil {
+		return fmt.Sprintf("Could not list snapshots: %v", err)
+	}
+	if len(list) == 0 {
+		return "No snapshots yet; one is taken before every change."
+	}
+	m.snapshotList = list
+	m.snapshotCursor = 0
+	m.state = StatePickingSnapshot
+	m.textarea.Blur()
+	return ""
+}
+
+// closeSnapshotPicker returns to the prompt
+func (m *Model) closeSnapshotPicker() {
+	m.snapshotList = nil
+	m.state = StateReady
+	m.textarea.Focus()
+}
+
+// updateSnapshotPicker handles a key press while the picker is open
+func (m *Model) updateSnapshotPicker(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c":
+		return tea.Quit
+	case "esc", "q":
+		m.closeSnapshotPicker()
+		m.notice = ""
+	case "up", "k":
+		m.snapshotCursor = max(m.snapshotCursor-1, 0)
+		m.notice = ""
+	case "down", "j":
+		m.snapshotCursor = min(m.snapshotCursor+1, len(m.snapshotList)-1)
+		m.notice = ""
+	case "enter":
+		m.confirmRestore()
+	}
+	return nil
+}
+
+// confirmRestore asks the user to approve restoring the selected snapshot,
+// the same way tools ask before a change
+func (m *Model) confirmRestore() {
+	info := m.snapshotList[m.snapshotCursor]
+	if !info.Restorable {
+		m.notice = fmt.Sprintf("Snapshot %s has no manifest, so its files cannot be put back automatically.", info.ID)
+		return
+	}
+	if m.agent.DryRun() {
+		m.notice = "Nothing is restored in a dry run."
+		return
+	}
+	m.snapshotList = nil
+	m.restoring = &info
+	m.state = StateConfirming
+
+	action := fmt.Sprintf("Restore snapshot %s?", info.ID)
+	if info.Label != "" {
+		action += fmt.Sprintf(" (taken before: %s)", info.Label)
+	}
+	action += "\nThese files will be overwritten:\n- " + strings.Join(info.Files, "\n- ")
+	m.appendContent("\n" + styleAgentHeader.Render("Confirmation required") + "\n" + styleBase.Render(action) + "\n")
+}
+
+// answerRestore handles the user's reply to confirmRestore
+func (m *Model) answerRestore(approved bool) tea.Cmd {
+	info := *m.restoring
+	m.restoring = nil
+	m.state = StateReady
+	m.textarea.Focus()
+	if !approved {
+		m.appendContent(styleStatus.Render("✘ Declined") + "\n")
+		m.notice = fmt.Sprintf("Snapshot %s was not restored.", info.ID)
+		return nil
+	}
+	m.appendContent(styleStatus.Render("✔ Approved") + "\n")
+	return m.restoreSnapshot(info)
+}
+
+// restoreSnapshot restores a snapshot without going through the LLM, so
+// recovery works even when the model is confused. The files it overwrites are
+// snapshotted first, so the restore can itself be rolled back.
+func (m *Model) restoreSnapshot(info safety.SnapshotInfo) tea.Cmd {
+	// Another instance may be changing the same files; the UI cannot wait for it
+	release, err := m.agent.ConfigLock().Acquire(0)
+	if err != nil {
+		m.notice = fmt.Sprintf("Could not restore snapshot %s: %v", info.ID, err)
+		return nil
+	}
+	defer release()
+
+	var current []string
+	for _, path := range info.Files {
+		if _, err := os.Stat(path); err == nil {
+			current = append(current, path)
+		}
+	}
+	// Pruning after the new snapshot could delete the one being restored, so
+	// it waits until the restore is done
+	unpruned := *m.snapshots
+	unpruned.MaxSnapshots, unpruned.MaxAge = 0, 0
+	defer m.snapshots.Prune(m.snapshots.MaxSnapshots, m.snapshots.MaxAge)
+	var before string
+	if len(current) > 0 {
+		before, err = unpruned.CreateSnapshot(current, "Before restoring snapshot "+info.ID)
+		if err != nil {
+			m.notice = fmt.Sprintf("Did not restore snapshot %s: could not snapshot the current files first: %v", info.ID, err)
+			return nil
+		}
+	}
+
+	restored, err := m.snapshots.Restore(info.ID)
+	if err != nil {
+		if len(restored) > 0 {
+			m.notice = fmt.Sprintf("Restore of snapshot %s partially failed after restoring %s: %v", info.ID, strings.Join(restored, ", "), err)
+		} else {
+			m.notice = fmt.Sprintf("Could not restore snapshot %s: %v", info.ID, err)
+		}
+		return nil
+	}
+	summary := fmt.Sprintf("Rolled back %d file(s) to snapshot %s", len(restored), info.ID)
+	m.notice = fmt.Sprintf("Restored %d file(s) from snapshot %s.", len(restored), info.ID)
+	if before != "" {
+		summary += "; the replaced files are in snapshot " + before
+		m.notice = fmt.Sprintf("Restored %d file(s) from snapshot %s; to undo, restore snapshot %s.", len(restored), info.ID, before)
+	}
+
+	// Recording it notes the restore in the transcript through the agent's
+	// updates, as it does for changes made by tools
+	m.agent.Actions().Record(assistant.Action{Tool: "rollback", SnapshotID: before, Summary: summary})
+	return listenForUpdates(m.agent.Updates())
+}
+
+// snapshotPickerView renders the visible part of the snapshot list, with the
+// selected one highlighted
+func (m Model) snapshotPickerView() string {
+	start := min(max(m.snapshotCursor-snapshotRows/2, 0), max(len(m.snapshotList)-snapshotRows, 0))
+	end := min(start+snapshotRows, len(m.snapshotList))
+
+	selected := lipgloss.NewStyle().Foreground(colorActive).Bold(true)
+	rows := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		info := m.snapshotList[i]
+		row := info.ID
+		if info.Label != "" {
+			row += " · " + info.Label
+		}
+		row += fmt.Sprintf(" · %d file(s)", len(info.Files))
+		if !info.Restorable {
+			row += " · not restorable"
+		}
+		row = ansi.Truncate(row, m.width-8, "…")
+
+		if i == m.snapshotCursor {
+			rows = append(rows, selected.Render("› "+row))
+		} else {
+			rows = append(rows, styleBase.Render("  "+row))
+		}
+	}
+	return strings.Join(rows, "\n")
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/reinhart/hyprAgent/internal/assistant"
+	"github.com/reinhart/hyprAgent/internal/safety"
+)
+
+// pickerModel returns a model whose only snapshot holds hyprland.conf as
+// "good", with the file since changed to "bad"
+func pickerModel(t *testing.T) (Model, string) {
+	t.Helper()
+	root := t.TempDir()
+	main := filepath.Join(root, "hyprland.conf")
+	if err := os.WriteFile(main, []byte("good\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshots := &safety.SnapshotService{BackupDir: t.TempDir(), Root: root}
+	if _, err := snapshots.CreateSnapshot([]string{main}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(main, []byte("bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := assistant.NewAgent(nil, assistant.NewToolRegistry(), "", assistant.AgentOptions{})
+	m := NewModel(agent, "", "", nil, snapshots)
+	m.width = 80
+	if notice := m.openSnapshotPicker(); notice != "" {
+		t.Fatalf("picker did not open: %s", notice)
+	}
+	return m, main
+}
+
+// press sends a key to the model and returns the updated model
+func press(m Model, msg tea.KeyMsg) Model {
+	updated, _ := m.Update(msg)
+	return updated.(Model)
+}
+
+var (
+	keyEnter = tea.KeyMsg{Type: tea.KeyEnter}
+	keyYes   = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")}
+	keyNo    = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")}
+)
+
+func TestSnapshotPickerRestoresSelection(t *testing.T) {
+	m, main := pickerModel(t)
+
+	m = press(m, keyEnter)
+	if m.state != StateConfirming {
+		t.Fatalf("state = %v after selecting, want StateConfirming", m.state)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "bad\n" {
+		t.Fatalf("restored before the user confirmed: %q", data)
+	}
+
+	m = press(m, keyYes)
+	if m.state != StateReady {
+		t.Errorf("state = %v after confirming, want StateReady", m.state)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "good\n" {
+		t.Errorf("hyprland.conf = %q after the restore, want the snapshot's content", data)
+	}
+
+	// The replaced content was snapshotted first and is named in the notice
+	list, err := m.snapshots.List()
+	if err != nil || len(list) != 2 {
+		t.Fatalf("List() = %v, %v; want the original and the pre-restore snapshot", list, err)
+	}
+	if !strings.Contains(m.notice, list[0].ID) {
+		t.Errorf("notice %q does not name the pre-restore snapshot %s", m.notice, list[0].ID)
+	}
+	if _, err := m.snapshots.Restore(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "bad\n" {
+		t.Errorf("pre-restore snapshot holds %q, want the replaced content", data)
+	}
+}
+
+func TestSnapshotPickerDeclined(t *testing.T) {
+	m, main := pickerModel(t)
+
+	m = press(press(m, keyEnter), keyNo)
+	if m.state != StateReady {
+		t.Errorf("state = %v after declining, want StateReady", m.state)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "bad\n" {
+		t.Errorf("declined restore changed hyprland.conf to %q", data)
+	}
+	if list, _ := m.snapshots.List(); len(list) != 1 {
+		t.Errorf("declined restore took a snapshot: %v", list)
+	}
+}